@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PluginPrefix is the file name prefix of executor plugins, the rest of the name is the task kind,
+// e.g. "pg_timetable-kafka" executes KAFKA tasks
+const PluginPrefix = "pg_timetable-"
+
+// Exec returns executor running the plugin program. The task is passed as JSON object to the standard input,
+// the standard output is the task output and the exit code is the return code. Anything written to the
+// standard error is returned as the error message if the plugin fails
+func Exec(path string) TaskExecutor {
+	return ExecutorFunc(func(ctx context.Context, task Task) (int, []byte, error) {
+		input, err := json.Marshal(task)
+		if err != nil {
+			return -1, nil, err
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, path) // #nosec
+		cmd.Stdin = bytes.NewReader(input)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return exitErr.ExitCode(), stdout.Bytes(), errors.New(msg)
+			}
+			return exitErr.ExitCode(), stdout.Bytes(), err
+		}
+		if err != nil {
+			return -1, stdout.Bytes(), err
+		}
+		return 0, stdout.Bytes(), nil
+	})
+}
+
+// LoadDir registers executable files named with PluginPrefix found in the directory and returns their task kinds
+func LoadDir(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var kinds []string
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), PluginPrefix) || f.Mode()&0111 == 0 {
+			continue
+		}
+		kind := strings.ToUpper(strings.TrimSuffix(strings.TrimPrefix(f.Name(), PluginPrefix), filepath.Ext(f.Name())))
+		if err := Register(kind, Exec(filepath.Join(dir, f.Name()))); err != nil {
+			return kinds, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
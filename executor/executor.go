@@ -0,0 +1,84 @@
+// Package executor allows to register custom task kinds executed by pg_timetable, e.g. Kafka producers or
+// proprietary APIs, without changes in the scheduler. Executors are registered either in Go with Register,
+// or as external programs found in the plugin directory with LoadDir.
+package executor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Task is the chain element passed to the executor
+type Task struct {
+	ClientName  string   `json:"client_name"`
+	ChainConfig int      `json:"chain_config"`
+	ChainID     int      `json:"chain_id"`
+	TaskName    string   `json:"task_name"`
+	Kind        string   `json:"kind"`
+	Script      string   `json:"script"`
+	Params      []string `json:"params"`
+}
+
+// TaskExecutor executes tasks of the registered kind. The return code and the output are stored in the execution log
+type TaskExecutor interface {
+	Execute(ctx context.Context, task Task) (code int, out []byte, err error)
+}
+
+// ExecutorFunc allows to use ordinary function as TaskExecutor
+type ExecutorFunc func(ctx context.Context, task Task) (int, []byte, error)
+
+// Execute calls f(ctx, task)
+func (f ExecutorFunc) Execute(ctx context.Context, task Task) (int, []byte, error) {
+	return f(ctx, task)
+}
+
+// kindRegExp limits kind names to the valid enum values not requiring quotation
+var kindRegExp = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+var (
+	mu        sync.RWMutex
+	executors = map[string]TaskExecutor{}
+)
+
+// builtinKinds cannot be overridden by executors
+var builtinKinds = map[string]bool{"SQL": true, "SHELL": true, "BUILTIN": true, "HTTP": true, "PROGRAM": true, "DOCKER": true, "K8S_JOB": true}
+
+// Register adds the executor of the task kind, the kind must be upper case identifier, e.g. KAFKA
+func Register(kind string, e TaskExecutor) error {
+	if !kindRegExp.MatchString(kind) {
+		return fmt.Errorf("Invalid task kind %q", kind)
+	}
+	if builtinKinds[kind] {
+		return fmt.Errorf("Task kind %s is implemented by pg_timetable", kind)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := executors[kind]; ok {
+		return fmt.Errorf("Executor of the task kind %s is already registered", kind)
+	}
+	executors[kind] = e
+	return nil
+}
+
+// Lookup returns the executor of the task kind
+func Lookup(kind string) (TaskExecutor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := executors[kind]
+	return e, ok
+}
+
+// Kinds returns sorted task kinds of registered executors
+func Kinds() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	kinds := make([]string, 0, len(executors))
+	for kind := range executors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func unregister(kind string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(executors, kind)
+}
+
+func TestRegister(t *testing.T) {
+	e := ExecutorFunc(func(ctx context.Context, task Task) (int, []byte, error) {
+		return 0, []byte(task.Script), nil
+	})
+	assert.NoError(t, Register("KAFKA", e))
+	defer unregister("KAFKA")
+	assert.Error(t, Register("KAFKA", e), "Kind should be registered once")
+	assert.Error(t, Register("SHELL", e), "Builtin kinds cannot be overridden")
+	assert.Error(t, Register("kafka producer", e))
+
+	got, ok := Lookup("KAFKA")
+	assert.True(t, ok)
+	_, out, err := got.Execute(context.Background(), Task{Script: "topic"})
+	assert.NoError(t, err)
+	assert.Equal(t, "topic", string(out))
+	_, ok = Lookup("UNKNOWN")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"KAFKA"}, Kinds())
+}
+
+func TestLoadDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts are not supported on Windows")
+	}
+	dir, err := ioutil.TempDir("", "plugins")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := "#!/bin/sh\ncat\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, PluginPrefix+"echo.sh"), []byte(script), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, PluginPrefix+"fail"), []byte("#!/bin/sh\necho broken >&2\nexit 3\n"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, PluginPrefix+"noexec"), []byte(script), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other"), []byte(script), 0755))
+
+	kinds, err := LoadDir(dir)
+	defer unregister("ECHO")
+	defer unregister("FAIL")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ECHO", "FAIL"}, kinds)
+
+	e, _ := Lookup("ECHO")
+	code, out, err := e.Execute(context.Background(), Task{TaskName: "produce", Kind: "ECHO", Params: []string{`{"key": 1}`}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.JSONEq(t, `{"client_name": "", "chain_config": 0, "chain_id": 0, "task_name": "produce", "kind": "ECHO",
+		"script": "", "params": ["{\"key\": 1}"]}`, string(out))
+
+	e, _ = Lookup("FAIL")
+	code, _, err = e.Execute(context.Background(), Task{})
+	assert.EqualError(t, err, "broken")
+	assert.Equal(t, 3, code)
+
+	_, err = LoadDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
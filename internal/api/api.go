@@ -0,0 +1,230 @@
+// Package api implements the embedded HTTP server of pg_timetable
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/scheduler"
+)
+
+// maximum time the synchronous trigger request may wait for the chain to finish
+const maxWait = time.Hour
+
+// overwritten in tests
+var (
+	getChain        = scheduler.GetChain
+	runChain        = scheduler.RunChain
+	getTenant       = pgengine.GetTokenTenant
+	getRunArtifacts = pgengine.GetRunArtifacts
+	getArtifact     = pgengine.GetArtifact
+	getContention   = pgengine.GetContentionReport
+)
+
+// Server serves REST API requests, chains triggered are executed within the server context
+type Server struct {
+	http.Server
+	ctx context.Context
+}
+
+// NewServer returns server listening on the address and port specified, all interfaces if the address is empty
+func NewServer(ctx context.Context, address string, port int) *Server {
+	s := &Server{ctx: ctx}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chains", s.handleChains)
+	mux.HandleFunc("/chains/", s.handleChains)
+	mux.HandleFunc("/tasks", s.handleTasks)
+	mux.HandleFunc("/tasks/", s.handleTasks)
+	mux.HandleFunc("/runs/", s.handleRuns)
+	mux.HandleFunc("/artifacts/", s.handleArtifact)
+	mux.HandleFunc("/reports/contention", s.handleContentionReport)
+	mux.HandleFunc("/liveness", s.handleLiveness)
+	mux.HandleFunc("/readiness", s.handleReadiness)
+	if UIEnabled {
+		mux.HandleFunc("/ui", s.handleUI)
+		mux.HandleFunc("/ui/", s.handleUI)
+		mux.HandleFunc("/dashboard", s.handleDashboard)
+	}
+	s.Addr = net.JoinHostPort(address, strconv.Itoa(port))
+	s.Handler = mux
+	return s
+}
+
+// Start starts listening in the background, errors are logged
+func Start(ctx context.Context, address string, port int) *Server {
+	s := NewServer(ctx, address, port)
+	go func() {
+		pgengine.LogToDB("LOG", "Starting REST API server on ", s.Addr)
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			pgengine.LogToDB("ERROR", "REST API server failed: ", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = s.Close()
+	}()
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// requestTenant returns the tenant of the bearer token in tenant isolation mode, empty string otherwise.
+// The token is required in tenant isolation mode and for every request changing chains or tasks, since
+// they are able to execute arbitrary commands
+func requestTenant(r *http.Request) (string, error) {
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if !pgengine.TenantIsolation && readOnly {
+		return "", nil
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return "", pgengine.ErrInvalidToken
+	}
+	tenant, err := getTenant(r.Context(), strings.TrimSpace(strings.TrimPrefix(auth, prefix)))
+	if !pgengine.TenantIsolation {
+		tenant = ""
+	}
+	return tenant, err
+}
+
+// authorize returns the tenant of the request, false is returned if the error response was written
+func authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tenant, err := requestTenant(r)
+	switch {
+	case err == pgengine.ErrInvalidToken:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err)
+		return "", false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return "", false
+	}
+	return tenant, true
+}
+
+// allowMethod writes 405 Method Not Allowed response if the request method is not one of specified
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+	return false
+}
+
+// handleChains routes /chains and /chains/{id}[/run|pause|resume|elements|runs] requests
+func (s *Server) handleChains(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/chains"), "/")
+	if path == "" {
+		s.handleChainList(w, r)
+		return
+	}
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeError(w, http.StatusNotFound, scheduler.ErrChainNotFound)
+		return
+	}
+	switch {
+	case len(parts) == 1:
+		s.handleChainConfig(w, r, id)
+	case len(parts) == 2 && parts[1] == "run":
+		s.handleRunChain(w, r, id)
+	case len(parts) == 2 && (parts[1] == "pause" || parts[1] == "resume"):
+		s.handlePauseChain(w, r, id, parts[1] == "resume")
+	case len(parts) == 2 && parts[1] == "elements":
+		s.handleChainElements(w, r, id)
+	case len(parts) == 2 && parts[1] == "runs":
+		s.handleChainRuns(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleRunChain triggers the chain. If "wait" seconds specified, the request blocks until the chain
+// finishes and returns the final status with elements output, otherwise 202 Accepted is returned immediately
+func (s *Server) handleRunChain(w http.ResponseWriter, r *http.Request, id int) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var wait time.Duration
+	if param := r.URL.Query().Get("wait"); param != "" {
+		seconds, err := strconv.Atoi(param)
+		if err != nil || seconds < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid wait parameter: %s", param))
+			return
+		}
+		if wait = time.Duration(seconds) * time.Second; wait > maxWait {
+			wait = maxWait
+		}
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	chain, err := getChain(r.Context(), id)
+	if err == nil && pgengine.TenantIsolation && chain.Tenant != tenant {
+		// chains of other tenants are invisible
+		err = scheduler.ErrChainNotFound
+	}
+	switch {
+	case err == scheduler.ErrChainNotFound:
+		writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	type runResponse struct {
+		result *scheduler.RunResult
+		err    error
+	}
+	done := make(chan runResponse, 1)
+	// the chain is not cancelled if the client disconnects or the wait timeout is over
+	go func() {
+		result, err := runChain(s.ctx, chain)
+		done <- runResponse{result, err}
+	}()
+	if wait == 0 {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "STARTED"})
+		return
+	}
+	select {
+	case resp := <-done:
+		switch {
+		case resp.err == scheduler.ErrChainBusy, resp.err == scheduler.ErrChainAffinity, resp.err == scheduler.ErrChainWindow:
+			writeError(w, http.StatusConflict, resp.err)
+		case resp.err == scheduler.ErrChainExcluded:
+			writeError(w, http.StatusForbidden, resp.err)
+		case resp.err == scheduler.ErrStandby:
+			writeError(w, http.StatusServiceUnavailable, resp.err)
+		case resp.err == scheduler.ErrQuotaExceeded:
+			writeError(w, http.StatusTooManyRequests, resp.err)
+		case resp.err != nil:
+			writeError(w, http.StatusInternalServerError, resp.err)
+		default:
+			writeJSON(w, http.StatusOK, resp.result)
+		}
+	case <-time.After(wait):
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "RUNNING"})
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunChain(t *testing.T) {
+	getChain = func(ctx context.Context, id int) (scheduler.Chain, error) {
+		switch id {
+		case 1, 2, 3, 6, 7, 8, 9, 10:
+			return scheduler.Chain{ChainExecutionConfigID: id}, nil
+		case 4:
+			return scheduler.Chain{}, errors.New("connection lost")
+		}
+		return scheduler.Chain{}, scheduler.ErrChainNotFound
+	}
+	runChain = func(ctx context.Context, chain scheduler.Chain) (*scheduler.RunResult, error) {
+		switch chain.ChainExecutionConfigID {
+		case 2:
+			return nil, scheduler.ErrChainBusy
+		case 6:
+			return nil, scheduler.ErrQuotaExceeded
+		case 7:
+			return nil, scheduler.ErrChainAffinity
+		case 8:
+			return nil, scheduler.ErrChainExcluded
+		case 9:
+			return nil, scheduler.ErrChainWindow
+		case 10:
+			return nil, scheduler.ErrStandby
+		case 3:
+			time.Sleep(2 * time.Second)
+		}
+		return &scheduler.RunResult{RunStatusID: 42, Status: "CHAIN_DONE",
+			Outputs: []scheduler.TaskOutput{{ChainID: 1, TaskName: "echo", Output: "hello"}}}, nil
+	}
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		if token == "secret" {
+			return "team_a", nil
+		}
+		return "", pgengine.ErrInvalidToken
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		s.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("POST", "/chains/1/run?wait=10")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result scheduler.RunResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 42, result.RunStatusID)
+	assert.Equal(t, "hello", result.Outputs[0].Output)
+
+	assert.Equal(t, http.StatusAccepted, request("POST", "/chains/1/run").Code, "Should not wait by default")
+	assert.Equal(t, http.StatusAccepted, request("POST", "/chains/3/run?wait=1").Code, "Should return on timeout")
+	assert.Equal(t, http.StatusConflict, request("POST", "/chains/2/run?wait=10").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request("POST", "/chains/6/run?wait=10").Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/chains/7/run?wait=10").Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/chains/8/run?wait=10").Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/chains/9/run?wait=10").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, request("POST", "/chains/10/run?wait=10").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/chains/5/run").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/chains/foo/run").Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/chains/1/foo").Code)
+	assert.Equal(t, http.StatusInternalServerError, request("POST", "/chains/4/run").Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/chains/1/run?wait=-1").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request("GET", "/chains/1/run").Code)
+
+	w = httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, httptest.NewRequest("POST", "/chains/1/run", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Chains should not be triggered without the token")
+}
+
+func TestNewServerAddress(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:8008", NewServer(context.Background(), "127.0.0.1", 8008).Addr)
+	assert.Equal(t, ":8008", NewServer(context.Background(), "", 8008).Addr)
+	assert.Equal(t, "[::1]:8008", NewServer(context.Background(), "::1", 8008).Addr)
+}
+
+func TestRunChainTenantIsolation(t *testing.T) {
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		if token == "secret" {
+			return "team_a", nil
+		}
+		return "", pgengine.ErrInvalidToken
+	}
+	getChain = func(ctx context.Context, id int) (scheduler.Chain, error) {
+		return scheduler.Chain{ChainExecutionConfigID: id, Tenant: map[int]string{1: "team_a", 2: "team_b"}[id]}, nil
+	}
+	runChain = func(ctx context.Context, chain scheduler.Chain) (*scheduler.RunResult, error) {
+		return &scheduler.RunResult{Status: "CHAIN_DONE"}, nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(url, token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", url, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, request("/chains/1/run?wait=10", "secret"))
+	assert.Equal(t, http.StatusNotFound, request("/chains/2/run?wait=10", "secret"), "Chains of other tenants should be invisible")
+	assert.Equal(t, http.StatusUnauthorized, request("/chains/1/run?wait=10", "foo"))
+	assert.Equal(t, http.StatusUnauthorized, request("/chains/1/run?wait=10", ""))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// visible returns artifacts of the tenant in tenant isolation mode, all artifacts otherwise
+func visible(artifacts []pgengine.Artifact, tenant string) []pgengine.Artifact {
+	if !pgengine.TenantIsolation {
+		return artifacts
+	}
+	res := make([]pgengine.Artifact, 0, len(artifacts))
+	for _, a := range artifacts {
+		if a.Tenant.Valid && a.Tenant.String == tenant {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// handleRuns routes GET /runs/{run_status}/artifacts requests listing artifacts of the run
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/runs/"), "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) != 2 || parts[1] != "artifacts" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	artifacts, err := getRunArtifacts(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, visible(artifacts, tenant))
+}
+
+// handleArtifact serves GET /artifacts/{artifact_id} requests downloading the artifact file
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/artifacts/"), "/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, pgengine.ErrArtifactNotFound)
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	a, err := getArtifact(r.Context(), id)
+	if err == nil && len(visible([]pgengine.Artifact{a}, tenant)) == 0 {
+		err = pgengine.ErrArtifactNotFound
+	}
+	switch {
+	case err == pgengine.ErrArtifactNotFound:
+		writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(a.FileName))
+	http.ServeFile(w, r, pgengine.ArtifactFile(a))
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { pgengine.ArtifactsDir = d }(pgengine.ArtifactsDir)
+	pgengine.ArtifactsDir = dir
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "42"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "42", "report.csv"), []byte("a,b\n"), 0644))
+
+	artifacts := []pgengine.Artifact{
+		{ID: 1, RunStatusID: 42, FileName: "report.csv", Path: "42/report.csv", Tenant: sql.NullString{String: "team_a", Valid: true}},
+		{ID: 2, RunStatusID: 42, FileName: "other.csv", Path: "42/other.csv", Tenant: sql.NullString{String: "team_b", Valid: true}},
+	}
+	getRunArtifacts = func(ctx context.Context, id int) ([]pgengine.Artifact, error) {
+		if id == 42 {
+			return artifacts, nil
+		}
+		return nil, errors.New("connection lost")
+	}
+	getArtifact = func(ctx context.Context, id int) (pgengine.Artifact, error) {
+		if id > 0 && id <= len(artifacts) {
+			return artifacts[id-1], nil
+		}
+		return pgengine.Artifact{}, pgengine.ErrArtifactNotFound
+	}
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		return token, nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/runs/42/artifacts", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list []pgengine.Artifact
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 2)
+	assert.NotContains(t, w.Body.String(), "42/report.csv", "Storage path should not be exposed")
+	assert.Equal(t, http.StatusInternalServerError, request("GET", "/runs/1/artifacts", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/runs/42/files", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request("POST", "/runs/42/artifacts", "").Code)
+
+	w = request("GET", "/artifacts/1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a,b\n", w.Body.String())
+	assert.Equal(t, `attachment; filename="report.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, http.StatusNotFound, request("GET", "/artifacts/2", "").Code, "Missing file should not be found")
+	assert.Equal(t, http.StatusNotFound, request("GET", "/artifacts/3", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/artifacts/abc", "").Code)
+
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/runs/42/artifacts", "").Code)
+	w = request("GET", "/runs/42/artifacts", "team_b")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, 2, list[0].ID)
+	}
+	assert.Equal(t, http.StatusNotFound, request("GET", "/artifacts/1", "team_b").Code, "Artifacts of other tenants are invisible")
+	assert.Equal(t, http.StatusOK, request("GET", "/artifacts/1", "team_a").Code)
+}
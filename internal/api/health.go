@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/scheduler"
+)
+
+// pingTimeout limits the database check of the readiness probe
+const pingTimeout = 3 * time.Second
+
+// overwritten in tests
+var (
+	getHealth = scheduler.GetHealth
+	pingDB    = pgengine.Ping
+)
+
+// probeResponse is the body of liveness and readiness responses
+type probeResponse struct {
+	Status string `json:"status"`
+	scheduler.Health
+	DBError string `json:"db_error,omitempty"`
+}
+
+func writeProbe(w http.ResponseWriter, ok bool, resp probeResponse) {
+	status := http.StatusOK
+	resp.Status = "ok"
+	if !ok {
+		status = http.StatusServiceUnavailable
+		resp.Status = "failed"
+	}
+	writeJSON(w, status, resp)
+}
+
+// handleLiveness serves GET /liveness requests failing if the main loop is wedged, probes are never authorized
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	h := getHealth()
+	writeProbe(w, h.Live(time.Now()), probeResponse{Health: h})
+}
+
+// handleReadiness serves GET /readiness requests succeeding if the main loop is running with the client name
+// lock held and the configuration database is reachable
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	h := getHealth()
+	resp := probeResponse{Health: h}
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+	if err := pingDB(ctx); err != nil {
+		resp.DBError = err.Error()
+	}
+	writeProbe(w, h.Ready() && resp.DBError == "", resp)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbes(t *testing.T) {
+	health := scheduler.Health{LastLoop: time.Now(), LockHeld: true}
+	var dbErr error
+	getHealth = func() scheduler.Health { return health }
+	pingDB = func(ctx context.Context) error { return dbErr }
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.Handler.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/liveness").Code, "Probes should not need authorization")
+	w := request("GET", "/readiness")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"lock_held":true`)
+
+	dbErr = errors.New("connection refused")
+	w = request("GET", "/readiness")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "connection refused")
+	assert.Equal(t, http.StatusOK, request("GET", "/liveness").Code, "Database failure should not fail liveness")
+
+	dbErr = nil
+	health.LockHeld = false
+	assert.Equal(t, http.StatusServiceUnavailable, request("GET", "/readiness").Code)
+	health.LastLoop = time.Now().Add(-time.Hour)
+	assert.Equal(t, http.StatusServiceUnavailable, request("GET", "/liveness").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, request("POST", "/liveness").Code)
+}
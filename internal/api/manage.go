@@ -0,0 +1,311 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+const (
+	maxBodySize     = 1 << 20
+	defaultRunLimit = 20
+	maxRunLimit     = 1000
+)
+
+// errSharedTasks is returned if the tenant tries to change base tasks shared by all tenants
+var errSharedTasks = errors.New("Base tasks are shared and cannot be changed in tenant isolation mode")
+
+// errTenantFields is returned if the tenant tries to link existing chain elements, run tasks as another role
+// or connect to another database, chains of other tenants or the scheduler could be reached that way
+var errTenantFields = errors.New("chain_id, run_uid and database_connection cannot be set in tenant isolation mode")
+
+// errContentType is returned if the request body is not JSON, so HTML forms of other sites cannot post it
+var errContentType = errors.New("Content-Type must be application/json")
+
+// overwritten in tests
+var (
+	listChainConfigs     = pgengine.ListChainConfigs
+	getChainConfig       = pgengine.GetChainConfig
+	createChainConfig    = pgengine.CreateChainConfig
+	updateChainConfig    = pgengine.UpdateChainConfig
+	removeChainConfig    = pgengine.RemoveChainConfig
+	setChainLive         = pgengine.SetChainLive
+	listChainElements    = pgengine.ListChainElements
+	replaceChainElements = pgengine.ReplaceChainElements
+	getChainRuns         = pgengine.GetChainRuns
+	listTasks            = pgengine.ListTasks
+	getTask              = pgengine.GetTask
+	createTask           = pgengine.CreateTask
+	updateTask           = pgengine.UpdateTask
+	deleteTask           = pgengine.DeleteTask
+)
+
+// writeManageError writes the error of the management function with the proper status
+func writeManageError(w http.ResponseWriter, err error) {
+	switch {
+	case err == pgengine.ErrChainConfigNotFound, err == pgengine.ErrTaskNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case pgengine.IsInvalidInput(err):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// readJSON decodes the request body, false is returned if the error response was written
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, errContentType)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// handleChainList serves GET /chains listing chains and POST /chains creating the chain
+func (s *Server) handleChainList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodGet {
+		chains, err := listChainConfigs(r.Context(), tenant)
+		if err != nil {
+			writeManageError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, chains)
+		return
+	}
+	var c pgengine.ChainConfig
+	if !readJSON(w, r, &c) {
+		return
+	}
+	if pgengine.TenantIsolation {
+		if c.ChainID != nil {
+			writeError(w, http.StatusForbidden, errTenantFields)
+			return
+		}
+		c.Tenant = tenant
+	}
+	id, err := createChainConfig(r.Context(), c)
+	if err == nil {
+		c, err = getChainConfig(r.Context(), id, tenant)
+	}
+	if err != nil {
+		writeManageError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/chains/%d", id))
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// handleChainConfig serves GET, PUT and DELETE /chains/{id} requests
+func (s *Server) handleChainConfig(w http.ResponseWriter, r *http.Request, id int) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		c, err := getChainConfig(r.Context(), id, tenant)
+		if err != nil {
+			writeManageError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodPut:
+		var c pgengine.ChainConfig
+		if !readJSON(w, r, &c) {
+			return
+		}
+		c.ID = id
+		err := updateChainConfig(r.Context(), c, tenant)
+		if err == nil {
+			c, err = getChainConfig(r.Context(), id, tenant)
+		}
+		if err != nil {
+			writeManageError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodDelete:
+		if err := removeChainConfig(r.Context(), id, tenant); err != nil {
+			writeManageError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handlePauseChain serves POST /chains/{id}/pause and /chains/{id}/resume requests switching the live flag
+func (s *Server) handlePauseChain(w http.ResponseWriter, r *http.Request, id int, live bool) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	if err := setChainLive(r.Context(), id, tenant, live); err != nil {
+		writeManageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleChainElements serves GET and PUT /chains/{id}/elements requests, PUT replaces all elements
+// of the chain with their parameters
+func (s *Server) handleChainElements(w http.ResponseWriter, r *http.Request, id int) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodPut {
+		var elements []pgengine.ChainElement
+		if !readJSON(w, r, &elements) {
+			return
+		}
+		if pgengine.TenantIsolation && !tenantElements(elements) {
+			writeError(w, http.StatusForbidden, errTenantFields)
+			return
+		}
+		if err := replaceChainElements(r.Context(), id, tenant, elements); err != nil {
+			writeManageError(w, err)
+			return
+		}
+	}
+	elements, err := listChainElements(r.Context(), id, tenant)
+	if err != nil {
+		writeManageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, elements)
+}
+
+// tenantElements returns false if elements run tasks as another role or connect to another database
+func tenantElements(elements []pgengine.ChainElement) bool {
+	for _, e := range elements {
+		if e.RunUID != nil || e.DatabaseConnection != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// handleChainRuns serves GET /chains/{id}/runs?limit=<n> requests returning the latest runs of the chain
+func (s *Server) handleChainRuns(w http.ResponseWriter, r *http.Request, id int) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	limit := defaultRunLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit parameter: %s", param))
+			return
+		}
+		if limit = n; limit > maxRunLimit {
+			limit = maxRunLimit
+		}
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	runs, err := getChainRuns(r.Context(), id, tenant, limit)
+	if err != nil {
+		writeManageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleTasks serves /tasks and /tasks/{id} requests managing base tasks. Base tasks are shared by all tenants,
+// so in tenant isolation mode they are read only
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tasks"), "/")
+	var id int
+	methods := []string{http.MethodGet, http.MethodPost}
+	if path != "" {
+		var err error
+		if id, err = strconv.Atoi(path); err != nil {
+			writeError(w, http.StatusNotFound, pgengine.ErrTaskNotFound)
+			return
+		}
+		methods = []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+	}
+	if !allowMethod(w, r, methods...) {
+		return
+	}
+	if _, ok := authorize(w, r); !ok {
+		return
+	}
+	if r.Method != http.MethodGet && pgengine.TenantIsolation {
+		writeError(w, http.StatusForbidden, errSharedTasks)
+		return
+	}
+	var t pgengine.Task
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		if path == "" {
+			tasks, err := listTasks(r.Context())
+			if err != nil {
+				writeManageError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, tasks)
+			return
+		}
+		t, err = getTask(r.Context(), id)
+	case http.MethodPost:
+		if !readJSON(w, r, &t) {
+			return
+		}
+		if id, err = createTask(r.Context(), t); err == nil {
+			t, err = getTask(r.Context(), id)
+		}
+	case http.MethodPut:
+		if !readJSON(w, r, &t) {
+			return
+		}
+		t.ID = id
+		if err = updateTask(r.Context(), t); err == nil {
+			t, err = getTask(r.Context(), id)
+		}
+	case http.MethodDelete:
+		if err = deleteTask(r.Context(), id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if err != nil {
+		writeManageError(w, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		w.Header().Set("Location", fmt.Sprintf("/tasks/%d", id))
+		writeJSON(w, http.StatusCreated, t)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
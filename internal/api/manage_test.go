@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManageChains(t *testing.T) {
+	chains := map[int]pgengine.ChainConfig{1: {ID: 1, ChainName: "nightly", Live: true}}
+	getChainConfig = func(ctx context.Context, id int, tenant string) (pgengine.ChainConfig, error) {
+		if c, ok := chains[id]; ok {
+			return c, nil
+		}
+		return pgengine.ChainConfig{}, pgengine.ErrChainConfigNotFound
+	}
+	listChainConfigs = func(ctx context.Context, tenant string) ([]pgengine.ChainConfig, error) {
+		return []pgengine.ChainConfig{chains[1]}, nil
+	}
+	createChainConfig = func(ctx context.Context, c pgengine.ChainConfig) (int, error) {
+		if c.ChainName == "nightly" {
+			return 0, &pq.Error{Code: "23505"} // unique_violation
+		}
+		c.ID = 2
+		chains[2] = c
+		return 2, nil
+	}
+	updateChainConfig = func(ctx context.Context, c pgengine.ChainConfig, tenant string) error {
+		if _, ok := chains[c.ID]; !ok {
+			return pgengine.ErrChainConfigNotFound
+		}
+		chains[c.ID] = c
+		return nil
+	}
+	removeChainConfig = func(ctx context.Context, id int, tenant string) error {
+		if _, ok := chains[id]; !ok {
+			return pgengine.ErrChainConfigNotFound
+		}
+		delete(chains, id)
+		return nil
+	}
+	setChainLive = func(ctx context.Context, id int, tenant string, live bool) error {
+		c := chains[id]
+		c.Live = live
+		chains[id] = c
+		return nil
+	}
+	var elements []pgengine.ChainElement
+	replaceChainElements = func(ctx context.Context, id int, tenant string, e []pgengine.ChainElement) error {
+		elements = e
+		return nil
+	}
+	listChainElements = func(ctx context.Context, id int, tenant string) ([]pgengine.ChainElement, error) {
+		return elements, nil
+	}
+	var runLimit int
+	getChainRuns = func(ctx context.Context, id int, tenant string, limit int) ([]pgengine.ChainRunInfo, error) {
+		runLimit = limit
+		return []pgengine.ChainRunInfo{{RunStatusID: 42, Status: "CHAIN_DONE"}}, nil
+	}
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		if token == "secret" {
+			return "team_a", nil
+		}
+		return "", pgengine.ErrInvalidToken
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("Content-Type", "application/json")
+		s.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/chains", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"chain_name":"nightly"`)
+
+	w = request("POST", "/chains", `{"chain_name": "hourly", "run_at": "0 * * * *"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/chains/2", w.Header().Get("Location"))
+	assert.Equal(t, "0 * * * *", *chains[2].RunAt)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/chains", `{"chain_name": "nightly"}`).Code,
+		"Constraint violations should be reported as bad request")
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/chains/", `{`).Code)
+
+	assert.Equal(t, http.StatusOK, request("GET", "/chains/2", "").Code)
+	assert.Equal(t, http.StatusOK, request("PUT", "/chains/2", `{"chain_name": "hourly", "max_instances": 2}`).Code)
+	assert.Equal(t, 2, *chains[2].MaxInstances)
+	assert.Equal(t, http.StatusNotFound, request("PUT", "/chains/3", `{"chain_name": "foo"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, request("POST", "/chains/1/pause", "").Code)
+	assert.False(t, chains[1].Live)
+	assert.Equal(t, http.StatusNoContent, request("POST", "/chains/1/resume", "").Code)
+	assert.True(t, chains[1].Live)
+	assert.Equal(t, http.StatusMethodNotAllowed, request("GET", "/chains/1/pause", "").Code)
+
+	w = request("PUT", "/chains/2/elements", `[{"task_id": 1, "parameters": [{"a": 1}]}, {"task_id": 2, "ignore_error": true}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, elements, 2)
+	assert.JSONEq(t, `{"a": 1}`, string(elements[0].Parameters[0]))
+	assert.True(t, elements[1].IgnoreError)
+
+	w = request("GET", "/chains/2/runs?limit=5000", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, maxRunLimit, runLimit)
+	var runs []pgengine.ChainRunInfo
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	assert.Equal(t, 42, runs[0].RunStatusID)
+	assert.Equal(t, http.StatusOK, request("GET", "/chains/2/runs", "").Code)
+	assert.Equal(t, defaultRunLimit, runLimit)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/chains/2/runs?limit=0", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/chains/2", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/chains/2", "").Code)
+	w = request("PATCH", "/chains/1", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PUT, DELETE", w.Header().Get("Allow"))
+}
+
+func TestManageChainsAuthorization(t *testing.T) {
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		if token == "secret" {
+			return "team_a", nil
+		}
+		return "", pgengine.ErrInvalidToken
+	}
+	var created pgengine.ChainConfig
+	createChainConfig = func(ctx context.Context, c pgengine.ChainConfig) (int, error) {
+		created = c
+		return 1, nil
+	}
+	getChainConfig = func(ctx context.Context, id int, tenant string) (pgengine.ChainConfig, error) {
+		assert.Empty(t, tenant, "Tenant should be ignored without tenant isolation")
+		return created, nil
+	}
+	listChainConfigs = func(ctx context.Context, tenant string) ([]pgengine.ChainConfig, error) {
+		return nil, nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url, token, contentType string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(`{"chain_name": "hourly"}`))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		s.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/chains", "", ""), "Reading should not need the token")
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/chains", "", "application/json"))
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/chains", "foo", "application/json"))
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/chains/1/pause", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("DELETE", "/tasks/1", "", ""))
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("POST", "/chains", "secret", "text/plain"),
+		"Bodies of HTML forms should be rejected")
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("POST", "/chains", "secret", ""))
+	assert.Empty(t, created.ChainName)
+	assert.Equal(t, http.StatusCreated, request("POST", "/chains", "secret", "application/json; charset=utf-8"))
+	assert.Equal(t, "hourly", created.ChainName)
+}
+
+func TestManageChainsTenantIsolation(t *testing.T) {
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		return map[string]string{"secret-a": "team_a", "secret-b": "team_b"}[token], nil
+	}
+	chains := map[int]pgengine.ChainConfig{1: {ID: 1, ChainName: "nightly", Tenant: "team_a"}}
+	visible := func(id int, tenant string) bool {
+		c, ok := chains[id]
+		return ok && c.Tenant == tenant
+	}
+	getChainConfig = func(ctx context.Context, id int, tenant string) (pgengine.ChainConfig, error) {
+		if !visible(id, tenant) {
+			return pgengine.ChainConfig{}, pgengine.ErrChainConfigNotFound
+		}
+		return chains[id], nil
+	}
+	createChainConfig = func(ctx context.Context, c pgengine.ChainConfig) (int, error) {
+		c.ID = len(chains) + 1
+		chains[c.ID] = c
+		return c.ID, nil
+	}
+	var elements []pgengine.ChainElement
+	replaceChainElements = func(ctx context.Context, id int, tenant string, e []pgengine.ChainElement) error {
+		if !visible(id, tenant) {
+			return pgengine.ErrChainConfigNotFound
+		}
+		elements = e
+		return nil
+	}
+	listChainElements = func(ctx context.Context, id int, tenant string) ([]pgengine.ChainElement, error) {
+		return elements, nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url, token, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Content-Type", "application/json")
+		s.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/chains/1", "secret-b", ""),
+		"Chains of other tenants should not be found")
+	assert.Equal(t, http.StatusCreated, request("POST", "/chains", "secret-b", `{"chain_name": "hourly", "tenant": "team_a"}`))
+	assert.Equal(t, "team_b", chains[2].Tenant, "Tenant should be taken from the token, not from the body")
+	assert.Equal(t, http.StatusForbidden, request("POST", "/chains", "secret-b", `{"chain_name": "stolen", "chain_id": 7}`),
+		"Elements of other tenants should not be linked to the new chain")
+	assert.Len(t, chains, 2)
+
+	assert.Equal(t, http.StatusNotFound, request("PUT", "/chains/1/elements", "secret-b", `[{"task_id": 1}]`),
+		"Elements of chains of other tenants should not be replaced")
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/chains/1/elements", "secret-a", `[{"task_id": 1, "run_uid": "postgres"}]`),
+		"Tasks should not be executed as another role")
+	assert.Equal(t, http.StatusForbidden, request("PUT", "/chains/1/elements", "secret-a", `[{"task_id": 1, "database_connection": 1}]`),
+		"Tasks should not connect to other databases")
+	assert.Empty(t, elements)
+	assert.Equal(t, http.StatusOK, request("PUT", "/chains/1/elements", "secret-a", `[{"task_id": 1}]`))
+	assert.Len(t, elements, 1)
+}
+
+func TestManageTasks(t *testing.T) {
+	tasks := map[int]pgengine.Task{1: {ID: 1, Name: "vacuum", Kind: "SQL", Script: "VACUUM"}}
+	getTask = func(ctx context.Context, id int) (pgengine.Task, error) {
+		if task, ok := tasks[id]; ok {
+			return task, nil
+		}
+		return pgengine.Task{}, pgengine.ErrTaskNotFound
+	}
+	listTasks = func(ctx context.Context) ([]pgengine.Task, error) {
+		return []pgengine.Task{tasks[1]}, nil
+	}
+	createTask = func(ctx context.Context, task pgengine.Task) (int, error) {
+		task.ID = 2
+		tasks[2] = task
+		return 2, nil
+	}
+	updateTask = func(ctx context.Context, task pgengine.Task) error {
+		tasks[task.ID] = task
+		return nil
+	}
+	deleteTask = func(ctx context.Context, id int) error {
+		delete(tasks, id)
+		return nil
+	}
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		return "team_a", nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(method, url, body string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("Content-Type", "application/json")
+		s.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/tasks", ""))
+	assert.Equal(t, http.StatusCreated, request("POST", "/tasks", `{"name": "analyze", "script": "ANALYZE"}`))
+	assert.Equal(t, "ANALYZE", tasks[2].Script)
+	assert.Equal(t, http.StatusOK, request("PUT", "/tasks/2", `{"name": "analyze", "script": "ANALYZE VERBOSE"}`))
+	assert.Equal(t, "ANALYZE VERBOSE", tasks[2].Script)
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/tasks/2", ""))
+	assert.Equal(t, http.StatusNotFound, request("GET", "/tasks/2", ""))
+	assert.Equal(t, http.StatusNotFound, request("GET", "/tasks/foo", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, request("DELETE", "/tasks", ""))
+
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		return "team_a", nil
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("DELETE", "/tasks/1", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	s.Handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code, "Shared tasks should be read only for tenants")
+	assert.Contains(t, tasks, 1)
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// handleContentionReport serves GET /reports/contention?period=<interval> requests returning waits of chains
+// on constraints during the period, the last day by default
+func (s *Server) handleContentionReport(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "1 day"
+	}
+	report, err := getContention(r.Context(), period)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res := make([]pgengine.ChainContention, 0, len(report))
+	for _, c := range report {
+		if !pgengine.TenantIsolation || c.Tenant.Valid && c.Tenant.String == tenant {
+			res = append(res, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
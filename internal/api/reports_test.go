@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentionReport(t *testing.T) {
+	var period string
+	getContention = func(ctx context.Context, p string) ([]pgengine.ChainContention, error) {
+		period = p
+		return []pgengine.ChainContention{
+			{ChainConfig: 1, ChainName: "export", Waits: 2, Tenant: sql.NullString{String: "team_a", Valid: true}},
+			{ChainConfig: 2, ChainName: "vacuum", Waits: 1, Tenant: sql.NullString{String: "team_b", Valid: true}},
+		}, nil
+	}
+	getTenant = func(ctx context.Context, token string) (string, error) {
+		return token, nil
+	}
+	s := NewServer(context.Background(), "", 0)
+	request := func(url, token string) (*httptest.ResponseRecorder, []pgengine.ChainContention) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", url, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.Handler.ServeHTTP(w, r)
+		var report []pgengine.ChainContention
+		_ = json.Unmarshal(w.Body.Bytes(), &report)
+		return w, report
+	}
+
+	w, report := request("/reports/contention", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, report, 2)
+	assert.Equal(t, "1 day", period)
+	_, _ = request("/reports/contention?period=7+days", "")
+	assert.Equal(t, "7 days", period)
+
+	pgengine.TenantIsolation = true
+	defer func() { pgengine.TenantIsolation = false }()
+	_, report = request("/reports/contention", "team_b")
+	if assert.Len(t, report, 1) {
+		assert.Equal(t, "vacuum", report[0].ChainName)
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// UIEnabled specifies if the web UI dashboard is served at /ui
+var UIEnabled bool
+
+// overwritten in tests
+var getDashboard = pgengine.GetDashboard
+
+// handleDashboard serves GET /dashboard requests returning data shown by the web UI
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	tenant, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+	d, err := getDashboard(r.Context(), tenant)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now()
+	for i := range d.Chains {
+		d.Chains[i].NextRun = d.Chains[i].Next(now)
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// handleUI serves the web UI page, the data is requested by the page with the token entered by the user
+func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui" && r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(uiPage))
+}
+
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pg_timetable</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; min-width: 60%; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 12px; text-align: left; }
+th { background: #f4f4f4; }
+.paused { color: #999; }
+.failed { color: #c00; }
+#error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>pg_timetable</h1>
+<p><label>API token <input id="token" type="password" size="30"></label> <span id="error"></span></p>
+<h2>Running chains</h2>
+<table><thead><tr><th>Run</th><th>Chain</th><th>Client</th><th>Started</th><th>Elapsed</th></tr></thead>
+<tbody id="running"></tbody></table>
+<h2>Failures of the last day</h2>
+<table><thead><tr><th>Run</th><th>Chain</th><th>Client</th><th>Status</th><th>Finished</th><th>Duration</th></tr></thead>
+<tbody id="failures"></tbody></table>
+<h2>Chains</h2>
+<table><thead><tr><th>ID</th><th>Chain</th><th>Schedule</th><th>Next run</th><th></th></tr></thead>
+<tbody id="chains"></tbody></table>
+<script>
+var token = document.getElementById("token");
+token.value = localStorage.getItem("pg_timetable_token") || "";
+token.onchange = function () { localStorage.setItem("pg_timetable_token", token.value); refresh(); };
+
+function api(method, url) {
+	var headers = {};
+	if (token.value) { headers["Authorization"] = "Bearer " + token.value; }
+	return fetch(url, {method: method, headers: headers}).then(function (resp) {
+		if (!resp.ok) { return resp.json().then(function (e) { throw new Error(e.error || resp.statusText); }); }
+		return resp.status === 204 ? null : resp.json();
+	});
+}
+
+function cell(tr, text, cls) {
+	var td = document.createElement("td");
+	td.textContent = text === null || text === undefined ? "" : text;
+	if (cls) { td.className = cls; }
+	tr.appendChild(td);
+	return td;
+}
+
+function button(td, title, method, url) {
+	var b = document.createElement("button");
+	b.textContent = title;
+	b.onclick = function () { api(method, url).then(refresh, showError); };
+	td.appendChild(b);
+}
+
+function time(t) { return t ? new Date(t).toLocaleString() : ""; }
+function seconds(s) { return s.toFixed(1) + " s"; }
+function showError(e) { document.getElementById("error").textContent = e.message; }
+
+function fill(id, rows, render) {
+	var tbody = document.getElementById(id);
+	tbody.innerHTML = "";
+	rows.forEach(function (row) {
+		var tr = document.createElement("tr");
+		render(tr, row);
+		tbody.appendChild(tr);
+	});
+}
+
+function refresh() {
+	api("GET", "/dashboard").then(function (d) {
+		document.getElementById("error").textContent = "";
+		fill("running", d.running, function (tr, r) {
+			cell(tr, r.run_status); cell(tr, r.chain_name); cell(tr, r.client_name);
+			cell(tr, time(r.started)); cell(tr, seconds(r.elapsed));
+		});
+		fill("failures", d.failures, function (tr, r) {
+			cell(tr, r.run_status); cell(tr, r.chain_name); cell(tr, r.client_name);
+			cell(tr, r.status, "failed"); cell(tr, time(r.finished)); cell(tr, seconds(r.elapsed));
+		});
+		fill("chains", d.chains, function (tr, c) {
+			if (!c.live) { tr.className = "paused"; }
+			cell(tr, c.chain_execution_config); cell(tr, c.chain_name);
+			cell(tr, c.schedule_engine ? c.schedule_engine + ": " + c.schedule : c.run_at);
+			cell(tr, c.live ? time(c.next_run) : "paused");
+			var td = cell(tr, "");
+			var url = "/chains/" + c.chain_execution_config;
+			button(td, "Run now", "POST", url + "/run");
+			button(td, c.live ? "Pause" : "Resume", "POST", url + (c.live ? "/pause" : "/resume"));
+		});
+	}, showError);
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
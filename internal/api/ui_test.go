@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboard(t *testing.T) {
+	hourly := "0 * * * *"
+	getDashboard = func(ctx context.Context, tenant string) (*pgengine.Dashboard, error) {
+		return &pgengine.Dashboard{
+			Chains:   []pgengine.DashboardChain{{ID: 1, ChainName: "hourly", Live: true, RunAt: &hourly}},
+			Running:  []pgengine.DashboardRun{{RunStatusID: 7, ChainName: "hourly", Elapsed: 1.5}},
+			Failures: []pgengine.DashboardRun{}}, nil
+	}
+	request := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		NewServer(context.Background(), "", 0).Handler.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, request("/ui").Code, "UI should be disabled by default")
+
+	UIEnabled = true
+	defer func() { UIEnabled = false }()
+	w := request("/ui")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	w = request("/dashboard")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var d pgengine.Dashboard
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &d))
+	assert.NotNil(t, d.Chains[0].NextRun, "Next run should be calculated")
+	assert.Equal(t, 7, d.Running[0].RunStatusID)
+}
@@ -0,0 +1,47 @@
+// Package clock abstracts the time source of the scheduler and builtin tasks, so timing can be tested
+// deterministically and simulated without waiting
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of the current time and timers
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (c realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (c realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Real is the wall clock used unless another clock is injected
+var Real Clock = realClock{}
+
+type clockKey struct{}
+
+// WithClock returns the context carrying the clock, everything executed within the context uses it
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// FromContext returns the clock of the context, the real clock if none injected
+func FromContext(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return c
+	}
+	return Real
+}
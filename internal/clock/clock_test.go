@@ -0,0 +1,32 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	c := NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := c.Now()
+	ch := c.After(time.Minute)
+	c.Advance(30 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("Timer should not fire before deadline")
+	default:
+	}
+	c.Advance(45 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-ch, "Timer should fire at deadline")
+	assert.Equal(t, start.Add(75*time.Second), c.Now())
+	assert.Equal(t, 0, c.Timers())
+	assert.Equal(t, c.Now(), <-c.After(0), "Expired timer should fire at once")
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, Real, FromContext(context.Background()))
+	c := NewFake(time.Now())
+	assert.Equal(t, c, FromContext(WithClock(context.Background(), c)))
+}
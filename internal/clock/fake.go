@@ -0,0 +1,78 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type fakeTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// Fake is the in-memory clock moving forward only when Advance is called
+type Fake struct {
+	sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+// NewFake returns the fake clock starting at the time specified
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the current time of the clock
+func (c *Fake) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// After returns the channel receiving the deadline once the clock is advanced up to it
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	t := fakeTimer{deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c
+	}
+	c.timers = append(c.timers, t)
+	return t.c
+}
+
+// Sleep blocks until the clock is advanced by d
+func (c *Fake) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward and fires all expired timers
+func (c *Fake) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			active = append(active, t)
+			continue
+		}
+		t.c <- t.deadline
+	}
+	c.timers = active
+}
+
+// Timers returns the number of timers waiting to be fired
+func (c *Fake) Timers() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until n timers are waiting to be fired
+func (c *Fake) WaitForTimers(n int) {
+	for c.Timers() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
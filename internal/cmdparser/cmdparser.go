@@ -1,32 +1,106 @@
 package cmdparser
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 
 	flags "github.com/jessevdk/go-flags"
 )
 
 type CmdOptions struct {
-	ClientName    string `short:"c" long:"clientname" description:"Unique name for application instance" required:"True"`
-	Verbose       bool   `short:"v" long:"verbose" description:"Show verbose debug information" env:"PGTT_VERBOSE"`
-	Host          string `short:"h" long:"host" description:"PG config DB host" default:"localhost" env:"PGTT_PGHOST"`
-	Port          string `short:"p" long:"port" description:"PG config DB port" default:"5432" env:"PGTT_PGPORT"`
-	Dbname        string `short:"d" long:"dbname" description:"PG config DB dbname" default:"timetable" env:"PGTT_PGDATABASE"`
-	User          string `short:"u" long:"user" description:"PG config DB user" default:"scheduler" env:"PGTT_PGUSER"`
-	File          string `short:"f" long:"file" description:"SQL script file to execute during startup"`
-	Password      string `long:"password" description:"PG config DB password" default:"somestrong" env:"PGTT_PGPASSWORD"`
-	SSLMode       string `long:"sslmode" default:"disable" description:"What SSL priority use for connection" choice:"disable" choice:"require"`
-	PostgresURL   DbURL  `long:"pgurl" description:"PG config DB url" env:"PGTT_URL"`
-	Init          bool   `long:"init" description:"Initialize database schema to the latest version and exit. Can be used with --upgrade"`
-	Upgrade       bool   `long:"upgrade" description:"Upgrade database to the latest version"`
-	NoShellTasks  bool   `long:"no-shell-tasks" description:"Disable executing of shell tasks" env:"PGTT_NOSHELLTASKS"`
-	NoHelpMessage bool   `long:"no-help" hidden:"system use"`
+	ClientName         string `short:"c" long:"clientname" description:"Unique name for application instance" required:"True" env:"PGTT_CLIENTNAME"`
+	Verbose            bool   `short:"v" long:"verbose" description:"Show verbose debug information" env:"PGTT_VERBOSE"`
+	Host               string `short:"h" long:"host" description:"PG config DB host, comma separated list or Unix socket directory" default:"localhost" env:"PGTT_PGHOST"`
+	Port               string `short:"p" long:"port" description:"PG config DB port, comma separated list for every host" default:"5432" env:"PGTT_PGPORT"`
+	Dbname             string `short:"d" long:"dbname" description:"PG config DB dbname, URI or connection string" default:"timetable" env:"PGTT_PGDATABASE"`
+	User               string `short:"u" long:"user" description:"PG config DB user" default:"scheduler" env:"PGTT_PGUSER"`
+	File               string `short:"f" long:"file" description:"SQL script file to execute during startup" env:"PGTT_FILE"`
+	Password           string `long:"password" description:"PG config DB password" default:"somestrong" env:"PGTT_PGPASSWORD"`
+	SSLMode            string `long:"sslmode" default:"disable" description:"What SSL priority use for connection" choice:"disable" choice:"require" choice:"verify-ca" choice:"verify-full" env:"PGTT_SSLMODE"`
+	SSLCert            string `long:"sslcert" description:"Client SSL certificate file" env:"PGTT_SSLCERT"`
+	SSLKey             string `long:"sslkey" description:"Client SSL private key file" env:"PGTT_SSLKEY"`
+	SSLRootCert        string `long:"sslrootcert" description:"SSL certificate authority file" env:"PGTT_SSLROOTCERT"`
+	TargetSessionAttrs string `long:"target-session-attrs" default:"any" description:"Properties of the session to select the host" choice:"any" choice:"read-write" choice:"read-only" env:"PGTT_TARGETSESSIONATTRS"`
+	Auth               string `long:"auth" default:"password" description:"Authentication method" choice:"password" choice:"rds-iam" env:"PGTT_AUTH"`
+	AWSRegion          string `long:"aws-region" description:"AWS region of the RDS instance used for IAM authentication" env:"PGTT_AWSREGION"`
+	PasswordFrom       string `long:"password-from" description:"Secret reference resolved to PG config DB password: env:, file:, vault: or awssm:" env:"PGTT_PASSWORDFROM"`
+	SecretTTL          int    `long:"secret-ttl" description:"Seconds resolved secrets are cached" default:"60" env:"PGTT_SECRETTTL"`
+	PostgresURL        DbURL  `long:"pgurl" description:"PG config DB url" env:"PGTT_URL"`
+	Init               bool   `long:"init" description:"Initialize database schema to the latest version and exit. Can be used with --upgrade" env:"PGTT_INIT"`
+	Upgrade            bool   `long:"upgrade" description:"Upgrade database to the latest version" env:"PGTT_UPGRADE"`
+	NoShellTasks       bool   `long:"no-shell-tasks" description:"Disable executing of shell tasks" env:"PGTT_NOSHELLTASKS"`
+	RestPort           int    `long:"rest-port" description:"REST API port, 0 disables REST API" env:"PGTT_RESTPORT"`
+	RestAddress        string `long:"rest-address" description:"REST API listen address, empty for all interfaces" default:"127.0.0.1" env:"PGTT_RESTADDRESS"`
+	LintRules          string `long:"lint-rules" description:"JSON file with rules applied by lint command" env:"PGTT_LINTRULES"`
+	ImportDir          string `long:"import-dir" description:"Synchronize chains with JSON and YAML definitions in the directory and exit" env:"PGTT_IMPORTDIR"`
+	TenantIsolation    bool   `long:"tenant-isolation" description:"Scope chains, logs and REST API by tenant" env:"PGTT_TENANTISOLATION"`
+	ExclusionFile      string `long:"exclude-chains" description:"File with chain names or IDs this client must never execute" env:"PGTT_EXCLUDECHAINS"`
+	ArtifactsDir       string `long:"artifacts-dir" description:"Directory where run artifacts are stored" env:"PGTT_ARTIFACTSDIR"`
+	PluginDir          string `long:"plugin-dir" description:"Directory with executor plugins named pg_timetable-<kind>" env:"PGTT_PLUGINDIR"`
+	EventsChannel      string `long:"events-channel" description:"NOTIFY channel to publish scheduler events to" env:"PGTT_EVENTSCHANNEL"`
+	OTLPEndpoint       string `long:"otlp-endpoint" description:"OTLP/HTTP collector URL to export chain run traces to" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OTLPHeaders        string `long:"otlp-headers" description:"Comma separated key=value headers of OTLP export requests" env:"OTEL_EXPORTER_OTLP_HEADERS"`
+	Schema             string `long:"schema" description:"Schema name of the scheduler configuration" default:"timetable" env:"PGTT_SCHEMA"`
+	InitTimeout        int    `long:"init-timeout" description:"Seconds to retry connecting to the database at startup, 0 means retry forever" default:"90" env:"PGTT_INITTIMEOUT"`
+	NoProgramUpgrade   bool   `long:"no-program-upgrade" description:"Run against database schema upgraded by newer pg_timetable version" env:"PGTT_NOPROGRAMUPGRADE"`
+	HA                 bool   `long:"ha" description:"Share the client name with standby clients taking over when the leader dies" env:"PGTT_HA"`
+	ClientGroup        string `long:"client-group" description:"Client group sharing the load of chains targeting the group" env:"PGTT_CLIENTGROUP"`
+	ClusterExclusive   bool   `long:"cluster-exclusive" description:"Enforce exclusive execution of chains across all clients" env:"PGTT_CLUSTEREXCLUSIVE"`
+	ResumeCrashed      bool   `long:"resume-crashed" description:"Execute again idempotent chains left unfinished by the crash" env:"PGTT_RESUMECRASHED"`
+	PgBouncer          bool   `long:"pgbouncer" description:"Avoid session level features to run behind PgBouncer in transaction pooling mode" env:"PGTT_PGBOUNCER"`
+	LogFormat          string `long:"log-format" description:"Format of log messages printed to stdout" default:"text" choice:"text" choice:"json" env:"PGTT_LOGFORMAT"`
+	UI                 bool   `long:"ui" description:"Serve web UI dashboard at /ui, needs --rest-port" env:"PGTT_UI"`
+	LogLevel           string `long:"log-level" description:"Minimal level of messages printed to stdout, all levels if --verbose" choice:"DEBUG" choice:"NOTICE" choice:"LOG" choice:"USER" choice:"ERROR" choice:"ALERT" choice:"PANIC" env:"PGTT_LOGLEVEL"`
+	LogDBLevel         string `long:"log-db-level" description:"Minimal level of messages stored in the database, all levels if --verbose" choice:"DEBUG" choice:"NOTICE" choice:"LOG" choice:"USER" choice:"ERROR" choice:"ALERT" choice:"PANIC" env:"PGTT_LOGDBLEVEL"`
+	WebhookURL         string `long:"webhook-url" description:"URL receiving scheduler events as JSON POST requests" env:"PGTT_WEBHOOKURL"`
+	WebhookEvents      string `long:"webhook-events" description:"Comma separated kinds of events sent to the webhook" default:"CHAIN_STARTED,CHAIN_DONE,CHAIN_FAILED,CLIENT_CONNECTED,CLIENT_STOPPED" env:"PGTT_WEBHOOKEVENTS"`
+	WebhookHeaders     string `long:"webhook-headers" description:"Comma separated key=value headers of webhook requests" env:"PGTT_WEBHOOKHEADERS"`
+	WebhookTemplate    string `long:"webhook-template" description:"Template file of the webhook JSON payload, the event is sent as is by default" env:"PGTT_WEBHOOKTEMPLATE"`
+	OutputLimit        int    `long:"output-limit" description:"Maximum bytes of stdout and stderr of shell tasks stored in the execution log" default:"65536" env:"PGTT_OUTPUTLIMIT"`
+	OutputDir          string `long:"output-dir" description:"Directory where complete outputs exceeding --output-limit are written" env:"PGTT_OUTPUTDIR"`
+	SentryDSN          string `long:"sentry-dsn" description:"Sentry DSN to report task failures, errors and panics to" env:"SENTRY_DSN"`
+	SentryEnvironment  string `long:"sentry-environment" description:"Environment of events reported to Sentry, e.g. production" env:"SENTRY_ENVIRONMENT"`
+	Config             string `long:"config" description:"YAML or TOML configuration file with option values" env:"PGTT_CONFIG"`
+	Once               bool   `long:"once" description:"Execute chains due right now, wait until they finish and exit" env:"PGTT_ONCE"`
+	OnceReboot         bool   `long:"once-reboot" description:"Execute @reboot chains as well in --once mode" env:"PGTT_ONCEREBOOT"`
+	Debug              bool   `long:"debug" description:"Shorten main loop and reconnect intervals and print debug messages" env:"PGTT_DEBUG"`
+	Workers            int    `long:"workers" description:"Number of chains executed in parallel" default:"16" env:"PGTT_WORKERS"`
+	ServiceName        string `long:"service-name" description:"Name of the Windows service" default:"pg_timetable" env:"PGTT_SERVICENAME"`
+	NoHelpMessage      bool   `long:"no-help" hidden:"system use"`
+
+	// DevRun contains chain definitions file passed as "dev run <file>" non option arguments
+	DevRun string
+	// Lint contains chain definitions file passed as "lint <file>" non option arguments
+	Lint string
+	// Simulate and SimulatePeriod contain chain definitions file and period passed as "simulate <file> [period]"
+	Simulate       string
+	SimulatePeriod string
+	// Crontab and CrontabOutput contain files passed as "import crontab <crontab> <output>" non option arguments
+	Crontab       string
+	CrontabOutput string
+	// ContentionReport contains the period passed as "report contention [period]" non option arguments
+	ContentionReport string
+	// Service contains the action passed as "service install|uninstall|start|stop" non option arguments
+	Service string
+	// Command is the subcommand passed as the first non option arguments, CommandRun if omitted
+	Command string
+	// ChainName contains the chain passed as "chain run <name>" non option arguments
+	ChainName string
 }
 
+// Subcommands working with the configuration database, connection non option arguments may follow them
+const (
+	CommandRun      = "run"       // run the scheduler, the default
+	CommandValidate = "validate"  // check the connection, the schema version and schedules of chains
+	CommandList     = "list"      // show chains and their next fire times
+	CommandChainRun = "chain run" // run the chain once and exit
+)
+
 // NewCmdOptions returns a new instance of CmdOptions with default values
 func NewCmdOptions() *CmdOptions {
 	cmdOpts := new(CmdOptions)
@@ -43,21 +117,97 @@ func (c *CmdOptions) String() string {
 	return s
 }
 
-//DbURL PostgreSQL connection URL
+// DbURL PostgreSQL connection URL
 type DbURL struct {
 	pgurl *url.URL
 }
 
 var nonOptionArgs []string
 
-//UnmarshalFlag parses commandline string in to url
+// defaultDbname is used if the connection string passed in dbname does not specify the database
+const defaultDbname = "timetable"
+
+// schemaName is the unquoted identifier, so it can be embedded into SQL statements as is
+var schemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var serviceAction = regexp.MustCompile(`^(install|uninstall|start|stop)$`)
+
+// parseURL parses URL allowing the host list in the authority, e.g. "postgresql://host1:5432,host2/db",
+// which is rejected by url.Parse if ports are specified partially
+func parseURL(s string) (*url.URL, error) {
+	authority := strings.Index(s, "://") + 3
+	if authority < 3 {
+		return url.Parse(s)
+	}
+	end := strings.IndexAny(s[authority:], "/?#")
+	if end < 0 {
+		end = len(s) - authority
+	}
+	end += authority
+	start := strings.LastIndex(s[authority:end], "@") + authority + 1
+	hosts := s[start:end]
+	if !strings.Contains(hosts, ",") {
+		return url.Parse(s)
+	}
+	u, err := url.Parse(s[:start] + "hosts" + s[end:])
+	if err == nil {
+		u.Host = hosts
+	}
+	return u, err
+}
+
+// UnmarshalFlag parses commandline string in to url
 func (d *DbURL) UnmarshalFlag(s string) error {
 	var err error
-	d.pgurl, err = url.Parse(s)
+	d.pgurl, err = parseURL(s)
 	return err
 }
 
-//ParseCurl parses URL structure into CmdOptions
+// setConnParam sets the option by the libpq connection parameter name
+func (c *CmdOptions) setConnParam(key string, value string) error {
+	switch key {
+	case "host":
+		c.Host = value
+	case "port":
+		c.Port = value
+	case "dbname":
+		c.Dbname = value
+	case "user":
+		c.User = value
+	case "password":
+		c.Password = value
+	case "sslmode":
+		c.SSLMode = value
+	case "sslcert":
+		c.SSLCert = value
+	case "sslkey":
+		c.SSLKey = value
+	case "sslrootcert":
+		c.SSLRootCert = value
+	case "target_session_attrs":
+		c.TargetSessionAttrs = value
+	default:
+		return fmt.Errorf("Unsupported connection parameter: %s", key)
+	}
+	return nil
+}
+
+// splitHosts splits the host list of URI, e.g. "host1:5432,host2", hosts without port use the default one
+func splitHosts(hostList string) (hosts string, ports string, err error) {
+	var h, p []string
+	for _, hostPort := range strings.Split(hostList, ",") {
+		host, port := hostPort, "5432"
+		if strings.Contains(hostPort, ":") {
+			if host, port, err = net.SplitHostPort(hostPort); err != nil {
+				return
+			}
+		}
+		h, p = append(h, host), append(p, port)
+	}
+	return strings.Join(h, ","), strings.Join(p, ","), nil
+}
+
+// ParseCurl parses URL structure into CmdOptions
 func (c *CmdOptions) ParseCurl(cmdURL *url.URL) error {
 	var err error
 	if cmdURL == nil {
@@ -67,13 +217,10 @@ func (c *CmdOptions) ParseCurl(cmdURL *url.URL) error {
 		return fmt.Errorf("Incorrect URI scheme: %s. "+
 			"The URI scheme designator can be either postgresql:// or postgres://", cmdURL.Scheme)
 	}
-	if strings.Contains(cmdURL.Host, ":") {
-		c.Host, c.Port, err = net.SplitHostPort(cmdURL.Host)
-		if err != nil {
+	if cmdURL.Host != "" {
+		if c.Host, c.Port, err = splitHosts(cmdURL.Host); err != nil {
 			return err
 		}
-	} else {
-		c.Host = cmdURL.Host
 	}
 
 	if cmdURL.User != nil {
@@ -85,13 +232,60 @@ func (c *CmdOptions) ParseCurl(cmdURL *url.URL) error {
 		c.Dbname = cmdURL.Path[1:]
 	}
 
-	a, _ := url.ParseQuery(cmdURL.RawQuery)
-	if len(a["sslmode"]) > 0 {
-		c.SSLMode = a["sslmode"][0]
+	a, err := url.ParseQuery(cmdURL.RawQuery)
+	if err != nil {
+		return err
+	}
+	for key, values := range a {
+		if err := c.setConnParam(key, values[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseConnString parses libpq keyword/value connection string, e.g. "host=localhost dbname='my db'", into CmdOptions
+func (c *CmdOptions) ParseConnString(s string) error {
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		eq := strings.IndexRune(s, '=')
+		if eq < 0 {
+			return fmt.Errorf("Missing \"=\" after %q in connection string", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " ")
+		var value strings.Builder
+		quoted := strings.HasPrefix(s, "'")
+		if quoted {
+			s = s[1:]
+		}
+		i := 0
+		for ; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			} else if quoted && s[i] == '\'' || !quoted && s[i] == ' ' {
+				break
+			}
+			value.WriteByte(s[i])
+		}
+		if quoted {
+			if i == len(s) {
+				return errors.New("Unterminated quoted value in connection string")
+			}
+			i++
+		}
+		s = s[i:]
+		if err := c.setConnParam(key, value.String()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// isConnString reports if the string is libpq keyword/value connection string
+func isConnString(s string) bool {
+	return strings.Contains(s, "=") && !isPostgresURI(s)
+}
+
 func isPostgresURI(s string) bool {
 	return strings.HasPrefix(s, "postgres://") || strings.HasPrefix(s, "postgresql://")
 }
@@ -101,6 +295,18 @@ func Parse() (*CmdOptions, error) {
 	cmdOpts := new(CmdOptions)
 	parser := flags.NewParser(cmdOpts, flags.PrintErrors)
 	var err error
+	if path := configPath(os.Args[1:]); path != "" {
+		values, err := loadConfig(path)
+		if err == nil {
+			err = applyConfig(parser, values)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load configuration file %s: %w", path, err)
+		}
+	}
+	if err = applyLibpqEnv(parser); err != nil {
+		return nil, err
+	}
 	if nonOptionArgs, err = parser.Parse(); err != nil {
 		if !flags.WroteHelp(err) && !cmdOpts.NoHelpMessage {
 			parser.WriteHelp(os.Stdout)
@@ -112,9 +318,94 @@ func Parse() (*CmdOptions, error) {
 			return nil, err
 		}
 	}
+	if cmdOpts.Debug {
+		cmdOpts.Verbose, cmdOpts.LogLevel = true, "DEBUG"
+	}
+	if cmdOpts.Workers < 1 {
+		return nil, fmt.Errorf("Invalid number of workers: %d", cmdOpts.Workers)
+	}
+	if !schemaName.MatchString(cmdOpts.Schema) {
+		return nil, fmt.Errorf("Invalid schema name: %s", cmdOpts.Schema)
+	}
+	//development mode: dev run <file>
+	if len(nonOptionArgs) == 3 && nonOptionArgs[0] == "dev" && nonOptionArgs[1] == "run" {
+		if _, err := os.Stat(nonOptionArgs[2]); os.IsNotExist(err) {
+			return nil, err
+		}
+		cmdOpts.DevRun = nonOptionArgs[2]
+		return cmdOpts, nil
+	}
+	//chain definitions linting: lint <file>
+	if len(nonOptionArgs) == 2 && nonOptionArgs[0] == "lint" {
+		if _, err := os.Stat(nonOptionArgs[1]); os.IsNotExist(err) {
+			return nil, err
+		}
+		cmdOpts.Lint = nonOptionArgs[1]
+		return cmdOpts, nil
+	}
+	//schedule simulation: simulate <file> [period]
+	if len(nonOptionArgs) >= 2 && len(nonOptionArgs) <= 3 && nonOptionArgs[0] == "simulate" {
+		if _, err := os.Stat(nonOptionArgs[1]); os.IsNotExist(err) {
+			return nil, err
+		}
+		cmdOpts.Simulate, cmdOpts.SimulatePeriod = nonOptionArgs[1], "1 day"
+		if len(nonOptionArgs) == 3 {
+			cmdOpts.SimulatePeriod = nonOptionArgs[2]
+		}
+		return cmdOpts, nil
+	}
+	//crontab conversion: import crontab <crontab> <output>
+	if len(nonOptionArgs) == 4 && nonOptionArgs[0] == "import" && nonOptionArgs[1] == "crontab" {
+		if _, err := os.Stat(nonOptionArgs[2]); os.IsNotExist(err) {
+			return nil, err
+		}
+		cmdOpts.Crontab, cmdOpts.CrontabOutput = nonOptionArgs[2], nonOptionArgs[3]
+		return cmdOpts, nil
+	}
+	//Windows service control: service install|uninstall|start|stop, the service is installed with the rest arguments
+	if len(nonOptionArgs) >= 1 && nonOptionArgs[0] == "service" {
+		if len(nonOptionArgs) < 2 || !serviceAction.MatchString(nonOptionArgs[1]) {
+			return nil, errors.New("Service action expected: service install|uninstall|start|stop")
+		}
+		cmdOpts.Service = nonOptionArgs[1]
+		return cmdOpts, nil
+	}
+	//chain waits report: report contention [period], connection options are processed as usual
+	if len(nonOptionArgs) >= 2 && len(nonOptionArgs) <= 3 && nonOptionArgs[0] == "report" && nonOptionArgs[1] == "contention" {
+		cmdOpts.ContentionReport = "1 day"
+		if len(nonOptionArgs) == 3 {
+			cmdOpts.ContentionReport = nonOptionArgs[2]
+		}
+		nonOptionArgs = nil
+	}
+	//subcommands: run, validate, list or chain run <name>, connection arguments may follow
+	cmdOpts.Command = CommandRun
+	switch {
+	case len(nonOptionArgs) > 0 && (nonOptionArgs[0] == CommandRun || nonOptionArgs[0] == CommandValidate ||
+		nonOptionArgs[0] == CommandList):
+		cmdOpts.Command, nonOptionArgs = nonOptionArgs[0], nonOptionArgs[1:]
+	case len(nonOptionArgs) >= 2 && nonOptionArgs[0] == "chain" && nonOptionArgs[1] == "run":
+		if len(nonOptionArgs) < 3 {
+			return nil, errors.New("Chain name expected: chain run <name>")
+		}
+		cmdOpts.Command, cmdOpts.ChainName, nonOptionArgs = CommandChainRun, nonOptionArgs[2], nonOptionArgs[3:]
+	}
+	//connection string in non option arguments or dbname
+	if len(nonOptionArgs) > 0 && isConnString(strings.Join(nonOptionArgs, " ")) {
+		if err = cmdOpts.ParseConnString(strings.Join(nonOptionArgs, " ")); err != nil {
+			return nil, err
+		}
+		nonOptionArgs = nil
+	}
+	if connString := cmdOpts.Dbname; isConnString(connString) {
+		cmdOpts.Dbname = defaultDbname
+		if err = cmdOpts.ParseConnString(connString); err != nil {
+			return nil, err
+		}
+	}
 	//non option arguments
 	if len(nonOptionArgs) > 0 && cmdOpts.PostgresURL.pgurl == nil {
-		cmdOpts.PostgresURL.pgurl, err = url.Parse(strings.Join(nonOptionArgs, ""))
+		cmdOpts.PostgresURL.pgurl, err = parseURL(strings.Join(nonOptionArgs, ""))
 		if err != nil {
 			return nil, err
 		}
@@ -122,7 +413,7 @@ func Parse() (*CmdOptions, error) {
 	}
 	//connection string in dbname
 	if isPostgresURI(cmdOpts.Dbname) && cmdOpts.PostgresURL.pgurl == nil {
-		cmdOpts.PostgresURL.pgurl, err = url.Parse(cmdOpts.Dbname)
+		cmdOpts.PostgresURL.pgurl, err = parseURL(cmdOpts.Dbname)
 		if err != nil {
 			return nil, err
 		}
@@ -1,11 +1,13 @@
 package cmdparser
 
 import (
+	"io/ioutil"
 	"net/url"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseFail(t *testing.T) {
@@ -82,3 +84,334 @@ func TestParseSuccessful(t *testing.T) {
 		assert.Equal(t, d.result.String(), c.String(), d.msg)
 	}
 }
+
+func TestParseDevRun(t *testing.T) {
+	f, err := ioutil.TempFile("", "chains*.json")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`[{"name": "ping", "tasks": [{"name": "ping", "kind": "SHELL", "script": "ping"}]}]`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	os.Args = []string{0: "go-test", "-c", "client01", "dev", "run", f.Name()}
+	c, err := Parse()
+	assert.NoError(t, err, "Dev run with existing file should succeed")
+	assert.Equal(t, f.Name(), c.DevRun)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "dev", "run", "non-existent.json"}
+	_, err = Parse()
+	assert.Error(t, err, "Dev run with non-existent file should fail")
+}
+
+func TestParseLint(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "--lint-rules=cmdparser_test.go", "lint", "cmdparser.go"}
+	c, err := Parse()
+	assert.NoError(t, err, "Lint with existing file should succeed")
+	assert.Equal(t, "cmdparser.go", c.Lint)
+	assert.Equal(t, "cmdparser_test.go", c.LintRules)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "lint", "non-existent.json"}
+	_, err = Parse()
+	assert.Error(t, err, "Lint with non-existent file should fail")
+}
+
+func TestParseSimulate(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "simulate", "cmdparser.go"}
+	c, err := Parse()
+	assert.NoError(t, err, "Simulate with existing file should succeed")
+	assert.Equal(t, "cmdparser.go", c.Simulate)
+	assert.Equal(t, "1 day", c.SimulatePeriod, "Period should default to the day")
+
+	os.Args = []string{0: "go-test", "-c", "client01", "simulate", "cmdparser.go", "7 days"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "7 days", c.SimulatePeriod)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "simulate", "non-existent.json"}
+	_, err = Parse()
+	assert.Error(t, err, "Simulate with non-existent file should fail")
+}
+
+func TestParseCrontabImport(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "import", "crontab", "cmdparser.go", "chains.json"}
+	c, err := Parse()
+	assert.NoError(t, err, "Crontab import with existing file should succeed")
+	assert.Equal(t, "cmdparser.go", c.Crontab)
+	assert.Equal(t, "chains.json", c.CrontabOutput)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "import", "crontab", "non-existent", "chains.json"}
+	_, err = Parse()
+	assert.Error(t, err, "Crontab import with non-existent file should fail")
+}
+
+func TestParseContentionReport(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "report", "contention"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "1 day", c.ContentionReport, "Should report the last day by default")
+
+	os.Args = []string{0: "go-test", "-c", "client01", "--dbname=postgres://user@host/db", "report", "contention", "7 days"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "7 days", c.ContentionReport)
+	assert.Equal(t, "db", c.Dbname, "Connection options should be processed")
+}
+
+func TestParseCommands(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, CommandRun, c.Command, "Should run the scheduler by default")
+
+	for _, cmd := range []string{CommandRun, CommandValidate, CommandList} {
+		os.Args = []string{0: "go-test", "-c", "client01", cmd, "postgres://user@host/db"}
+		c, err = Parse()
+		assert.NoError(t, err)
+		assert.Equal(t, cmd, c.Command)
+		assert.Equal(t, "db", c.Dbname, "Connection arguments should follow the command")
+	}
+
+	os.Args = []string{0: "go-test", "-c", "client01", "chain", "run", "nightly backup", "dbname=db"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, CommandChainRun, c.Command)
+	assert.Equal(t, "nightly backup", c.ChainName)
+	assert.Equal(t, "db", c.Dbname)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "chain", "run"}
+	_, err = Parse()
+	assert.Error(t, err, "Chain run without the chain name should fail")
+}
+
+func TestParseService(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "service", "install", "postgres://user@host/db"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "install", c.Service)
+	assert.Equal(t, "pg_timetable", c.ServiceName)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "service", "restart"}
+	_, err = Parse()
+	assert.Error(t, err, "Unknown service action should fail")
+}
+
+func TestParseDebug(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "--debug"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.True(t, c.Verbose)
+	assert.Equal(t, "DEBUG", c.LogLevel, "Debug mode should print debug messages")
+}
+
+func TestParseLogLevel(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "--log-level=ALERT", "--log-db-level=ALERT"}
+	c, err := Parse()
+	assert.NoError(t, err, "SLA alerts should be selectable as the minimal level")
+	assert.Equal(t, "ALERT", c.LogLevel)
+	assert.Equal(t, "ALERT", c.LogDBLevel)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "--log-level=FATAL"}
+	_, err = Parse()
+	assert.Error(t, err, "Unknown level should fail")
+}
+
+func TestParseInitTimeout(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, 90, c.InitTimeout, "Should retry connecting for 90 seconds by default")
+
+	os.Args = []string{0: "go-test", "-c", "client01", "--init-timeout=0"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c.InitTimeout)
+}
+
+func TestParseSchema(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "timetable", c.Schema)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "--schema=etl_timetable"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "etl_timetable", c.Schema)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "--schema=etl; DROP"}
+	_, err = Parse()
+	assert.EqualError(t, err, "Invalid schema name: etl; DROP")
+}
+
+func TestParseConnectionOptions(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01",
+		"postgresql://user@db1:5433,db2/sales?sslmode=verify-full&sslrootcert=/etc/ca.pem&target_session_attrs=read-write"}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "db1,db2", c.Host)
+	assert.Equal(t, "5433,5432", c.Port, "Hosts without port should use the default one")
+	assert.Equal(t, "sales", c.Dbname)
+	assert.Equal(t, "verify-full", c.SSLMode)
+	assert.Equal(t, "/etc/ca.pem", c.SSLRootCert)
+	assert.Equal(t, "read-write", c.TargetSessionAttrs)
+
+	os.Args = []string{0: "go-test", "-c", "client01", "postgresql:///sales?host=/var/run/postgresql"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/run/postgresql", c.Host, "Unix socket directory should be accepted")
+
+	os.Args = []string{0: "go-test", "-c", "client01", "postgresql://host/db?application=foo"}
+	_, err = Parse()
+	assert.EqualError(t, err, "Unsupported connection parameter: application")
+}
+
+func TestParseConnString(t *testing.T) {
+	os.Args = []string{0: "go-test", "-c", "client01", "-d", `host=db1,db2 port=5432 user=scheduler password='it\'s \\ secret' sslcert=/etc/client.crt`}
+	c, err := Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "db1,db2", c.Host)
+	assert.Equal(t, `it's \ secret`, c.Password)
+	assert.Equal(t, "/etc/client.crt", c.SSLCert)
+	assert.Equal(t, "timetable", c.Dbname, "Default database should be used if not specified")
+
+	os.Args = []string{0: "go-test", "-c", "client01", "host=db1", "dbname=sales"}
+	c, err = Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "sales", c.Dbname, "Connection string may be passed as non option arguments")
+
+	assert.Error(t, new(CmdOptions).ParseConnString("host"))
+	assert.Error(t, new(CmdOptions).ParseConnString("password='secret"))
+}
+
+func writeConfig(t *testing.T, pattern string, content string) string {
+	f, err := ioutil.TempFile("", pattern)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	return f.Name()
+}
+
+func TestParseConfigFile(t *testing.T) {
+	yamlFile := writeConfig(t, "pgtt_*.yaml", `
+clientname: worker01
+connection:
+  host: db1
+  port: 5433
+  sslmode: require
+logging:
+  log-level: ERROR
+rest-port: 8008
+no-shell-tasks: true
+`)
+	defer os.Remove(yamlFile)
+	os.Args = []string{0: "go-test", "--config", yamlFile}
+	c, err := Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "worker01", c.ClientName, "Required option may be specified in the file")
+	assert.Equal(t, "db1", c.Host)
+	assert.Equal(t, "5433", c.Port)
+	assert.Equal(t, "require", c.SSLMode)
+	assert.Equal(t, "ERROR", c.LogLevel)
+	assert.Equal(t, 8008, c.RestPort)
+	assert.True(t, c.NoShellTasks)
+	assert.Equal(t, "timetable", c.Dbname, "Defaults should be used for options not in the file")
+
+	os.Setenv("PGTT_PGHOST", "envhost")
+	defer os.Unsetenv("PGTT_PGHOST")
+	os.Setenv("PGTT_CONFIG", yamlFile)
+	defer os.Unsetenv("PGTT_CONFIG")
+	os.Args = []string{0: "go-test", "--port=6432"}
+	c, err = Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "envhost", c.Host, "Environment should take precedence over the file")
+	assert.Equal(t, "6432", c.Port, "Command line should take precedence over the file")
+	assert.Equal(t, "worker01", c.ClientName)
+	os.Unsetenv("PGTT_CONFIG")
+
+	tomlFile := writeConfig(t, "pgtt_*.toml", `
+clientname = "worker02" # comment
+[connection]
+dbname = 'sales'
+password = "it's \"secret\""
+[api]
+rest-port = 8009
+ui = true
+`)
+	defer os.Remove(tomlFile)
+	os.Args = []string{0: "go-test", "--config=" + tomlFile}
+	c, err = Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "worker02", c.ClientName)
+	assert.Equal(t, "sales", c.Dbname)
+	assert.Equal(t, `it's "secret"`, c.Password)
+	assert.Equal(t, 8009, c.RestPort)
+	assert.True(t, c.UI)
+}
+
+func TestParseConfigFileFail(t *testing.T) {
+	for _, content := range []string{
+		"clientname: worker01\nunknown-option: 1",
+		"clientname: worker01\nsslmode: sometimes",
+		"clientname: worker01\nrest-port: http",
+		"clientname: [worker01]",
+		"clientname: worker01\nclient:\n  clientname: worker02",
+	} {
+		file := writeConfig(t, "pgtt_*.yml", content)
+		defer os.Remove(file)
+		os.Args = []string{0: "go-test", "--config", file}
+		_, err := Parse()
+		assert.Error(t, err, content)
+	}
+	for _, content := range []string{"clientname", `clientname = "worker01`, `clientname = "worker01" x`, "clientname ="} {
+		file := writeConfig(t, "pgtt_*.toml", content)
+		defer os.Remove(file)
+		os.Args = []string{0: "go-test", "--config", file}
+		_, err := Parse()
+		assert.Error(t, err, content)
+	}
+	file := writeConfig(t, "pgtt_*.ini", "clientname=worker01")
+	defer os.Remove(file)
+	os.Args = []string{0: "go-test", "--config", file}
+	_, err := Parse()
+	assert.Error(t, err, "Unknown file format should fail")
+	os.Args = []string{0: "go-test", "-c", "worker01", "--config", "/nonexistent/pg_timetable.yaml"}
+	_, err = Parse()
+	assert.Error(t, err, "Missing file should fail")
+}
+
+func TestParseEnvironment(t *testing.T) {
+	env := map[string]string{
+		"PGTT_CLIENTNAME": "worker01",
+		"PGTT_SSLMODE":    "require",
+		"PGTT_UPGRADE":    "true",
+		"PGHOST":          "db1",
+		"PGTT_PGHOST":     "db2",
+		"PGPORT":          "5433",
+		"PGDATABASE":      "sales",
+		"PGPASSWORD":      "secret",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	os.Args = []string{0: "go-test", "--user=admin"}
+	c, err := Parse()
+	require.NoError(t, err)
+	assert.Equal(t, "worker01", c.ClientName, "Required option may be set in the environment")
+	assert.Equal(t, "require", c.SSLMode)
+	assert.True(t, c.Upgrade)
+	assert.Equal(t, "db2", c.Host, "PGTT_* variables should take precedence over libpq ones")
+	assert.Equal(t, "5433", c.Port)
+	assert.Equal(t, "sales", c.Dbname)
+	assert.Equal(t, "secret", c.Password)
+	assert.Equal(t, "admin", c.User, "Command line should take precedence over the environment")
+
+	os.Setenv("PGSSLMODE", "sometimes")
+	defer os.Unsetenv("PGSSLMODE")
+	_, err = Parse()
+	assert.NoError(t, err, "Overridden libpq variable should be ignored")
+	os.Unsetenv("PGTT_SSLMODE")
+	_, err = Parse()
+	assert.Error(t, err, "Invalid libpq variable should fail")
+}
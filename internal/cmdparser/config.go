@@ -0,0 +1,207 @@
+package cmdparser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	flags "github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+)
+
+// configPath returns the configuration file passed with --config or PGTT_CONFIG
+func configPath(args []string) string {
+	var opts struct {
+		Config string `long:"config" env:"PGTT_CONFIG"`
+	}
+	_, _ = flags.NewParser(&opts, flags.IgnoreUnknown).ParseArgs(args)
+	return opts.Config
+}
+
+// loadConfig reads option values by long option name from YAML or TOML file depending on the extension.
+// Sections or nested mappings only group options, e.g. "connection" or "logging", their names are ignored
+func loadConfig(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return parseYAMLConfig(data)
+	case ".toml":
+		return parseTOMLConfig(data)
+	}
+	return nil, errors.New("Configuration file must have .yaml, .yml or .toml extension")
+}
+
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	return values, flattenYAML(doc, values)
+}
+
+func flattenYAML(doc map[string]interface{}, values map[string]string) error {
+	for key, value := range doc {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flattenYAML(v, values); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("Option %s cannot be a list", key)
+		case nil:
+		default:
+			if _, ok := values[key]; ok {
+				return fmt.Errorf("Option %s is specified more than once", key)
+			}
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// parseTOMLConfig parses the subset of TOML: [section] headers, comments and key = value pairs
+// with strings, integers and booleans
+func parseTOMLConfig(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") ||
+			strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("Line %d: missing \"=\"", n)
+		}
+		key := strings.Trim(strings.TrimSpace(line[:eq]), `"`)
+		value, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", n, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("Line %d: option %s is specified more than once", n, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseTOMLValue returns the value without quotes and the trailing comment
+func parseTOMLValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				if rest := strings.TrimSpace(s[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+					return "", fmt.Errorf("unexpected %q after value", rest)
+				}
+				return strconv.Unquote(s[:i+1])
+			}
+		}
+		return "", errors.New("unterminated string")
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated string")
+		}
+		if rest := strings.TrimSpace(s[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after value", rest)
+		}
+		return s[1 : end+1], nil
+	}
+	if comment := strings.Index(s, "#"); comment >= 0 {
+		s = strings.TrimSpace(s[:comment])
+	}
+	if s == "" {
+		return "", errors.New("missing value")
+	}
+	return s, nil
+}
+
+// applyConfig makes values of the configuration file defaults of the options, so environment variables
+// and the command line take precedence over the file
+func applyConfig(parser *flags.Parser, values map[string]string) error {
+	for key, value := range values {
+		option := parser.FindOptionByLongName(key)
+		if option == nil || key == "config" {
+			return fmt.Errorf("Unknown option: %s", key)
+		}
+		if err := validateConfigValue(option, value); err != nil {
+			return err
+		}
+		option.Default = []string{value}
+	}
+	return nil
+}
+
+// libpqEnv maps connection options to the standard libpq environment variables
+var libpqEnv = map[string]string{
+	"host":                 "PGHOST",
+	"port":                 "PGPORT",
+	"dbname":               "PGDATABASE",
+	"user":                 "PGUSER",
+	"password":             "PGPASSWORD",
+	"sslmode":              "PGSSLMODE",
+	"sslcert":              "PGSSLCERT",
+	"sslkey":               "PGSSLKEY",
+	"sslrootcert":          "PGSSLROOTCERT",
+	"target-session-attrs": "PGTARGETSESSIONATTRS",
+}
+
+// applyLibpqEnv makes values of libpq environment variables defaults of the connection options, so they take
+// precedence over the configuration file, but PGTT_* variables and the command line take precedence over them
+func applyLibpqEnv(parser *flags.Parser) error {
+	for key, env := range libpqEnv {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		option := parser.FindOptionByLongName(key)
+		if _, ok := os.LookupEnv(option.EnvDefaultKey); ok {
+			continue
+		}
+		if err := validateConfigValue(option, value); err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		option.Default = []string{value}
+	}
+	return nil
+}
+
+// validateConfigValue checks the value in advance, since the parser silently ignores invalid defaults
+func validateConfigValue(option *flags.Option, value string) error {
+	if len(option.Choices) > 0 {
+		for _, choice := range option.Choices {
+			if choice == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("Invalid value %q of option %s, allowed values are: %s",
+			value, option.LongName, strings.Join(option.Choices, ", "))
+	}
+	var err error
+	switch option.Field().Type.Kind() {
+	case reflect.Bool:
+		_, err = strconv.ParseBool(value)
+	case reflect.Int:
+		_, err = strconv.Atoi(value)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid value %q of option %s", value, option.LongName)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package crontab converts classic crontab files to chain definitions, so cron jobs can be migrated to pg_timetable
+package crontab
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
+)
+
+// defaultShell executes commands unless SHELL variable is set in the crontab
+const defaultShell = "/bin/sh"
+
+var (
+	envRegexp  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+	jobRegexp  = regexp.MustCompile(`^(@\w+|\S+\s+\S+\s+\S+\s+\S+\s+\S+)\s+(.+)$`)
+	userRegexp = regexp.MustCompile(`^(\S+)\s+(.+)$`)
+)
+
+// IsSystem returns true for /etc/crontab and files of /etc/cron.d having the user field, the same way cron does
+func IsSystem(filename string) bool {
+	filename = filepath.Clean(filename)
+	return filename == "/etc/crontab" || filepath.Dir(filename) == "/etc/cron.d"
+}
+
+// Parse converts every job of the crontab to the chain with the single SHELL task executing the command with the
+// shell. Variables set in the crontab are passed to commands with env, "%" characters of the command are
+// converted to stdin as cron does. Chain names are "<name>:<line>", chains are not live, so the job is not
+// executed twice until it is removed from the crontab. The system crontab has the user field stored as the owner
+func Parse(r io.Reader, name string, system bool) ([]pgengine.ChainDefinition, error) {
+	chains := []pgengine.ChainDefinition{}
+	shell := defaultShell
+	var env []string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := envRegexp.FindStringSubmatch(line); m != nil {
+			value := unquote(m[2])
+			switch m[1] {
+			case "SHELL":
+				shell = value
+			case "MAILTO", "MAILFROM", "CRON_TZ":
+				// mail and time zone of the cron daemon are not applicable
+			default:
+				env = append(env, m[1]+"="+value)
+			}
+			continue
+		}
+		expr, rest, err := splitSchedule(line)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", n, err)
+		}
+		runAt, err := schedule.NormalizeCron(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", n, err)
+		}
+		chain := pgengine.ChainDefinition{
+			Name:        fmt.Sprintf("%s:%d", name, n),
+			RunAt:       runAt,
+			Description: fmt.Sprintf("Imported from crontab %s line %d: %s", name, n, line),
+		}
+		if system {
+			m := userRegexp.FindStringSubmatch(rest)
+			if m == nil {
+				return nil, fmt.Errorf("Line %d: user and command expected", n)
+			}
+			chain.Owner, rest = m[1], m[2]
+		}
+		command, stdin := splitStdin(rest)
+		args := append(append([]string{}, env...), shell, "-c", command)
+		script := "env"
+		if len(env) == 0 {
+			script, args = shell, args[1:]
+		}
+		params, err := marshal(args, "")
+		if err != nil {
+			return nil, err
+		}
+		chain.Tasks = []pgengine.TaskDefinition{{
+			Name:       chain.Name,
+			Kind:       "SHELL",
+			Script:     script,
+			Parameters: []json.RawMessage{params},
+			Stdin:      stdin}}
+		chains = append(chains, chain)
+	}
+	return chains, scanner.Err()
+}
+
+// splitSchedule returns the schedule of the job, the 5 fields or the macro, and the rest of the line
+func splitSchedule(line string) (expr string, rest string, err error) {
+	m := jobRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", fmt.Errorf("schedule and command expected: %s", line)
+	}
+	return m[1], m[2], nil
+}
+
+// splitStdin splits the command at the first unescaped "%", the rest is stdin with "%" replaced by new lines
+func splitStdin(command string) (string, string) {
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '%':
+			b.WriteByte('%')
+			i++
+		case command[i] == '%':
+			return b.String(), strings.Replace(command[i+1:], "%", "\n", -1)
+		default:
+			b.WriteByte(command[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// marshal encodes the value without escaping HTML characters, so shell redirections stay readable
+func marshal(v interface{}, indent string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Run converts the crontab to the JSON chain definitions file usable with "dev run", "lint" and --import-dir
+func Run(filename string, output string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read crontab: ", err)
+		return false
+	}
+	defer f.Close()
+	chains, err := Parse(f, filepath.Base(filename), IsSystem(filename))
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot parse crontab: ", err)
+		return false
+	}
+	data, err := marshal(chains, "    ")
+	if err == nil {
+		err = ioutil.WriteFile(output, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot write chain definitions: ", err)
+		return false
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("%d cron jobs converted to chain definitions in %s", len(chains), output))
+	return true
+}
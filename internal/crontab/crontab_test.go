@@ -0,0 +1,81 @@
+package crontab
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userCrontab = `# m h dom mon dow command
+MAILTO=ops@example.com
+*/15 9-17 * * mon-fri /usr/local/bin/sync.sh > /tmp/sync.log 2>&1
+
+@daily	pg_dump sales | gzip > /backup/sales-$(date +\%F).gz
+PATH="/usr/local/bin:/usr/bin"
+0 8 * * 1 mail -s "Weekly report" ops@example.com%Report is ready%Bye
+`
+
+func TestParse(t *testing.T) {
+	chains, err := Parse(strings.NewReader(userCrontab), "crontab", false)
+	require.NoError(t, err)
+	require.Len(t, chains, 3)
+
+	sync := chains[0]
+	assert.Equal(t, "crontab:3", sync.Name)
+	assert.Equal(t, "*/15 9-17 * * 1-5", sync.RunAt, "Day names should be replaced by numbers")
+	assert.False(t, sync.Live, "Imported chains should not be live")
+	assert.Contains(t, sync.Description, "line 3")
+	require.Len(t, sync.Tasks, 1)
+	assert.Equal(t, pgengine.TaskDefinition{Name: "crontab:3", Kind: "SHELL", Script: "/bin/sh",
+		Parameters: []json.RawMessage{json.RawMessage(`["-c","/usr/local/bin/sync.sh > /tmp/sync.log 2>&1"]`)}},
+		sync.Tasks[0])
+
+	backup := chains[1]
+	assert.Equal(t, "0 0 * * *", backup.RunAt, "Macros should be resolved")
+	assert.Equal(t, `["-c","pg_dump sales | gzip > /backup/sales-$(date +%F).gz"]`, string(backup.Tasks[0].Parameters[0]),
+		"Escaped percent should be kept in the command")
+
+	mail := chains[2]
+	assert.Equal(t, "env", mail.Tasks[0].Script, "Variables should be passed with env")
+	assert.Equal(t, `["PATH=/usr/local/bin:/usr/bin","/bin/sh","-c","mail -s \"Weekly report\" ops@example.com"]`,
+		string(mail.Tasks[0].Parameters[0]))
+	assert.Equal(t, "Report is ready\nBye", mail.Tasks[0].Stdin, "Text after percent should be passed to stdin")
+
+	chains, err = Parse(strings.NewReader("SHELL=/bin/bash\n@reboot root /usr/sbin/warmup\n"), "warmup", true)
+	require.NoError(t, err)
+	require.Len(t, chains, 1)
+	assert.Equal(t, "@reboot", chains[0].RunAt)
+	assert.Equal(t, "root", chains[0].Owner, "User of the system crontab should be the owner")
+	assert.Equal(t, "/bin/bash", chains[0].Tasks[0].Script)
+
+	for _, crontab := range []string{"* * * * *", "61 * * * * date", "@sometimes date", "0 0 * * *  root"} {
+		_, err = Parse(strings.NewReader(crontab), "crontab", true)
+		assert.Error(t, err, crontab)
+	}
+}
+
+func TestIsSystem(t *testing.T) {
+	assert.True(t, IsSystem("/etc/crontab"))
+	assert.True(t, IsSystem("/etc/cron.d/backup"))
+	assert.False(t, IsSystem("/var/spool/cron/crontabs/postgres"))
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crontab")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "crontab"), filepath.Join(dir, "chains.json")
+	require.NoError(t, ioutil.WriteFile(input, []byte(userCrontab), 0644))
+	assert.True(t, Run(input, output))
+	chains, err := pgengine.ReadChainDefinitions(output)
+	require.NoError(t, err, "Generated definitions should be readable")
+	assert.Len(t, chains, 3)
+	assert.False(t, Run(filepath.Join(dir, "missing"), output))
+}
@@ -0,0 +1,48 @@
+package events
+
+// AsyncSubscriber delivers events to the wrapped subscriber in the separate goroutine, so the scheduler
+// is never blocked by slow integrations. Events are dropped if the queue is full
+type AsyncSubscriber struct {
+	subscriber Subscriber
+	queue      chan Event
+	done       chan struct{}
+	// OnDrop is called for every event dropped because of the full queue
+	OnDrop func(Event)
+}
+
+// Async returns subscriber queueing up to size events for s
+func Async(s Subscriber, size int) *AsyncSubscriber {
+	a := &AsyncSubscriber{subscriber: s, queue: make(chan Event, size), done: make(chan struct{})}
+	go a.loop()
+	return a
+}
+
+func (a *AsyncSubscriber) loop() {
+	defer close(a.done)
+	for e := range a.queue {
+		a.handle(e)
+	}
+}
+
+// handle prevents the panic of the subscriber from stopping the delivery
+func (a *AsyncSubscriber) handle(e Event) {
+	defer func() { _ = recover() }()
+	a.subscriber.HandleEvent(e)
+}
+
+// HandleEvent queues the event for the wrapped subscriber
+func (a *AsyncSubscriber) HandleEvent(e Event) {
+	select {
+	case a.queue <- e:
+	default:
+		if a.OnDrop != nil {
+			a.OnDrop(e)
+		}
+	}
+}
+
+// Close stops accepting events and waits until queued events are delivered, events must not be published after
+func (a *AsyncSubscriber) Close() {
+	close(a.queue)
+	<-a.done
+}
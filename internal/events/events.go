@@ -0,0 +1,110 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind of the scheduler event
+type Kind string
+
+// Events published by the scheduler
+const (
+	ChainQueued     Kind = "CHAIN_QUEUED"
+	ChainStarted    Kind = "CHAIN_STARTED"
+	ElementFinished Kind = "ELEMENT_FINISHED"
+	ChainDone       Kind = "CHAIN_DONE"
+	ChainFailed     Kind = "CHAIN_FAILED"
+	ClientConnected Kind = "CLIENT_CONNECTED"
+	ClientLost      Kind = "CLIENT_LOST"
+	ClientStopped   Kind = "CLIENT_STOPPED"
+	ClientDead      Kind = "CLIENT_DEAD"
+	SLAViolated     Kind = "SLA_VIOLATED"
+	ChainSuspended  Kind = "CHAIN_SUSPENDED"
+	ChainResumed    Kind = "CHAIN_RESUMED"
+)
+
+// Event describes what happened in the scheduler, fields not related to the kind of event are left empty
+type Event struct {
+	Kind        Kind      `json:"kind"`
+	Time        time.Time `json:"time"`
+	ClientName  string    `json:"client_name,omitempty"`
+	ChainConfig int       `json:"chain_config,omitempty"`
+	ChainID     int       `json:"chain_id,omitempty"`
+	ChainName   string    `json:"chain_name,omitempty"`
+	RunStatusID int       `json:"run_status,omitempty"`
+	TaskName    string    `json:"task_name,omitempty"`
+	TaskKind    string    `json:"task_kind,omitempty"`
+	ReturnCode  int       `json:"returncode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Duration    float64   `json:"duration,omitempty"` // in seconds
+	// Script of the task is delivered to in-process subscribers only, e.g. tracing, it's never published outside
+	Script string `json:"-"`
+	// Description and RunbookURL of the chain, or of the task for ELEMENT_FINISHED events
+	Description string `json:"description,omitempty"`
+	RunbookURL  string `json:"runbook_url,omitempty"`
+}
+
+// Subscriber handles events published to the bus
+type Subscriber interface {
+	HandleEvent(Event)
+}
+
+// SubscriberFunc allows to use ordinary function as subscriber
+type SubscriberFunc func(Event)
+
+// HandleEvent calls f(e)
+func (f SubscriberFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// Bus delivers published events to all subscribers. Subscribers are called synchronously in the order of
+// subscription within the publishing goroutine, thus slow subscribers should be wrapped with Async
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []Subscriber
+	// OnPanic is called if subscriber panicked, the event is still delivered to the other subscribers
+	OnPanic func(s Subscriber, e Event, r interface{})
+}
+
+// Subscribe adds subscriber receiving all events published after the call
+func (b *Bus) Subscribe(s Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, s)
+}
+
+// Publish delivers the event to subscribers, the time of the event is set if omitted
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+	for _, s := range subscribers {
+		b.deliver(s, e)
+	}
+}
+
+func (b *Bus) deliver(s Subscriber, e Event) {
+	defer func() {
+		if r := recover(); r != nil && b.OnPanic != nil {
+			b.OnPanic(s, e, r)
+		}
+	}()
+	s.HandleEvent(e)
+}
+
+// Default is the bus used by the scheduler
+var Default = &Bus{}
+
+// Subscribe adds subscriber to the Default bus
+func Subscribe(s Subscriber) {
+	Default.Subscribe(s)
+}
+
+// Publish publishes the event to the Default bus
+func Publish(e Event) {
+	Default.Publish(e)
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	var bus Bus
+	var received []string
+	bus.Subscribe(SubscriberFunc(func(e Event) { received = append(received, "first "+string(e.Kind)) }))
+	bus.Subscribe(SubscriberFunc(func(e Event) { panic("subscriber failed") }))
+	bus.Subscribe(SubscriberFunc(func(e Event) {
+		assert.False(t, e.Time.IsZero(), "Time of the event should be set")
+		received = append(received, "last "+string(e.Kind))
+	}))
+	var panicked interface{}
+	bus.OnPanic = func(s Subscriber, e Event, r interface{}) { panicked = r }
+
+	bus.Publish(Event{Kind: ChainStarted, ChainID: 1})
+	assert.Equal(t, []string{"first CHAIN_STARTED", "last CHAIN_STARTED"}, received, "Subscribers should be called in order")
+	assert.Equal(t, "subscriber failed", panicked, "Panic of the subscriber should be reported")
+
+	ts := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	bus = Bus{}
+	bus.Subscribe(SubscriberFunc(func(e Event) { assert.Equal(t, ts, e.Time, "Time of the event should be kept") }))
+	bus.Publish(Event{Kind: ChainDone, Time: ts})
+	bus.Publish(Event{Kind: ChainDone, Time: ts}) // without OnPanic set
+}
+
+func TestAsync(t *testing.T) {
+	var mu sync.Mutex
+	var received []Kind
+	block := make(chan struct{})
+	a := Async(SubscriberFunc(func(e Event) {
+		<-block
+		mu.Lock()
+		received = append(received, e.Kind)
+		mu.Unlock()
+		if e.Kind == ClientLost {
+			panic("should not stop delivery")
+		}
+	}), 2)
+	var dropped []Kind
+	a.OnDrop = func(e Event) { dropped = append(dropped, e.Kind) }
+
+	a.HandleEvent(Event{Kind: ChainQueued}) // taken by the subscriber goroutine, or queued
+	time.Sleep(10 * time.Millisecond)
+	a.HandleEvent(Event{Kind: ClientLost})
+	a.HandleEvent(Event{Kind: ChainStarted})
+	a.HandleEvent(Event{Kind: ChainFailed})
+	assert.Equal(t, []Kind{ChainFailed}, dropped, "Events should be dropped if the queue is full")
+	close(block)
+	a.Close()
+	assert.Equal(t, []Kind{ChainQueued, ClientLost, ChainStarted}, received, "Queued events should be delivered on close")
+}
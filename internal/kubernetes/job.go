@@ -0,0 +1,117 @@
+// Package kubernetes runs Kubernetes Jobs with kubectl and waits for their completion
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// Runner executes kubectl with the arguments and the standard input and returns its combined output
+type Runner func(ctx context.Context, stdin string, args ...string) ([]byte, error)
+
+// PollInterval is the delay between job status checks
+var PollInterval = 5 * time.Second
+
+// deleteTimeout limits the time spent on deleting the finished or interrupted job
+const deleteTimeout = 30 * time.Second
+
+// Job is the outcome of the finished job
+type Job struct {
+	Name     string // e.g. job.batch/pg-timetable-x7k2p
+	Status   string // Complete or Failed
+	ExitCode int    // of the last terminated container, -1 if unknown
+	Logs     []byte
+}
+
+// kubectl runs the command in the namespace
+func kubectl(ctx context.Context, run Runner, namespace string, stdin string, args ...string) ([]byte, error) {
+	if namespace != "" {
+		args = append([]string{"--namespace", namespace}, args...)
+	}
+	return run(ctx, stdin, args...)
+}
+
+// lastLine returns the last non empty line of the output ignoring warnings printed by kubectl
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// RunJob creates the job from the manifest, waits until it is complete or failed and returns its logs and exit code.
+// The job is deleted afterwards, also if the timeout in seconds is over or the context is cancelled
+func RunJob(ctx context.Context, run Runner, manifest string, namespace string, timeout int) (job Job, err error) {
+	job.ExitCode = -1
+	out, err := kubectl(ctx, run, namespace, manifest, "create", "--filename", "-", "--output", "name")
+	if err != nil {
+		return job, fmt.Errorf("Cannot create Kubernetes job: %s %s", err, strings.TrimSpace(string(out)))
+	}
+	// the name is returned by kubectl, thus generateName can be used in the manifest
+	job.Name = lastLine(out)
+	runCtx, cancel := ctx, func() {}
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	}
+	defer cancel()
+	if job.Status, err = wait(runCtx, run, job.Name, namespace); err == nil {
+		job.ExitCode = exitCode(runCtx, run, job.Name, namespace)
+		job.Logs, err = kubectl(runCtx, run, namespace, "", "logs", job.Name, "--all-containers")
+		if err == nil && job.Status == "Failed" {
+			err = fmt.Errorf("Kubernetes job %s failed", job.Name)
+		}
+	}
+	if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		err = fmt.Errorf("Kubernetes job %s deleted after timeout of %d seconds", job.Name, timeout)
+	}
+	// pods are deleted in the background
+	deleteCtx, deleteCancel := context.WithTimeout(context.Background(), deleteTimeout)
+	defer deleteCancel()
+	if _, deleteErr := kubectl(deleteCtx, run, namespace, "", "delete", job.Name, "--wait=false"); deleteErr != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot delete Kubernetes job %s: %s", job.Name, deleteErr))
+	}
+	return job, err
+}
+
+// wait polls the job conditions until it is "Complete" or "Failed"
+func wait(ctx context.Context, run Runner, name string, namespace string) (string, error) {
+	for {
+		out, err := kubectl(ctx, run, namespace, "", "get", name, "--output",
+			`jsonpath={.status.conditions[?(@.status=="True")].type}`)
+		if err != nil {
+			return "", err
+		}
+		for _, condition := range strings.Fields(lastLine(out)) {
+			if condition == "Complete" || condition == "Failed" {
+				return condition, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(PollInterval):
+		}
+	}
+}
+
+// exitCode returns the exit code of the last terminated container of the job pods or -1
+func exitCode(ctx context.Context, run Runner, name string, namespace string) int {
+	selector := "job-name=" + name[strings.LastIndex(name, "/")+1:]
+	out, err := kubectl(ctx, run, namespace, "", "get", "pods", "--selector", selector, "--output",
+		"jsonpath={.items[*].status.containerStatuses[*].state.terminated.exitCode}")
+	if err != nil {
+		return -1
+	}
+	codes := strings.Fields(lastLine(out))
+	if len(codes) == 0 {
+		return -1
+	}
+	code, err := strconv.Atoi(codes[len(codes)-1])
+	if err != nil {
+		return -1
+	}
+	return code
+}
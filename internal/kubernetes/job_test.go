@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKubectl records commands and reports the job status
+type fakeKubectl struct {
+	calls  []string
+	status string
+}
+
+func (k *fakeKubectl) run(ctx context.Context, stdin string, args ...string) ([]byte, error) {
+	call := strings.Join(args, " ")
+	k.calls = append(k.calls, call)
+	switch {
+	case strings.Contains(call, "create "):
+		return []byte("Warning: deprecated\njob.batch/" + stdin + "\n"), nil
+	case strings.Contains(call, "get pods "):
+		return []byte("0 3"), nil
+	case strings.Contains(call, "get "):
+		return []byte(k.status), nil
+	case strings.Contains(call, "logs "):
+		return []byte("job logs"), nil
+	}
+	return []byte{}, nil
+}
+
+func TestRunJob(t *testing.T) {
+	defer func(d time.Duration) { PollInterval = d }(PollInterval)
+	PollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	k := &fakeKubectl{status: "SuccessCriteriaMet Complete"}
+	job, err := RunJob(ctx, k.run, "train", "batch", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, Job{Name: "job.batch/train", Status: "Complete", ExitCode: 3, Logs: []byte("job logs")}, job)
+	assert.Equal(t, []string{
+		"--namespace batch create --filename - --output name",
+		`--namespace batch get job.batch/train --output jsonpath={.status.conditions[?(@.status=="True")].type}`,
+		"--namespace batch get pods --selector job-name=train --output jsonpath={.items[*].status.containerStatuses[*].state.terminated.exitCode}",
+		"--namespace batch logs job.batch/train --all-containers",
+		"--namespace batch delete job.batch/train --wait=false",
+	}, k.calls)
+
+	k = &fakeKubectl{status: "Failed"}
+	job, err = RunJob(ctx, k.run, "train", "", 0)
+	assert.EqualError(t, err, "Kubernetes job job.batch/train failed")
+	assert.Equal(t, "job logs", string(job.Logs), "Logs of the failed job should be returned")
+	assert.Equal(t, "create --filename - --output name", k.calls[0])
+
+	k = &fakeKubectl{}
+	_, err = RunJob(ctx, k.run, "train", "", 1)
+	assert.EqualError(t, err, "Kubernetes job job.batch/train deleted after timeout of 1 seconds")
+	assert.Equal(t, "delete job.batch/train --wait=false", k.calls[len(k.calls)-1], "Job should be deleted after timeout")
+}
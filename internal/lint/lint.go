@@ -0,0 +1,166 @@
+// Package lint checks chain definitions against configurable rules before they are run or imported
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
+)
+
+// Config enables and configures lint rules
+type Config struct {
+	// ConfirmDrop requires "confirm_drop" flag for SQL tasks containing DROP statements
+	ConfirmDrop bool `json:"confirm_drop"`
+	// NoShellTags forbids SHELL tasks in chains tagged with any of these tags
+	NoShellTags []string `json:"no_shell_tags"`
+	// RequireOwner requires every chain to specify its owner
+	RequireOwner bool `json:"require_owner"`
+	// BlackoutWindows are cron expressions of minutes when no chain may be scheduled
+	BlackoutWindows []string `json:"blackout_windows"`
+}
+
+// DefaultConfig is used when no rules file specified
+var DefaultConfig = Config{ConfirmDrop: true, NoShellTags: []string{"prod"}}
+
+// Issue describes the rule violation
+type Issue struct {
+	Chain   string
+	Task    string
+	Rule    string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Task == "" {
+		return fmt.Sprintf("chain %q: [%s] %s", i.Chain, i.Rule, i.Message)
+	}
+	return fmt.Sprintf("chain %q, task %q: [%s] %s", i.Chain, i.Task, i.Rule, i.Message)
+}
+
+// Rule checks the chain definition and returns violations found
+type Rule func(cfg Config, chain pgengine.ChainDefinition) []Issue
+
+// Rules are applied by Lint in this order
+var Rules = []Rule{ruleConfirmDrop, ruleNoShellTags, ruleRequireOwner, ruleBlackoutWindows}
+
+// period checked by the blackout windows rule
+const blackoutLookAhead = 366 * 24 * time.Hour
+
+var dropRegexp = regexp.MustCompile(`(?i)\bDROP\s+\w+`)
+
+// ReadConfig reads rules configuration from the JSON file
+func ReadConfig(filename string) (cfg Config, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	return
+}
+
+// Lint applies all rules to the chain definitions
+func Lint(cfg Config, chains []pgengine.ChainDefinition) (issues []Issue) {
+	for _, chain := range chains {
+		for _, rule := range Rules {
+			issues = append(issues, rule(cfg, chain)...)
+		}
+	}
+	return
+}
+
+func ruleConfirmDrop(cfg Config, chain pgengine.ChainDefinition) (issues []Issue) {
+	if !cfg.ConfirmDrop {
+		return
+	}
+	for _, task := range chain.Tasks {
+		if task.Kind == "SQL" && !task.ConfirmDrop && dropRegexp.MatchString(task.Script) {
+			issues = append(issues, Issue{chain.Name, task.Name, "confirm_drop",
+				"DROP statement requires confirm_drop flag"})
+		}
+	}
+	return
+}
+
+func ruleNoShellTags(cfg Config, chain pgengine.ChainDefinition) (issues []Issue) {
+	for _, tag := range chain.Tags {
+		for _, forbidden := range cfg.NoShellTags {
+			if !strings.EqualFold(tag, forbidden) {
+				continue
+			}
+			for _, task := range chain.Tasks {
+				if task.Kind == "SHELL" || task.Kind == "PROGRAM" || task.Kind == "DOCKER" || task.Kind == "K8S_JOB" {
+					issues = append(issues, Issue{chain.Name, task.Name, "no_shell_tags",
+						fmt.Sprintf("%s tasks are forbidden in chains tagged %q", task.Kind, tag)})
+				}
+			}
+		}
+	}
+	return
+}
+
+func ruleRequireOwner(cfg Config, chain pgengine.ChainDefinition) []Issue {
+	if cfg.RequireOwner && strings.TrimSpace(chain.Owner) == "" {
+		return []Issue{{chain.Name, "", "require_owner", "Chain owner is not specified"}}
+	}
+	return nil
+}
+
+// ruleBlackoutWindows checks cron scheduled chains only, "@" schedules have no fixed times
+func ruleBlackoutWindows(cfg Config, chain pgengine.ChainDefinition) (issues []Issue) {
+	if len(cfg.BlackoutWindows) == 0 || strings.HasPrefix(chain.RunAt, "@") {
+		return
+	}
+	runAt := chain.RunAt
+	if runAt == "" {
+		runAt = "* * * * *"
+	}
+	s, err := schedule.ParseCron(runAt)
+	if err != nil {
+		return []Issue{{chain.Name, "", "blackout_windows", err.Error()}}
+	}
+	now := time.Now()
+	for _, window := range cfg.BlackoutWindows {
+		blackout, err := schedule.ParseCron(window)
+		if err != nil {
+			issues = append(issues, Issue{chain.Name, "", "blackout_windows", err.Error()})
+			continue
+		}
+		for t := s.Next(now); !t.IsZero() && t.Before(now.Add(blackoutLookAhead)); t = s.Next(t) {
+			if blackout.IsDue(t) {
+				issues = append(issues, Issue{chain.Name, "", "blackout_windows",
+					fmt.Sprintf("Schedule %q conflicts with blackout window %q, e.g. at %s", runAt, window, t.Format(time.RFC3339))})
+				break
+			}
+		}
+	}
+	return
+}
+
+// Run reads chain definitions and reports rules violations, rules file is optional
+func Run(filename string, rulesFile string) bool {
+	cfg := DefaultConfig
+	var err error
+	if rulesFile != "" {
+		if cfg, err = ReadConfig(rulesFile); err != nil {
+			pgengine.LogToDB("ERROR", "Cannot read lint rules: ", err)
+			return false
+		}
+	}
+	chains, err := pgengine.ReadChainDefinitions(filename)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read chain definitions: ", err)
+		return false
+	}
+	issues := Lint(cfg, chains)
+	for _, issue := range issues {
+		pgengine.LogToDB("ERROR", issue)
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("%d chains checked, %d issues found", len(chains), len(issues)))
+	return len(issues) == 0
+}
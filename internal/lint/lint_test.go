@@ -0,0 +1,78 @@
+package lint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func rulesOf(issues []Issue) (rules []string) {
+	for _, i := range issues {
+		rules = append(rules, i.Rule)
+	}
+	return
+}
+
+func TestRuleConfirmDrop(t *testing.T) {
+	chain := pgengine.ChainDefinition{Name: "cleanup", Tasks: []pgengine.TaskDefinition{
+		{Name: "drop", Kind: "SQL", Script: "drop table if exists tmp"},
+		{Name: "confirmed", Kind: "SQL", Script: "DROP TABLE tmp", ConfirmDrop: true},
+		{Name: "select", Kind: "SQL", Script: "SELECT 'drop'"},
+	}}
+	issues := Lint(Config{ConfirmDrop: true}, []pgengine.ChainDefinition{chain})
+	assert.Equal(t, []Issue{{"cleanup", "drop", "confirm_drop", "DROP statement requires confirm_drop flag"}}, issues)
+	assert.Empty(t, Lint(Config{}, []pgengine.ChainDefinition{chain}), "Disabled rule should not report issues")
+}
+
+func TestRuleNoShellTags(t *testing.T) {
+	chains := []pgengine.ChainDefinition{
+		{Name: "prod", Tags: []string{"PROD"}, Tasks: []pgengine.TaskDefinition{{Name: "sh", Kind: "SHELL"}, {Name: "sql", Kind: "SQL"}}},
+		{Name: "dev", Tags: []string{"dev"}, Tasks: []pgengine.TaskDefinition{{Name: "sh", Kind: "SHELL"}}},
+	}
+	issues := Lint(DefaultConfig, chains)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, `chain "prod", task "sh": [no_shell_tags] SHELL tasks are forbidden in chains tagged "PROD"`, issues[0].String())
+}
+
+func TestRuleRequireOwner(t *testing.T) {
+	chains := []pgengine.ChainDefinition{{Name: "orphan"}, {Name: "owned", Owner: "dba team"}}
+	issues := Lint(Config{RequireOwner: true}, chains)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, `chain "orphan": [require_owner] Chain owner is not specified`, issues[0].String())
+}
+
+func TestRuleBlackoutWindows(t *testing.T) {
+	cfg := Config{BlackoutWindows: []string{"* 2-4 * * *"}}
+	chains := []pgengine.ChainDefinition{
+		{Name: "nightly", RunAt: "30 3 * * *"},
+		{Name: "morning", RunAt: "0 6 * * *"},
+		{Name: "every minute"},
+		{Name: "interval", RunAt: "@every 1 hour"},
+		{Name: "broken", RunAt: "61 * * * *"},
+	}
+	issues := Lint(cfg, chains)
+	assert.Equal(t, []string{"blackout_windows", "blackout_windows", "blackout_windows"}, rulesOf(issues))
+	assert.Equal(t, "nightly", issues[0].Chain)
+	assert.Equal(t, "every minute", issues[1].Chain)
+	assert.Equal(t, "broken", issues[2].Chain)
+	assert.Len(t, Lint(Config{BlackoutWindows: []string{"bad"}}, chains[1:2]), 1, "Invalid blackout window should be reported")
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	chains := filepath.Join(dir, "chains.json")
+	assert.NoError(t, ioutil.WriteFile(chains, []byte(`[{"name": "orphan", "tasks": [{"name": "select", "script": "SELECT 1"}]}]`), 0644))
+	rules := filepath.Join(dir, "rules.json")
+	assert.NoError(t, ioutil.WriteFile(rules, []byte(`{"require_owner": true}`), 0644))
+
+	assert.True(t, Run(chains, ""), "Chain should pass default rules")
+	assert.False(t, Run(chains, rules), "Chain without owner should fail configured rules")
+	assert.False(t, Run(chains, filepath.Join(dir, "non-existent.json")), "Missing rules file should fail")
+	assert.False(t, Run(filepath.Join(dir, "non-existent.json"), ""), "Missing chains file should fail")
+}
@@ -9,6 +9,9 @@ import (
 
 const defaultTableName = "migrations"
 
+// ErrNewerSchema is returned if the database was migrated by the newer version of the program
+var ErrNewerSchema = errors.New("Applied migration number on db cannot be greater than the defined migration list")
+
 // Migrator is the migrator implementation
 type Migrator struct {
 	TableName  string
@@ -89,7 +92,7 @@ func (m *Migrator) Migrate(ctx context.Context, db *sql.DB) error {
 	}
 
 	if count > len(m.migrations) {
-		return errors.New("Applied migration number on db cannot be greater than the defined migration list")
+		return ErrNewerSchema
 	}
 
 	// plan migrations
@@ -116,9 +119,21 @@ func (m *Migrator) Pending(ctx context.Context, db *sql.DB) ([]interface{}, erro
 	if err != nil {
 		return nil, err
 	}
+	if count > len(m.migrations) {
+		return nil, ErrNewerSchema
+	}
 	return m.migrations[count:len(m.migrations)], nil
 }
 
+// Version returns the name of the last applied migration, empty string if none is applied
+func (m *Migrator) Version(ctx context.Context, db *sql.DB) (version string, err error) {
+	err = db.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s ORDER BY id DESC LIMIT 1", m.TableName)).Scan(&version)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
 // NeedUpgrade returns True if database need to be updated with migrations
 func (m *Migrator) NeedUpgrade(ctx context.Context, db *sql.DB) (bool, error) {
 	exists, err := tableExists(ctx, db, m.TableName)
@@ -175,3 +175,26 @@ func TestPending(t *testing.T) {
 		t.Fatalf("pending migrations should be 1, got %d", len(pending))
 	}
 }
+
+func TestNewerSchema(t *testing.T) {
+	pgengine.InitAndTestConfigDBConnection(context.Background(), *cmdparser.NewCmdOptions())
+	db := pgengine.ConfigDb.DB
+	pgengine.ConfigDb.MustExec("DROP TABLE IF EXISTS newer_migrations")
+	noop := func(name string) *migrator.Migration {
+		return &migrator.Migration{Name: name, Func: func(tx *sql.Tx) error { return nil }}
+	}
+	newer := mustMigrator(migrator.New(migrator.TableName("newer_migrations"),
+		migrator.Migrations(noop("0001 first"), noop("0002 second"))))
+	if err := newer.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	older := mustMigrator(migrator.New(migrator.TableName("newer_migrations"),
+		migrator.Migrations(noop("0001 first"))))
+	if _, err := older.NeedUpgrade(context.Background(), db); err != migrator.ErrNewerSchema {
+		t.Fatalf("schema migrated by newer version should be reported, got %v", err)
+	}
+	version, err := older.Version(context.Background(), db)
+	if err != nil || version != "0002 second" {
+		t.Fatalf("version should be the last applied migration, got %q, %v", version, err)
+	}
+}
@@ -3,6 +3,7 @@ package pgengine
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"hash/adler32"
 	"os"
@@ -19,17 +20,25 @@ const AppID = 0x204F04EE
 /*FixSchedulerCrash make sure that task chains which are not complete due to a scheduler crash are "fixed"
 and marked as stopped at a certain point */
 func FixSchedulerCrash(ctx context.Context) {
-	_, err := ConfigDb.ExecContext(ctx, `
+	if _, err := fixClientRuns(ctx, ClientName); err != nil {
+		LogToDB("ERROR", "Error occurred during reverting from the scheduler crash: ", err)
+	}
+}
+
+// fixClientRuns marks runs of the client which are not complete as DEAD, returns the number of such runs
+func fixClientRuns(ctx context.Context, clientName string) (int64, error) {
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL(`
 		INSERT INTO timetable.run_status (execution_status, started, last_status_update, start_status, chain_execution_config, client_name)
 		  SELECT 'DEAD', now(), now(), start_status, 0, $1 FROM (
 		   SELECT   start_status
 		     FROM   timetable.run_status
 		     WHERE   execution_status IN ('STARTED', 'CHAIN_FAILED', 'CHAIN_DONE', 'DEAD') AND client_name = $1
 		     GROUP BY 1
-		     HAVING count(*) < 2 ) AS abc`, ClientName)
+		     HAVING count(*) < 2 ) AS abc`), clientName)
 	if err != nil {
-		LogToDB("ERROR", "Error occurred during reverting from the scheduler crash: ", err)
+		return 0, err
 	}
+	return res.RowsAffected()
 }
 
 // CanProceedChainExecution checks if particular chain can be exeuted in parallel
@@ -37,7 +46,7 @@ func CanProceedChainExecution(ctx context.Context, chainConfigID int, maxInstanc
 	const sqlProcCount = "SELECT count(*) FROM timetable.get_running_jobs($1) AS (id BIGINT, status BIGINT) GROUP BY id"
 	var procCount int
 	LogToDB("DEBUG", fmt.Sprintf("Checking if can proceed with chaing config ID: %d", chainConfigID))
-	err := ConfigDb.GetContext(ctx, &procCount, sqlProcCount, chainConfigID)
+	err := ConfigDb.GetContext(ctx, &procCount, SchemaSQL(sqlProcCount), chainConfigID)
 	switch {
 	case err == sql.ErrNoRows:
 		return true
@@ -52,7 +61,7 @@ func CanProceedChainExecution(ctx context.Context, chainConfigID int, maxInstanc
 // DeleteChainConfig delete chaing configuration for self destructive chains
 func DeleteChainConfig(ctx context.Context, chainConfigID int) bool {
 	LogToDB("LOG", "Deleting self destructive chain configuration ID: ", chainConfigID)
-	res, err := ConfigDb.ExecContext(ctx, "DELETE FROM timetable.chain_execution_config WHERE chain_execution_config = $1 ", chainConfigID)
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.chain_execution_config WHERE chain_execution_config = $1 "), chainConfigID)
 	if err != nil {
 		LogToDB("ERROR", "Error occurred during deleting self destructive chains: ", err)
 	}
@@ -60,20 +69,60 @@ func DeleteChainConfig(ctx context.Context, chainConfigID int) bool {
 	return err == nil && rowsDeleted == 1
 }
 
-// TryLockClientName obtains lock on the server to prevent another client with the same name
+// DisableChainConfig disables chain configuration preserving it for inspection
+func DisableChainConfig(ctx context.Context, chainConfigID int) bool {
+	LogToDB("LOG", "Disabling chain configuration ID: ", chainConfigID)
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL("UPDATE timetable.chain_execution_config SET live = FALSE WHERE chain_execution_config = $1 "), chainConfigID)
+	if err != nil {
+		LogToDB("ERROR", "Error occurred during disabling chain configuration: ", err)
+		return false
+	}
+	rowsUpdated, err := res.RowsAffected()
+	return err == nil && rowsUpdated == 1
+}
+
+// clientLockID returns the advisory lock key of the client name, clients of deployments using
+// other schemas than the default one may have the same names
+func clientLockID(clientName string) uint32 {
+	if SchemaName != DefaultSchemaName {
+		clientName = SchemaName + "." + clientName
+	}
+	return adler32.Checksum([]byte(clientName))
+}
+
+// TryLockClientName obtains lock on the server to prevent another client with the same name.
+// In PgBouncer mode the lease is obtained instead and must be renewed by calling it periodically
 func TryLockClientName(ctx context.Context) (res bool) {
-	adler32Int := adler32.Checksum([]byte(ClientName))
-	LogToDB("DEBUG", fmt.Sprintf("Trying to get advisory lock for '%s' with hash 0x%x", ClientName, adler32Int))
-	err := ConfigDb.GetContext(ctx, &res, "select pg_try_advisory_lock($1, $2)", AppID, adler32Int)
+	var err error
+	if PgBouncerMode {
+		LogToDB("DEBUG", fmt.Sprintf("Trying to get lease for '%s'", ClientName))
+		res, err = tryLeaseClientName(ctx)
+	} else {
+		adler32Int := clientLockID(ClientName)
+		LogToDB("DEBUG", fmt.Sprintf("Trying to get advisory lock for '%s' with hash 0x%x", ClientName, adler32Int))
+		err = ConfigDb.GetContext(ctx, &res, "select pg_try_advisory_lock($1, $2)", AppID, adler32Int)
+		if err == nil && !res && takeOverStaleLock(ctx, adler32Int) {
+			err = ConfigDb.GetContext(ctx, &res, "select pg_try_advisory_lock($1, $2)", AppID, adler32Int)
+		}
+		if err == nil && res {
+			clientHeartbeat(ctx)
+		}
+	}
 	if err != nil {
 		LogToDB("ERROR", "Error occurred during client name locking: ", err)
 	}
-	if !res {
+	switch {
+	case !res && HAMode:
+		LogToDB("DEBUG", "The leader is connected to server with name: ", ClientName)
+	case !res:
 		LogToDB("ERROR", "Another client is already connected to server with name: ", ClientName)
 	}
 	return
 }
 
+// OnClose is called by the close handler before the session is closed, e.g. to flush event subscribers
+var OnClose func()
+
 // SetupCloseHandler creates a 'listener' on a new goroutine which will notify the
 // program if it receives an interrupt from the OS. We then handle this by calling
 // our clean up procedure and exiting the program.
@@ -82,25 +131,43 @@ func SetupCloseHandler() {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		FinalizeConfigDBConnection()
+		CloseSession()
 		os.Exit(0)
 	}()
 }
 
+// CloseSession calls OnClose and closes the session if connected, e.g. when the service is stopped
+func CloseSession() {
+	if OnClose != nil {
+		OnClose()
+	}
+	if ConfigDb != nil {
+		FinalizeConfigDBConnection()
+	}
+}
+
 func IsAlive() bool {
 	return ConfigDb != nil && ConfigDb.Ping() == nil
 }
 
+// Ping checks the configuration database connection within the context
+func Ping(ctx context.Context) error {
+	if ConfigDb == nil {
+		return errors.New("Not connected to the configuration database")
+	}
+	return ConfigDb.PingContext(ctx)
+}
+
 // InsertChainRunStatus inits the execution run log, which will be use to effectively control scheduler concurrency
 func InsertChainRunStatus(ctx context.Context, chainConfigID int, chainID int) int {
 	const sqlInsertRunStatus = `
 INSERT INTO timetable.run_status 
-(chain_id, execution_status, started, chain_execution_config, client_name) 
+(chain_id, execution_status, started, chain_execution_config, client_name, worker_id, host) 
 VALUES 
-($1, 'STARTED', now(), $2, $3) 
+($1, 'STARTED', now(), $2, $3, $4, $5) 
 RETURNING run_status`
 	var id int
-	err := ConfigDb.GetContext(ctx, &id, sqlInsertRunStatus, chainID, chainConfigID, ClientName)
+	err := ConfigDb.GetContext(ctx, &id, SchemaSQL(sqlInsertRunStatus), chainID, chainConfigID, ClientName, WorkerID(ctx), Host)
 	if err != nil {
 		LogToDB("ERROR", "Cannot save information about the chain run status: ", err)
 	}
@@ -111,13 +178,127 @@ RETURNING run_status`
 func UpdateChainRunStatus(ctx context.Context, chainElemExec *ChainElementExecution, runStatusID int, status string) {
 	const sqlInsertFinishStatus = `
 INSERT INTO timetable.run_status 
-(chain_id, execution_status, current_execution_element, started, last_status_update, start_status, chain_execution_config, client_name)
+(chain_id, execution_status, current_execution_element, started, last_status_update, start_status, chain_execution_config, client_name,
+worker_id, host, child_pid)
 VALUES 
-($1, $2, $3, clock_timestamp(), now(), $4, $5, $6)`
+($1, $2, $3, clock_timestamp(), now(), $4, $5, $6, $7, $8, NULLIF($9, 0))`
 	var err error
-	_, err = ConfigDb.ExecContext(ctx, sqlInsertFinishStatus, chainElemExec.ChainID, status, chainElemExec.TaskID,
-		runStatusID, chainElemExec.ChainConfig, ClientName)
+	_, err = ConfigDb.ExecContext(ctx, SchemaSQL(sqlInsertFinishStatus), chainElemExec.ChainID, status, chainElemExec.TaskID,
+		runStatusID, chainElemExec.ChainConfig, ClientName, WorkerID(ctx), Host, chainElemExec.ChildPID)
 	if err != nil {
 		LogToDB("ERROR", "Update Chain Status failed: ", err)
 	}
 }
+
+// CheckChainQuota checks if the tenant owning the chain is within its quota. Otherwise the run is
+// registered with QUOTA_EXCEEDED status, notification is sent to the "timetable_quota" channel and false is returned
+func CheckChainQuota(ctx context.Context, chainConfigID int, chainID int) bool {
+	if !Enabled(FeatureQuotas) {
+		return true
+	}
+	const sqlQuotaExceeded = `
+WITH rs AS (
+	INSERT INTO timetable.run_status 
+	(chain_id, execution_status, started, last_status_update, chain_execution_config, client_name) 
+	VALUES 
+	($1, 'QUOTA_EXCEEDED', now(), now(), $2, $3) 
+	RETURNING run_status
+)
+SELECT pg_notify('timetable_quota', json_build_object('run_status', run_status, 
+	'chain_execution_config', $2::bigint, 'client_name', $3::text, 'reason', $4::text)::text) 
+FROM rs`
+	var reason sql.NullString
+	if err := ConfigDb.GetContext(ctx, &reason, SchemaSQL("SELECT timetable.check_quota($1)"), chainConfigID); err != nil {
+		LogToDB("ERROR", "Cannot check quota of the chain configuration: ", err)
+		return true
+	}
+	if !reason.Valid {
+		return true
+	}
+	LogToDB("ERROR", fmt.Sprintf("Chain configuration ID %d is not executed: %s", chainConfigID, reason.String))
+	if _, err := ConfigDb.ExecContext(ctx, SchemaSQL(sqlQuotaExceeded), chainID, chainConfigID, ClientName, reason.String); err != nil {
+		LogToDB("ERROR", "Cannot save information about the exceeded quota: ", err)
+	}
+	return false
+}
+
+// ChainAffinity describes the client executed the chain previously, see chain_execution_config.affinity
+type ChainAffinity struct {
+	Affinity    sql.NullString `db:"affinity"`
+	LastClient  sql.NullString `db:"last_client"`
+	FailoverDue bool           `db:"failover_due"`
+}
+
+// GetChainAffinity returns the affinity of the chain and the client executed it last time.
+// Skipped runs registered with QUOTA_EXCEEDED or SHELL_DISABLED status are not taken into account
+func GetChainAffinity(ctx context.Context, chainConfigID int) (a ChainAffinity, err error) {
+	if !Enabled(FeatureAffinity) {
+		return
+	}
+	const sqlSelectAffinity = `
+SELECT c.affinity, r.client_name AS last_client,
+	COALESCE(r.last_status_update < now() - c.affinity_failover, FALSE) AS failover_due
+FROM timetable.chain_execution_config c LEFT JOIN LATERAL (
+	SELECT client_name, last_status_update FROM timetable.run_status 
+	WHERE chain_execution_config = c.chain_execution_config AND execution_status NOT IN ('QUOTA_EXCEEDED', 'SHELL_DISABLED')
+	ORDER BY run_status DESC LIMIT 1
+) r ON TRUE
+WHERE c.chain_execution_config = $1`
+	err = ConfigDb.GetContext(ctx, &a, SchemaSQL(sqlSelectAffinity), chainConfigID)
+	return
+}
+
+// GetShellDisabledAction returns what to do with elements of the chain blocked by NoShellTasks:
+// FAIL, SKIP_ELEMENT or SKIP_CHAIN
+func GetShellDisabledAction(ctx context.Context, chainConfigID int) (action string, err error) {
+	if !Enabled(FeatureShellDisabled) {
+		return "FAIL", nil
+	}
+	err = ConfigDb.GetContext(ctx, &action, SchemaSQL("SELECT shell_disabled_action FROM timetable.chain_execution_config ")+
+		"WHERE chain_execution_config = $1", chainConfigID)
+	return
+}
+
+// ChainWindow describes the execution window of the chain as HH24:MI:SS strings in the time zone
+// of the database session, see chain_execution_config.window_start
+type ChainWindow struct {
+	Start sql.NullString `db:"window_start"`
+	End   sql.NullString `db:"window_end"`
+	Now   string         `db:"now"`
+}
+
+// GetChainWindow returns the execution window of the chain and the current time of day
+func GetChainWindow(ctx context.Context, chainConfigID int) (w ChainWindow, err error) {
+	if !Enabled(FeatureWindows) {
+		return
+	}
+	const sqlSelectWindow = `
+SELECT to_char(window_start, 'HH24:MI:SS') AS window_start, to_char(window_end, 'HH24:MI:SS') AS window_end,
+	to_char(now(), 'HH24:MI:SS') AS now
+FROM timetable.chain_execution_config WHERE chain_execution_config = $1`
+	err = ConfigDb.GetContext(ctx, &w, SchemaSQL(sqlSelectWindow), chainConfigID)
+	return
+}
+
+// GetChainHeartbeat returns the heartbeat URL of the chain, empty if not set
+func GetChainHeartbeat(ctx context.Context, chainConfigID int) (url string, err error) {
+	if !Enabled(FeatureHeartbeat) {
+		return
+	}
+	err = ConfigDb.GetContext(ctx, &url, SchemaSQL("SELECT COALESCE(heartbeat_url, '') FROM timetable.chain_execution_config ")+
+		"WHERE chain_execution_config = $1", chainConfigID)
+	return
+}
+
+// IsClientConnected returns true if the client with the name holds the lock obtained by TryLockClientName
+func IsClientConnected(ctx context.Context, clientName string) (res bool, err error) {
+	if PgBouncerMode {
+		err = ConfigDb.GetContext(ctx, &res, SchemaSQL("SELECT EXISTS(SELECT 1 FROM timetable.client_lease ")+
+			"WHERE client_name = $1 AND expires > now())", clientName)
+		return
+	}
+	const sqlClientLocked = `SELECT EXISTS(SELECT 1 FROM pg_locks 
+	WHERE locktype = 'advisory' AND classid = $1 AND objid = $2 AND objsubid = 2 AND granted)`
+	err = ConfigDb.GetContext(ctx, &res, sqlClientLocked, AppID, clientLockID(clientName))
+	return
+}
@@ -0,0 +1,153 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ArtifactsDir is the root directory where run artifacts are stored, artifacts are disabled if empty
+var ArtifactsDir string
+
+// ErrArtifactNotFound is returned if the artifact is not registered
+var ErrArtifactNotFound = errors.New("Artifact not found")
+
+// Artifact is the file produced by the chain run and stored under ArtifactsDir
+type Artifact struct {
+	ID          int            `db:"artifact_id" json:"artifact_id"`
+	RunStatusID int            `db:"run_status" json:"run_status"`
+	ChainConfig int            `db:"chain_execution_config" json:"chain_execution_config"`
+	TaskName    string         `db:"task_name" json:"task_name"`
+	FileName    string         `db:"file_name" json:"file_name"`
+	Path        string         `db:"path" json:"-"` // relative to ArtifactsDir
+	Size        int64          `db:"size" json:"size"`
+	ClientName  string         `db:"client_name" json:"client_name"`
+	Created     time.Time      `db:"created" json:"created"`
+	Expires     sql.NullTime   `db:"expires" json:"-"`
+	Tenant      sql.NullString `db:"tenant" json:"-"`
+}
+
+const sqlInsertArtifact = `INSERT INTO timetable.run_artifact
+(run_status, chain_execution_config, task_name, file_name, path, size, client_name, expires)
+SELECT $1, chain_execution_config, $2, $3, $4, $5, $6, now() + $7::interval
+FROM timetable.run_status WHERE run_status = $1
+RETURNING artifact_id`
+
+const sqlSelectArtifacts = `SELECT a.artifact_id, a.run_status, COALESCE(a.chain_execution_config, 0) AS chain_execution_config,
+a.task_name, a.file_name,
+a.path, a.size, a.client_name, a.created, a.expires, c.tenant
+FROM timetable.run_artifact a LEFT JOIN timetable.chain_execution_config c USING (chain_execution_config)`
+
+// copyFile copies src to dst creating missing directories and returns the number of bytes copied
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return size, err
+}
+
+// StoreArtifact copies the file to <ArtifactsDir>/<run_status>/<file name> and registers it as the artifact of the run.
+// keep is the interval the artifact is kept for, the artifact is removed by Retention together with the run if empty
+func StoreArtifact(ctx context.Context, runStatusID int, taskName string, file string, keep string) (id int, err error) {
+	if ArtifactsDir == "" {
+		return 0, errors.New("Artifacts directory is not specified")
+	}
+	if !Enabled(FeatureArtifacts) {
+		return 0, ErrFeatureDisabled
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("Artifact %s is not a regular file", file)
+	}
+	path := filepath.Join(strconv.Itoa(runStatusID), filepath.Base(file))
+	size, err := copyFile(file, filepath.Join(ArtifactsDir, path))
+	if err != nil {
+		return 0, err
+	}
+	var expires sql.NullString
+	if keep != "" {
+		expires = sql.NullString{String: keep, Valid: true}
+	}
+	err = ConfigDb.GetContext(ctx, &id, SchemaSQL(sqlInsertArtifact), runStatusID, taskName, info.Name(), path, size, ClientName, expires)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("Run status %d not found", runStatusID)
+	}
+	if err != nil {
+		_ = os.Remove(filepath.Join(ArtifactsDir, path))
+	}
+	return id, err
+}
+
+// GetRunArtifacts returns artifacts of the run
+func GetRunArtifacts(ctx context.Context, runStatusID int) (artifacts []Artifact, err error) {
+	if !Enabled(FeatureArtifacts) {
+		return nil, ErrFeatureDisabled
+	}
+	err = ConfigDb.SelectContext(ctx, &artifacts, SchemaSQL(sqlSelectArtifacts)+" WHERE a.run_status = $1 ORDER BY a.artifact_id", runStatusID)
+	return
+}
+
+// GetArtifact returns the registered artifact
+func GetArtifact(ctx context.Context, id int) (a Artifact, err error) {
+	err = ConfigDb.GetContext(ctx, &a, SchemaSQL(sqlSelectArtifacts)+" WHERE a.artifact_id = $1", id)
+	if err == sql.ErrNoRows {
+		err = ErrArtifactNotFound
+	}
+	return
+}
+
+// ArtifactFile returns the absolute path of the stored artifact file
+func ArtifactFile(a Artifact) string {
+	return filepath.Join(ArtifactsDir, a.Path)
+}
+
+// DeleteExpiredArtifacts removes artifacts expired or, if kept for unspecified time, older than period together
+// with their files. ArtifactsDir should be shared by clients, otherwise files stored by other clients are left
+func DeleteExpiredArtifacts(ctx context.Context, period string) (deleted int, err error) {
+	if ArtifactsDir == "" || !Enabled(FeatureArtifacts) {
+		return 0, nil
+	}
+	var artifacts []Artifact
+	err = ConfigDb.SelectContext(ctx, &artifacts, SchemaSQL(sqlSelectArtifacts)+
+		" WHERE COALESCE(a.expires, a.created + $1::interval) < now()", period)
+	if err != nil {
+		return
+	}
+	for _, a := range artifacts {
+		if err := os.Remove(ArtifactFile(a)); err != nil && !os.IsNotExist(err) {
+			LogToDB("ERROR", fmt.Sprintf("Cannot remove artifact %s: %s", ArtifactFile(a), err))
+			continue
+		}
+		_ = os.Remove(filepath.Dir(ArtifactFile(a))) // the run directory is removed if empty
+		if _, err = ConfigDb.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.run_artifact WHERE artifact_id = $1"), a.ID); err != nil {
+			return
+		}
+		deleted++
+	}
+	return
+}
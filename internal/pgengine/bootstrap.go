@@ -10,16 +10,22 @@ import (
 	"time"
 
 	"github.com/cybertec-postgresql/pg_timetable/internal/cmdparser"
+	"github.com/cybertec-postgresql/pg_timetable/internal/secrets"
 	"github.com/jmoiron/sqlx"
 
 	"github.com/lib/pq"
 )
 
-// WaitTime specifies amount of time in seconds to wait before reconnecting to DB
-const WaitTime = 5
+// WaitTime specifies amount of time in seconds to wait before reconnecting to DB, shortened in debug mode
+var WaitTime = defaultWaitTime
 
-// maximum wait time before reconnect attempts
-const maxWaitTime = WaitTime * 16
+const (
+	defaultWaitTime = 5
+	debugWaitTime   = 1
+)
+
+// maximum wait time before reconnect attempts is WaitTime multiplied by maxWaitFactor
+const maxWaitFactor = 16
 
 // ConfigDb is the global database object
 var ConfigDb *sqlx.DB
@@ -30,6 +36,12 @@ var ClientName string
 // NoShellTasks parameter disables SHELL tasks executing
 var NoShellTasks bool
 
+// ExclusionFile lists chains this client must never execute
+var ExclusionFile string
+
+// ResumeCrashed executes idempotent chains again if their runs were left unfinished by the crash of the client
+var ResumeCrashed bool
+
 var sqls = []string{sqlDDL, sqlJSONSchema, sqlTasks, sqlJobFunctions}
 var sqlNames = []string{"DDL", "JSON Schema", "Built-in Tasks", "Job Functions"}
 
@@ -37,14 +49,30 @@ var sqlNames = []string{"DDL", "JSON Schema", "Built-in Tasks", "Job Functions"}
 func InitAndTestConfigDBConnection(ctx context.Context, cmdOpts cmdparser.CmdOptions) bool {
 	ClientName = cmdOpts.ClientName
 	NoShellTasks = cmdOpts.NoShellTasks
+	NoProgramUpgrade = cmdOpts.NoProgramUpgrade
+	PgBouncerMode = cmdOpts.PgBouncer
+	HAMode = cmdOpts.HA
+	ClientGroup = cmdOpts.ClientGroup
+	ClusterExclusive = cmdOpts.ClusterExclusive
+	ResumeCrashed = cmdOpts.ResumeCrashed
+	ExclusionFile = cmdOpts.ExclusionFile
+	ArtifactsDir = cmdOpts.ArtifactsDir
+	OutputLimit, OutputDir = cmdOpts.OutputLimit, cmdOpts.OutputDir
+	TenantIsolation = cmdOpts.TenantIsolation
 	VerboseLogLevel = cmdOpts.Verbose
+	WaitTime = defaultWaitTime
+	if cmdOpts.Debug {
+		WaitTime = debugWaitTime
+	}
+	secrets.CacheTTL = time.Duration(cmdOpts.SecretTTL) * time.Second
+	if cmdOpts.Schema != "" {
+		SchemaName = cmdOpts.Schema
+	}
 	LogToDB("DEBUG", fmt.Sprintf("Starting new session... %s", &cmdOpts))
 	var wt int = WaitTime
 	var err error
-	connstr := fmt.Sprintf("application_name='pg_timetable' host='%s' port='%s' dbname='%s' sslmode='%s' user='%s' password='%s'",
-		cmdOpts.Host, cmdOpts.Port, cmdOpts.Dbname, cmdOpts.SSLMode, cmdOpts.User, cmdOpts.Password)
-	// Base connector to wrap
-	base, err := pq.NewConnector(connstr)
+	// Base connector to wrap trying all the hosts of the list
+	base, connstr, err := newMultiHostConnector(cmdOpts)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -63,10 +91,14 @@ func InitAndTestConfigDBConnection(ctx context.Context, cmdOpts cmdparser.CmdOpt
 		case <-time.After(time.Duration(wt) * time.Second):
 			err = db.PingContext(ctx)
 		case <-ctx.Done():
-			LogToDB("ERROR", "Connection request cancelled: ", ctx.Err())
+			if ctx.Err() == context.DeadlineExceeded {
+				LogToDB("ERROR", "Cannot connect to the database within init timeout")
+			} else {
+				LogToDB("ERROR", "Connection request cancelled: ", ctx.Err())
+			}
 			return false
 		}
-		if wt < maxWaitTime {
+		if wt < WaitTime*maxWaitFactor {
 			wt = wt * 2
 		}
 	}
@@ -74,6 +106,15 @@ func InitAndTestConfigDBConnection(ctx context.Context, cmdOpts cmdparser.CmdOpt
 	LogToDB("LOG", "Connection established...")
 	LogToDB("LOG", fmt.Sprintf("Proceeding as '%s' with client PID %d", ClientName, os.Getpid()))
 	ConfigDb = sqlx.NewDb(db, "postgres")
+	// the error is already reported by the connector
+	password, _ := newPasswordFunc(cmdOpts)
+	if password != nil {
+		cmdOpts.Password = ""
+	}
+	// COPY tasks fail with ErrNoPool if the pool cannot be prepared, the scheduler doesn't need it otherwise
+	if copyPool, err = openCopyPool(ctx, poolConnString(cmdOpts), cmdOpts.TargetSessionAttrs, password); err != nil {
+		LogToDB("ERROR", "Cannot prepare connection pool for COPY tasks: ", err)
+	}
 
 	if !executeSchemaScripts(ctx) {
 		return false
@@ -91,12 +132,12 @@ func ExecuteCustomScripts(ctx context.Context, filename ...string) bool {
 	for _, f := range filename {
 		sql, err := ioutil.ReadFile(f)
 		if err != nil {
-			fmt.Printf(GetLogPrefixLn("PANIC"), err)
+			printLog("PANIC", err)
 			return false
 		}
-		fmt.Printf(GetLogPrefixLn("LOG"), "Executing script: "+f)
+		printLog("LOG", "Executing script: "+f)
 		if _, err = ConfigDb.ExecContext(ctx, string(sql)); err != nil {
-			fmt.Printf(GetLogPrefixLn("PANIC"), err)
+			printLog("PANIC", err)
 			return false
 		}
 		LogToDB("LOG", "Script file executed: "+f)
@@ -106,17 +147,17 @@ func ExecuteCustomScripts(ctx context.Context, filename ...string) bool {
 
 func executeSchemaScripts(ctx context.Context) bool {
 	var exists bool
-	err := ConfigDb.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM pg_namespace WHERE nspname = 'timetable')")
+	err := ConfigDb.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM pg_namespace WHERE nspname = $1)", SchemaName)
 	if err != nil || !exists {
 		for i, sql := range sqls {
 			sqlName := sqlNames[i]
-			fmt.Printf(GetLogPrefixLn("LOG"), "Executing script: "+sqlName)
+			printLog("LOG", "Executing script: "+sqlName)
 			if _, err = ConfigDb.ExecContext(ctx, sql); err != nil {
-				fmt.Printf(GetLogPrefixLn("PANIC"), err)
-				fmt.Printf(GetLogPrefixLn("PANIC"), "Dropping \"timetable\" schema")
-				_, err = ConfigDb.ExecContext(ctx, "DROP SCHEMA IF EXISTS timetable CASCADE")
+				printLog("PANIC", err)
+				printLog("PANIC", fmt.Sprintf("Dropping %q schema", SchemaName))
+				_, err = ConfigDb.ExecContext(ctx, SchemaSQL("DROP SCHEMA IF EXISTS timetable CASCADE"))
 				if err != nil {
-					fmt.Printf(GetLogPrefixLn("PANIC"), err)
+					printLog("PANIC", err)
 				}
 				return false
 			}
@@ -129,26 +170,31 @@ func executeSchemaScripts(ctx context.Context) bool {
 
 // FinalizeConfigDBConnection closes session
 func FinalizeConfigDBConnection() {
-	fmt.Printf(GetLogPrefixLn("LOG"), "Closing session")
-	if _, err := ConfigDb.Exec("SELECT pg_advisory_unlock_all()"); err != nil {
-		fmt.Printf(GetLogPrefixLn("ERROR"), fmt.Sprintf("Error occurred during locks releasing: %v", err))
+	StopLogWriter()
+	printLog("LOG", "Closing session")
+	if err := releaseClientLock(); err != nil {
+		printLog("ERROR", fmt.Sprintf("Error occurred during locks releasing: %v", err))
 	}
 	if err := ConfigDb.Close(); err != nil {
-		fmt.Printf(GetLogPrefixLn("ERROR"), fmt.Sprintf("Error occurred during connection closing: %v", err))
+		printLog("ERROR", fmt.Sprintf("Error occurred during connection closing: %v", err))
 	}
 	ConfigDb = nil
+	if copyPool != nil {
+		copyPool.Close()
+		copyPool = nil
+	}
 }
 
 //ReconnectDbAndFixLeftovers keeps trying reconnecting every `waitTime` seconds till connection established
 func ReconnectDbAndFixLeftovers(ctx context.Context) bool {
 	for ConfigDb.PingContext(ctx) != nil {
-		fmt.Printf(GetLogPrefixLn("REPAIR"),
+		printLog("REPAIR",
 			fmt.Sprintf("Connection to the server was lost. Waiting for %d sec...", WaitTime))
 		select {
-		case <-time.After(WaitTime * time.Second):
-			fmt.Printf(GetLogPrefix("REPAIR"), "Reconnecting...\n")
+		case <-time.After(time.Duration(WaitTime) * time.Second):
+			printLog("REPAIR", "Reconnecting...")
 		case <-ctx.Done():
-			fmt.Printf(GetLogPrefixLn("ERROR"), fmt.Sprintf("request cancelled: %v", ctx.Err()))
+			printLog("ERROR", fmt.Sprintf("request cancelled: %v", ctx.Err()))
 			return false
 		}
 	}
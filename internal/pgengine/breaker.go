@@ -0,0 +1,53 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+)
+
+// sqlSuspendFailingChain suspends the chain if its failed runs since the last successful run reached max_failures
+const sqlSuspendFailingChain = `UPDATE timetable.chain_execution_config c SET live = false, suspended = now()
+WHERE c.chain_execution_config = $1 AND c.live AND c.max_failures <= (
+	SELECT count(*) FROM timetable.run_status f
+	WHERE f.chain_execution_config = c.chain_execution_config AND f.execution_status = 'CHAIN_FAILED'
+		AND f.run_status > COALESCE((SELECT max(d.run_status) FROM timetable.run_status d
+			WHERE d.chain_execution_config = c.chain_execution_config AND d.execution_status = 'CHAIN_DONE'), 0))
+RETURNING c.max_failures`
+
+// sqlResumeSuspendedChains enables chains suspended longer than their failure_cooldown. Failures before
+// the suspension still count, so the chain is suspended again if the next run fails
+const sqlResumeSuspendedChains = `UPDATE timetable.chain_execution_config SET live = true, suspended = NULL
+WHERE NOT live AND suspended + failure_cooldown <= now()
+RETURNING chain_execution_config, chain_name`
+
+// SuspendedChain is the chain enabled again by the circuit breaker
+type SuspendedChain struct {
+	ChainConfig int    `db:"chain_execution_config"`
+	ChainName   string `db:"chain_name"`
+}
+
+// SuspendFailingChain trips the circuit breaker of the chain which failed max_failures consecutive times:
+// the chain is suspended, i.e. not live anymore. Returns max_failures of the chain if it was suspended
+func SuspendFailingChain(ctx context.Context, chainConfigID int) (maxFailures int, suspended bool) {
+	if !Enabled(FeatureCircuitBreaker) {
+		return 0, false
+	}
+	err := ConfigDb.GetContext(ctx, &maxFailures, SchemaSQL(sqlSuspendFailingChain), chainConfigID)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, false
+	case err != nil:
+		LogToDB("ERROR", "Cannot check consecutive failures of the chain: ", err)
+		return 0, false
+	}
+	return maxFailures, true
+}
+
+// ResumeSuspendedChains enables chains which failure_cooldown passed since they were suspended
+func ResumeSuspendedChains(ctx context.Context) (chains []SuspendedChain, err error) {
+	if !Enabled(FeatureCircuitBreaker) {
+		return nil, nil
+	}
+	err = ConfigDb.SelectContext(ctx, &chains, SchemaSQL(sqlResumeSuspendedChains))
+	return
+}
@@ -0,0 +1,38 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"os"
+)
+
+// ClientResources describes the health of the host the client is running on, invalid values are unknown
+type ClientResources struct {
+	Hostname     sql.NullString
+	Load1        sql.NullFloat64
+	Load5        sql.NullFloat64
+	Load15       sql.NullFloat64
+	MemTotal     sql.NullInt64 // in bytes
+	MemAvailable sql.NullInt64
+	DiskTotal    sql.NullInt64 // of the temporary directory, in bytes
+	DiskFree     sql.NullInt64
+}
+
+// ReportClientResources saves the current resources of the host into timetable.client
+func ReportClientResources(ctx context.Context, r ClientResources) {
+	if !Enabled(FeatureClientResources) {
+		return
+	}
+	const sqlReportClient = `INSERT INTO timetable.client
+(client_name, hostname, pid, load1, load5, load15, mem_total, mem_available, disk_total, disk_free, reported)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now())
+ON CONFLICT (client_name) DO UPDATE SET hostname = EXCLUDED.hostname, pid = EXCLUDED.pid,
+	load1 = EXCLUDED.load1, load5 = EXCLUDED.load5, load15 = EXCLUDED.load15,
+	mem_total = EXCLUDED.mem_total, mem_available = EXCLUDED.mem_available,
+	disk_total = EXCLUDED.disk_total, disk_free = EXCLUDED.disk_free, reported = EXCLUDED.reported`
+	_, err := ConfigDb.ExecContext(ctx, SchemaSQL(sqlReportClient), ClientName, r.Hostname, os.Getpid(),
+		r.Load1, r.Load5, r.Load15, r.MemTotal, r.MemAvailable, r.DiskTotal, r.DiskFree)
+	if err != nil {
+		LogToDB("ERROR", "Cannot report client resources: ", err)
+	}
+}
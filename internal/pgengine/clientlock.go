@@ -0,0 +1,86 @@
+package pgengine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// sqlClientHeartbeat renews the lease row of the client holding the advisory lock, so the session of
+// the crashed client still holding the lock can be recognized and terminated
+const sqlClientHeartbeat = `INSERT INTO timetable.client_lease (client_name, hostname, pid, expires)
+VALUES ($1, $2, $3, now() + $4::interval)
+ON CONFLICT (client_name) DO UPDATE SET hostname = EXCLUDED.hostname, pid = EXCLUDED.pid, expires = EXCLUDED.expires,
+	heartbeat = now(), lost = NULL`
+
+// sqlStaleLockHolders returns backends holding the client name lock while the heartbeat of the client expired
+const sqlStaleLockHolders = `SELECT pid FROM pg_locks
+WHERE locktype = 'advisory' AND classid = $1 AND objid = $2 AND objsubid = 2 AND granted
+	AND EXISTS(SELECT 1 FROM timetable.client_lease WHERE client_name = $3 AND expires < now())`
+
+// HAMode allows several clients to share the client name: the one holding the lock is the leader executing
+// chains, others are standbys polling the lock every HAHeartbeat and taking over once the leader dies
+var HAMode bool
+
+// HAHeartbeat is the period the leader renews its lease and standbys try to obtain the lock in HA mode
+const HAHeartbeat = 2 * time.Second
+
+// RenewClientLock renews the heartbeat of the advisory lock or the lease in PgBouncer mode.
+// Returns false if the lease was lost and the client name must be locked again
+func RenewClientLock(ctx context.Context) bool {
+	if PgBouncerMode {
+		return TryLockClientName(ctx)
+	}
+	clientHeartbeat(ctx)
+	return true
+}
+
+// clientHeartbeat renews the lease row of the client holding the advisory lock
+func clientHeartbeat(ctx context.Context) {
+	if !Enabled(FeatureClientLeases) {
+		return
+	}
+	if _, err := ConfigDb.ExecContext(ctx, SchemaSQL(sqlClientHeartbeat), ClientName, hostname(), os.Getpid(), leaseTTL()); err != nil {
+		LogToDB("ERROR", "Cannot renew client heartbeat: ", err)
+		return
+	}
+	joinClientGroup(ctx)
+}
+
+// takeOverStaleLock terminates sessions holding the client name lock if the client stopped renewing its
+// heartbeat, e.g. the connection of the crashed client is still alive. Returns true if some were terminated
+func takeOverStaleLock(ctx context.Context, lockID uint32) bool {
+	if !Enabled(FeatureClientLeases) {
+		return false
+	}
+	var pids []int
+	if err := ConfigDb.SelectContext(ctx, &pids, SchemaSQL(sqlStaleLockHolders), AppID, lockID, ClientName); err != nil {
+		LogToDB("ERROR", "Cannot check stale client name lock: ", err)
+		return false
+	}
+	for _, pid := range pids {
+		LogToDB("LOG", fmt.Sprintf("Terminating session %d holding the lock of the stale client '%s'", pid, ClientName))
+		if _, err := ConfigDb.ExecContext(ctx, "SELECT pg_terminate_backend($1)", pid); err != nil {
+			LogToDB("ERROR", "Cannot terminate the session holding stale client name lock: ", err)
+			return false
+		}
+	}
+	if len(pids) > 0 {
+		// the lock is released once the terminated backend exits
+		time.Sleep(time.Second)
+	}
+	return len(pids) > 0
+}
+
+// releaseClientLock releases the client name lock obtained by TryLockClientName
+func releaseClientLock() (err error) {
+	if !PgBouncerMode {
+		if _, err = ConfigDb.Exec("SELECT pg_advisory_unlock_all()"); err != nil || !Enabled(FeatureClientLeases) {
+			return
+		}
+	}
+	_, err = ConfigDb.Exec(SchemaSQL("DELETE FROM timetable.client_lease WHERE client_name = $1 AND hostname = $2 AND pid = $3"),
+		ClientName, hostname(), os.Getpid())
+	return
+}
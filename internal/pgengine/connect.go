@@ -0,0 +1,238 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/cmdparser"
+	"github.com/cybertec-postgresql/pg_timetable/internal/secrets"
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+// quoteConnValue quotes the value of the keyword/value connection string
+func quoteConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// connHosts returns the hosts of the list with the ports, the single port is used for every host
+func connHosts(cmdOpts cmdparser.CmdOptions) (hosts []string, ports []string, err error) {
+	hosts = strings.Split(cmdOpts.Host, ",")
+	ports = strings.Split(cmdOpts.Port, ",")
+	if len(ports) == 1 {
+		for len(ports) < len(hosts) {
+			ports = append(ports, ports[0])
+		}
+	}
+	if len(ports) != len(hosts) {
+		return nil, nil, fmt.Errorf("Could not match %d port numbers to %d hosts", len(ports), len(hosts))
+	}
+	return
+}
+
+// connString returns the keyword/value connection string for the host and port
+func connString(cmdOpts cmdparser.CmdOptions, host, port string) string {
+	params := [][2]string{
+		{"application_name", "pg_timetable"},
+		{"host", host},
+		{"port", port},
+		{"dbname", cmdOpts.Dbname},
+		{"sslmode", cmdOpts.SSLMode},
+		{"user", cmdOpts.User},
+		{"password", cmdOpts.Password},
+		{"sslcert", cmdOpts.SSLCert},
+		{"sslkey", cmdOpts.SSLKey},
+		{"sslrootcert", cmdOpts.SSLRootCert},
+	}
+	var s []string
+	for i, p := range params {
+		// optional SSL files are omitted, so the library defaults apply
+		if i < 7 || p[1] != "" {
+			s = append(s, p[0]+"="+quoteConnValue(p[1]))
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// poolConnString returns the connection string of the native pool listing all the hosts
+func poolConnString(cmdOpts cmdparser.CmdOptions) string {
+	connstr := connString(cmdOpts, cmdOpts.Host, cmdOpts.Port)
+	if cmdOpts.TargetSessionAttrs == "read-write" {
+		connstr += " target_session_attrs='read-write'"
+	}
+	if cmdOpts.PgBouncer {
+		// named prepared statements do not survive the transaction behind PgBouncer
+		connstr += " prefer_simple_protocol='true'"
+	}
+	return connstr
+}
+
+// pqConnString returns the connection string of lib/pq connections to the host. Behind PgBouncer
+// parameters are sent along with the statement, so it's executed in one round trip
+func pqConnString(cmdOpts cmdparser.CmdOptions, host, port string) string {
+	connstr := connString(cmdOpts, host, port)
+	if cmdOpts.PgBouncer {
+		connstr += " binary_parameters='yes'"
+	}
+	return connstr
+}
+
+// passwordFunc returns the password to connect to the host, it is called for every new connection
+// within the context of the connection attempt
+type passwordFunc func(ctx context.Context, host, port string) (string, error)
+
+// newPasswordFunc returns nil if the static password is used, otherwise the function obtaining
+// IAM token or resolving the secret reference for every new connection, so rotated passwords are picked up
+func newPasswordFunc(cmdOpts cmdparser.CmdOptions) (passwordFunc, error) {
+	switch {
+	case cmdOpts.Auth == "rds-iam":
+		return newRDSPasswordFunc(cmdOpts)
+	case cmdOpts.PasswordFrom != "":
+		if !secrets.IsReference(cmdOpts.PasswordFrom) {
+			return nil, errors.New("Unknown secret reference scheme of the password: " + cmdOpts.PasswordFrom)
+		}
+		return func(ctx context.Context, host, port string) (string, error) {
+			return secrets.Resolve(ctx, cmdOpts.PasswordFrom)
+		}, nil
+	}
+	return nil, nil
+}
+
+// errSessionAttrs is returned for the connection not matching target session attributes
+var errSessionAttrs = errors.New("Session does not match target session attributes")
+
+// matchesSessionAttrs checks if the read only state of the session satisfies target session attributes
+func matchesSessionAttrs(attrs string, readOnly string) bool {
+	switch attrs {
+	case "read-write":
+		return readOnly != "on"
+	case "read-only":
+		return readOnly == "on"
+	}
+	return true
+}
+
+// validatePoolConn rejects native connections not matching target session attributes
+func validatePoolConn(attrs string) pgconn.ValidateConnectFunc {
+	return func(ctx context.Context, pgConn *pgconn.PgConn) error {
+		result := pgConn.ExecParams(ctx, "SHOW transaction_read_only", nil, nil, nil, nil).Read()
+		if result.Err != nil {
+			return result.Err
+		}
+		if !matchesSessionAttrs(attrs, string(result.Rows[0][0])) {
+			return errSessionAttrs
+		}
+		return nil
+	}
+}
+
+// multiHostConnector tries hosts in order the same way as libpq does and returns the first connection
+// matching target session attributes. With IAM authentication the fresh token is generated for every connection
+type multiHostConnector struct {
+	cmdOpts  cmdparser.CmdOptions
+	hosts    []string
+	ports    []string
+	attrs    string
+	password passwordFunc
+}
+
+func newMultiHostConnector(cmdOpts cmdparser.CmdOptions) (driver.Connector, string, error) {
+	hosts, ports, err := connHosts(cmdOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	password, err := newPasswordFunc(cmdOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	if password != nil {
+		cmdOpts.Password = ""
+	}
+	c := &multiHostConnector{cmdOpts: cmdOpts, hosts: hosts, ports: ports, attrs: cmdOpts.TargetSessionAttrs, password: password}
+	var connstrs []string
+	for i, host := range hosts {
+		connstr := pqConnString(cmdOpts, host, ports[i])
+		// check the connection string once, so errors are reported before connecting
+		if _, err := pq.NewConnector(connstr); err != nil {
+			return nil, "", err
+		}
+		connstrs = append(connstrs, connstr)
+	}
+	return c, strings.Join(connstrs, "; "), nil
+}
+
+// connect opens the connection to the host of the list
+func (c *multiHostConnector) connect(ctx context.Context, i int) (driver.Conn, error) {
+	cmdOpts := c.cmdOpts
+	if c.password != nil {
+		password, err := c.password(ctx, c.hosts[i], c.ports[i])
+		if err != nil {
+			return nil, err
+		}
+		cmdOpts.Password = password
+	}
+	connector, err := pq.NewConnector(pqConnString(cmdOpts, c.hosts[i], c.ports[i]))
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Connect returns the connection to the first suitable host or the error of the last one
+func (c *multiHostConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var lastErr error
+	for i := range c.hosts {
+		conn, err := c.connect(ctx, i)
+		if err == nil {
+			if err = c.checkSession(ctx, conn); err == nil {
+				return conn, nil
+			}
+			_ = conn.Close()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// checkSession verifies target session attributes of the connection
+func (c *multiHostConnector) checkSession(ctx context.Context, conn driver.Conn) error {
+	if c.attrs == "" || c.attrs == "any" {
+		return nil
+	}
+	queryer, ok := conn.(driver.QueryerContext)
+	if !ok {
+		return errSessionAttrs
+	}
+	rows, err := queryer.QueryContext(ctx, "SHOW transaction_read_only", nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			return errSessionAttrs
+		}
+		return err
+	}
+	readOnly := fmt.Sprint(dest[0])
+	if b, ok := dest[0].([]byte); ok {
+		readOnly = string(b)
+	}
+	if !matchesSessionAttrs(c.attrs, readOnly) {
+		return errSessionAttrs
+	}
+	return nil
+}
+
+// Driver returns lib/pq driver
+func (c *multiHostConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
@@ -0,0 +1,107 @@
+package pgengine
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/cmdparser"
+	"github.com/cybertec-postgresql/pg_timetable/internal/sigv4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnString(t *testing.T) {
+	cmdOpts := cmdparser.CmdOptions{Host: "db1,db2", Port: "5433", Dbname: "timetable", SSLMode: "verify-full",
+		User: "scheduler", Password: `it's\secret`, SSLRootCert: "/etc/ca.pem"}
+	hosts, ports, err := connHosts(cmdOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db1", "db2"}, hosts)
+	assert.Equal(t, []string{"5433", "5433"}, ports, "Single port should be used for every host")
+	assert.Equal(t, `application_name='pg_timetable' host='db2' port='5433' dbname='timetable' sslmode='verify-full' `+
+		`user='scheduler' password='it\'s\\secret' sslrootcert='/etc/ca.pem'`, connString(cmdOpts, hosts[1], ports[1]))
+
+	cmdOpts.Port = "5433,5434,5435"
+	_, _, err = connHosts(cmdOpts)
+	assert.Error(t, err, "Ports should match hosts")
+
+	cmdOpts.Port = "5433,5434"
+	cmdOpts.TargetSessionAttrs = "read-write"
+	assert.Contains(t, poolConnString(cmdOpts), "host='db1,db2' port='5433,5434'")
+	assert.Contains(t, poolConnString(cmdOpts), "target_session_attrs='read-write'")
+}
+
+func TestPgBouncerConnString(t *testing.T) {
+	cmdOpts := cmdparser.CmdOptions{Host: "pgbouncer", Port: "6432", Dbname: "timetable", SSLMode: "disable", User: "scheduler"}
+	assert.NotContains(t, pqConnString(cmdOpts, "pgbouncer", "6432"), "binary_parameters")
+	assert.NotContains(t, poolConnString(cmdOpts), "prefer_simple_protocol")
+	cmdOpts.PgBouncer = true
+	assert.Contains(t, pqConnString(cmdOpts, "pgbouncer", "6432"), "binary_parameters='yes'",
+		"lib/pq should send parameters along with the statement")
+	assert.Contains(t, poolConnString(cmdOpts), "prefer_simple_protocol='true'",
+		"pgx should not use named prepared statements")
+	assert.NotContains(t, poolConnString(cmdOpts), "binary_parameters", "pgx would pass unknown keyword to the server")
+}
+
+func TestMatchesSessionAttrs(t *testing.T) {
+	assert.True(t, matchesSessionAttrs("any", "on"))
+	assert.True(t, matchesSessionAttrs("read-write", "off"))
+	assert.False(t, matchesSessionAttrs("read-write", "on"))
+	assert.True(t, matchesSessionAttrs("read-only", "on"))
+	assert.False(t, matchesSessionAttrs("read-only", "off"))
+}
+
+func TestRDSAuthToken(t *testing.T) {
+	assert.Equal(t, "eu-west-1", rdsRegion("db.abc123.eu-west-1.rds.amazonaws.com"))
+	assert.Equal(t, "", rdsRegion("localhost"))
+
+	creds := sigv4.Credentials{AccessKey: "AKIDEXAMPLE", SecretKey: "secret"}
+	token := rdsAuthToken("db.abc123.eu-west-1.rds.amazonaws.com", "5432", "eu-west-1", "scheduler", creds,
+		time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC))
+	assert.True(t, strings.HasPrefix(token, "db.abc123.eu-west-1.rds.amazonaws.com:5432/?"), "Token should not contain scheme")
+	assert.Contains(t, token, "Action=connect")
+	assert.Contains(t, token, "DBUser=scheduler")
+	assert.Contains(t, token, "X-Amz-Credential=AKIDEXAMPLE%2F20210501%2Feu-west-1%2Frds-db%2Faws4_request")
+	assert.Contains(t, token, "X-Amz-Expires=900")
+}
+
+func TestNewPasswordFunc(t *testing.T) {
+	cmdOpts := cmdparser.CmdOptions{Auth: "password", User: "scheduler", SSLMode: "disable"}
+	password, err := newPasswordFunc(cmdOpts)
+	assert.NoError(t, err)
+	assert.Nil(t, password, "Static password should be used")
+
+	cmdOpts.Auth = "rds-iam"
+	_, err = newPasswordFunc(cmdOpts)
+	assert.Error(t, err, "SSL is required")
+
+	cmdOpts.SSLMode = "require"
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Unsetenv("AWS_REGION")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	password, err = newPasswordFunc(cmdOpts)
+	assert.NoError(t, err)
+	token, err := password(context.Background(), "db.abc123.eu-west-1.rds.amazonaws.com", "5432")
+	assert.NoError(t, err)
+	assert.Contains(t, token, "eu-west-1%2Frds-db")
+	_, err = password(context.Background(), "localhost", "5432")
+	assert.Error(t, err, "Region cannot be determined")
+}
+
+func TestPasswordFromSecret(t *testing.T) {
+	cmdOpts := cmdparser.CmdOptions{Auth: "password", PasswordFrom: "unknown:password"}
+	_, err := newPasswordFunc(cmdOpts)
+	assert.Error(t, err, "Unknown scheme should be rejected")
+
+	os.Setenv("PGTT_TEST_DBPASSWORD", "rotated")
+	defer os.Unsetenv("PGTT_TEST_DBPASSWORD")
+	cmdOpts.PasswordFrom = "env:PGTT_TEST_DBPASSWORD"
+	password, err := newPasswordFunc(cmdOpts)
+	assert.NoError(t, err)
+	value, err := password(context.Background(), "localhost", "5432")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", value)
+}
@@ -0,0 +1,73 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Constraints chains may wait on before the execution
+const (
+	WaitMaxInstances = "MAX_INSTANCES"
+	WaitExclusive    = "EXCLUSIVE"
+	WaitMutex        = "MUTEX"
+)
+
+// ChainContention summarizes waits of the chain on the constraint during the report period
+type ChainContention struct {
+	ChainConfig int    `db:"chain_execution_config" json:"chain_execution_config"`
+	ChainName   string `db:"chain_name" json:"chain_name"`
+	Constraint  string `db:"reason" json:"constraint"`
+	Waits       int    `db:"waits" json:"waits"`
+	// in seconds
+	TotalWait float64 `db:"total_wait" json:"total_wait"`
+	MaxWait   float64 `db:"max_wait" json:"max_wait"`
+	// chains running while the chain waited
+	ConcurrentChains pq.StringArray `db:"concurrent_chains" json:"concurrent_chains"`
+	Tenant           sql.NullString `db:"tenant" json:"-"`
+}
+
+// RecordChainWait saves the time the chain waited on the constraint before the execution
+func RecordChainWait(ctx context.Context, chainConfigID int, reason string, started time.Time, finished time.Time) {
+	if !Enabled(FeatureContention) {
+		return
+	}
+	_, err := ConfigDb.ExecContext(ctx, SchemaSQL(`INSERT INTO timetable.chain_wait
+(chain_execution_config, reason, client_name, started, finished) VALUES ($1, $2, $3, $4, $5)`),
+		chainConfigID, reason, ClientName, started, finished)
+	if err != nil {
+		LogToDB("ERROR", "Cannot save chain wait: ", err)
+	}
+}
+
+// runs are spans of chain runs reconstructed from status updates, other chains running during the wait
+// are reported as concurrent, thus schedules fighting each other can be identified
+const sqlContentionReport = `WITH waits AS (
+	SELECT * FROM timetable.chain_wait WHERE finished >= now() - $1::interval
+), runs AS (
+	SELECT chain_execution_config, min(COALESCE(started, last_status_update)) AS started, max(last_status_update) AS finished
+	FROM timetable.run_status WHERE last_status_update >= now() - $1::interval
+	GROUP BY COALESCE(start_status, run_status), chain_execution_config
+)
+SELECT w.chain_execution_config, COALESCE(c.chain_name, '') AS chain_name, c.tenant, w.reason, count(*) AS waits,
+	sum(extract(epoch FROM w.finished - w.started)) AS total_wait,
+	max(extract(epoch FROM w.finished - w.started)) AS max_wait,
+	ARRAY(SELECT DISTINCT rc.chain_name FROM waits w2
+		JOIN runs r ON r.started < w2.finished AND r.finished > w2.started
+		JOIN timetable.chain_execution_config rc ON rc.chain_execution_config = r.chain_execution_config
+		WHERE w2.chain_execution_config = w.chain_execution_config AND w2.reason = w.reason
+		ORDER BY 1) AS concurrent_chains
+FROM waits w LEFT JOIN timetable.chain_execution_config c USING (chain_execution_config)
+GROUP BY w.chain_execution_config, c.chain_name, c.tenant, w.reason
+ORDER BY total_wait DESC`
+
+// GetContentionReport returns waits of chains on constraints during the period specified as interval, e.g. '7 days'
+func GetContentionReport(ctx context.Context, period string) (report []ChainContention, err error) {
+	if !Enabled(FeatureContention) {
+		return nil, ErrFeatureDisabled
+	}
+	err = ConfigDb.SelectContext(ctx, &report, SchemaSQL(sqlContentionReport), period)
+	return
+}
@@ -0,0 +1,109 @@
+package pgengine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
+)
+
+// maxDashboardFailures limits failed runs of the last day shown on the dashboard
+const maxDashboardFailures = 20
+
+// DashboardChain is the chain shown on the dashboard, NextRun is calculated by the caller from the schedule
+type DashboardChain struct {
+	ID             int        `db:"chain_execution_config" json:"chain_execution_config"`
+	ChainName      string     `db:"chain_name" json:"chain_name"`
+	Live           bool       `db:"live" json:"live"`
+	RunAt          *string    `db:"run_at" json:"run_at"`
+	ScheduleEngine *string    `db:"schedule_engine" json:"schedule_engine"`
+	Schedule       *string    `db:"schedule" json:"schedule"`
+	NextRun        *time.Time `db:"-" json:"next_run"`
+}
+
+// DashboardRun is the running or failed chain run shown on the dashboard
+type DashboardRun struct {
+	RunStatusID int        `db:"run_status" json:"run_status"`
+	ChainConfig int        `db:"chain_execution_config" json:"chain_execution_config"`
+	ChainName   string     `db:"chain_name" json:"chain_name"`
+	ClientName  string     `db:"client_name" json:"client_name"`
+	Status      string     `db:"execution_status" json:"status"`
+	Started     time.Time  `db:"started" json:"started"`
+	Finished    *time.Time `db:"finished" json:"finished"`
+	Elapsed     float64    `db:"elapsed" json:"elapsed"` // in seconds
+}
+
+// ParseSchedule returns the calendar schedule of the chain, nil if the schedule is not calendar based,
+// e.g. @every, @after and @reboot
+func (c DashboardChain) ParseSchedule() (schedule.Schedule, error) {
+	if c.ScheduleEngine != nil {
+		if c.Schedule == nil {
+			return nil, nil
+		}
+		return schedule.Parse(*c.ScheduleEngine, *c.Schedule)
+	}
+	if c.RunAt == nil || strings.HasPrefix(*c.RunAt, "@") {
+		return nil, nil
+	}
+	return schedule.ParseCron(*c.RunAt)
+}
+
+// Next returns the next fire time of the live chain, nil if the chain is paused or its schedule is not calendar based
+func (c DashboardChain) Next(now time.Time) *time.Time {
+	if !c.Live {
+		return nil
+	}
+	s, err := c.ParseSchedule()
+	if s == nil || err != nil {
+		return nil
+	}
+	if t := s.Next(now); !t.IsZero() {
+		return &t
+	}
+	return nil
+}
+
+// Dashboard contains chains, currently running chains and failures of the last day
+type Dashboard struct {
+	Chains   []DashboardChain `json:"chains"`
+	Running  []DashboardRun   `json:"running"`
+	Failures []DashboardRun   `json:"failures"`
+}
+
+const sqlDashboardChains = `SELECT chain_execution_config, chain_name, COALESCE(live, false) AS live,
+run_at, schedule_engine, schedule
+FROM timetable.chain_execution_config WHERE true`
+
+const sqlDashboardRunning = `SELECT s.run_status, s.chain_execution_config, c.chain_name, s.client_name,
+s.execution_status, s.started, NULL::timestamptz AS finished, EXTRACT(EPOCH FROM now() - s.started)::float8 AS elapsed
+FROM timetable.run_status s JOIN timetable.chain_execution_config c USING (chain_execution_config)
+WHERE s.start_status IS NULL AND s.execution_status = 'STARTED' AND NOT EXISTS (
+	SELECT 1 FROM timetable.run_status f
+	WHERE f.start_status = s.run_status AND f.execution_status IN ('CHAIN_DONE', 'CHAIN_FAILED', 'DEAD'))`
+
+const sqlDashboardFailures = `SELECT s.run_status, s.chain_execution_config, c.chain_name, s.client_name,
+f.execution_status, s.started, f.last_status_update AS finished,
+EXTRACT(EPOCH FROM f.last_status_update - s.started)::float8 AS elapsed
+FROM timetable.run_status f JOIN timetable.run_status s ON s.run_status = f.start_status
+JOIN timetable.chain_execution_config c ON c.chain_execution_config = s.chain_execution_config
+WHERE f.execution_status IN ('CHAIN_FAILED', 'DEAD') AND f.last_status_update > now() - '1 day'::interval`
+
+// GetDashboard returns chains and runs of the tenant, all chains if tenant is empty
+func GetDashboard(ctx context.Context, tenant string) (*Dashboard, error) {
+	d := &Dashboard{Chains: []DashboardChain{}, Running: []DashboardRun{}, Failures: []DashboardRun{}}
+	filter := fmt.Sprintf(tenantFilter, 1)
+	if err := ConfigDb.SelectContext(ctx, &d.Chains, SchemaSQL(sqlDashboardChains)+filter+" ORDER BY chain_name", tenant); err != nil {
+		return nil, err
+	}
+	if err := ConfigDb.SelectContext(ctx, &d.Running, SchemaSQL(sqlDashboardRunning)+filter+" ORDER BY s.started", tenant); err != nil {
+		return nil, err
+	}
+	err := ConfigDb.SelectContext(ctx, &d.Failures, SchemaSQL(sqlDashboardFailures)+filter+
+		fmt.Sprintf(" ORDER BY f.last_status_update DESC LIMIT %d", maxDashboardFailures), tenant)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
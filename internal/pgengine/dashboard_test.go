@@ -0,0 +1,30 @@
+package pgengine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboardChainNext(t *testing.T) {
+	now := time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC)
+	hourly, every := "0 * * * *", "@every 10 minutes"
+	next := DashboardChain{Live: true, RunAt: &hourly}.Next(now)
+	if assert.NotNil(t, next) {
+		assert.Equal(t, time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC), *next)
+	}
+	assert.Nil(t, DashboardChain{Live: false, RunAt: &hourly}.Next(now), "Paused chains have no next run")
+	assert.Nil(t, DashboardChain{Live: true, RunAt: &every}.Next(now), "Interval chains have no next run")
+	engine := "cron"
+	assert.NotNil(t, DashboardChain{Live: true, ScheduleEngine: &engine, Schedule: &hourly}.Next(now))
+
+	invalid, unknown := "0 25 * * *", "calendar"
+	_, err := DashboardChain{ScheduleEngine: &engine, Schedule: &invalid}.ParseSchedule()
+	assert.Error(t, err, "Invalid expression should fail")
+	_, err = DashboardChain{ScheduleEngine: &unknown, Schedule: &hourly}.ParseSchedule()
+	assert.Error(t, err, "Unknown engine should fail")
+	s, err := DashboardChain{RunAt: &every}.ParseSchedule()
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+}
@@ -0,0 +1,41 @@
+package pgengine
+
+import (
+	"context"
+	"time"
+)
+
+// LostClient is the client which stopped renewing its heartbeat without releasing the client name
+type LostClient struct {
+	ClientName string    `db:"client_name"`
+	Hostname   string    `db:"hostname"`
+	PID        int       `db:"pid"`
+	Heartbeat  time.Time `db:"heartbeat"`
+	DeadRuns   int64     `db:"-"` // unfinished runs of the client marked as DEAD
+}
+
+// sqlMarkLostClients marks clients with the expired heartbeat as lost. Every lost client is returned once,
+// by one of living clients, until it renews its heartbeat again
+const sqlMarkLostClients = `UPDATE timetable.client_lease SET lost = now()
+WHERE expires < now() AND lost IS NULL AND client_name <> $1
+RETURNING client_name, COALESCE(hostname, '') AS hostname, pid, heartbeat`
+
+// MarkLostClients marks clients which have not checked in before their heartbeat expired as lost, and their
+// unfinished runs as DEAD the same way FixSchedulerCrash does on the client start
+func MarkLostClients(ctx context.Context) ([]LostClient, error) {
+	if !Enabled(FeatureClientLeases) {
+		return nil, nil
+	}
+	var lost []LostClient
+	if err := ConfigDb.SelectContext(ctx, &lost, SchemaSQL(sqlMarkLostClients), ClientName); err != nil {
+		return nil, err
+	}
+	for i := range lost {
+		n, err := fixClientRuns(ctx, lost[i].ClientName)
+		if err != nil {
+			return lost, err
+		}
+		lost[i].DeadRuns = n
+	}
+	return lost, nil
+}
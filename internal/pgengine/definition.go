@@ -0,0 +1,155 @@
+package pgengine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/executor"
+	"gopkg.in/yaml.v3"
+)
+
+// TaskDefinition describes chain element in the chain definition file
+type TaskDefinition struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind,omitempty"`
+	Script      string            `json:"script,omitempty"`
+	Parameters  []json.RawMessage `json:"parameters,omitempty"`
+	IgnoreError bool              `json:"ignore_error,omitempty"`
+	Autonomous  bool              `json:"autonomous,omitempty"`
+	OnCommit    bool              `json:"on_commit,omitempty"`
+	WorkDir     string            `json:"workdir,omitempty"`
+	Umask       string            `json:"umask,omitempty"`
+	Stdin       string            `json:"stdin,omitempty"`
+	ConfirmDrop bool              `json:"confirm_drop,omitempty"`
+}
+
+// ChainDefinition describes chain with its elements in the chain definition file, optional fields are omitted
+// when definitions are generated
+type ChainDefinition struct {
+	Name               string           `json:"name"`
+	RunAt              string           `json:"run_at,omitempty"`
+	Live               bool             `json:"live,omitempty"`
+	MaxInstances       int              `json:"max_instances,omitempty"`
+	ExclusiveExecution bool             `json:"exclusive_execution,omitempty"`
+	ClientName         string           `json:"client_name,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	RunbookURL         string           `json:"runbook_url,omitempty"`
+	Owner              string           `json:"owner,omitempty"`
+	Tags               []string         `json:"tags,omitempty"`
+	Tasks              []TaskDefinition `json:"tasks"`
+	Source             string           `json:"-"` // the file name the chain is read from
+}
+
+// ParamValues returns parameters in the same form as they are stored in timetable.chain_execution_parameters
+func (task TaskDefinition) ParamValues() []string {
+	values := make([]string, len(task.Parameters))
+	for i, p := range task.Parameters {
+		values[i] = string(p)
+	}
+	return values
+}
+
+// ReadChainDefinitions reads and validates chain definitions from the JSON or YAML file. The YAML file may contain
+// the list of chains or the single chain
+func ReadChainDefinitions(filename string) ([]ChainDefinition, error) {
+	var chains []ChainDefinition
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, err
+		}
+	}
+	if err = json.Unmarshal(data, &chains); err != nil {
+		return nil, err
+	}
+	for i, chain := range chains {
+		if chain.Name == "" {
+			return nil, errors.New("Chain name cannot be empty")
+		}
+		if len(chain.Tasks) == 0 {
+			return nil, fmt.Errorf("Chain %s has no tasks", chain.Name)
+		}
+		chains[i].Source = filepath.Base(filename)
+		for j, task := range chain.Tasks {
+			switch task.Kind {
+			case "":
+				chains[i].Tasks[j].Kind = "SQL"
+			case "BUILTIN":
+				// builtin tasks are referenced by name, their base tasks use the name as script
+				chains[i].Tasks[j].Script = task.Name
+			case "SQL", "SHELL", "PROGRAM", "DOCKER", "K8S_JOB", "HTTP":
+			default:
+				if _, ok := executor.Lookup(task.Kind); ok {
+					continue
+				}
+				return nil, fmt.Errorf("Unknown task kind %s for task %s", task.Kind, task.Name)
+			}
+		}
+	}
+	return chains, nil
+}
+
+// yamlToJSON converts the YAML document to JSON, so definitions are decoded the same way as from JSON files
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc.(map[string]interface{}); ok {
+		doc = []interface{}{doc}
+	}
+	return json.Marshal(doc)
+}
+
+// ReadChainDefinitionsDir reads chain definitions from all JSON and YAML files of the directory. Chain names must
+// be unique and tasks with the same name must have the same kind and script, since base tasks are shared by name
+func ReadChainDefinitionsDir(dir string) ([]ChainDefinition, error) {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		// the wrong path must not delete all imported chains
+		return nil, fmt.Errorf("No chain definition files found in %s", dir)
+	}
+	sort.Strings(files)
+	var chains []ChainDefinition
+	chainSources := map[string]string{}
+	tasks := map[string]TaskDefinition{}
+	for _, file := range files {
+		defs, err := ReadChainDefinitions(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, chain := range defs {
+			if source, ok := chainSources[chain.Name]; ok {
+				return nil, fmt.Errorf("Chain %s is defined in %s and %s", chain.Name, source, chain.Source)
+			}
+			chainSources[chain.Name] = chain.Source
+			for _, task := range chain.Tasks {
+				if task.Name == "" {
+					return nil, fmt.Errorf("Task name cannot be empty in chain %s", chain.Name)
+				}
+				if prev, ok := tasks[task.Name]; ok && (prev.Kind != task.Kind || prev.Script != task.Script) {
+					return nil, fmt.Errorf("Task %s is defined with different kind or script", task.Name)
+				}
+				tasks[task.Name] = task
+			}
+		}
+		chains = append(chains, defs...)
+	}
+	return chains, nil
+}
@@ -0,0 +1,71 @@
+package pgengine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChainDefinitionsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chains")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, err = ReadChainDefinitionsDir(dir)
+	assert.Error(t, err, "Empty directory should fail")
+
+	write := func(name string, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("nightly.yaml", `
+name: nightly
+run_at: "0 1 * * *"
+live: true
+tasks:
+  - name: vacuum
+    script: VACUUM ANALYZE
+  - name: NoOp
+    kind: BUILTIN
+    parameters:
+      - {channel: ops, retries: 3}
+`)
+	write("reports.json", `[{"name": "reports", "tasks": [{"name": "vacuum", "script": "VACUUM ANALYZE"}]}]`)
+	write("README.md", "not a definition")
+	chains, err := ReadChainDefinitionsDir(dir)
+	require.NoError(t, err)
+	require.Len(t, chains, 2)
+	nightly := chains[0]
+	assert.Equal(t, "nightly", nightly.Name)
+	assert.Equal(t, "nightly.yaml", nightly.Source)
+	assert.True(t, nightly.Live)
+	assert.Equal(t, "SQL", nightly.Tasks[0].Kind, "SQL kind should be used by default")
+	assert.Equal(t, "NoOp", nightly.Tasks[1].Script, "Builtin task name should be used as script")
+	assert.JSONEq(t, `{"channel": "ops", "retries": 3}`, nightly.Tasks[1].ParamValues()[0])
+	assert.Equal(t, "reports.json", chains[1].Source)
+
+	write("other.yml", `[{name: reports, tasks: [{name: cleanup, script: "DELETE FROM log"}]}]`)
+	_, err = ReadChainDefinitionsDir(dir)
+	assert.Error(t, err, "Duplicated chain names should fail")
+
+	write("other.yml", `[{name: weekly, tasks: [{name: vacuum, script: VACUUM FULL}]}]`)
+	_, err = ReadChainDefinitionsDir(dir)
+	assert.Error(t, err, "Tasks with the same name and different script should fail")
+}
+
+func TestSameChainElements(t *testing.T) {
+	elements := []importedElement{{ChainID: 10, TaskName: "vacuum", Kind: "SQL", Script: "VACUUM"}}
+	params := map[int][]string{10: {`{"a": 1, "b": [1, 2]}`}}
+	tasks := []TaskDefinition{{Name: "vacuum", Kind: "SQL", Script: "VACUUM", Parameters: []json.RawMessage{
+		json.RawMessage(`{"b":[1,2],"a":1}`)}}}
+	assert.True(t, sameChainElements(elements, params, tasks), "Parameters should be compared regardless of formatting")
+	tasks[0].IgnoreError = true
+	assert.False(t, sameChainElements(elements, params, tasks))
+	tasks[0].IgnoreError = false
+	tasks[0].Parameters = nil
+	assert.False(t, sameChainElements(elements, params, tasks))
+	assert.False(t, sameChainElements(nil, nil, tasks))
+}
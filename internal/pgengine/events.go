@@ -0,0 +1,30 @@
+package pgengine
+
+import (
+	"encoding/json"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+)
+
+// LogEvents subscriber logs every scheduler event with DEBUG level
+var LogEvents = events.SubscriberFunc(func(e events.Event) {
+	data, _ := json.Marshal(e)
+	LogToDB("DEBUG", "Event: ", string(data))
+})
+
+// NotifyEvents returns subscriber sending every scheduler event as JSON payload to the NOTIFY channel,
+// so external listeners can react on chain runs without polling run_status
+func NotifyEvents(channel string) events.Subscriber {
+	return events.SubscriberFunc(func(e events.Event) {
+		if ConfigDb == nil {
+			return
+		}
+		data, err := json.Marshal(e)
+		if err == nil {
+			_, err = ConfigDb.Exec("SELECT pg_notify($1, $2)", channel, string(data))
+		}
+		if err != nil {
+			LogToDB("ERROR", "Cannot notify event: ", err)
+		}
+	})
+}
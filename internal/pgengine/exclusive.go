@@ -0,0 +1,34 @@
+package pgengine
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ClusterExclusive enforces exclusive_execution across all clients sharing the configuration schema: every chain
+// transaction holds the shared advisory lock, and the transaction of the exclusive chain holds it exclusively
+var ClusterExclusive bool
+
+// exclusiveLockID is the key of the advisory lock shared by chain runs, it's derived the same way as keys of
+// client name locks, so it depends on the schema name
+func exclusiveLockID() uint32 {
+	return clientLockID("exclusive_execution")
+}
+
+// LockExclusiveExecution obtains the transaction level advisory lock of the chain run, shared for ordinary chains
+// and exclusive for chains with exclusive_execution. The lock is released with the transaction, so it works in
+// PgBouncer mode too. Returns true if the run had to wait for chains running on other clients
+func LockExclusiveExecution(ctx context.Context, tx *sqlx.Tx, exclusive bool) (waited bool, err error) {
+	tryLock, lock := "pg_try_advisory_xact_lock_shared", "pg_advisory_xact_lock_shared"
+	if exclusive {
+		tryLock, lock = "pg_try_advisory_xact_lock", "pg_advisory_xact_lock"
+	}
+	var locked bool
+	if err = tx.GetContext(ctx, &locked, "SELECT "+tryLock+"($1, $2)", AppID, exclusiveLockID()); err != nil || locked {
+		return false, err
+	}
+	LogToDB("DEBUG", "Waiting for exclusive chains running on other clients")
+	_, err = tx.ExecContext(ctx, "SELECT "+lock+"($1, $2)", AppID, exclusiveLockID())
+	return true, err
+}
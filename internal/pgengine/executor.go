@@ -0,0 +1,25 @@
+package pgengine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// RegisterTaskKinds adds task kinds of executor plugins to timetable.task_kind, so base tasks of these kinds can be
+// created. Values are never removed from the enum, thus tasks of unloaded plugins fail with the unknown kind error
+func RegisterTaskKinds(ctx context.Context, kinds []string) bool {
+	for _, kind := range kinds {
+		// ALTER TYPE ... ADD VALUE cannot be executed with parameters
+		sql := fmt.Sprintf(SchemaSQL("ALTER TYPE timetable.task_kind ADD VALUE IF NOT EXISTS %s"), pq.QuoteLiteral(kind))
+		if _, err := ConfigDb.ExecContext(ctx, sql); err != nil {
+			LogToDB("PANIC", fmt.Sprintf("Cannot register task kind %s: %s", kind, err))
+			return false
+		}
+	}
+	if len(kinds) > 0 {
+		LogToDB("LOG", "Registered task kinds of executor plugins: ", kinds)
+	}
+	return true
+}
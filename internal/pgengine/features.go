@@ -0,0 +1,199 @@
+package pgengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Features of the scheduler depending on schema objects
+const (
+	FeatureCore            = "core"
+	FeatureQuotas          = "tenant quotas"
+	FeatureResume          = "resuming runs"
+	FeatureRunSummary      = "run summaries"
+	FeatureAffinity        = "chain affinity"
+	FeatureWindows         = "execution windows"
+	FeatureContention      = "contention report"
+	FeatureArtifacts       = "run artifacts"
+	FeatureClientResources = "client resources"
+	FeatureSinks           = "result sinks"
+	FeatureShellDisabled   = "shell disabled actions"
+	FeatureSecrets         = "secret parameters"
+	FeatureTaskSettings    = "task settings"
+	FeatureRunAsRole       = "task roles"
+	FeatureClientLeases    = "client leases"
+	FeatureSLA             = "SLA monitoring"
+	FeatureHeartbeat       = "heartbeat pings"
+	FeatureCommandOutput   = "command output streams"
+	FeatureImport          = "chain import"
+	FeatureClientGroups    = "client groups"
+	FeatureCrashRecovery   = "crash recovery"
+	FeatureCircuitBreaker  = "circuit breaker"
+	FeaturePreconditions   = "run preconditions"
+	FeatureMutexes         = "chain mutexes"
+)
+
+// schemaFeature lists schema objects the feature needs: tables, "table.column" columns and function signatures.
+// Names are relative to the configuration schema
+type schemaFeature struct {
+	Name      string
+	Required  bool
+	Tables    []string
+	Columns   []string
+	Functions []string
+}
+
+// schemaFeatures is the feature matrix of this binary, the scheduler refuses to start without required features
+var schemaFeatures = []schemaFeature{
+	{Name: FeatureCore, Required: true,
+		Tables: []string{"chain_execution_config", "chain_execution_parameters", "task_chain", "base_task",
+			"database_connection", "run_status", "execution_log", "log", "migrations"},
+		Columns: []string{"chain_execution_config.self_destruct_mode", "chain_execution_config.schedule_engine",
+			"chain_execution_config.schedule", "chain_execution_config.tenant", "run_status.client_name",
+			"chain_execution_config.description", "chain_execution_config.runbook_url",
+			"base_task.description", "base_task.runbook_url", "chain_execution_config.client_group",
+			"chain_execution_config.interval_aligned"},
+		Functions: []string{"is_cron_in_time(timetable.cron, timestamptz)"}},
+	{Name: FeatureQuotas, Tables: []string{"tenant_quota"}, Functions: []string{"check_quota(bigint)"}},
+	{Name: FeatureResume, Tables: []string{"run_resume"}, Functions: []string{"resume_run(bigint)"}},
+	{Name: FeatureRunSummary, Tables: []string{"run_summary"}},
+	{Name: FeatureAffinity, Columns: []string{"chain_execution_config.affinity", "chain_execution_config.affinity_failover"}},
+	{Name: FeatureWindows, Columns: []string{"chain_execution_config.window_start", "chain_execution_config.window_end"}},
+	{Name: FeatureContention, Tables: []string{"chain_wait"}},
+	{Name: FeatureArtifacts, Tables: []string{"run_artifact"}},
+	{Name: FeatureClientResources, Tables: []string{"client"}},
+	{Name: FeatureSinks, Columns: []string{"task_chain.sink"}},
+	{Name: FeatureShellDisabled, Columns: []string{"chain_execution_config.shell_disabled_action"}},
+	{Name: FeatureSecrets, Columns: []string{"chain_execution_parameters.secret"}},
+	{Name: FeatureTaskSettings, Columns: []string{"task_chain.settings"}},
+	{Name: FeatureRunAsRole, Columns: []string{"task_chain.run_as_role"}},
+	{Name: FeatureClientLeases, Tables: []string{"client_lease"},
+		Columns: []string{"client_lease.heartbeat", "client_lease.lost"}},
+	{Name: FeatureSLA, Tables: []string{"sla_violation"},
+		Columns: []string{"chain_execution_config.max_duration", "chain_execution_config.max_start_delay"}},
+	{Name: FeatureHeartbeat, Columns: []string{"chain_execution_config.heartbeat_url"}},
+	{Name: FeatureCommandOutput, Columns: []string{"execution_log.stdout", "execution_log.stderr",
+		"execution_log.stdout_file", "execution_log.stderr_file"}},
+	{Name: FeatureImport, Columns: []string{"chain_execution_config.import_source"}},
+	{Name: FeatureClientGroups, Tables: []string{"chain_claim"}, Columns: []string{"client_lease.client_group"}},
+	{Name: FeatureCrashRecovery, Columns: []string{"chain_execution_config.idempotent"}},
+	{Name: FeatureCircuitBreaker, Columns: []string{"chain_execution_config.max_failures",
+		"chain_execution_config.failure_cooldown", "chain_execution_config.suspended"}},
+	{Name: FeaturePreconditions, Columns: []string{"chain_execution_config.run_if"}},
+	{Name: FeatureMutexes, Columns: []string{"chain_execution_config.mutexes"}},
+}
+
+// ErrFeatureDisabled is returned by functions of the feature disabled because of the schema mismatch
+var ErrFeatureDisabled = errors.New("Feature is disabled because of the configuration schema mismatch")
+
+// disabledFeatures are set once by ValidateSchema before the scheduler is started
+var disabledFeatures = map[string]bool{}
+
+// Enabled returns false if the feature was disabled because of the schema mismatch
+func Enabled(feature string) bool {
+	return !disabledFeatures[feature]
+}
+
+// schemaChecker reports if the object of the kind ("table", "column" or "function") exists
+type schemaChecker func(kind string, name string) (bool, error)
+
+// missingObjects returns human readable descriptions of the feature objects not found in the schema
+func (f schemaFeature) missingObjects(exists schemaChecker) (missing []string, err error) {
+	for _, o := range []struct {
+		kind  string
+		names []string
+	}{{"table", f.Tables}, {"column", f.Columns}, {"function", f.Functions}} {
+		for _, name := range o.names {
+			ok, err := exists(o.kind, name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				missing = append(missing, o.kind+" "+name)
+			}
+		}
+	}
+	return
+}
+
+// checkFeatures disables optional features with missing objects and returns the report,
+// ok is false if some required feature is missing
+func checkFeatures(features []schemaFeature, exists schemaChecker) (report []string, ok bool, err error) {
+	ok = true
+	for _, f := range features {
+		missing, err := f.missingObjects(exists)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(missing) == 0 {
+			delete(disabledFeatures, f.Name)
+			continue
+		}
+		state := "disabled"
+		if f.Required {
+			state, ok = "required", false
+		}
+		disabledFeatures[f.Name] = true
+		report = append(report, fmt.Sprintf("%s (%s): missing %s", f.Name, state, strings.Join(missing, ", ")))
+	}
+	return
+}
+
+// schemaObjectExists checks the object in the configuration schema
+func schemaObjectExists(ctx context.Context, kind string, name string) (res bool, err error) {
+	// function signatures may refer to types of the default schema
+	name = SchemaSQL(name)
+	switch kind {
+	case "table":
+		err = ConfigDb.GetContext(ctx, &res, "SELECT to_regclass($1) IS NOT NULL", SchemaName+"."+name)
+	case "column":
+		parts := strings.SplitN(name, ".", 2)
+		err = ConfigDb.GetContext(ctx, &res, `SELECT EXISTS(SELECT 1 FROM information_schema.columns
+WHERE table_schema = $1 AND table_name = $2 AND column_name = $3)`, SchemaName, parts[0], parts[1])
+	case "function":
+		err = ConfigDb.GetContext(ctx, &res, "SELECT to_regprocedure($1) IS NOT NULL", SchemaName+"."+name)
+	default:
+		err = fmt.Errorf("Unknown schema object kind: %s", kind)
+	}
+	return
+}
+
+// ValidateSchema verifies that schema objects match the features of this binary and logs the explicit report.
+// Features with missing objects are disabled, returns false if the required ones are missing
+func ValidateSchema(ctx context.Context) bool {
+	report, ok, err := checkFeatures(schemaFeatures, func(kind string, name string) (bool, error) {
+		return schemaObjectExists(ctx, kind, name)
+	})
+	switch {
+	case err != nil:
+		LogToDB("ERROR", "Cannot validate the configuration schema: ", err)
+		return false
+	case !ok:
+		LogToDB("ERROR", fmt.Sprintf("Configuration schema %s does not match this version of pg_timetable:\n\t%s",
+			SchemaName, strings.Join(report, "\n\t")))
+	case len(report) > 0:
+		LogToDB("ERROR", fmt.Sprintf("Features disabled because of the configuration schema %s mismatch:\n\t%s",
+			SchemaName, strings.Join(report, "\n\t")))
+	default:
+		LogToDB("LOG", "Configuration schema validated")
+	}
+	if ok && PgBouncerMode && !Enabled(FeatureClientLeases) {
+		LogToDB("ERROR", "PgBouncer mode requires client leases, use --upgrade option")
+		return false
+	}
+	if ok && HAMode && !Enabled(FeatureClientLeases) {
+		LogToDB("ERROR", "HA mode requires client leases, use --upgrade option")
+		return false
+	}
+	if ok && ClientGroup != "" && !Enabled(FeatureClientGroups) {
+		LogToDB("ERROR", "Client groups require the upgraded schema, use --upgrade option")
+		return false
+	}
+	if ok && ResumeCrashed && !Enabled(FeatureCrashRecovery) {
+		LogToDB("ERROR", "Resuming crashed runs requires the upgraded schema, use --upgrade option")
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,67 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ClientGroup is the group of clients sharing the load of chains targeting the group. Every member runs
+// under its own client name and executes the part of group chains assigned to it
+var ClientGroup string
+
+// sqlClaimChainRun inserts the claim unless another member of the group claimed the run already
+const sqlClaimChainRun = `INSERT INTO timetable.chain_claim (chain_execution_config, due, client_name)
+VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING TRUE`
+
+// sqlSelectGroupMembers returns names of living clients of the group, the lease of every member is renewed
+// by the client heartbeat
+const sqlSelectGroupMembers = `SELECT client_name FROM timetable.client_lease
+WHERE client_group = $1 AND expires > now() ORDER BY client_name`
+
+// ClaimChainRun claims the run of the group chain due at the moment, so it's executed by one member of
+// the group only. Returns false if another member claimed the run or the claim failed
+func ClaimChainRun(ctx context.Context, chainConfigID int, due time.Time) bool {
+	if !Enabled(FeatureClientGroups) {
+		return true
+	}
+	var claimed bool
+	err := ConfigDb.GetContext(ctx, &claimed, SchemaSQL(sqlClaimChainRun), chainConfigID, due, ClientName)
+	switch {
+	case err == sql.ErrNoRows:
+		LogToDB("DEBUG", "The run is claimed by another member of the group, chain ", chainConfigID)
+		return false
+	case err != nil:
+		LogToDB("ERROR", "Cannot claim the run of the group chain: ", err)
+		return false
+	}
+	return claimed
+}
+
+// GetGroupMembers returns client names of living members of the client group including this client
+func GetGroupMembers(ctx context.Context) []string {
+	if ClientGroup == "" || !Enabled(FeatureClientGroups) {
+		return []string{ClientName}
+	}
+	var members []string
+	if err := ConfigDb.SelectContext(ctx, &members, SchemaSQL(sqlSelectGroupMembers), ClientGroup); err != nil {
+		LogToDB("ERROR", "Cannot select members of the client group: ", err)
+	}
+	for _, m := range members {
+		if m == ClientName {
+			return members
+		}
+	}
+	return append(members, ClientName)
+}
+
+// joinClientGroup marks the lease of the client with the client group, so other members see it alive
+func joinClientGroup(ctx context.Context) {
+	if ClientGroup == "" || !Enabled(FeatureClientGroups) {
+		return
+	}
+	if _, err := ConfigDb.ExecContext(ctx, SchemaSQL("UPDATE timetable.client_lease SET client_group = $2 WHERE client_name = $1"),
+		ClientName, ClientGroup); err != nil {
+		LogToDB("ERROR", "Cannot join the client group: ", err)
+	}
+}
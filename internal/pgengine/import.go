@@ -0,0 +1,265 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ImportResult counts chains changed by ImportChainDefinitions
+type ImportResult struct {
+	Created   int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// importedElement is the chain element compared with the task definition
+type importedElement struct {
+	TaskName    string         `db:"task_name"`
+	Kind        string         `db:"kind"`
+	Script      string         `db:"script"`
+	IgnoreError bool           `db:"ignore_error"`
+	Autonomous  bool           `db:"autonomous"`
+	OnCommit    bool           `db:"on_commit"`
+	WorkDir     sql.NullString `db:"workdir"`
+	Umask       sql.NullString `db:"umask"`
+	Stdin       sql.NullString `db:"stdin"`
+	ChainID     int            `db:"chain_id"`
+}
+
+const sqlSelectImportedChain = `SELECT chain_execution_config, chain_id, chain_name, COALESCE(run_at, '') AS run_at,
+COALESCE(live, false) AS live, COALESCE(max_instances, 0) AS max_instances,
+COALESCE(exclusive_execution, false) AS exclusive_execution, COALESCE(client_name, '') AS client_name,
+COALESCE(description, '') AS description, COALESCE(runbook_url, '') AS runbook_url,
+COALESCE(import_source, '') AS import_source
+FROM timetable.chain_execution_config`
+
+const sqlSelectImportedElements = `WITH RECURSIVE x AS (
+	SELECT tc.*, 1 AS pos FROM timetable.task_chain tc WHERE tc.chain_id = $1
+	UNION ALL
+	SELECT tc.*, x.pos + 1 FROM timetable.task_chain tc JOIN x ON tc.parent_id = x.chain_id
+)
+SELECT x.chain_id, t.name AS task_name, t.kind, COALESCE(t.script, '') AS script, x.ignore_error, x.autonomous,
+x.on_commit, x.workdir, x.umask, x.stdin
+FROM x JOIN timetable.base_task t USING (task_id) ORDER BY x.pos`
+
+// importedChain is the chain execution config found in the configuration database
+type importedChain struct {
+	ID                 int           `db:"chain_execution_config"`
+	ChainID            sql.NullInt64 `db:"chain_id"`
+	Name               string        `db:"chain_name"`
+	RunAt              string        `db:"run_at"`
+	Live               bool          `db:"live"`
+	MaxInstances       int           `db:"max_instances"`
+	ExclusiveExecution bool          `db:"exclusive_execution"`
+	ClientName         string        `db:"client_name"`
+	Description        string        `db:"description"`
+	RunbookURL         string        `db:"runbook_url"`
+	Source             string        `db:"import_source"`
+}
+
+// ImportChainDefinitions reconciles chains of the configuration database with definitions in one transaction.
+// Missing chains are created, changed chains are updated, and chains imported before but missing in definitions
+// are deleted. Chains created manually with the same name are taken over, other manual chains are kept.
+// Base tasks are shared by name and updated in place, they are never deleted
+func ImportChainDefinitions(ctx context.Context, chains []ChainDefinition) (res ImportResult, err error) {
+	if !Enabled(FeatureImport) {
+		return res, ErrFeatureDisabled
+	}
+	tx, err := ConfigDb.BeginTxx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	var existing []importedChain
+	if err = tx.SelectContext(ctx, &existing, SchemaSQL(sqlSelectImportedChain)+" FOR UPDATE"); err != nil {
+		return
+	}
+	byName := make(map[string]importedChain, len(existing))
+	for _, c := range existing {
+		byName[c.Name] = c
+	}
+	defined := make(map[string]bool, len(chains))
+	for _, chain := range chains {
+		defined[chain.Name] = true
+		current, ok := byName[chain.Name]
+		var changed bool
+		if changed, err = importChain(ctx, tx, chain, current, ok); err != nil {
+			return res, err
+		}
+		switch {
+		case !ok:
+			res.Created++
+		case changed:
+			res.Updated++
+		default:
+			res.Unchanged++
+		}
+	}
+	for _, c := range existing {
+		if c.Source == "" || defined[c.Name] {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.chain_execution_config WHERE chain_execution_config = $1"),
+			c.ID); err != nil {
+			return
+		}
+		if err = deleteUnusedChain(ctx, tx, c.ChainID); err != nil {
+			return
+		}
+		res.Deleted++
+	}
+	err = tx.Commit()
+	return
+}
+
+// importChain creates or updates the chain, returns true if the existing chain was changed
+func importChain(ctx context.Context, tx *sqlx.Tx, chain ChainDefinition, current importedChain, exists bool) (bool, error) {
+	// elements are compared before base tasks are updated, so the changed script updates the chain
+	var elements []importedElement
+	if current.ChainID.Valid {
+		if err := tx.SelectContext(ctx, &elements, SchemaSQL(sqlSelectImportedElements), current.ChainID); err != nil {
+			return false, err
+		}
+	}
+	params, err := importedParams(ctx, tx, current.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, task := range chain.Tasks {
+		if task.Kind == "BUILTIN" {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, SchemaSQL(`INSERT INTO timetable.base_task (name, kind, script)
+VALUES ($1, $2::timetable.task_kind, $3) ON CONFLICT (name) DO UPDATE SET kind = EXCLUDED.kind, script = EXCLUDED.script
+WHERE (base_task.kind, base_task.script) IS DISTINCT FROM (EXCLUDED.kind, EXCLUDED.script)`),
+			task.Name, task.Kind, task.Script); err != nil {
+			return false, err
+		}
+	}
+	if !exists {
+		if err = tx.GetContext(ctx, &current.ID, SchemaSQL(`INSERT INTO timetable.chain_execution_config (chain_name)
+VALUES ($1) RETURNING chain_execution_config`), chain.Name); err != nil {
+			return false, err
+		}
+	}
+	changed := !exists || !sameChainConfig(current, chain)
+	if changed {
+		if _, err = tx.ExecContext(ctx, SchemaSQL(`UPDATE timetable.chain_execution_config SET
+run_at = NULLIF($2, ''), live = $3, max_instances = NULLIF($4, 0), exclusive_execution = $5,
+client_name = NULLIF($6, ''), description = NULLIF($7, ''), runbook_url = NULLIF($8, ''), import_source = $9
+WHERE chain_execution_config = $1`), current.ID, chain.RunAt, chain.Live, chain.MaxInstances,
+			chain.ExclusiveExecution, chain.ClientName, chain.Description, chain.RunbookURL, chain.Source); err != nil {
+			return false, err
+		}
+	}
+	if exists && sameChainElements(elements, params, chain.Tasks) {
+		return changed, nil
+	}
+	return true, replaceImportedElements(ctx, tx, current, chain.Tasks)
+}
+
+// importedParams returns parameters of the config by chain element
+func importedParams(ctx context.Context, tx *sqlx.Tx, id int) (map[int][]string, error) {
+	var rows []struct {
+		ChainID int    `db:"chain_id"`
+		Value   string `db:"value"`
+	}
+	err := tx.SelectContext(ctx, &rows, SchemaSQL(`SELECT chain_id, value::text AS value
+FROM timetable.chain_execution_parameters WHERE chain_execution_config = $1 ORDER BY chain_id, order_id`), id)
+	params := make(map[int][]string)
+	for _, r := range rows {
+		params[r.ChainID] = append(params[r.ChainID], r.Value)
+	}
+	return params, err
+}
+
+// replaceImportedElements replaces elements and parameters of the chain, the previous elements are deleted
+// unless they are used by another config
+func replaceImportedElements(ctx context.Context, tx *sqlx.Tx, current importedChain, tasks []TaskDefinition) error {
+	if _, err := tx.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.chain_execution_parameters WHERE chain_execution_config = $1"),
+		current.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, SchemaSQL("UPDATE timetable.chain_execution_config SET chain_id = NULL WHERE chain_execution_config = $1"),
+		current.ID); err != nil {
+		return err
+	}
+	if err := deleteUnusedChain(ctx, tx, current.ChainID); err != nil {
+		return err
+	}
+	var headID, parentID sql.NullInt64
+	for _, task := range tasks {
+		var chainID int64
+		err := tx.GetContext(ctx, &chainID, SchemaSQL(`INSERT INTO timetable.task_chain
+(parent_id, task_id, ignore_error, autonomous, on_commit, workdir, umask, stdin)
+SELECT $1, task_id, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, '')
+FROM timetable.base_task WHERE name = $2 RETURNING chain_id`),
+			parentID, task.Name, task.IgnoreError, task.Autonomous, task.OnCommit, task.WorkDir, task.Umask, task.Stdin)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("Builtin task %s not found", task.Name)
+		}
+		if err != nil {
+			return err
+		}
+		for i, p := range task.ParamValues() {
+			if _, err = tx.ExecContext(ctx, SchemaSQL(`INSERT INTO timetable.chain_execution_parameters
+(chain_execution_config, chain_id, order_id, value) VALUES ($1, $2, $3, $4)`), current.ID, chainID, i+1, p); err != nil {
+				return err
+			}
+		}
+		parentID = sql.NullInt64{Int64: chainID, Valid: true}
+		if !headID.Valid {
+			headID = parentID
+		}
+	}
+	_, err := tx.ExecContext(ctx, SchemaSQL(`UPDATE timetable.chain_execution_config SET chain_id = $2
+WHERE chain_execution_config = $1`), current.ID, headID)
+	return err
+}
+
+// sameChainConfig returns true if the config matches the definition and was imported from the same file
+func sameChainConfig(c importedChain, chain ChainDefinition) bool {
+	return c.RunAt == chain.RunAt && c.Live == chain.Live && c.MaxInstances == chain.MaxInstances &&
+		c.ExclusiveExecution == chain.ExclusiveExecution && c.ClientName == chain.ClientName &&
+		c.Description == chain.Description && c.RunbookURL == chain.RunbookURL && c.Source == chain.Source
+}
+
+// sameChainElements returns true if elements with their parameters match task definitions
+func sameChainElements(elements []importedElement, params map[int][]string, tasks []TaskDefinition) bool {
+	if len(elements) != len(tasks) {
+		return false
+	}
+	for i, e := range elements {
+		task := tasks[i]
+		if e.TaskName != task.Name || e.Kind != task.Kind || e.Script != task.Script ||
+			e.IgnoreError != task.IgnoreError || e.Autonomous != task.Autonomous || e.OnCommit != task.OnCommit ||
+			e.WorkDir.String != task.WorkDir || e.Umask.String != task.Umask || e.Stdin.String != task.Stdin {
+			return false
+		}
+		values := task.ParamValues()
+		if len(params[e.ChainID]) != len(values) {
+			return false
+		}
+		for j, value := range values {
+			if !sameJSON(params[e.ChainID][j], value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameJSON compares JSON values regardless of formatting, e.g. jsonb output and the definition file
+func sameJSON(a string, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(va, vb)
+}
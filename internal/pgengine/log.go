@@ -1,8 +1,11 @@
 package pgengine
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -19,6 +22,7 @@ const (
 
 var levelColors = map[string]int{
 	"PANIC":  red,
+	"ALERT":  red,
 	"ERROR":  red,
 	"REPAIR": red,
 	"USER":   yellow,
@@ -29,6 +33,57 @@ var levelColors = map[string]int{
 // VerboseLogLevel specifies if log messages with level LOG should be logged
 var VerboseLogLevel = true
 
+// ConsoleLogLevel and DBLogLevel are the minimal levels of messages printed to stdout and stored in timetable.log.
+// Empty level keeps the default: every message if VerboseLogLevel is set, LOG and above otherwise
+var ConsoleLogLevel, DBLogLevel string
+
+// logSettingsMu guards log settings changed by SetLogSettings while messages are being logged
+var logSettingsMu sync.RWMutex
+
+// SetLogSettings changes the format and levels of messages at runtime, e.g. when the configuration is reloaded
+func SetLogSettings(format string, consoleLevel string, dbLevel string, verbose bool) {
+	logSettingsMu.Lock()
+	defer logSettingsMu.Unlock()
+	LogFormat, ConsoleLogLevel, DBLogLevel, VerboseLogLevel = format, consoleLevel, dbLevel, verbose
+}
+
+// logLevelRanks orders levels by severity
+var logLevelRanks = map[string]int{
+	"DEBUG":  0,
+	"NOTICE": 1,
+	"LOG":    2,
+	"USER":   3,
+	"ERROR":  4,
+	"REPAIR": 4,
+	"ALERT":  4,
+	"PANIC":  5}
+
+// logLevelEnabled returns if the message of the level passes the minimal level of the destination
+func logLevelEnabled(level string, minLevel string) bool {
+	if minLevel == "" {
+		if VerboseLogLevel {
+			return true
+		}
+		minLevel = "LOG"
+	}
+	rank, ok := logLevelRanks[level]
+	return !ok || rank >= logLevelRanks[minLevel]
+}
+
+// LogFormat specifies the format of messages printed to stdout, "text" or "json"
+var LogFormat = "text"
+
+// logLine is the message printed as the JSON line when LogFormat is "json"
+type logLine struct {
+	Time        string `json:"ts"`
+	Level       string `json:"level"`
+	ClientName  string `json:"client"`
+	ChainConfig int    `json:"chain_config,omitempty"`
+	ChainID     int    `json:"chain_id,omitempty"`
+	RunID       int    `json:"run_id,omitempty"`
+	Message     string `json:"message"`
+}
+
 func getColorizedLevel(level string) string {
 	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", levelColors[level], level)
 }
@@ -43,38 +98,165 @@ func GetLogPrefixLn(level string) string {
 	return GetLogPrefix(level) + "\n"
 }
 
+// formatLog returns the message line printed to stdout. Chain and run ids of the JSON line
+// are taken from the chain element passed among the message arguments
+func formatLog(level string, msg ...interface{}) string {
+	if LogFormat != "json" {
+		return fmt.Sprintf(GetLogPrefix(level), fmt.Sprint(msg...))
+	}
+	line := logLine{
+		Time:       time.Now().Format(time.RFC3339Nano),
+		Level:      level,
+		ClientName: ClientName,
+		Message:    fmt.Sprint(msg...)}
+	if elem := logElement(msg...); elem != nil {
+		line.ChainConfig, line.ChainID = elem.ChainConfig, elem.ChainID
+		if elem.Run != nil {
+			line.RunID = elem.Run.RunStatusID
+		}
+	}
+	data, _ := json.Marshal(line)
+	return string(data)
+}
+
+// logElement returns the last chain element passed among the message arguments, nil if there is none
+func logElement(msg ...interface{}) (elem *ChainElementExecution) {
+	for _, m := range msg {
+		switch v := m.(type) {
+		case *ChainElementExecution:
+			elem = v
+		case ChainElementExecution:
+			elem = &v
+		}
+	}
+	return
+}
+
+// PrintHook replaces printing messages to stdout, e.g. to write them to the Windows event log
+var PrintHook func(level string, line string)
+
+// printLog prints the message to stdout only if ConsoleLogLevel allows, e.g. when the database is not available
+func printLog(level string, msg ...interface{}) {
+	logSettingsMu.RLock()
+	enabled := logLevelEnabled(level, ConsoleLogLevel)
+	var line string
+	if enabled {
+		line = formatLog(level, msg...)
+	}
+	logSettingsMu.RUnlock()
+	if !enabled {
+		return
+	}
+	if PrintHook != nil {
+		PrintHook(level, line)
+		return
+	}
+	fmt.Println(line)
+}
+
 const logTemplate = `INSERT INTO timetable.log(pid, client_name, log_level, message) VALUES ($1, $2, $3, $4)`
 
+// ErrorHook receives ERROR and PANIC messages, e.g. to report them to the error tracker. Messages about
+// chain elements are not passed, since task failures are published as events with the full context
+var ErrorHook func(level string, msg string)
+
 // LogToDB performs logging to configuration database ConfigDB initiated during bootstrap
 func LogToDB(level string, msg ...interface{}) {
-	if !VerboseLogLevel {
-		switch level {
-		case
-			"DEBUG", "NOTICE":
-			return
-		}
+	printLog(level, msg...)
+	if ErrorHook != nil && (level == "ERROR" || level == "PANIC") && logElement(msg...) == nil {
+		ErrorHook(level, fmt.Sprint(msg...))
+	}
+	logSettingsMu.RLock()
+	enabled := logLevelEnabled(level, DBLogLevel)
+	logSettingsMu.RUnlock()
+	if !enabled {
+		return
+	}
+	if enqueueLog(level, fmt.Sprint(msg...)) {
+		return
 	}
-	s := fmt.Sprintf(GetLogPrefix(level), fmt.Sprint(msg...))
-	fmt.Println(s)
-	if ConfigDb != nil {
-		_, err := ConfigDb.Exec(logTemplate, os.Getpid(), ClientName, level, fmt.Sprint(msg...))
+	// the standby server is read only
+	if ConfigDb != nil && !InRecovery() {
+		_, err := ConfigDb.Exec(SchemaSQL(logTemplate), os.Getpid(), ClientName, level, fmt.Sprint(msg...))
 		if err != nil {
-			fmt.Printf(GetLogPrefixLn("ERROR"), fmt.Sprint("Cannot log to the database: ", err))
+			printLog("ERROR", "Cannot log to the database: ", err)
 		}
 	}
 }
 
+// OutputLimit is the maximum size in bytes of stdout and stderr of SHELL and PROGRAM tasks stored in the execution log
+var OutputLimit = 64 * 1024
+
+// OutputDir is the directory where complete streams exceeding OutputLimit are written, streams are truncated if empty
+var OutputDir string
+
 // LogChainElementExecution will log current chain element execution status including retcode
 func LogChainElementExecution(chainElemExec *ChainElementExecution, retCode int, output string) {
-	_, err := ConfigDb.Exec("INSERT INTO timetable.execution_log (chain_execution_config, chain_id, task_id, name, script, "+
-		"kind, last_run, finished, returncode, pid, output, client_name) "+
-		"VALUES ($1, $2, $3, $4, $5, $6, clock_timestamp() - $7 :: interval, clock_timestamp(), $8, $9, "+
-		"NULLIF($10, ''), $11)",
-		chainElemExec.ChainConfig, chainElemExec.ChainID, chainElemExec.TaskID, chainElemExec.TaskName,
+	columns, values := "", ""
+	args := []interface{}{chainElemExec.ChainConfig, chainElemExec.ChainID, chainElemExec.TaskID, chainElemExec.TaskName,
 		chainElemExec.Script, chainElemExec.Kind,
 		fmt.Sprintf("%d microsecond", chainElemExec.Duration),
-		retCode, os.Getpid(), output, ClientName)
+		retCode, os.Getpid(), output, ClientName}
+	if Enabled(FeatureCommandOutput) {
+		columns = ", stdout, stderr, stdout_file, stderr_file"
+		values = ", NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, '')"
+		args = append(args, chainElemExec.Stdout, chainElemExec.Stderr, chainElemExec.StdoutFile, chainElemExec.StderrFile)
+	}
+	_, err := ConfigDb.Exec(SchemaSQL("INSERT INTO timetable.execution_log (chain_execution_config, chain_id, task_id, name, script, ")+
+		"kind, last_run, finished, returncode, pid, output, client_name"+columns+") "+
+		"VALUES ($1, $2, $3, $4, $5, $6, clock_timestamp() - $7 :: interval, clock_timestamp(), $8, $9, "+
+		"NULLIF($10, ''), $11"+values+")", args...)
 	if err != nil {
 		LogToDB("ERROR", "Error occurred during logging current chain element execution status including retcode: ", err)
 	}
 }
+
+// RunSummary aggregates statistics of the chain run elements
+type RunSummary struct {
+	RunStatusID   int
+	ChainConfig   int
+	StartedAt     time.Time
+	KindDurations map[string]int64 // in microseconds
+	RowsAffected  int64
+	OutputBytes   int64
+	Retries       int
+}
+
+// NewRunSummary returns summary of the run started at the moment
+func NewRunSummary(runStatusID int, chainConfigID int, startedAt time.Time) *RunSummary {
+	return &RunSummary{
+		RunStatusID:   runStatusID,
+		ChainConfig:   chainConfigID,
+		StartedAt:     startedAt,
+		KindDurations: make(map[string]int64)}
+}
+
+// Add accounts executed chain element in the summary, retries are counted by the run the element belongs to
+func (s *RunSummary) Add(chainElemExec *ChainElementExecution) {
+	s.KindDurations[chainElemExec.Kind] += chainElemExec.Duration
+	s.RowsAffected += chainElemExec.RowsAffected
+	s.OutputBytes += int64(chainElemExec.OutputBytes)
+	if chainElemExec.Run != nil {
+		s.Retries = chainElemExec.Run.Retries
+	}
+}
+
+// LogRunSummary inserts the single summary row of the finished run, status is CHAIN_DONE or CHAIN_FAILED
+func LogRunSummary(ctx context.Context, s *RunSummary, finishedAt time.Time, status string) {
+	if !Enabled(FeatureRunSummary) {
+		return
+	}
+	durations := make(map[string]float64, len(s.KindDurations))
+	for kind, d := range s.KindDurations {
+		durations[kind] = float64(d) / 1e6
+	}
+	kindDurations, _ := json.Marshal(durations)
+	_, err := ConfigDb.ExecContext(ctx, SchemaSQL("INSERT INTO timetable.run_summary (run_status, chain_execution_config, ")+
+		"started, finished, kind_durations, rows_affected, output_bytes, retries, execution_status, client_name) "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		s.RunStatusID, s.ChainConfig, s.StartedAt, finishedAt, string(kindDurations),
+		s.RowsAffected, s.OutputBytes, s.Retries, status, ClientName)
+	if err != nil {
+		LogToDB("ERROR", "Cannot save the chain run summary: ", err)
+	}
+}
@@ -0,0 +1,77 @@
+package pgengine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatLog(t *testing.T) {
+	defer func() { LogFormat = "text" }()
+	elem := &ChainElementExecution{ChainConfig: 3, ChainID: 5, Run: &ChainRun{RunStatusID: 7}}
+
+	LogFormat = "text"
+	assert.Contains(t, formatLog("LOG", "Starting chain element: ", 5), "Starting chain element: 5")
+
+	LogFormat = "json"
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(formatLog("ERROR", "Task failed:\n", elem)), &line))
+	assert.Equal(t, "ERROR", line["level"])
+	assert.Equal(t, ClientName, line["client"])
+	assert.EqualValues(t, 3, line["chain_config"])
+	assert.EqualValues(t, 5, line["chain_id"])
+	assert.EqualValues(t, 7, line["run_id"])
+	assert.Contains(t, line["message"], "Task failed:\n")
+	assert.NotEmpty(t, line["ts"])
+
+	require.NoError(t, json.Unmarshal([]byte(formatLog("LOG", "Closing session")), &line))
+	assert.NotContains(t, formatLog("LOG", "Closing session"), "chain_id", "Ids should be omitted without chain element")
+}
+
+func TestLogLevelEnabled(t *testing.T) {
+	defer func() { VerboseLogLevel = true }()
+	VerboseLogLevel = true
+	assert.True(t, logLevelEnabled("DEBUG", ""), "Verbose mode should enable all levels by default")
+	assert.False(t, logLevelEnabled("DEBUG", "LOG"))
+	assert.True(t, logLevelEnabled("ERROR", "LOG"))
+	assert.True(t, logLevelEnabled("REPAIR", "ERROR"))
+	assert.False(t, logLevelEnabled("USER", "ERROR"))
+	assert.True(t, logLevelEnabled("UNKNOWN", "PANIC"), "Unknown levels should never be filtered")
+
+	VerboseLogLevel = false
+	assert.False(t, logLevelEnabled("NOTICE", ""))
+	assert.True(t, logLevelEnabled("LOG", ""))
+	assert.True(t, logLevelEnabled("DEBUG", "DEBUG"), "Explicit level should override verbose mode")
+}
+
+func TestErrorHook(t *testing.T) {
+	var reported []string
+	ErrorHook = func(level string, msg string) { reported = append(reported, level+": "+msg) }
+	defer func() { ErrorHook = nil }()
+	LogToDB("LOG", "Checking for task chains...")
+	LogToDB("ERROR", "Could not query pending tasks: ", "connection refused")
+	LogToDB("ERROR", "Task execution failed: ", &ChainElementExecution{TaskName: "backup"})
+	assert.Equal(t, []string{"ERROR: Could not query pending tasks: connection refused"}, reported,
+		"Only errors not about chain elements should be passed")
+}
+
+func TestPrintHook(t *testing.T) {
+	var printed []string
+	PrintHook = func(level string, line string) { printed = append(printed, level) }
+	defer func() { PrintHook = nil }()
+	ConsoleLogLevel = "LOG"
+	defer func() { ConsoleLogLevel = "" }()
+	printLog("DEBUG", "Trying to get advisory lock")
+	printLog("ERROR", "Cannot log to the database")
+	assert.Equal(t, []string{"ERROR"}, printed, "Only messages allowed by ConsoleLogLevel should be passed")
+}
+
+func TestSetLogSettings(t *testing.T) {
+	defer SetLogSettings("text", "", "", true)
+	SetLogSettings("json", "ERROR", "LOG", false)
+	assert.Equal(t, "json", LogFormat)
+	assert.False(t, logLevelEnabled("LOG", ConsoleLogLevel))
+	assert.True(t, logLevelEnabled("LOG", DBLogLevel))
+}
@@ -0,0 +1,128 @@
+package pgengine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	logQueueSize     = 10000 // messages queued above the limit are printed but not stored in the database
+	logBatchSize     = 100
+	logFlushInterval = 500 * time.Millisecond
+)
+
+// logEntry is the message queued for the background writer, the timestamp is taken when LogToDB is called
+type logEntry struct {
+	ts      time.Time
+	level   string
+	message string
+}
+
+// logWriter inserts queued log messages into timetable.log in batches
+type logWriter struct {
+	queue   chan logEntry
+	done    chan struct{}
+	dropped int64
+}
+
+var (
+	logWriterMu sync.RWMutex
+	asyncLog    *logWriter
+)
+
+// StartLogWriter switches LogToDB to the background writer, so logging does not wait for the database.
+// Messages are flushed every logFlushInterval, when logBatchSize is reached or by StopLogWriter
+func StartLogWriter() {
+	logWriterMu.Lock()
+	defer logWriterMu.Unlock()
+	if asyncLog != nil {
+		return
+	}
+	asyncLog = &logWriter{queue: make(chan logEntry, logQueueSize), done: make(chan struct{})}
+	go asyncLog.run()
+}
+
+// StopLogWriter flushes queued messages and switches LogToDB back to synchronous inserts
+func StopLogWriter() {
+	logWriterMu.Lock()
+	w := asyncLog
+	asyncLog = nil
+	logWriterMu.Unlock()
+	if w == nil {
+		return
+	}
+	close(w.queue)
+	<-w.done
+}
+
+// enqueueLog passes the message to the background writer, returns false if the writer is not started
+func enqueueLog(level string, message string) bool {
+	logWriterMu.RLock()
+	defer logWriterMu.RUnlock()
+	if asyncLog == nil {
+		return false
+	}
+	select {
+	case asyncLog.queue <- logEntry{time.Now(), level, message}:
+	default:
+		atomic.AddInt64(&asyncLog.dropped, 1)
+	}
+	return true
+}
+
+func (w *logWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+	batch := make([]logEntry, 0, logBatchSize)
+	for {
+		select {
+		case e, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			if batch = append(batch, e); len(batch) >= logBatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		}
+	}
+}
+
+// flush inserts the batch with the single statement and returns the emptied batch. Errors are printed only,
+// since logging them to the database would fail the same way
+func (w *logWriter) flush(batch []logEntry) []logEntry {
+	if dropped := atomic.SwapInt64(&w.dropped, 0); dropped > 0 {
+		printLog("ERROR", fmt.Sprintf("Log queue is full, %d messages not stored in the database", dropped))
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	// the standby server is read only
+	if ConfigDb != nil && !InRecovery() {
+		args := make([]interface{}, 0, len(batch)*5)
+		for _, e := range batch {
+			args = append(args, e.ts, os.Getpid(), ClientName, e.level, e.message)
+		}
+		if _, err := ConfigDb.Exec(logBatchQuery(len(batch)), args...); err != nil {
+			printLog("ERROR", fmt.Sprint("Cannot log to the database: ", err))
+		}
+	}
+	return batch[:0]
+}
+
+// logBatchQuery returns multi-row INSERT statement for n messages
+func logBatchQuery(n int) string {
+	values := make([]string, n)
+	for i := range values {
+		p := i * 5
+		values[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", p+1, p+2, p+3, p+4, p+5)
+	}
+	return SchemaSQL("INSERT INTO timetable.log(ts, pid, client_name, log_level, message) VALUES ") + strings.Join(values, ", ")
+}
@@ -0,0 +1,23 @@
+package pgengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogBatchQuery(t *testing.T) {
+	assert.Equal(t, "INSERT INTO timetable.log(ts, pid, client_name, log_level, message) VALUES ($1, $2, $3, $4, $5)",
+		logBatchQuery(1))
+	assert.Equal(t, "INSERT INTO timetable.log(ts, pid, client_name, log_level, message) VALUES "+
+		"($1, $2, $3, $4, $5), ($6, $7, $8, $9, $10)", logBatchQuery(2))
+}
+
+func TestLogWriter(t *testing.T) {
+	assert.False(t, enqueueLog("LOG", "sync"), "Messages should be inserted synchronously until the writer is started")
+	StartLogWriter()
+	assert.True(t, enqueueLog("LOG", "async"))
+	StopLogWriter()
+	assert.False(t, enqueueLog("LOG", "sync"), "Messages should be inserted synchronously after the writer is stopped")
+	assert.NotPanics(t, StopLogWriter, "Stopping twice should be allowed")
+}
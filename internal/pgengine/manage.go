@@ -0,0 +1,345 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrChainConfigNotFound is returned if there is no chain execution config with such id visible to the tenant
+	ErrChainConfigNotFound = errors.New("Chain not found")
+	// ErrTaskNotFound is returned if there is no base task with such id
+	ErrTaskNotFound = errors.New("Task not found")
+)
+
+// ChainConfig is the chain execution config managed by REST API. Tenant is set by the server in tenant isolation mode
+type ChainConfig struct {
+	ID                 int     `db:"chain_execution_config" json:"chain_execution_config"`
+	ChainID            *int    `db:"chain_id" json:"chain_id"` // the head of the chain elements
+	ChainName          string  `db:"chain_name" json:"chain_name"`
+	RunAt              *string `db:"run_at" json:"run_at"`
+	MaxInstances       *int    `db:"max_instances" json:"max_instances"`
+	Live               bool    `db:"live" json:"live"`
+	SelfDestruct       bool    `db:"self_destruct" json:"self_destruct"`
+	ExclusiveExecution bool    `db:"exclusive_execution" json:"exclusive_execution"`
+	ClientName         *string `db:"client_name" json:"client_name"`
+	Tenant             string  `db:"tenant" json:"tenant"`
+	Description        *string `db:"description" json:"description"`
+	RunbookURL         *string `db:"runbook_url" json:"runbook_url"`
+	ClientGroup        *string `db:"client_group" json:"client_group"`
+}
+
+// ChainElement is the element of the chain managed by REST API, parameters are stored per chain execution config
+type ChainElement struct {
+	ChainID            int               `db:"chain_id" json:"chain_id"`
+	TaskID             int               `db:"task_id" json:"task_id"`
+	TaskName           string            `db:"task_name" json:"task_name"`
+	RunUID             *string           `db:"run_uid" json:"run_uid"`
+	DatabaseConnection *int              `db:"database_connection" json:"database_connection"`
+	IgnoreError        bool              `db:"ignore_error" json:"ignore_error"`
+	Autonomous         bool              `db:"autonomous" json:"autonomous"`
+	Parameters         []json.RawMessage `db:"-" json:"parameters"`
+}
+
+// Task is the base task managed by REST API
+type Task struct {
+	ID          int     `db:"task_id" json:"task_id"`
+	Name        string  `db:"name" json:"name"`
+	Kind        string  `db:"kind" json:"kind"`
+	Script      string  `db:"script" json:"script"`
+	Description *string `db:"description" json:"description"`
+	RunbookURL  *string `db:"runbook_url" json:"runbook_url"`
+}
+
+// ChainRunInfo describes the run of the chain in the run history
+type ChainRunInfo struct {
+	RunStatusID int        `db:"run_status" json:"run_status"`
+	Status      string     `db:"execution_status" json:"status"`
+	ClientName  string     `db:"client_name" json:"client_name"`
+	Started     time.Time  `db:"started" json:"started"`
+	Finished    *time.Time `db:"finished" json:"finished"`
+	Duration    *float64   `db:"duration" json:"duration"` // in seconds
+}
+
+// tenantFilter matches every row if the tenant parameter is empty
+const tenantFilter = ` AND ($%d = '' OR tenant = $%[1]d)`
+
+const sqlSelectChainConfigs = `SELECT chain_execution_config, chain_id, chain_name, run_at, max_instances,
+COALESCE(live, false) AS live, COALESCE(self_destruct, false) AS self_destruct,
+COALESCE(exclusive_execution, false) AS exclusive_execution, client_name, tenant, description, runbook_url,
+client_group FROM timetable.chain_execution_config WHERE true`
+
+const sqlSelectChainElements = `WITH RECURSIVE x AS (
+	SELECT tc.*, 1 AS pos FROM timetable.task_chain tc
+	WHERE tc.chain_id = (SELECT chain_id FROM timetable.chain_execution_config WHERE chain_execution_config = $1)
+	UNION ALL
+	SELECT tc.*, x.pos + 1 FROM timetable.task_chain tc JOIN x ON tc.parent_id = x.chain_id
+)
+SELECT x.chain_id, x.task_id, t.name AS task_name, x.run_uid, x.database_connection, x.ignore_error, x.autonomous
+FROM x JOIN timetable.base_task t USING (task_id) ORDER BY x.pos`
+
+const sqlSelectTasks = `SELECT task_id, name, kind, COALESCE(script, '') AS script, description, runbook_url
+FROM timetable.base_task`
+
+const sqlSelectChainRuns = `SELECT s.run_status, COALESCE(f.execution_status, s.execution_status) AS execution_status,
+s.client_name, s.started, f.last_status_update AS finished,
+EXTRACT(EPOCH FROM f.last_status_update - s.started)::float8 AS duration
+FROM timetable.run_status s LEFT JOIN LATERAL (
+	SELECT execution_status, last_status_update FROM timetable.run_status
+	WHERE start_status = s.run_status AND execution_status IN ('CHAIN_DONE', 'CHAIN_FAILED', 'DEAD')
+	ORDER BY last_status_update DESC LIMIT 1) f ON true
+WHERE s.start_status IS NULL AND s.chain_execution_config = $1
+ORDER BY s.run_status DESC LIMIT $2`
+
+// IsInvalidInput returns true if the statement failed because of the data violating constraints or types,
+// e.g. the duplicated chain name or the wrong cron expression
+func IsInvalidInput(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22", "23":
+			return true
+		}
+	}
+	return false
+}
+
+// ListChainConfigs returns chain execution configs of the tenant, all configs if tenant is empty
+func ListChainConfigs(ctx context.Context, tenant string) ([]ChainConfig, error) {
+	chains := []ChainConfig{}
+	err := ConfigDb.SelectContext(ctx, &chains, SchemaSQL(sqlSelectChainConfigs)+
+		fmt.Sprintf(tenantFilter, 1)+" ORDER BY chain_execution_config", tenant)
+	return chains, err
+}
+
+// GetChainConfig returns the chain execution config visible to the tenant
+func GetChainConfig(ctx context.Context, id int, tenant string) (c ChainConfig, err error) {
+	err = ConfigDb.GetContext(ctx, &c, SchemaSQL(sqlSelectChainConfigs)+" AND chain_execution_config = $1"+
+		fmt.Sprintf(tenantFilter, 2), id, tenant)
+	if err == sql.ErrNoRows {
+		err = ErrChainConfigNotFound
+	}
+	return
+}
+
+// CreateChainConfig inserts the chain execution config and returns its id. Empty tenant means the scheduler role
+func CreateChainConfig(ctx context.Context, c ChainConfig) (id int, err error) {
+	err = ConfigDb.GetContext(ctx, &id, SchemaSQL(`INSERT INTO timetable.chain_execution_config
+(chain_id, chain_name, run_at, max_instances, live, self_destruct, exclusive_execution, client_name, tenant,
+description, runbook_url, client_group)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE(NULLIF($9, ''), current_user), $10, $11, $12)
+RETURNING chain_execution_config`),
+		c.ChainID, c.ChainName, c.RunAt, c.MaxInstances, c.Live, c.SelfDestruct, c.ExclusiveExecution,
+		c.ClientName, c.Tenant, c.Description, c.RunbookURL, c.ClientGroup)
+	return
+}
+
+// UpdateChainConfig updates the chain execution config visible to the tenant. The tenant and chain elements
+// of the config are kept, elements are replaced by ReplaceChainElements
+func UpdateChainConfig(ctx context.Context, c ChainConfig, tenant string) error {
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL(`UPDATE timetable.chain_execution_config SET
+chain_name = $2, run_at = $3, max_instances = $4, live = $5, self_destruct = $6,
+exclusive_execution = $7, client_name = $8, description = $9, runbook_url = $10, client_group = $11
+WHERE chain_execution_config = $1`)+fmt.Sprintf(tenantFilter, 12),
+		c.ID, c.ChainName, c.RunAt, c.MaxInstances, c.Live, c.SelfDestruct, c.ExclusiveExecution,
+		c.ClientName, c.Description, c.RunbookURL, c.ClientGroup, tenant)
+	return checkAffected(res, err, ErrChainConfigNotFound)
+}
+
+// SetChainLive pauses (live = false) or resumes the chain visible to the tenant. The chain paused manually
+// is never resumed by the circuit breaker
+func SetChainLive(ctx context.Context, id int, tenant string, live bool) error {
+	set := "live = $2"
+	if Enabled(FeatureCircuitBreaker) {
+		set += ", suspended = NULL"
+	}
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL(`UPDATE timetable.chain_execution_config SET `)+set+`
+WHERE chain_execution_config = $1`+fmt.Sprintf(tenantFilter, 3), id, live, tenant)
+	return checkAffected(res, err, ErrChainConfigNotFound)
+}
+
+// RemoveChainConfig deletes the chain execution config visible to the tenant together with its chain elements
+// unless they are used by another config
+func RemoveChainConfig(ctx context.Context, id int, tenant string) error {
+	tx, err := ConfigDb.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var chainID sql.NullInt64
+	err = tx.GetContext(ctx, &chainID, SchemaSQL(`DELETE FROM timetable.chain_execution_config
+WHERE chain_execution_config = $1`)+fmt.Sprintf(tenantFilter, 2)+` RETURNING chain_id`, id, tenant)
+	if err == sql.ErrNoRows {
+		return ErrChainConfigNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err = deleteUnusedChain(ctx, tx, chainID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteUnusedChain deletes the chain elements not used by any chain execution config,
+// the elements following the head are deleted by cascade
+func deleteUnusedChain(ctx context.Context, tx *sqlx.Tx, chainID sql.NullInt64) error {
+	if !chainID.Valid {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, SchemaSQL(`DELETE FROM timetable.task_chain WHERE chain_id = $1
+AND NOT EXISTS (SELECT 1 FROM timetable.chain_execution_config WHERE chain_id = $1)`), chainID)
+	return err
+}
+
+// ListChainElements returns elements of the chain in the execution order with parameters of the config
+func ListChainElements(ctx context.Context, id int, tenant string) ([]ChainElement, error) {
+	if _, err := GetChainConfig(ctx, id, tenant); err != nil {
+		return nil, err
+	}
+	elements := []ChainElement{}
+	if err := ConfigDb.SelectContext(ctx, &elements, SchemaSQL(sqlSelectChainElements), id); err != nil {
+		return nil, err
+	}
+	var params []struct {
+		ChainID int    `db:"chain_id"`
+		Value   string `db:"value"`
+	}
+	err := ConfigDb.SelectContext(ctx, &params, SchemaSQL(`SELECT chain_id, value::text AS value
+FROM timetable.chain_execution_parameters WHERE chain_execution_config = $1 ORDER BY chain_id, order_id`), id)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		for i := range elements {
+			if elements[i].ChainID == p.ChainID {
+				elements[i].Parameters = append(elements[i].Parameters, json.RawMessage(p.Value))
+			}
+		}
+	}
+	return elements, nil
+}
+
+// ReplaceChainElements replaces elements and parameters of the chain visible to the tenant.
+// The previous elements are deleted unless they are used by another config
+func ReplaceChainElements(ctx context.Context, id int, tenant string, elements []ChainElement) error {
+	tx, err := ConfigDb.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var oldChainID sql.NullInt64
+	err = tx.GetContext(ctx, &oldChainID, SchemaSQL(`SELECT chain_id FROM timetable.chain_execution_config
+WHERE chain_execution_config = $1`)+fmt.Sprintf(tenantFilter, 2)+` FOR UPDATE`, id, tenant)
+	if err == sql.ErrNoRows {
+		return ErrChainConfigNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.chain_execution_parameters WHERE chain_execution_config = $1"),
+		id); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, SchemaSQL("UPDATE timetable.chain_execution_config SET chain_id = NULL WHERE chain_execution_config = $1"),
+		id); err != nil {
+		return err
+	}
+	if err = deleteUnusedChain(ctx, tx, oldChainID); err != nil {
+		return err
+	}
+	var headID, parentID sql.NullInt64
+	for _, e := range elements {
+		var chainID int64
+		err = tx.GetContext(ctx, &chainID, SchemaSQL(`INSERT INTO timetable.task_chain
+(parent_id, task_id, run_uid, database_connection, ignore_error, autonomous)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING chain_id`),
+			parentID, e.TaskID, e.RunUID, e.DatabaseConnection, e.IgnoreError, e.Autonomous)
+		if err != nil {
+			return err
+		}
+		for i, p := range e.Parameters {
+			if _, err = tx.ExecContext(ctx, SchemaSQL(`INSERT INTO timetable.chain_execution_parameters
+(chain_execution_config, chain_id, order_id, value) VALUES ($1, $2, $3, $4)`), id, chainID, i+1, string(p)); err != nil {
+				return err
+			}
+		}
+		parentID = sql.NullInt64{Int64: chainID, Valid: true}
+		if !headID.Valid {
+			headID = parentID
+		}
+	}
+	if _, err = tx.ExecContext(ctx, SchemaSQL(`UPDATE timetable.chain_execution_config SET chain_id = $2
+WHERE chain_execution_config = $1`), id, headID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChainRuns returns the latest runs of the chain visible to the tenant, the newest first
+func GetChainRuns(ctx context.Context, id int, tenant string, limit int) ([]ChainRunInfo, error) {
+	if _, err := GetChainConfig(ctx, id, tenant); err != nil {
+		return nil, err
+	}
+	runs := []ChainRunInfo{}
+	err := ConfigDb.SelectContext(ctx, &runs, SchemaSQL(sqlSelectChainRuns), id, limit)
+	return runs, err
+}
+
+// ListTasks returns all base tasks
+func ListTasks(ctx context.Context) ([]Task, error) {
+	tasks := []Task{}
+	err := ConfigDb.SelectContext(ctx, &tasks, SchemaSQL(sqlSelectTasks)+" ORDER BY task_id")
+	return tasks, err
+}
+
+// GetTask returns the base task by id
+func GetTask(ctx context.Context, id int) (t Task, err error) {
+	err = ConfigDb.GetContext(ctx, &t, SchemaSQL(sqlSelectTasks)+" WHERE task_id = $1", id)
+	if err == sql.ErrNoRows {
+		err = ErrTaskNotFound
+	}
+	return
+}
+
+// CreateTask inserts the base task and returns its id, SQL kind is used if the kind is empty
+func CreateTask(ctx context.Context, t Task) (id int, err error) {
+	err = ConfigDb.GetContext(ctx, &id, SchemaSQL(`INSERT INTO timetable.base_task (name, kind, script, description, runbook_url)
+VALUES ($1, COALESCE(NULLIF($2, ''), 'SQL')::timetable.task_kind, $3, $4, $5) RETURNING task_id`),
+		t.Name, t.Kind, t.Script, t.Description, t.RunbookURL)
+	return
+}
+
+// UpdateTask updates the base task, all chains using the task are affected
+func UpdateTask(ctx context.Context, t Task) error {
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL(`UPDATE timetable.base_task SET name = $2,
+kind = COALESCE(NULLIF($3, ''), 'SQL')::timetable.task_kind, script = $4, description = $5, runbook_url = $6
+WHERE task_id = $1`), t.ID, t.Name, t.Kind, t.Script, t.Description, t.RunbookURL)
+	return checkAffected(res, err, ErrTaskNotFound)
+}
+
+// DeleteTask deletes the base task, elements using the task are removed from their chains by trigger
+func DeleteTask(ctx context.Context, id int) error {
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL("DELETE FROM timetable.base_task WHERE task_id = $1"), id)
+	return checkAffected(res, err, ErrTaskNotFound)
+}
+
+// checkAffected returns notFound error if the statement succeeded but no rows were affected
+func checkAffected(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -3,19 +3,29 @@ package pgengine
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/cybertec-postgresql/pg_timetable/internal/migrator"
 )
 
 var m *migrator.Migrator
 
+// NoProgramUpgrade allows running against the schema upgraded by the newer version of pg_timetable.
+// Features depending on unknown schema changes are checked by ValidateSchema
+var NoProgramUpgrade bool
+
 // MigrateDb upgrades database with all migrations
 func MigrateDb(ctx context.Context) bool {
 	LogToDB("LOG", "Upgrading database...")
 	if err := m.Migrate(ctx, ConfigDb.DB); err != nil {
+		if errors.Is(err, migrator.ErrNewerSchema) {
+			return checkNewerSchema(ctx)
+		}
 		LogToDB("PANIC", err)
 		return false
 	}
+	logSchemaVersion(ctx)
 	return true
 }
 
@@ -23,19 +33,47 @@ func MigrateDb(ctx context.Context) bool {
 func CheckNeedMigrateDb(ctx context.Context) (bool, error) {
 	LogToDB("DEBUG", "Check need of upgrading database...")
 	upgrade, err := m.NeedUpgrade(ctx, ConfigDb.DB)
+	if errors.Is(err, migrator.ErrNewerSchema) {
+		if checkNewerSchema(ctx) {
+			return false, nil
+		}
+		return false, err
+	}
 	if upgrade {
 		LogToDB("PANIC", "You need to upgrade your database before proceeding, use --upgrade option")
 	}
 	if err != nil {
 		LogToDB("PANIC", err)
 	}
+	if !upgrade && err == nil {
+		logSchemaVersion(ctx)
+	}
 	return upgrade, err
 }
 
+// checkNewerSchema reports the schema upgraded by the newer version of pg_timetable,
+// returns true if the client may proceed anyway
+func checkNewerSchema(ctx context.Context) bool {
+	version, _ := m.Version(ctx, ConfigDb.DB)
+	if !NoProgramUpgrade {
+		LogToDB("PANIC", fmt.Sprintf("Database schema version %q is newer than this client supports, "+
+			"upgrade pg_timetable or use --no-program-upgrade option", version))
+		return false
+	}
+	LogToDB("LOG", fmt.Sprintf("Database schema version %q is newer than this client supports, proceeding", version))
+	return true
+}
+
+func logSchemaVersion(ctx context.Context) {
+	if version, err := m.Version(ctx, ConfigDb.DB); err == nil {
+		LogToDB("LOG", "Database schema version: ", version)
+	}
+}
+
 func init() {
 	var err error
 	m, err = migrator.New(
-		migrator.TableName("timetable.migrations"),
+		migrator.TableName(SchemaSQL("timetable.migrations")),
 		migrator.SetNotice(func(s string) {
 			LogToDB("LOG", s)
 		}),
@@ -54,7 +92,7 @@ func init() {
 			&migrator.Migration{
 				Name: "0086 Add task output to execution_log",
 				Func: func(tx *sql.Tx) error {
-					_, err := tx.Exec("ALTER TABLE timetable.execution_log " +
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.execution_log ") +
 						"ADD COLUMN output TEXT")
 					return err
 				},
@@ -66,11 +104,479 @@ func init() {
 			&migrator.Migration{
 				Name: "0122 Add autonomous tasks",
 				Func: func(tx *sql.Tx) error {
-					_, err := tx.Exec("ALTER TABLE timetable.task_chain " +
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ") +
 						"ADD COLUMN autonomous BOOLEAN NOT NULL DEFAULT false")
 					return err
 				},
 			},
+			&migrator.Migration{
+				Name: "0279 Add resume_run function",
+				Func: migration279,
+			},
+			&migrator.Migration{
+				Name: "0279 Add ExportRunHistory built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "ExportRunHistory")
+				},
+			},
+			&migrator.Migration{
+				Name: "0280 Add Retention built-in task and default chain",
+				Func: func(tx *sql.Tx) error {
+					if err := addBuiltinTask(tx, "Retention"); err != nil {
+						return err
+					}
+					_, err := tx.Exec(SchemaSQL(sqlRetentionChain))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0281 Add self_destruct_mode to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ") +
+						"ADD COLUMN self_destruct_mode TEXT NOT NULL DEFAULT 'ALWAYS' " +
+						"CHECK (self_destruct_mode IN ('ALWAYS', 'ON_SUCCESS', 'DISABLE_ON_FAILURE'))")
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0282 Add HTTP task kind",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					// ALTER TYPE ... ADD VALUE cannot be executed inside a transaction block for PostgreSQL < 12
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.task_kind ADD VALUE IF NOT EXISTS 'HTTP'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0282 Add schedule_engine to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.chain_execution_config 
+	ADD COLUMN schedule_engine TEXT,
+	ADD COLUMN schedule TEXT,
+	ADD CHECK ((schedule_engine IS NULL) = (schedule IS NULL)),
+	ADD CHECK (schedule_engine IS NULL OR run_at IS NULL)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0284 Add Notify built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "Notify")
+				},
+			},
+			&migrator.Migration{
+				Name: "0284 Add S3Upload and S3Download built-in tasks",
+				Func: func(tx *sql.Tx) error {
+					if err := addBuiltinTask(tx, "S3Upload"); err != nil {
+						return err
+					}
+					return addBuiltinTask(tx, "S3Download")
+				},
+			},
+			&migrator.Migration{
+				Name: "0285 Add SftpUpload and SftpDownload built-in tasks",
+				Func: func(tx *sql.Tx) error {
+					if err := addBuiltinTask(tx, "SftpUpload"); err != nil {
+						return err
+					}
+					return addBuiltinTask(tx, "SftpDownload")
+				},
+			},
+			&migrator.Migration{
+				Name: "0285 Add worker identity to run_status",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.run_status
+	ADD COLUMN worker_id INTEGER,
+	ADD COLUMN host TEXT,
+	ADD COLUMN child_pid INTEGER`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0286 Add Backup built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "Backup")
+				},
+			},
+			&migrator.Migration{
+				Name: "0287 Add CopyFromFile built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "CopyFromFile")
+				},
+			},
+			&migrator.Migration{
+				Name: "0287 Add run_summary table",
+				Func: migration287,
+			},
+			&migrator.Migration{
+				Name: "0288 Add CopyToFile built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "CopyToFile")
+				},
+			},
+			&migrator.Migration{
+				Name: "0289 Add tenant quotas",
+				Func: migration289,
+			},
+			&migrator.MigrationNoTx{
+				Name: "0289 Add QUOTA_EXCEEDED execution status",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.execution_status ADD VALUE IF NOT EXISTS 'QUOTA_EXCEEDED'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0290 Add Slack built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "Slack")
+				},
+			},
+			&migrator.Migration{
+				Name: "0290 Add api_token table",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.api_token (
+	token_hash					TEXT		PRIMARY KEY,
+	tenant						TEXT		NOT NULL,
+	comment						TEXT
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0291 Add RowCountSnapshot built-in task",
+				Func: func(tx *sql.Tx) error {
+					if err := addBuiltinTask(tx, "RowCountSnapshot"); err != nil {
+						return err
+					}
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.row_count_snapshot (
+	table_name					TEXT		NOT NULL,
+	taken						TIMESTAMPTZ	NOT NULL DEFAULT clock_timestamp(),
+	row_count					BIGINT		NOT NULL,
+	checksum					TEXT,
+	PRIMARY KEY (table_name, taken)
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0291 Add Telegram built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "Telegram")
+				},
+			},
+			&migrator.Migration{
+				Name: "0292 Add on_commit to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ") +
+						"ADD COLUMN on_commit BOOLEAN NOT NULL DEFAULT false")
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0292 Add PROGRAM task kind",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.task_kind ADD VALUE IF NOT EXISTS 'PROGRAM'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0293 Add compensate_task_id to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ") +
+						SchemaSQL("ADD COLUMN compensate_task_id BIGINT REFERENCES timetable.base_task(task_id) ") +
+						"ON UPDATE CASCADE ON DELETE SET NULL")
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0294 Add workdir, umask and stdin to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ") +
+						"ADD COLUMN workdir TEXT, " +
+						"ADD COLUMN umask TEXT CHECK (umask ~ '^[0-7]{3,4}$'), " +
+						"ADD COLUMN stdin TEXT")
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0296 Add affinity to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ") +
+						"ADD COLUMN affinity TEXT CHECK (affinity IN ('PREFER', 'REQUIRE')), " +
+						"ADD COLUMN affinity_failover INTERVAL, " +
+						"ADD CHECK (affinity_failover IS NULL OR affinity = 'REQUIRE')")
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0297 Add DOCKER task kind",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.task_kind ADD VALUE IF NOT EXISTS 'DOCKER'"))
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0298 Add K8S_JOB task kind",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.task_kind ADD VALUE IF NOT EXISTS 'K8S_JOB'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0300 Add RefreshMatViews built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "RefreshMatViews")
+				},
+			},
+			&migrator.Migration{
+				Name: "0300 Add KubernetesJob built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "KubernetesJob")
+				},
+			},
+			&migrator.Migration{
+				Name: "0301 Add PartitionMaintenance built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "PartitionMaintenance")
+				},
+			},
+			&migrator.Migration{
+				Name: "0301 Add run_artifact table and StoreArtifacts built-in task",
+				Func: func(tx *sql.Tx) error {
+					if err := addBuiltinTask(tx, "StoreArtifacts"); err != nil {
+						return err
+					}
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.run_artifact (
+	artifact_id					BIGSERIAL	PRIMARY KEY,
+	run_status					BIGINT		NOT NULL,
+	chain_execution_config		BIGINT,
+	task_name					TEXT		NOT NULL,
+	file_name					TEXT		NOT NULL,
+	path						TEXT		NOT NULL,
+	size						BIGINT		NOT NULL,
+	client_name					TEXT		NOT NULL,
+	created						TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	expires						TIMESTAMPTZ
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0302 Add chain_wait table",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.chain_wait (
+	chain_execution_config		BIGINT		NOT NULL,
+	reason						TEXT		NOT NULL,
+	client_name					TEXT		NOT NULL,
+	started						TIMESTAMPTZ	NOT NULL,
+	finished					TIMESTAMPTZ	NOT NULL
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0303 Add execution window to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ") +
+						"ADD COLUMN window_start TIME, " +
+						"ADD COLUMN window_end TIME, " +
+						"ADD CHECK ((window_start IS NULL) = (window_end IS NULL) AND window_start <> window_end)")
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0304 Add WaitFor built-in task",
+				Func: func(tx *sql.Tx) error {
+					return addBuiltinTask(tx, "WaitFor")
+				},
+			},
+			&migrator.Migration{
+				Name: "0305 Add client table",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.client (
+	client_name					TEXT		PRIMARY KEY,
+	hostname					TEXT,
+	pid							INTEGER		NOT NULL,
+	load1						FLOAT8,
+	load5						FLOAT8,
+	load15						FLOAT8,
+	mem_total					BIGINT,
+	mem_available				BIGINT,
+	disk_total					BIGINT,
+	disk_free					BIGINT,
+	reported					TIMESTAMPTZ	NOT NULL
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0307 Add sink to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ADD COLUMN sink JSONB"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0308 Add shell_disabled_action to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ") +
+						"ADD COLUMN shell_disabled_action TEXT NOT NULL DEFAULT 'FAIL' " +
+						"CHECK (shell_disabled_action IN ('FAIL', 'SKIP_ELEMENT', 'SKIP_CHAIN'))")
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0308 Add SHELL_DISABLED execution status",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.execution_status ADD VALUE IF NOT EXISTS 'SHELL_DISABLED'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0309 Add description and runbook_url to chains and tasks",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`
+ALTER TABLE timetable.base_task ADD COLUMN description TEXT, ADD COLUMN runbook_url TEXT;
+ALTER TABLE timetable.chain_execution_config ADD COLUMN description TEXT, ADD COLUMN runbook_url TEXT`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0309 Add secret to chain_execution_parameters",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_parameters ADD COLUMN secret BOOLEAN NOT NULL DEFAULT false"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0310 Add settings to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ADD COLUMN settings JSONB ") +
+						"CHECK (jsonb_typeof(settings) = 'object')")
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0311 Add run_as_role to task_chain",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.task_chain ADD COLUMN run_as_role TEXT"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0314 Add client_lease table",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`CREATE TABLE timetable.client_lease (
+	client_name					TEXT		PRIMARY KEY,
+	hostname					TEXT,
+	pid							INTEGER		NOT NULL,
+	expires						TIMESTAMPTZ	NOT NULL
+)`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0324 Add SLA to chain_execution_config",
+				Func: migration324,
+			},
+			&migrator.MigrationNoTx{
+				Name: "0324 Add ALERT log level",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.log_type ADD VALUE IF NOT EXISTS 'ALERT'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0325 Add heartbeat_url to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ADD COLUMN heartbeat_url TEXT"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0328 Add stdout and stderr to execution_log",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.execution_log ADD COLUMN stdout TEXT, ADD COLUMN stderr TEXT, ") +
+						"ADD COLUMN stdout_file TEXT, ADD COLUMN stderr_file TEXT")
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0332 Add import_source to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ADD COLUMN import_source TEXT"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0343 Add client groups",
+				Func: migration343,
+			},
+			&migrator.Migration{
+				Name: "0344 Add client heartbeat",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.client_lease
+	ADD COLUMN heartbeat TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN lost TIMESTAMPTZ;
+
+CREATE VIEW timetable.client_status AS
+SELECT client_name, hostname, pid, client_group, heartbeat, expires, expires < now() AS dead, lost
+FROM timetable.client_lease`))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0346 Add idempotent to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ADD COLUMN idempotent BOOLEAN NOT NULL DEFAULT false"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0347 Add circuit breaker to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.chain_execution_config
+	ADD COLUMN max_failures INTEGER CHECK (max_failures > 0),
+	ADD COLUMN failure_cooldown INTERVAL CHECK (failure_cooldown > '0'::interval),
+	ADD COLUMN suspended TIMESTAMPTZ`))
+					return err
+				},
+			},
+			&migrator.MigrationNoTx{
+				Name: "0348 Add SKIPPED execution status",
+				Func: func(ctx context.Context, db *sql.DB) error {
+					_, err := db.ExecContext(ctx, SchemaSQL("ALTER TYPE timetable.execution_status ADD VALUE IF NOT EXISTS 'SKIPPED'"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0348 Add run_if to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ADD COLUMN run_if TEXT"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0349 Add mutexes to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ADD COLUMN mutexes TEXT[]"))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0352 Make is_cron_in_time daylight saving time safe",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL(sqlIsCronInTime))
+					return err
+				},
+			},
+			&migrator.Migration{
+				Name: "0353 Add interval_aligned to chain_execution_config",
+				Func: func(tx *sql.Tx) error {
+					_, err := tx.Exec(SchemaSQL("ALTER TABLE timetable.chain_execution_config ") +
+						"ADD COLUMN interval_aligned BOOLEAN NOT NULL DEFAULT false")
+					return err
+				},
+			},
 			// adding new migration here, update "timetable"."migrations" in "sql_ddl.go"
 		),
 	)
@@ -81,9 +587,118 @@ func init() {
 
 // below this line should appear migration funсtions only
 
+// addBuiltinTask registers the new builtin implemented in the tasks package
+func addBuiltinTask(tx *sql.Tx, name string) error {
+	_, err := tx.Exec(SchemaSQL("INSERT INTO timetable.base_task(task_id, name, script, kind) VALUES (DEFAULT, $1, $1, 'BUILTIN')"), name)
+	return err
+}
+
+func migration289(tx *sql.Tx) error {
+	_, err := tx.Exec(SchemaSQL(`
+ALTER TABLE timetable.chain_execution_config 
+	ADD COLUMN tenant TEXT NOT NULL DEFAULT current_user;
+
+CREATE TABLE timetable.tenant_quota (
+	tenant						TEXT		PRIMARY KEY,
+	max_chains					INTEGER		CHECK (max_chains >= 0),
+	max_runs_per_hour			INTEGER		CHECK (max_runs_per_hour >= 0),
+	max_runtime_per_day			INTERVAL
+);
+
+CREATE OR REPLACE FUNCTION timetable.trig_max_chains() RETURNS trigger AS $$
+DECLARE
+	v_max_chains INTEGER;
+BEGIN
+	SELECT max_chains FROM timetable.tenant_quota WHERE tenant = NEW.tenant INTO v_max_chains;
+	IF v_max_chains <= (SELECT count(*) FROM timetable.chain_execution_config 
+		WHERE tenant = NEW.tenant AND chain_execution_config <> NEW.chain_execution_config) THEN
+		RAISE EXCEPTION 'Tenant % exceeded max_chains quota of %', NEW.tenant, v_max_chains
+		USING 
+			ERRCODE = 'program_limit_exceeded',
+			HINT = 'Please check timetable.tenant_quota';
+	END IF;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trig_max_chains
+	BEFORE INSERT OR UPDATE OF tenant ON timetable.chain_execution_config
+	FOR EACH ROW EXECUTE PROCEDURE timetable.trig_max_chains();
+
+-- check_quota() returns the reason if the tenant owning the chain exceeded its quota, NULL otherwise
+CREATE OR REPLACE FUNCTION timetable.check_quota(config_id BIGINT) RETURNS TEXT AS $$
+    SELECT CASE
+        WHEN q.max_runs_per_hour <= (
+            SELECT count(*) FROM timetable.run_status s 
+                JOIN timetable.chain_execution_config cc USING (chain_execution_config)
+            WHERE cc.tenant = q.tenant AND s.start_status IS NULL AND s.execution_status = 'STARTED'
+                AND s.started > now() - interval '1 hour')
+        THEN format('Tenant %s exceeded max_runs_per_hour quota of %s', q.tenant, q.max_runs_per_hour)
+        WHEN q.max_runtime_per_day <= (
+            SELECT COALESCE(sum(s.finished - s.started), interval '0') FROM timetable.run_summary s 
+                JOIN timetable.chain_execution_config cc USING (chain_execution_config)
+            WHERE cc.tenant = q.tenant AND s.finished > now() - interval '1 day')
+        THEN format('Tenant %s exceeded max_runtime_per_day quota of %s', q.tenant, q.max_runtime_per_day)
+    END
+    FROM timetable.tenant_quota q JOIN timetable.chain_execution_config c ON c.tenant = q.tenant
+    WHERE c.chain_execution_config = config_id
+$$ LANGUAGE 'sql' STABLE;`))
+	return err
+}
+
+func migration287(tx *sql.Tx) error {
+	_, err := tx.Exec(SchemaSQL(`
+CREATE TABLE timetable.run_summary (
+	run_status					BIGINT		PRIMARY KEY REFERENCES timetable.run_status(run_status)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	chain_execution_config		BIGINT,
+	started						TIMESTAMPTZ	NOT NULL,
+	finished					TIMESTAMPTZ	NOT NULL,
+	kind_durations				JSONB		NOT NULL DEFAULT '{}',
+	rows_affected				BIGINT		NOT NULL DEFAULT 0,
+	output_bytes				BIGINT		NOT NULL DEFAULT 0,
+	retries						INTEGER		NOT NULL DEFAULT 0,
+	execution_status			TEXT		NOT NULL,
+	client_name					TEXT		NOT NULL
+);`))
+	return err
+}
+
+func migration279(tx *sql.Tx) error {
+	_, err := tx.Exec(SchemaSQL(`
+CREATE TABLE timetable.run_resume (
+	run_status					BIGINT		PRIMARY KEY REFERENCES timetable.run_status(run_status)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	requested					TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	resumed						TIMESTAMPTZ
+);
+
+CREATE OR REPLACE FUNCTION timetable.resume_run(run_status_id BIGINT) RETURNS BIGINT AS $$
+DECLARE
+    v_failed_element BIGINT;
+BEGIN
+    SELECT chain_id FROM timetable.run_status
+    WHERE start_status = run_status_id AND execution_status = 'CHAIN_FAILED'
+    INTO v_failed_element;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Failed chain run not found --> %', run_status_id
+        USING 
+            ERRCODE = 'invalid_parameter_value',
+            HINT = 'Please check run_status identifier of the failed run';
+    END IF;
+    INSERT INTO timetable.run_resume (run_status) VALUES (run_status_id)
+    ON CONFLICT (run_status) DO UPDATE SET requested = now(), resumed = NULL;
+    RETURN v_failed_element;
+END
+$$ LANGUAGE 'plpgsql';`))
+	return err
+}
+
 func migration108(tx *sql.Tx) error {
 	// first set <unknown> for existing rows, then drop default to force application to set it
-	_, err := tx.Exec(`
+	_, err := tx.Exec(SchemaSQL(`
 ALTER TABLE timetable.execution_log
 	ADD COLUMN client_name TEXT NOT NULL DEFAULT '<unknown>';
 ALTER TABLE timetable.run_status
@@ -91,12 +706,12 @@ ALTER TABLE timetable.run_status
 ALTER TABLE timetable.execution_log
 	ALTER COLUMN client_name DROP DEFAULT;
 ALTER TABLE timetable.run_status
-	ALTER COLUMN client_name DROP DEFAULT;`)
+	ALTER COLUMN client_name DROP DEFAULT;`))
 	return err
 }
 
 func migration70(tx *sql.Tx) error {
-	if _, err := tx.Exec(`
+	if _, err := tx.Exec(SchemaSQL(`
 CREATE DOMAIN timetable.cron AS TEXT CHECK(
 	substr(VALUE, 1, 6) IN ('@every', '@after') AND (substr(VALUE, 7) :: INTERVAL) IS NOT NULL	
 	OR VALUE IN ('@annually', '@yearly', '@monthly', '@weekly', '@daily', '@hourly', '@reboot')
@@ -187,8 +802,46 @@ INSERT INTO timetable.chain_execution_config (
     self_destruct
 FROM cte_chain
 RETURNING chain_execution_config 
-' LANGUAGE 'sql';`); err != nil {
+' LANGUAGE 'sql';`)); err != nil {
 		return err
 	}
 	return nil
 }
+
+func migration324(tx *sql.Tx) error {
+	_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.chain_execution_config
+	ADD COLUMN max_duration INTERVAL CHECK (max_duration > '0'::interval),
+	ADD COLUMN max_start_delay INTERVAL CHECK (max_start_delay > '0'::interval);
+
+CREATE TABLE timetable.sla_violation (
+	sla_violation				BIGSERIAL	PRIMARY KEY,
+	chain_execution_config		BIGINT		NOT NULL REFERENCES timetable.chain_execution_config(chain_execution_config)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	kind						TEXT		NOT NULL CHECK (kind IN ('MAX_DURATION', 'MISSED_START')),
+	run_status					BIGINT,
+	scheduled					TIMESTAMPTZ,
+	detected					TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	client_name					TEXT		NOT NULL,
+	UNIQUE (chain_execution_config, run_status),
+	UNIQUE (chain_execution_config, scheduled)
+)`))
+	return err
+}
+
+func migration343(tx *sql.Tx) error {
+	_, err := tx.Exec(SchemaSQL(`ALTER TABLE timetable.chain_execution_config ADD COLUMN client_group TEXT;
+
+ALTER TABLE timetable.client_lease ADD COLUMN client_group TEXT;
+
+CREATE TABLE timetable.chain_claim (
+	chain_execution_config		BIGINT		NOT NULL REFERENCES timetable.chain_execution_config(chain_execution_config)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	due							TIMESTAMPTZ	NOT NULL,
+	client_name					TEXT		NOT NULL,
+	claimed						TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	PRIMARY KEY (chain_execution_config, due)
+)`))
+	return err
+}
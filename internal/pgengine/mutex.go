@@ -0,0 +1,50 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// mutexLockClass is the class of advisory locks of chain mutexes, so they never collide with client name locks
+const mutexLockClass = AppID + 1
+
+// mutexLockID is the key of the advisory lock of the mutex, it depends on the schema name as client name locks do
+func mutexLockID(name string) int32 {
+	return int32(clientLockID(name))
+}
+
+// LockChainMutexes obtains transaction level advisory locks of mutexes declared by the chain. Locks are obtained
+// in the name order, so chains sharing mutexes are serialized across all clients without deadlocks.
+// Returns true if the run had to wait for chains holding the mutex
+func LockChainMutexes(ctx context.Context, tx *sqlx.Tx, chainConfigID int) (waited bool, err error) {
+	if !Enabled(FeatureMutexes) {
+		return false, nil
+	}
+	var names pq.StringArray
+	err = tx.GetContext(ctx, &names, SchemaSQL(`SELECT COALESCE(mutexes, '{}') FROM timetable.chain_execution_config
+WHERE chain_execution_config = $1`), chainConfigID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var locked bool
+		if err = tx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock($1, $2)", mutexLockClass, mutexLockID(name)); err != nil {
+			return
+		}
+		if locked {
+			continue
+		}
+		LogToDB("DEBUG", fmt.Sprintf("Waiting for mutex %s of chain configuration ID %d", name, chainConfigID))
+		if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2)", mutexLockClass, mutexLockID(name)); err != nil {
+			return
+		}
+		waited = true
+	}
+	return
+}
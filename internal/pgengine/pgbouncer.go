@@ -0,0 +1,54 @@
+package pgengine
+
+import (
+	"context"
+	"os"
+)
+
+// PgBouncerMode avoids session level features, so the client can run behind PgBouncer in transaction pooling mode.
+// The client name is locked with the lease in timetable.client_lease instead of the advisory lock
+var PgBouncerMode bool
+
+// clientLeaseTTL is the time the lease is valid without renewal, the scheduler renews it every minute.
+// In HA mode the leader renews it every HAHeartbeat, so the standby takes over within haLeaseTTL
+const (
+	clientLeaseTTL = "3 minutes"
+	haLeaseTTL     = "10 seconds"
+)
+
+func leaseTTL() string {
+	if HAMode {
+		return haLeaseTTL
+	}
+	return clientLeaseTTL
+}
+
+// sqlLeaseClientName obtains or renews the lease unless it's held by another living client
+const sqlLeaseClientName = `INSERT INTO timetable.client_lease (client_name, hostname, pid, expires)
+VALUES ($1, $2, $3, now() + $4::interval)
+ON CONFLICT (client_name) DO UPDATE SET hostname = EXCLUDED.hostname, pid = EXCLUDED.pid, expires = EXCLUDED.expires,
+	heartbeat = now(), lost = NULL
+WHERE client_lease.expires < now() OR (client_lease.hostname = EXCLUDED.hostname AND client_lease.pid = EXCLUDED.pid)
+RETURNING TRUE`
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// tryLeaseClientName obtains the lease of the client name, it must be renewed by calling it again
+func tryLeaseClientName(ctx context.Context) (res bool, err error) {
+	rows, err := ConfigDb.QueryContext(ctx, SchemaSQL(sqlLeaseClientName), ClientName, hostname(), os.Getpid(), leaseTTL())
+	if err != nil {
+		return false, err
+	}
+	res, err = rows.Next(), rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return false, err
+	}
+	if res {
+		joinClientGroup(ctx)
+	}
+	return res, nil
+}
@@ -3,7 +3,9 @@ package pgengine_test
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"hash/adler32"
 	"io/ioutil"
 	"os"
 	"strconv"
@@ -152,7 +154,7 @@ func TestInitAndTestConfigDBConnection(t *testing.T) {
 		var oid int
 		tableNames := []string{"database_connection", "base_task", "task_chain",
 			"chain_execution_config", "chain_execution_parameters",
-			"log", "execution_log", "run_status"}
+			"log", "execution_log", "run_status", "run_resume", "run_summary", "tenant_quota", "api_token", "row_count_snapshot"}
 		for _, tableName := range tableNames {
 			err := pgengine.ConfigDb.Get(&oid, fmt.Sprintf("SELECT COALESCE(to_regclass('timetable.%s'), 0) :: int", tableName))
 			assert.NoError(t, err, fmt.Sprintf("Query for %s existence failed", tableName))
@@ -166,7 +168,10 @@ func TestInitAndTestConfigDBConnection(t *testing.T) {
 			"validate_json_schema(jsonb, jsonb, jsonb)",
 			"get_running_jobs(bigint)",
 			"trig_chain_fixer()",
-			"is_cron_in_time(timetable.cron, timestamptz)"}
+			"is_cron_in_time(timetable.cron, timestamptz)",
+			"resume_run(bigint)",
+			"trig_max_chains()",
+			"check_quota(bigint)"}
 		for _, funcName := range funcNames {
 			err := pgengine.ConfigDb.Get(&oid, fmt.Sprintf("SELECT COALESCE(to_regprocedure('timetable.%s'), 0) :: int", funcName))
 			assert.NoError(t, err, fmt.Sprintf("Query for %s existence failed", funcName))
@@ -258,6 +263,10 @@ func TestSchedulerFunctions(t *testing.T) {
 		assert.Equal(t, false, pgengine.DeleteChainConfig(ctx, 0), "Should not delete in clean database")
 	})
 
+	t.Run("Check DisableChainConfig funсtion", func(t *testing.T) {
+		assert.Equal(t, false, pgengine.DisableChainConfig(ctx, 0), "Should not disable in clean database")
+	})
+
 	t.Run("Check GetChainElements funсtion", func(t *testing.T) {
 		var chains []pgengine.ChainElementExecution
 		tx, err := pgengine.StartTransaction(ctx)
@@ -271,19 +280,120 @@ func TestSchedulerFunctions(t *testing.T) {
 		var paramVals []string
 		tx, err := pgengine.StartTransaction(ctx)
 		assert.NoError(t, err, "Should start transaction")
-		assert.True(t, pgengine.GetChainParamValues(tx, &paramVals, &pgengine.ChainElementExecution{
+		assert.True(t, pgengine.GetChainParamValues(ctx, tx, &paramVals, &pgengine.ChainElementExecution{
 			ChainID:     0,
 			ChainConfig: 0}), "Should no error in clean database")
 		assert.Empty(t, paramVals, "Should be empty in clean database")
 		pgengine.MustCommitTransaction(tx)
 	})
 
+	t.Run("Check chain management functions", func(t *testing.T) {
+		taskID, err := pgengine.CreateTask(ctx, pgengine.Task{Name: "managed task", Script: "SELECT $1"})
+		assert.NoError(t, err, "Should create task")
+		runAt := "0 * * * *"
+		id, err := pgengine.CreateChainConfig(ctx, pgengine.ChainConfig{ChainName: "managed chain", RunAt: &runAt})
+		assert.NoError(t, err, "Should create chain")
+		_, err = pgengine.CreateChainConfig(ctx, pgengine.ChainConfig{ChainName: "managed chain"})
+		assert.True(t, pgengine.IsInvalidInput(err), "Duplicated name should be invalid input")
+
+		elements := []pgengine.ChainElement{
+			{TaskID: taskID, Parameters: []json.RawMessage{json.RawMessage(`[1]`), json.RawMessage(`[2]`)}},
+			{TaskID: taskID, IgnoreError: true}}
+		assert.NoError(t, pgengine.ReplaceChainElements(ctx, id, "", elements))
+		assert.NoError(t, pgengine.ReplaceChainElements(ctx, id, "", elements), "Should replace elements")
+		res, err := pgengine.ListChainElements(ctx, id, "")
+		assert.NoError(t, err)
+		if assert.Len(t, res, 2) {
+			assert.Equal(t, "managed task", res[0].TaskName)
+			assert.Len(t, res[0].Parameters, 2)
+			assert.True(t, res[1].IgnoreError)
+		}
+		var count int
+		assert.NoError(t, pgengine.ConfigDb.Get(&count, "SELECT count(*) FROM timetable.task_chain WHERE task_id = $1", taskID))
+		assert.Equal(t, 2, count, "Replaced elements should be deleted")
+
+		assert.NoError(t, pgengine.SetChainLive(ctx, id, "", true))
+		c, err := pgengine.GetChainConfig(ctx, id, "")
+		assert.NoError(t, err)
+		assert.True(t, c.Live)
+		_, err = pgengine.GetChainConfig(ctx, id, "other_tenant")
+		assert.Equal(t, pgengine.ErrChainConfigNotFound, err, "Chains of other tenants should be invisible")
+		runs, err := pgengine.GetChainRuns(ctx, id, "", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, runs)
+
+		d, err := pgengine.GetDashboard(ctx, "")
+		assert.NoError(t, err)
+		assert.Contains(t, d.Chains, pgengine.DashboardChain{ID: id, ChainName: "managed chain", Live: true, RunAt: &runAt})
+
+		_, err = pgengine.ConfigDb.Exec("UPDATE timetable.chain_execution_config SET max_start_delay = '1 minute' WHERE chain_execution_config = $1", id)
+		assert.NoError(t, err)
+		slaChains, err := pgengine.GetSLAChains(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, slaChains, 1)
+		scheduled := time.Now().Add(-time.Hour)
+		recorded, err := pgengine.RecordMissedStart(ctx, id, scheduled)
+		assert.NoError(t, err)
+		assert.True(t, recorded, "Should record the missed start")
+		recorded, err = pgengine.RecordMissedStart(ctx, id, scheduled)
+		assert.NoError(t, err)
+		assert.False(t, recorded, "Should record the missed start once")
+		_, err = pgengine.RecordOverruns(ctx)
+		assert.NoError(t, err)
+
+		assert.NoError(t, pgengine.RemoveChainConfig(ctx, id, ""))
+		assert.Equal(t, pgengine.ErrChainConfigNotFound, pgengine.RemoveChainConfig(ctx, id, ""))
+		assert.NoError(t, pgengine.ConfigDb.Get(&count, "SELECT count(*) FROM timetable.task_chain WHERE task_id = $1", taskID))
+		assert.Zero(t, count, "Elements of the deleted chain should be deleted")
+		assert.NoError(t, pgengine.DeleteTask(ctx, taskID))
+		assert.Equal(t, pgengine.ErrTaskNotFound, pgengine.DeleteTask(ctx, taskID))
+	})
+
+	t.Run("Check chain import", func(t *testing.T) {
+		chains := []pgengine.ChainDefinition{
+			{Name: "imported chain", RunAt: "0 1 * * *", Live: true, Source: "nightly.yaml", Tasks: []pgengine.TaskDefinition{
+				{Name: "imported task", Kind: "SQL", Script: "SELECT $1", Parameters: []json.RawMessage{json.RawMessage(`[1]`)}},
+				{Name: "Log", Kind: "BUILTIN", Script: "Log", IgnoreError: true}}}}
+		res, err := pgengine.ImportChainDefinitions(ctx, chains)
+		assert.NoError(t, err)
+		assert.Equal(t, pgengine.ImportResult{Created: 1}, res)
+		res, err = pgengine.ImportChainDefinitions(ctx, chains)
+		assert.NoError(t, err)
+		assert.Equal(t, pgengine.ImportResult{Unchanged: 1}, res, "Second import should change nothing")
+
+		chains[0].Tasks[0].Script = "SELECT $1, 2"
+		res, err = pgengine.ImportChainDefinitions(ctx, chains)
+		assert.NoError(t, err)
+		assert.Equal(t, pgengine.ImportResult{Updated: 1}, res, "Changed script should update the chain")
+
+		res, err = pgengine.ImportChainDefinitions(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, pgengine.ImportResult{Deleted: 1}, res, "Imported chain missing in definitions should be deleted")
+		var count int
+		assert.NoError(t, pgengine.ConfigDb.Get(&count, "SELECT count(*) FROM timetable.chain_execution_config WHERE chain_name = 'imported chain'"))
+		assert.Zero(t, count)
+		assert.NoError(t, pgengine.ConfigDb.Get(&count, "SELECT count(*) FROM timetable.base_task WHERE name = 'imported task'"))
+		assert.Equal(t, 1, count, "Base tasks should be kept")
+	})
+
 	t.Run("Check InsertChainRunStatus funсtion", func(t *testing.T) {
 		var id int
 		assert.NotPanics(t, func() { id = pgengine.InsertChainRunStatus(ctx, 0, 0) }, "Should no error in clean database")
 		assert.NotZero(t, id, "Run status id should be greater then 0")
 	})
 
+	t.Run("Check worker identity in run status", func(t *testing.T) {
+		id := pgengine.InsertChainRunStatus(pgengine.WithWorkerID(ctx, 3), 0, 0)
+		pgengine.UpdateChainRunStatus(pgengine.WithWorkerID(ctx, 3), &pgengine.ChainElementExecution{ChildPID: 42}, id, "CHAIN_DONE")
+		var workerID, childPID int
+		var host string
+		assert.NoError(t, pgengine.ConfigDb.QueryRow("SELECT worker_id, host, child_pid FROM timetable.run_status "+
+			"WHERE start_status = $1", id).Scan(&workerID, &host, &childPID))
+		assert.Equal(t, 3, workerID)
+		assert.Equal(t, pgengine.Host, host)
+		assert.Equal(t, 42, childPID)
+	})
+
 	t.Run("Check Remote DB Connection string", func(t *testing.T) {
 		var databaseConnection sql.NullString
 		tx, err := pgengine.StartTransaction(ctx)
@@ -306,6 +416,277 @@ func TestSchedulerFunctions(t *testing.T) {
 		pgengine.MustCommitTransaction(tx)
 	})
 
+	t.Run("Check remote SQL task", func(t *testing.T) {
+		connstr := fmt.Sprintf("host='%s' port='%s' sslmode='%s' dbname='%s' user='%s' password='%s'",
+			cmdOpts.Host, cmdOpts.Port, cmdOpts.SSLMode, cmdOpts.Dbname, cmdOpts.User, cmdOpts.Password)
+		_, err := pgengine.ConfigDb.Exec("CREATE TABLE timetable.remote_test(id int)")
+		assert.NoError(t, err)
+		defer pgengine.ConfigDb.MustExec("DROP TABLE timetable.remote_test")
+		chainElemExec := &pgengine.ChainElementExecution{
+			Script:             "INSERT INTO timetable.remote_test VALUES (1)",
+			DatabaseConnection: sql.NullString{String: "1", Valid: true},
+			ConnectString:      sql.NullString{String: connstr, Valid: true}}
+		tx, err := pgengine.StartTransaction(ctx)
+		assert.NoError(t, err, "Should start transaction")
+		assert.NoError(t, pgengine.ExecuteSQLTask(ctx, tx, chainElemExec, nil))
+		chainElemExec.Script = "SELECT 1/0"
+		assert.Error(t, pgengine.ExecuteSQLTask(ctx, tx, chainElemExec, nil), "Failed remote task should be rolled back")
+		pgengine.MustRollbackTransaction(tx)
+		var num int
+		assert.NoError(t, pgengine.ConfigDb.Get(&num, "SELECT count(*) FROM timetable.remote_test"))
+		assert.Equal(t, 1, num, "Remote task should be committed independently of the chain transaction")
+	})
+
+	t.Run("Check cron daylight saving time", func(t *testing.T) {
+		tx, err := pgengine.StartTransaction(ctx)
+		require.NoError(t, err)
+		defer pgengine.MustRollbackTransaction(tx)
+		_, err = tx.Exec("SET LOCAL TIME ZONE 'Europe/Berlin'")
+		require.NoError(t, err)
+		var due bool
+		// 2021-03-28 02:00 CET is skipped, 2021-10-31 02:00-02:59 CEST is repeated
+		for ts, expected := range map[string]bool{
+			"2021-03-28 03:00:10+02": true,
+			"2021-03-28 03:30:00+02": false,
+			"2021-10-31 02:30:00+02": true,
+			"2021-10-31 02:30:00+01": false,
+		} {
+			assert.NoError(t, tx.Get(&due, "SELECT timetable.is_cron_in_time('30 2 * * *', $1)", ts))
+			assert.Equal(t, expected, due, ts)
+		}
+		assert.NoError(t, tx.Get(&due, "SELECT timetable.is_cron_in_time('30 * * * *', '2021-10-31 02:30:00+01')"))
+		assert.True(t, due, "Chains with any hour should follow the elapsed time")
+	})
+
+	t.Run("Check SQL task cancellation", func(t *testing.T) {
+		tx, err := pgengine.StartTransaction(ctx)
+		require.NoError(t, err)
+		defer pgengine.MustRollbackTransaction(tx)
+		taskCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		assert.Error(t, pgengine.ExecuteSQLTask(taskCtx, tx, &pgengine.ChainElementExecution{Script: "SELECT pg_sleep(30)"}, nil))
+		assert.True(t, time.Since(started) < 10*time.Second, "Query should be cancelled on the server")
+	})
+
+	t.Run("Check savepoint functions", func(t *testing.T) {
+		tx, err := pgengine.StartTransaction(ctx)
+		assert.NoError(t, err, "Should start transaction")
+		savepoint := pgengine.TaskSavepoint(&pgengine.ChainElementExecution{ChainID: 42})
+		assert.Equal(t, "task_42", savepoint, "Savepoint name should be based on chain ID")
+		pgengine.MustSavepoint(tx, savepoint)
+		assert.Error(t, pgengine.ExecuteSQLCommand(tx, "SELECT 1/0", nil), "Division by zero should fail")
+		pgengine.MustRollbackToSavepoint(tx, savepoint)
+		assert.NoError(t, pgengine.ExecuteSQLCommand(tx, "SELECT 1", nil), "Transaction should be usable after rollback to savepoint")
+		pgengine.MustSavepoint(tx, savepoint)
+		pgengine.MustReleaseSavepoint(tx, savepoint)
+		assert.NoError(t, pgengine.ExecuteSQLCommand(tx, "SELECT 1", nil), "Transaction should be usable after savepoint release")
+		pgengine.MustCommitTransaction(tx)
+	})
+
+	t.Run("Check run summary functions", func(t *testing.T) {
+		tx, err := pgengine.StartTransaction(ctx)
+		assert.NoError(t, err, "Should start transaction")
+		elem := &pgengine.ChainElementExecution{Kind: "SQL", Script: "SELECT generate_series(1, 3)", Duration: 1500000, OutputBytes: 10}
+		assert.NoError(t, pgengine.ExecuteSQLTask(ctx, tx, elem, nil), "Simple query should succeed")
+		assert.EqualValues(t, 3, elem.RowsAffected, "Rows affected should be counted")
+		pgengine.MustCommitTransaction(tx)
+
+		id := pgengine.InsertChainRunStatus(ctx, 0, 0)
+		summary := pgengine.NewRunSummary(id, 0, time.Now())
+		summary.Add(elem)
+		elem.Run = &pgengine.ChainRun{Retries: 2}
+		summary.Add(elem)
+		pgengine.LogRunSummary(ctx, summary, time.Now(), "CHAIN_DONE")
+		var rows, bytes, retries int64
+		var duration float64
+		assert.NoError(t, pgengine.ConfigDb.QueryRow("SELECT rows_affected, output_bytes, retries, (kind_durations->>'SQL')::float8 "+
+			"FROM timetable.run_summary WHERE run_status = $1", id).Scan(&rows, &bytes, &retries, &duration))
+		assert.EqualValues(t, 6, rows)
+		assert.EqualValues(t, 20, bytes)
+		assert.EqualValues(t, 2, retries, "Retries of the run should be reported")
+		assert.Equal(t, 3.0, duration)
+	})
+
+	t.Run("Check tenant quota functions", func(t *testing.T) {
+		var cfgID int
+		assert.NoError(t, pgengine.ConfigDb.Get(&cfgID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, tenant) VALUES ('quota test', 'quota_tenant') RETURNING chain_execution_config"))
+		assert.True(t, pgengine.CheckChainQuota(ctx, cfgID, 0), "Chain without quota should proceed")
+
+		_, err := pgengine.ConfigDb.Exec("INSERT INTO timetable.tenant_quota (tenant, max_chains, max_runs_per_hour) " +
+			"VALUES ('quota_tenant', 1, 1)")
+		assert.NoError(t, err)
+		_, err = pgengine.ConfigDb.Exec("INSERT INTO timetable.chain_execution_config " +
+			"(chain_name, tenant) VALUES ('quota test 2', 'quota_tenant')")
+		assert.Error(t, err, "Should fail on max_chains quota")
+
+		assert.True(t, pgengine.CheckChainQuota(ctx, cfgID, 0), "Chain within quota should proceed")
+		pgengine.InsertChainRunStatus(ctx, cfgID, 0)
+		assert.False(t, pgengine.CheckChainQuota(ctx, cfgID, 0), "Should fail on max_runs_per_hour quota")
+		var num int
+		assert.NoError(t, pgengine.ConfigDb.Get(&num, "SELECT count(*) FROM timetable.run_status "+
+			"WHERE chain_execution_config = $1 AND execution_status = 'QUOTA_EXCEEDED'", cfgID))
+		assert.Equal(t, 1, num, "Exceeded quota should be registered")
+	})
+
+	t.Run("Check circuit breaker functions", func(t *testing.T) {
+		var cfgID int
+		assert.NoError(t, pgengine.ConfigDb.Get(&cfgID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, live, max_failures, failure_cooldown) VALUES ('breaker test', TRUE, 2, '1 minute') "+
+			"RETURNING chain_execution_config"))
+		const sqlFinish = "INSERT INTO timetable.run_status (execution_status, started, last_status_update, " +
+			"chain_execution_config, client_name) VALUES ($1, now(), now(), $2, 'pgengine_unit_test')"
+		for _, status := range []string{"CHAIN_FAILED", "CHAIN_DONE", "CHAIN_FAILED"} {
+			_, err := pgengine.ConfigDb.Exec(sqlFinish, status, cfgID)
+			require.NoError(t, err)
+		}
+		_, suspended := pgengine.SuspendFailingChain(ctx, cfgID)
+		assert.False(t, suspended, "Failures before the successful run should not count")
+		_, err := pgengine.ConfigDb.Exec(sqlFinish, "CHAIN_FAILED", cfgID)
+		require.NoError(t, err)
+		maxFailures, suspended := pgengine.SuspendFailingChain(ctx, cfgID)
+		assert.True(t, suspended)
+		assert.Equal(t, 2, maxFailures)
+
+		chains, err := pgengine.ResumeSuspendedChains(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, chains, "Chain should be suspended until the cooldown passes")
+		_, err = pgengine.ConfigDb.Exec("UPDATE timetable.chain_execution_config SET suspended = now() - '1 hour'::interval "+
+			"WHERE chain_execution_config = $1", cfgID)
+		require.NoError(t, err)
+		chains, err = pgengine.ResumeSuspendedChains(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []pgengine.SuspendedChain{{ChainConfig: cfgID, ChainName: "breaker test"}}, chains)
+	})
+
+	t.Run("Check chain precondition", func(t *testing.T) {
+		var cfgID int
+		assert.NoError(t, pgengine.ConfigDb.Get(&cfgID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, run_if) VALUES ('precondition test', 'EXISTS(SELECT 1 FROM timetable.log WHERE false)') "+
+			"RETURNING chain_execution_config"))
+		assert.False(t, pgengine.CheckChainPrecondition(ctx, cfgID, 0), "Chain should be skipped")
+		var num int
+		assert.NoError(t, pgengine.ConfigDb.Get(&num, "SELECT count(*) FROM timetable.run_status "+
+			"WHERE chain_execution_config = $1 AND execution_status = 'SKIPPED'", cfgID))
+		assert.Equal(t, 1, num, "Skipped run should be registered")
+
+		_, err := pgengine.ConfigDb.Exec("UPDATE timetable.chain_execution_config SET run_if = 'true' "+
+			"WHERE chain_execution_config = $1", cfgID)
+		require.NoError(t, err)
+		assert.True(t, pgengine.CheckChainPrecondition(ctx, cfgID, 0))
+		_, err = pgengine.ConfigDb.Exec("UPDATE timetable.chain_execution_config SET run_if = 'foo bar' "+
+			"WHERE chain_execution_config = $1", cfgID)
+		require.NoError(t, err)
+		assert.False(t, pgengine.CheckChainPrecondition(ctx, cfgID, 0), "Invalid expression should not run the chain")
+		for _, runIf := range []string{"true); DELETE FROM timetable.log; SELECT (true",
+			"true)::boolean WHERE $1; DELETE FROM timetable.log --"} {
+			_, err = pgengine.ConfigDb.Exec("UPDATE timetable.chain_execution_config SET run_if = $1 "+
+				"WHERE chain_execution_config = $2", runIf, cfgID)
+			require.NoError(t, err)
+			assert.NoError(t, pgengine.ConfigDb.Get(&num, "SELECT count(*) FROM timetable.log"))
+			assert.False(t, pgengine.CheckChainPrecondition(ctx, cfgID, 0), "Several statements should not run the chain")
+			var after int
+			assert.NoError(t, pgengine.ConfigDb.Get(&after, "SELECT count(*) FROM timetable.log"))
+			assert.True(t, after >= num, "Statements smuggled into the expression should not be executed")
+		}
+	})
+
+	t.Run("Check chain mutexes", func(t *testing.T) {
+		var cfgID, otherID int
+		assert.NoError(t, pgengine.ConfigDb.Get(&cfgID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, mutexes) VALUES ('mutex test', '{warehouse_load}') RETURNING chain_execution_config"))
+		assert.NoError(t, pgengine.ConfigDb.Get(&otherID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, mutexes) VALUES ('other mutex test', '{warehouse_load, staging}') RETURNING chain_execution_config"))
+		tx, err := pgengine.ConfigDb.BeginTxx(ctx, nil)
+		require.NoError(t, err)
+		waited, err := pgengine.LockChainMutexes(ctx, tx, cfgID)
+		assert.NoError(t, err)
+		assert.False(t, waited, "Mutex is free")
+		other, err := pgengine.ConfigDb.BeginTxx(ctx, nil)
+		require.NoError(t, err)
+		go func() {
+			time.Sleep(time.Second)
+			_ = tx.Rollback()
+		}()
+		waited, err = pgengine.LockChainMutexes(ctx, other, otherID)
+		assert.NoError(t, err)
+		assert.True(t, waited, "Chain should wait for the mutex")
+		assert.NoError(t, other.Rollback())
+	})
+
+	t.Run("Check chain affinity functions", func(t *testing.T) {
+		var cfgID int
+		assert.NoError(t, pgengine.ConfigDb.Get(&cfgID, "INSERT INTO timetable.chain_execution_config "+
+			"(chain_name, affinity, affinity_failover) VALUES ('affinity test', 'REQUIRE', '1 hour') RETURNING chain_execution_config"))
+		a, err := pgengine.GetChainAffinity(ctx, cfgID)
+		assert.NoError(t, err)
+		assert.Equal(t, "REQUIRE", a.Affinity.String)
+		assert.False(t, a.LastClient.Valid, "Chain was never executed")
+		_, err = pgengine.ConfigDb.Exec("INSERT INTO timetable.run_status (execution_status, started, last_status_update, "+
+			"chain_execution_config, client_name) VALUES ('CHAIN_DONE', now() - '2 hours'::interval, now() - '2 hours'::interval, $1, 'gone')", cfgID)
+		assert.NoError(t, err)
+		a, err = pgengine.GetChainAffinity(ctx, cfgID)
+		assert.NoError(t, err)
+		assert.Equal(t, "gone", a.LastClient.String)
+		assert.True(t, a.FailoverDue, "Failover interval passed since the last run")
+		_, err = pgengine.ConfigDb.Exec("INSERT INTO timetable.chain_execution_config " +
+			"(chain_name, affinity_failover) VALUES ('affinity test 2', '1 hour')")
+		assert.Error(t, err, "Failover is allowed only for REQUIRE affinity")
+
+		assert.True(t, pgengine.TryLockClientName(ctx))
+		connected, err := pgengine.IsClientConnected(ctx, pgengine.ClientName)
+		assert.NoError(t, err)
+		assert.True(t, connected, "Client holding the lock should be connected")
+		connected, err = pgengine.IsClientConnected(ctx, "gone")
+		assert.NoError(t, err)
+		assert.False(t, connected)
+	})
+
+	t.Run("Check stale client lock takeover", func(t *testing.T) {
+		defer func(name string) { pgengine.ClientName = name }(pgengine.ClientName)
+		pgengine.ClientName = "stale"
+		// the session of the crashed client still holds the lock
+		conn, err := pgengine.ConfigDb.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1, $2)", pgengine.AppID, adler32.Checksum([]byte("stale")))
+		require.NoError(t, err)
+		_, err = pgengine.ConfigDb.Exec("INSERT INTO timetable.client_lease (client_name, pid, expires) " +
+			"VALUES ('stale', 1, now() - interval '1 minute')")
+		require.NoError(t, err)
+		assert.True(t, pgengine.TryLockClientName(ctx), "Lock of the client with expired heartbeat should be taken over")
+		assert.Error(t, conn.PingContext(ctx), "Stale session should be terminated")
+	})
+
+	t.Run("Check lost clients", func(t *testing.T) {
+		_, err := pgengine.ConfigDb.Exec("INSERT INTO timetable.client_lease (client_name, hostname, pid, expires) " +
+			"VALUES ('lost', 'host2', 42, now() - interval '1 minute')")
+		require.NoError(t, err)
+		lost, err := pgengine.MarkLostClients(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, lost, 1) {
+			assert.Equal(t, "lost", lost[0].ClientName)
+			assert.Equal(t, 42, lost[0].PID)
+		}
+		lost, err = pgengine.MarkLostClients(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, lost, "Lost client should be reported once")
+	})
+
+	t.Run("Check tenant isolation functions", func(t *testing.T) {
+		assert.True(t, pgengine.SetupTenantIsolation(ctx), "Should install policies")
+		assert.True(t, pgengine.SetupTenantIsolation(ctx), "Should reinstall policies")
+		_, err := pgengine.ConfigDb.Exec("INSERT INTO timetable.api_token (token_hash, tenant) " +
+			"VALUES (encode(sha256('secret'), 'hex'), 'team_a')")
+		assert.NoError(t, err)
+		tenant, err := pgengine.GetTokenTenant(ctx, "secret")
+		assert.NoError(t, err)
+		assert.Equal(t, "team_a", tenant)
+		_, err = pgengine.GetTokenTenant(ctx, "foo")
+		assert.Equal(t, pgengine.ErrInvalidToken, err)
+	})
+
 }
 
 func TestBuiltInTasks(t *testing.T) {
@@ -315,7 +696,7 @@ func TestBuiltInTasks(t *testing.T) {
 		var num int
 		err := pgengine.ConfigDb.Get(&num, "SELECT count(1) FROM timetable.base_task WHERE kind = 'BUILTIN'")
 		assert.NoError(t, err, "Query for built-in tasks existence failed")
-		assert.Equal(t, len(tasks.Tasks), num, fmt.Sprintf("Wrong number of built-in tasks: %d", num))
+		assert.Equal(t, len(tasks.Names()), num, fmt.Sprintf("Wrong number of built-in tasks: %d", num))
 	})
 }
 
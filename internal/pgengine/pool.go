@@ -0,0 +1,83 @@
+package pgengine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// copyPool is the native pgx connection pool to the configuration database used only by the COPY protocol,
+// which lib/pq behind ConfigDb cannot stream. ConfigDb stays on database/sql, the pool is not its replacement
+// and never executes embedded statements. Connections are opened on the first COPY and closed once idle,
+// so the pool doesn't hold connections besides ConfigDb unless COPY tasks are executed
+var copyPool *pgxpool.Pool
+
+const (
+	copyPoolSize     = 2 // concurrent COPY tasks above the limit wait for the connection
+	copyPoolIdleTime = time.Minute
+)
+
+// ErrNoPool is returned by the native helpers if the pool is not established
+var ErrNoPool = errors.New("Configuration database pool is not established")
+
+// openCopyPool prepares the lazy pool to the same database as ConfigDb, notices are logged as USER messages.
+// Hosts not matching target session attributes are skipped. If password is set, it is called for every new
+// connection with the first host of the list, fallback hosts use the same password
+func openCopyPool(ctx context.Context, connstr string, attrs string, password passwordFunc) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connstr)
+	if err != nil {
+		return nil, err
+	}
+	config.LazyConnect = true
+	config.MaxConns = copyPoolSize
+	config.MaxConnIdleTime = copyPoolIdleTime
+	config.ConnConfig.OnNotice = func(_ *pgconn.PgConn, notice *pgconn.Notice) {
+		LogToDB("USER", "Severity: ", notice.Severity, "; Message: ", notice.Message)
+	}
+	if attrs == "read-only" {
+		config.ConnConfig.ValidateConnect = validatePoolConn(attrs)
+	}
+	if password != nil {
+		config.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) (err error) {
+			connConfig.Password, err = password(ctx, connConfig.Host, strconv.Itoa(int(connConfig.Port)))
+			return
+		}
+	}
+	return pgxpool.ConnectConfig(ctx, config)
+}
+
+// CopyFrom streams data from the reader to the server using the "COPY ... FROM STDIN" sql statement
+// and returns the number of rows copied
+func CopyFrom(ctx context.Context, sql string, r io.Reader) (int64, error) {
+	if copyPool == nil {
+		return 0, ErrNoPool
+	}
+	conn, err := copyPool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+	tag, err := conn.Conn().PgConn().CopyFrom(ctx, r, sql)
+	return tag.RowsAffected(), err
+}
+
+// CopyTo streams the output of the "COPY ... TO STDOUT" sql statement to the writer
+// and returns the number of rows copied
+func CopyTo(ctx context.Context, w io.Writer, sql string) (int64, error) {
+	if copyPool == nil {
+		return 0, ErrNoPool
+	}
+	conn, err := copyPool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+	tag, err := conn.Conn().PgConn().CopyTo(ctx, w, sql)
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,124 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z_0-9]*)?\$`)
+
+// chainPrecondition is the run_if expression of the chain and the tenant it's evaluated as
+type chainPrecondition struct {
+	RunIf  sql.NullString `db:"run_if"`
+	Tenant string         `db:"tenant"`
+}
+
+// CheckChainPrecondition evaluates run_if expression of the chain right before the execution, the run is recorded
+// as SKIPPED unless it's true. The chain is not executed if the expression cannot be evaluated.
+// Returns true if the chain should be executed
+func CheckChainPrecondition(ctx context.Context, chainConfigID int, chainID int) bool {
+	if !Enabled(FeaturePreconditions) {
+		return true
+	}
+	var p chainPrecondition
+	err := ConfigDb.GetContext(ctx, &p, SchemaSQL(`SELECT run_if, tenant FROM timetable.chain_execution_config
+WHERE chain_execution_config = $1`), chainConfigID)
+	if err != nil {
+		LogToDB("ERROR", "Cannot check precondition of the chain configuration: ", err)
+		return true
+	}
+	if !p.RunIf.Valid {
+		return true
+	}
+	ok, err := evalPrecondition(ctx, p)
+	if err != nil {
+		LogToDB("ERROR", fmt.Sprintf("Chain configuration ID %d is not executed, cannot evaluate run_if: %v", chainConfigID, err))
+		return false
+	}
+	if ok {
+		return true
+	}
+	LogToDB("LOG", fmt.Sprintf("Chain configuration ID %d is skipped, run_if is not true", chainConfigID))
+	if _, err := ConfigDb.ExecContext(ctx, SchemaSQL(`INSERT INTO timetable.run_status
+(chain_id, execution_status, started, last_status_update, chain_execution_config, client_name)
+VALUES ($1, 'SKIPPED', now(), now(), $2, $3)`), chainID, chainConfigID, ClientName); err != nil {
+		LogToDB("ERROR", "Cannot save information about the skipped run: ", err)
+	}
+	return false
+}
+
+// evalPrecondition evaluates the expression in the read only transaction, as the tenant of the chain in tenant
+// isolation mode. NULL is not true
+func evalPrecondition(ctx context.Context, p chainPrecondition) (bool, error) {
+	tx, err := ConfigDb.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if TenantIsolation {
+		if _, err = tx.ExecContext(ctx, "SET LOCAL ROLE "+pq.QuoteIdentifier(p.Tenant)); err != nil {
+			return false, err
+		}
+	}
+	if err = checkSingleExpression(p.RunIf.String); err != nil {
+		return false, err
+	}
+	// the argument forces the extended query protocol, so the server rejects several statements smuggled
+	// into the expression even if they are hidden from checkSingleExpression
+	var res sql.NullBool
+	err = tx.GetContext(ctx, &res, "SELECT ("+p.RunIf.String+")::boolean WHERE $1::boolean", true)
+	return res.Valid && res.Bool, err
+}
+
+// checkSingleExpression returns error if the expression contains semicolon outside of string literals,
+// quoted identifiers and comments, i.e. ends the statement
+func checkSingleExpression(expr string) error {
+	for i := 0; i < len(expr); i++ {
+		var end string
+		switch {
+		case expr[i] == ';':
+			return errors.New("run_if must be a single expression")
+		case expr[i] == '\'' || expr[i] == '"':
+			end = expr[i : i+1]
+		case strings.HasPrefix(expr[i:], "--"):
+			end = "\n"
+		case strings.HasPrefix(expr[i:], "/*"):
+			// comments may be nested
+			depth := 0
+			for ; i < len(expr); i++ {
+				if strings.HasPrefix(expr[i:], "/*") {
+					depth++
+					i++
+				} else if strings.HasPrefix(expr[i:], "*/") {
+					depth--
+					i++
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			continue
+		case expr[i] == '$':
+			if m := dollarQuote.FindString(expr[i:]); m != "" {
+				end = m
+				i += len(m) - 1
+			}
+		}
+		if end == "" {
+			continue
+		}
+		n := strings.Index(expr[i+1:], end)
+		if n < 0 {
+			// unterminated literal is reported by the server
+			return nil
+		}
+		i += n + len(end)
+	}
+	return nil
+}
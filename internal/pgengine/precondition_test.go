@@ -0,0 +1,31 @@
+package pgengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSingleExpression(t *testing.T) {
+	for _, expr := range []string{
+		"true",
+		"EXISTS(SELECT 1 FROM timetable.log WHERE message = 'a;b')",
+		`(SELECT count(*) FROM "odd;table") > 0`,
+		"now() > '2020-01-01' -- no runs before ;\n",
+		"true /* outer /* nested; */ still comment; */",
+		"length($$;$$) = 1",
+		"length($tag$ $$; $tag$) = 4",
+		"'it''s;' IS NOT NULL",
+		"$1"} {
+		assert.NoError(t, checkSingleExpression(expr), expr)
+	}
+	for _, expr := range []string{
+		"true; DROP TABLE timetable.log",
+		"true);DELETE FROM timetable.log;SELECT (true",
+		"'a' = 'a'; SELECT 1",
+		"true /* comment */; SELECT 1",
+		"true -- comment\n; SELECT 1",
+		"$$a$$ = 'a'; SELECT 1"} {
+		assert.EqualError(t, checkSingleExpression(expr), "run_if must be a single expression", expr)
+	}
+}
@@ -0,0 +1,59 @@
+package pgengine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/cmdparser"
+	"github.com/cybertec-postgresql/pg_timetable/internal/sigv4"
+)
+
+// rdsTokenExpires is the maximum lifetime of RDS IAM authentication token accepted by AWS
+const rdsTokenExpires = 15 * time.Minute
+
+// rdsRegion returns the region of the RDS endpoint, e.g. "eu-west-1" for "db.abc.eu-west-1.rds.amazonaws.com"
+func rdsRegion(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 5 && strings.HasSuffix(host, ".rds.amazonaws.com") {
+		return parts[len(parts)-4]
+	}
+	return ""
+}
+
+// rdsAuthToken returns the presigned "connect" request used by RDS as the password of the user
+func rdsAuthToken(host, port, region, user string, creds sigv4.Credentials, t time.Time) string {
+	u := &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port), Path: "/",
+		RawQuery: url.Values{"Action": {"connect"}, "DBUser": {user}}.Encode()}
+	signed := sigv4.Presign("GET", u, creds, region, "rds-db", sigv4.EmptyPayloadHash, rdsTokenExpires, t)
+	return strings.TrimPrefix(signed.String(), "https://")
+}
+
+// newRDSPasswordFunc returns the generator of IAM tokens using AWS credentials from the environment
+func newRDSPasswordFunc(cmdOpts cmdparser.CmdOptions) (passwordFunc, error) {
+	if cmdOpts.SSLMode == "disable" {
+		return nil, errors.New("RDS IAM authentication requires SSL connection, set --sslmode")
+	}
+	creds := sigv4.Credentials{}.FromEnv()
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, errors.New("AWS credentials are required for RDS IAM authentication")
+	}
+	region := cmdOpts.AWSRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	return func(_ context.Context, host, port string) (string, error) {
+		r := region
+		if r == "" {
+			r = rdsRegion(host)
+		}
+		if r == "" {
+			return "", errors.New("AWS region of the RDS instance " + host + " cannot be determined")
+		}
+		return rdsAuthToken(host, port, r, cmdOpts.User, creds, time.Now()), nil
+	}, nil
+}
@@ -0,0 +1,29 @@
+package pgengine
+
+import (
+	"regexp"
+)
+
+// DefaultSchemaName is the schema embedded SQL statements are written for
+const DefaultSchemaName = "timetable"
+
+// SchemaName is the schema holding the configuration of this deployment, several deployments
+// may share one database using different schemas
+var SchemaName = DefaultSchemaName
+
+// schemaRefs matches qualified references to the default schema and schema DDL commands
+var schemaRefs = regexp.MustCompile(`\btimetable\.|\bSCHEMA (IF (NOT )?EXISTS )?timetable\b`)
+
+// SchemaSQL replaces references to the default schema in the embedded statement with SchemaName.
+// Only statements of pg_timetable itself are templated, SQL of tasks and scripts is executed as is
+func SchemaSQL(query string) string {
+	if SchemaName == DefaultSchemaName {
+		return query
+	}
+	return schemaRefs.ReplaceAllStringFunc(query, func(ref string) string {
+		if ref == "timetable." {
+			return SchemaName + "."
+		}
+		return ref[:len(ref)-len(DefaultSchemaName)] + SchemaName
+	})
+}
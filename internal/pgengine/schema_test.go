@@ -0,0 +1,38 @@
+package pgengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaSQL(t *testing.T) {
+	query := "CREATE SCHEMA timetable; SELECT * FROM timetable.log WHERE client_name = 'pg_timetable.worker'"
+	assert.Equal(t, query, SchemaSQL(query), "Default schema should not be rewritten")
+	SchemaName = "etl"
+	defer func() { SchemaName = DefaultSchemaName }()
+	assert.Equal(t, "CREATE SCHEMA etl; SELECT * FROM etl.log WHERE client_name = 'pg_timetable.worker'", SchemaSQL(query))
+	assert.Equal(t, "DROP SCHEMA IF EXISTS etl CASCADE", SchemaSQL("DROP SCHEMA IF EXISTS timetable CASCADE"))
+}
+
+func TestCheckFeatures(t *testing.T) {
+	features := []schemaFeature{
+		{Name: FeatureCore, Required: true, Tables: []string{"run_status"}},
+		{Name: FeatureWindows, Columns: []string{"chain_execution_config.window_start"}},
+		{Name: FeatureClientResources, Tables: []string{"client"}},
+	}
+	defer func() { disabledFeatures = map[string]bool{} }()
+	missing := map[string]bool{"column chain_execution_config.window_start": true}
+	exists := func(kind string, name string) (bool, error) { return !missing[kind+" "+name], nil }
+	report, ok, err := checkFeatures(features, exists)
+	assert.NoError(t, err)
+	assert.True(t, ok, "Optional features should not prevent the start")
+	assert.Equal(t, []string{"execution windows (disabled): missing column chain_execution_config.window_start"}, report)
+	assert.False(t, Enabled(FeatureWindows))
+	assert.True(t, Enabled(FeatureClientResources))
+
+	missing["table run_status"] = true
+	_, ok, err = checkFeatures(features, exists)
+	assert.NoError(t, err)
+	assert.False(t, ok, "Missing required features should prevent the start")
+}
@@ -0,0 +1,105 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// settingName matches run-time parameter names, optionally prefixed by the extension, e.g. "pg_stat_statements.track"
+var settingName = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// taskSetting is the run-time parameter applied to the SQL task, e.g. statement_timeout
+type taskSetting struct {
+	Name  string
+	Value string
+}
+
+// parseTaskSettings parses task_chain.settings JSON object, e.g. {"statement_timeout": "5min", "work_mem": "256MB"}.
+// Settings are sorted by name so they are applied in the same order every time
+func parseTaskSettings(doc string) ([]taskSetting, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &values); err != nil {
+		return nil, fmt.Errorf("Settings must be JSON object: %w", err)
+	}
+	settings := make([]taskSetting, 0, len(values))
+	for name, value := range values {
+		if !settingName.MatchString(name) {
+			return nil, fmt.Errorf("Invalid setting name: %q", name)
+		}
+		switch v := value.(type) {
+		case string:
+			settings = append(settings, taskSetting{name, v})
+		case float64, bool:
+			settings = append(settings, taskSetting{name, fmt.Sprint(v)})
+		default:
+			return nil, fmt.Errorf("Value of setting %s must be string, number or boolean", name)
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings, nil
+}
+
+// applyTaskSettings sets run-time parameters of the element with set_config(), i.e. SET LOCAL if local is true.
+// Returned function restores previous values, so settings do not leak into later elements of the chain
+// transaction or into other sessions of the pool
+func applyTaskSettings(executor sqlRunner, chainElemExec *ChainElementExecution, local bool) (restore func(), err error) {
+	restore = func() {}
+	if !chainElemExec.Settings.Valid {
+		return
+	}
+	settings, err := parseTaskSettings(chainElemExec.Settings.String)
+	if err != nil {
+		return
+	}
+	previous := make([]taskSetting, 0, len(settings))
+	restore = func() {
+		for i := len(previous) - 1; i >= 0; i-- {
+			if _, err := executor.Exec("SELECT set_config($1, $2, $3)", previous[i].Name, previous[i].Value, local); err != nil {
+				LogToDB("ERROR", "Cannot restore setting ", previous[i].Name, ": ", err)
+			}
+		}
+	}
+	for _, s := range settings {
+		var value string
+		if err = executor.QueryRow("SELECT current_setting($1)", s.Name).Scan(&value); err == nil {
+			previous = append(previous, taskSetting{s.Name, value})
+			LogToDB("DEBUG", "Setting ", s.Name, " to ", s.Value)
+			_, err = executor.Exec("SELECT set_config($1, $2, $3)", s.Name, s.Value, local)
+		}
+		if err != nil {
+			restore()
+			return func() {}, fmt.Errorf("Cannot apply setting %s: %w", s.Name, err)
+		}
+	}
+	return
+}
+
+// contextRunner is implemented by the database, the transaction and the dedicated connection
+type contextRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ctxRunner executes statements with the chain context, so the running statement is cancelled on the server
+// once the context is cancelled, e.g. on shutdown, instead of running to completion after the client gave up
+type ctxRunner struct {
+	ctx context.Context
+	db  contextRunner
+}
+
+func (c ctxRunner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c ctxRunner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c ctxRunner) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
@@ -0,0 +1,25 @@
+package pgengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTaskSettings(t *testing.T) {
+	settings, err := parseTaskSettings(`{"work_mem": "256MB", "statement_timeout": 30000, "search_path": "etl, public", "pg_stat_statements.track": "all"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []taskSetting{
+		{"pg_stat_statements.track", "all"},
+		{"search_path", "etl, public"},
+		{"statement_timeout", "30000"},
+		{"work_mem", "256MB"},
+	}, settings, "Settings should be sorted by name")
+
+	_, err = parseTaskSettings(`["statement_timeout"]`)
+	assert.Error(t, err, "Settings must be object")
+	_, err = parseTaskSettings(`{"work_mem; DROP TABLE x": "1MB"}`)
+	assert.Error(t, err, "Invalid setting name should fail")
+	_, err = parseTaskSettings(`{"search_path": ["etl", "public"]}`)
+	assert.Error(t, err, "Setting value must be scalar")
+}
@@ -0,0 +1,83 @@
+package pgengine
+
+import (
+	"context"
+	"time"
+)
+
+// SLA violation kinds, see timetable.sla_violation
+const (
+	SLAMaxDuration = "MAX_DURATION"
+	SLAMissedStart = "MISSED_START"
+)
+
+// SLAViolation is the recorded violation of the chain SLA
+type SLAViolation struct {
+	ChainConfig int        `db:"chain_execution_config"`
+	ChainName   string     `db:"chain_name"`
+	Kind        string     `db:"kind"`
+	RunStatusID *int       `db:"run_status"`
+	Scheduled   *time.Time `db:"scheduled"`
+	Limit       float64    `db:"sla_limit"` // max_duration or max_start_delay in seconds
+}
+
+// SLAChain is the live chain with the start delay SLA, the schedule is checked by the caller
+type SLAChain struct {
+	ChainConfig    int     `db:"chain_execution_config"`
+	ChainName      string  `db:"chain_name"`
+	RunAt          *string `db:"run_at"`
+	ScheduleEngine *string `db:"schedule_engine"`
+	Schedule       *string `db:"schedule"`
+	MaxStartDelay  float64 `db:"max_start_delay"` // in seconds
+}
+
+// runs of the client exceeding max_duration of their chains
+const sqlRecordOverruns = `WITH v AS (
+	INSERT INTO timetable.sla_violation (chain_execution_config, kind, run_status, client_name)
+	SELECT s.chain_execution_config, 'MAX_DURATION', s.run_status, $1
+	FROM timetable.run_status s JOIN timetable.chain_execution_config c USING (chain_execution_config)
+	WHERE s.start_status IS NULL AND s.execution_status = 'STARTED' AND s.client_name = $1
+		AND now() - s.started > c.max_duration
+		AND NOT EXISTS (SELECT 1 FROM timetable.run_status f WHERE f.start_status = s.run_status
+			AND f.execution_status IN ('CHAIN_DONE', 'CHAIN_FAILED', 'DEAD'))
+	ON CONFLICT DO NOTHING
+	RETURNING chain_execution_config, kind, run_status, scheduled
+)
+SELECT v.*, c.chain_name, EXTRACT(EPOCH FROM c.max_duration)::float8 AS sla_limit
+FROM v JOIN timetable.chain_execution_config c USING (chain_execution_config)`
+
+const sqlSelectSLAChains = `SELECT chain_execution_config, chain_name, run_at, schedule_engine, schedule,
+EXTRACT(EPOCH FROM max_start_delay)::float8 AS max_start_delay
+FROM timetable.chain_execution_config
+WHERE live AND max_start_delay IS NOT NULL AND (client_name = $1 OR client_name IS NULL)
+	AND (client_group IS NULL OR client_group = $2)`
+
+// the scheduled run is missed if no run of the chain was started since the scheduled time
+const sqlRecordMissedStart = `INSERT INTO timetable.sla_violation (chain_execution_config, kind, scheduled, client_name)
+SELECT $1, 'MISSED_START', $2, $3
+WHERE NOT EXISTS (SELECT 1 FROM timetable.run_status
+	WHERE chain_execution_config = $1 AND start_status IS NULL AND started >= $2)
+ON CONFLICT DO NOTHING`
+
+// RecordOverruns records and returns new violations of max_duration by runs of the client
+func RecordOverruns(ctx context.Context) (violations []SLAViolation, err error) {
+	err = ConfigDb.SelectContext(ctx, &violations, SchemaSQL(sqlRecordOverruns), ClientName)
+	return
+}
+
+// GetSLAChains returns live chains of the client having max_start_delay
+func GetSLAChains(ctx context.Context) (chains []SLAChain, err error) {
+	err = ConfigDb.SelectContext(ctx, &chains, SchemaSQL(sqlSelectSLAChains), ClientName, ClientGroup)
+	return
+}
+
+// RecordMissedStart records the violation if the chain was not started since the scheduled time,
+// returns false if the run was started or the violation is already recorded, e.g. by another client
+func RecordMissedStart(ctx context.Context, chainConfigID int, scheduled time.Time) (bool, error) {
+	res, err := ConfigDb.ExecContext(ctx, SchemaSQL(sqlRecordMissedStart), chainConfigID, scheduled, ClientName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -19,7 +19,64 @@ VALUES
 	(1, '0070 Interval scheduling and cron only syntax'),
 	(2, '0086 Add task output to execution_log'),
 	(3, '0108 Add client_name column to timetable.run_status'),
-	(4, '0122 Add autonomous tasks');
+	(4, '0122 Add autonomous tasks'),
+	(5, '0279 Add resume_run function'),
+	(6, '0279 Add ExportRunHistory built-in task'),
+	(7, '0280 Add Retention built-in task and default chain'),
+	(8, '0281 Add self_destruct_mode to chain_execution_config'),
+	(9, '0282 Add HTTP task kind'),
+	(10, '0282 Add schedule_engine to chain_execution_config'),
+	(11, '0284 Add Notify built-in task'),
+	(12, '0284 Add S3Upload and S3Download built-in tasks'),
+	(13, '0285 Add SftpUpload and SftpDownload built-in tasks'),
+	(14, '0285 Add worker identity to run_status'),
+	(15, '0286 Add Backup built-in task'),
+	(16, '0287 Add CopyFromFile built-in task'),
+	(17, '0287 Add run_summary table'),
+	(18, '0288 Add CopyToFile built-in task'),
+	(19, '0289 Add tenant quotas'),
+	(20, '0289 Add QUOTA_EXCEEDED execution status'),
+	(21, '0290 Add Slack built-in task'),
+	(22, '0290 Add api_token table'),
+	(23, '0291 Add RowCountSnapshot built-in task'),
+	(24, '0291 Add Telegram built-in task'),
+	(25, '0292 Add on_commit to task_chain'),
+	(26, '0292 Add PROGRAM task kind'),
+	(27, '0293 Add compensate_task_id to task_chain'),
+	(28, '0294 Add workdir, umask and stdin to task_chain'),
+	(29, '0296 Add affinity to chain_execution_config'),
+	(30, '0297 Add DOCKER task kind'),
+	(31, '0298 Add K8S_JOB task kind'),
+	(32, '0300 Add RefreshMatViews built-in task'),
+	(33, '0300 Add KubernetesJob built-in task'),
+	(34, '0301 Add PartitionMaintenance built-in task'),
+	(35, '0301 Add run_artifact table and StoreArtifacts built-in task'),
+	(36, '0302 Add chain_wait table'),
+	(37, '0303 Add execution window to chain_execution_config'),
+	(38, '0304 Add WaitFor built-in task'),
+	(39, '0305 Add client table'),
+	(40, '0307 Add sink to task_chain'),
+	(41, '0308 Add shell_disabled_action to chain_execution_config'),
+	(42, '0308 Add SHELL_DISABLED execution status'),
+	(43, '0309 Add description and runbook_url to chains and tasks'),
+	(44, '0309 Add secret to chain_execution_parameters'),
+	(45, '0310 Add settings to task_chain'),
+	(46, '0311 Add run_as_role to task_chain'),
+	(47, '0314 Add client_lease table'),
+	(48, '0324 Add SLA to chain_execution_config'),
+	(49, '0324 Add ALERT log level'),
+	(50, '0325 Add heartbeat_url to chain_execution_config'),
+	(51, '0328 Add stdout and stderr to execution_log'),
+	(52, '0332 Add import_source to chain_execution_config'),
+	(53, '0343 Add client groups'),
+	(54, '0344 Add client heartbeat'),
+	(55, '0346 Add idempotent to chain_execution_config'),
+	(56, '0347 Add circuit breaker to chain_execution_config'),
+	(57, '0348 Add SKIPPED execution status'),
+	(58, '0348 Add run_if to chain_execution_config'),
+	(59, '0349 Add mutexes to chain_execution_config'),
+	(60, '0352 Make is_cron_in_time daylight saving time safe'),
+	(61, '0353 Add interval_aligned to chain_execution_config');
 
 -- define database connections for script execution
 CREATE TABLE timetable.database_connection (
@@ -35,14 +92,21 @@ CREATE TABLE timetable.database_connection (
 -- "script" contains either an SQL script, or
 --      command string to be executed
 --
--- "kind" indicates whether "script" is SQL, built-in function or external program
-CREATE TYPE timetable.task_kind AS ENUM ('SQL', 'SHELL', 'BUILTIN');
+-- "kind" indicates whether "script" is SQL, built-in function, external program, URL for HTTP request
+-- 		JSON array with program and its arguments executed without shell, container image,
+-- 		or Kubernetes Job manifest template
+--
+-- "description" and "runbook_url" explain the task and point to the remediation doc, both are
+-- 		included into events and failure messages
+CREATE TYPE timetable.task_kind AS ENUM ('SQL', 'SHELL', 'BUILTIN', 'HTTP', 'PROGRAM', 'DOCKER', 'K8S_JOB');
 
 CREATE TABLE timetable.base_task (
 	task_id		BIGSERIAL  			PRIMARY KEY,
 	name		TEXT    		    NOT NULL UNIQUE,
 	kind		timetable.task_kind	NOT NULL DEFAULT 'SQL',
 	script		TEXT				NOT NULL,
+	description	TEXT,
+	runbook_url	TEXT,
 	CHECK (CASE WHEN kind <> 'BUILTIN' THEN script IS NOT NULL ELSE TRUE END)
 );
 
@@ -53,9 +117,18 @@ CREATE TABLE timetable.base_task (
 --      upon execution
 -- "run_uid" is the username to run as (e.g. su -c "..." - username)
 --              (if NULL then don't bother changing UIDs)
+-- "run_as_role" is the database role the SQL task is executed as with SET ROLE, takes precedence over "run_uid"
 -- "ignore_error" indicates whether the next task
 --      in the chain can be executed regardless of the
 --      success of the current one
+-- "on_commit" indicates that the element is executed only after the chain transaction
+--      is successfully committed, e.g. to send notifications or delete source files
+-- "compensate_task_id" is the base task undoing the side effects of the element if a later
+--      element fails, compensations are executed in reverse order with the element parameters
+-- "workdir", "umask" and "stdin" set the working directory, octal file mode creation mask
+--      and standard input content of SHELL and PROGRAM tasks
+-- "sink" describes the file or S3 object the result set of the SQL task is streamed to
+-- "settings" are run-time parameters applied with SET LOCAL to the SQL task, e.g. {"statement_timeout": "5min"}
 CREATE TABLE timetable.task_chain (
 	chain_id        	BIGSERIAL	PRIMARY KEY,
 	parent_id			BIGINT 		UNIQUE  REFERENCES timetable.task_chain(chain_id)
@@ -65,11 +138,21 @@ CREATE TABLE timetable.task_chain (
 									ON UPDATE CASCADE
 									ON DELETE CASCADE,
 	run_uid				TEXT,
+	run_as_role			TEXT,
 	database_connection	BIGINT		REFERENCES timetable.database_connection(database_connection)
 									ON UPDATE CASCADE
 									ON DELETE CASCADE,
 	ignore_error		BOOLEAN		NOT NULL DEFAULT false,
-	autonomous			BOOLEAN		NOT NULL DEFAULT false
+	autonomous			BOOLEAN		NOT NULL DEFAULT false,
+	on_commit			BOOLEAN		NOT NULL DEFAULT false,
+	compensate_task_id	BIGINT		REFERENCES timetable.base_task(task_id)
+									ON UPDATE CASCADE
+									ON DELETE SET NULL,
+	workdir				TEXT,
+	umask				TEXT		CHECK (umask ~ '^[0-7]{3,4}$'),
+	stdin				TEXT,
+	sink				JSONB,
+	settings			JSONB		CHECK (jsonb_typeof(settings) = 'object')
 );
 
 
@@ -81,7 +164,39 @@ CREATE TABLE timetable.task_chain (
 -- "max_instances" is the number of instances this chain can run in parallel
 -- "live" is the indication that the chain is finalized, the system can run it
 -- "self_destruct" is the indication that this chain will delete itself after run
+-- "self_destruct_mode" specifies when self destructive chain is deleted: after every run (ALWAYS), 
+--      only after successful run (ON_SUCCESS), or after successful run while failure disables 
+--      and preserves the chain for inspection (DISABLE_ON_FAILURE)
+-- "schedule_engine" is the name of the client side engine checking "schedule" expression instead of "run_at",
+--      e.g. 'cron'. NULL means "run_at" is checked by timetable.is_cron_in_time()
 -- "client_name" is the indication that this chain will run only under this tag
+-- "tenant" is the database role owning the chain, see timetable.tenant_quota
+-- "affinity" binds the chain to the client executed it previously: PREFER lets other clients run the chain
+--      only if that client is not connected, REQUIRE waits for that client unless it is not connected
+--      and the chain was not served by it for "affinity_failover"; NULL means any client
+-- "window_start" and "window_end" limit the time of day the chain may be started at regardless of the trigger,
+--      the window wraps around midnight if "window_start" is later than "window_end"; NULL means any time
+-- "description" and "runbook_url" explain the chain and point to the remediation doc for whoever is paged,
+--      the runbook of the chain is used for tasks without their own one
+-- "shell_disabled_action" specifies what happens if the element cannot be executed because of --no-shell-tasks:
+--      the chain fails (FAIL), the element is skipped (SKIP_ELEMENT), or the whole run is skipped (SKIP_CHAIN)
+-- "max_duration" and "max_start_delay" are SLA of the chain: the run longer than "max_duration" and the scheduled run
+--      not started within "max_start_delay" are reported as violations, see timetable.sla_violation
+-- "heartbeat_url" is pinged with "/start" suffix when the chain run begins, and as is or with "/fail" suffix
+--      when the run succeeds or fails, so external dead man's switch monitors detect missing runs
+-- "import_source" is the definition file the chain is imported from with --import-dir, imported chains missing
+--      in the directory are deleted on the next import; NULL means the chain is managed manually
+-- "client_group" targets the chain to clients started with the same --client-group, members of the group
+--      partition runs of such chains between themselves, see timetable.chain_claim
+-- "idempotent" chains can be safely executed again, the run left unfinished by the crashed client is executed
+--      again on the client restart with --resume-crashed
+-- "max_failures" consecutive failed runs trip the circuit breaker: the chain is "suspended" and not "live" anymore,
+--      it's enabled again after "failure_cooldown" if specified
+-- "run_if" is the SQL expression evaluated right before the scheduled run, the run is recorded as SKIPPED
+--      unless it's true
+-- "mutexes" are names of resources the chain uses exclusively, chains sharing any of them never run simultaneously
+-- "interval_aligned" executes @every and @after chains at multiples of the interval, e.g. every 5 minutes
+--      at :00, :05, :10, instead of relative to the time the client started
 CREATE DOMAIN timetable.cron AS TEXT CHECK(
 	substr(VALUE, 1, 6) IN ('@every', '@after') AND (substr(VALUE, 7) :: INTERVAL) IS NOT NULL	
 	OR VALUE = '@reboot'
@@ -99,12 +214,42 @@ CREATE TABLE timetable.chain_execution_config (
     max_instances				INTEGER,
     live						BOOLEAN		DEFAULT false,
     self_destruct				BOOLEAN		DEFAULT false,
+    self_destruct_mode			TEXT		NOT NULL DEFAULT 'ALWAYS'
+											CHECK (self_destruct_mode IN ('ALWAYS', 'ON_SUCCESS', 'DISABLE_ON_FAILURE')),
 	exclusive_execution			BOOLEAN		DEFAULT false,
 	excluded_execution_configs	INTEGER[],
-	client_name					TEXT
+	client_name					TEXT,
+	schedule_engine				TEXT,
+	schedule					TEXT,
+	tenant						TEXT		NOT NULL DEFAULT current_user,
+	affinity					TEXT		CHECK (affinity IN ('PREFER', 'REQUIRE')),
+	affinity_failover			INTERVAL,
+	window_start				TIME,
+	window_end					TIME,
+	shell_disabled_action		TEXT		NOT NULL DEFAULT 'FAIL'
+											CHECK (shell_disabled_action IN ('FAIL', 'SKIP_ELEMENT', 'SKIP_CHAIN')),
+	description					TEXT,
+	runbook_url					TEXT,
+	max_duration				INTERVAL	CHECK (max_duration > '0'::interval),
+	max_start_delay				INTERVAL	CHECK (max_start_delay > '0'::interval),
+	heartbeat_url				TEXT,
+	import_source				TEXT,
+	client_group				TEXT,
+	idempotent					BOOLEAN		NOT NULL DEFAULT false,
+	max_failures				INTEGER		CHECK (max_failures > 0),
+	failure_cooldown			INTERVAL	CHECK (failure_cooldown > '0'::interval),
+	suspended					TIMESTAMPTZ,
+	run_if						TEXT,
+	mutexes						TEXT[],
+	interval_aligned			BOOLEAN		NOT NULL DEFAULT false,
+	CHECK ((window_start IS NULL) = (window_end IS NULL) AND window_start <> window_end),
+	CHECK ((schedule_engine IS NULL) = (schedule IS NULL)),
+	CHECK (affinity_failover IS NULL OR affinity = 'REQUIRE'),
+	CHECK (schedule_engine IS NULL OR run_at IS NULL)
 );
 
 -- parameter passing for config
+-- "secret" marks parameters with secret references resolved at runtime, e.g. {"password": "vault:secret/data/smtp#password"}
 CREATE TABLE timetable.chain_execution_parameters(
 	chain_execution_config	BIGINT	REFERENCES timetable.chain_execution_config (chain_execution_config)
 									ON UPDATE CASCADE
@@ -114,12 +259,13 @@ CREATE TABLE timetable.chain_execution_parameters(
 									ON DELETE CASCADE,
 	order_id 				INTEGER	CHECK (order_id > 0),
 	value 					jsonb,
+	secret					BOOLEAN	NOT NULL DEFAULT false,
 	PRIMARY KEY (chain_execution_config, chain_id, order_id)
 );
 
 
 -- log client application related actions
-CREATE TYPE timetable.log_type AS ENUM ('DEBUG', 'NOTICE', 'LOG', 'ERROR', 'PANIC', 'USER');
+CREATE TYPE timetable.log_type AS ENUM ('DEBUG', 'NOTICE', 'LOG', 'ERROR', 'PANIC', 'USER', 'ALERT');
 
 CREATE TABLE timetable.log
 (
@@ -132,6 +278,8 @@ CREATE TABLE timetable.log
 );
 
 -- log timetable related action
+-- "stdout" and "stderr" of SHELL and PROGRAM tasks are truncated to --output-limit bytes, the complete streams
+--      exceeding the limit are written to "stdout_file" and "stderr_file" under --output-dir
 CREATE TABLE timetable.execution_log (
 	chain_execution_config	BIGINT,
 	chain_id        		BIGINT,
@@ -144,10 +292,14 @@ CREATE TABLE timetable.execution_log (
 	returncode      		INTEGER,
 	pid             		BIGINT,
 	output					TEXT,
-	client_name				TEXT		NOT NULL
+	client_name				TEXT		NOT NULL,
+	stdout					TEXT,
+	stderr					TEXT,
+	stdout_file				TEXT,
+	stderr_file				TEXT
 );
 
-CREATE TYPE timetable.execution_status AS ENUM ('STARTED', 'CHAIN_FAILED', 'CHAIN_DONE', 'DEAD');
+CREATE TYPE timetable.execution_status AS ENUM ('STARTED', 'CHAIN_FAILED', 'CHAIN_DONE', 'DEAD', 'QUOTA_EXCEEDED', 'SHELL_DISABLED', 'SKIPPED');
 
 CREATE TABLE timetable.run_status (
 	run_status 					BIGSERIAL,
@@ -159,9 +311,165 @@ CREATE TABLE timetable.run_status (
 	last_status_update 			TIMESTAMPTZ 				DEFAULT clock_timestamp(),
 	chain_execution_config 		BIGINT,
 	client_name					TEXT	NOT NULL,
+	worker_id					INTEGER,
+	host						TEXT,
+	child_pid					INTEGER,
 	PRIMARY KEY (run_status)
 );
 
+-- single summary row per chain run, "kind_durations" contains total seconds spent by the tasks of every kind
+CREATE TABLE timetable.run_summary (
+	run_status					BIGINT		PRIMARY KEY REFERENCES timetable.run_status(run_status)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	chain_execution_config		BIGINT,
+	started						TIMESTAMPTZ	NOT NULL,
+	finished					TIMESTAMPTZ	NOT NULL,
+	kind_durations				JSONB		NOT NULL DEFAULT '{}',
+	rows_affected				BIGINT		NOT NULL DEFAULT 0,
+	output_bytes				BIGINT		NOT NULL DEFAULT 0,
+	retries						INTEGER		NOT NULL DEFAULT 0,
+	execution_status			TEXT		NOT NULL,
+	client_name					TEXT		NOT NULL
+);
+
+-- resume requests for failed chain runs, see timetable.resume_run()
+CREATE TABLE timetable.run_resume (
+	run_status					BIGINT		PRIMARY KEY REFERENCES timetable.run_status(run_status)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	requested					TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	resumed						TIMESTAMPTZ
+);
+
+-- per tenant quotas checked at dispatch time, NULL value means no limit
+CREATE TABLE timetable.tenant_quota (
+	tenant						TEXT		PRIMARY KEY,
+	max_chains					INTEGER		CHECK (max_chains >= 0),
+	max_runs_per_hour			INTEGER		CHECK (max_runs_per_hour >= 0),
+	max_runtime_per_day			INTERVAL
+);
+
+-- row counts and optional checksums recorded by RowCountSnapshot built-in task
+CREATE TABLE timetable.row_count_snapshot (
+	table_name					TEXT		NOT NULL,
+	taken						TIMESTAMPTZ	NOT NULL DEFAULT clock_timestamp(),
+	row_count					BIGINT		NOT NULL,
+	checksum					TEXT,
+	PRIMARY KEY (table_name, taken)
+);
+
+-- REST API tokens used in tenant isolation mode, only SHA-256 hashes of tokens are stored
+CREATE TABLE timetable.api_token (
+	token_hash					TEXT		PRIMARY KEY,
+	tenant						TEXT		NOT NULL,
+	comment						TEXT
+);
+
+-- files produced by chain runs stored under the artifacts directory, "path" is relative to it
+CREATE TABLE timetable.run_artifact (
+	artifact_id					BIGSERIAL	PRIMARY KEY,
+	run_status					BIGINT		NOT NULL,
+	chain_execution_config		BIGINT,
+	task_name					TEXT		NOT NULL,
+	file_name					TEXT		NOT NULL,
+	path						TEXT		NOT NULL,
+	size						BIGINT		NOT NULL,
+	client_name					TEXT		NOT NULL,
+	created						TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	expires						TIMESTAMPTZ
+);
+
+-- time chains waited on constraints, e.g. max_instances, before the execution
+CREATE TABLE timetable.chain_wait (
+	chain_execution_config		BIGINT		NOT NULL,
+	reason						TEXT		NOT NULL,
+	client_name					TEXT		NOT NULL,
+	started						TIMESTAMPTZ	NOT NULL,
+	finished					TIMESTAMPTZ	NOT NULL
+);
+
+-- resources of hosts reported by clients every minute, memory and disk space of the temporary directory
+-- are in bytes, NULL means the metric is not available on the platform
+CREATE TABLE timetable.client (
+	client_name					TEXT		PRIMARY KEY,
+	hostname					TEXT,
+	pid							INTEGER		NOT NULL,
+	load1						FLOAT8,
+	load5						FLOAT8,
+	load15						FLOAT8,
+	mem_total					BIGINT,
+	mem_available				BIGINT,
+	disk_total					BIGINT,
+	disk_free					BIGINT,
+	reported					TIMESTAMPTZ	NOT NULL
+);
+
+-- client name leases used instead of advisory locks by clients running behind PgBouncer, and heartbeats
+-- of clients holding the lock. The client which "heartbeat" expired is marked "lost" once by living clients
+CREATE TABLE timetable.client_lease (
+	client_name					TEXT		PRIMARY KEY,
+	hostname					TEXT,
+	pid							INTEGER		NOT NULL,
+	expires						TIMESTAMPTZ	NOT NULL,
+	client_group				TEXT,
+	heartbeat					TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	lost						TIMESTAMPTZ
+);
+
+-- clients with their last heartbeat, "dead" clients have not checked in before their heartbeat expired
+CREATE VIEW timetable.client_status AS
+SELECT client_name, hostname, pid, client_group, heartbeat, expires, expires < now() AS dead, lost
+FROM timetable.client_lease;
+
+-- runs of group chains claimed by members of the client group, the run "due" at is executed by the client
+-- inserting the claim first
+CREATE TABLE timetable.chain_claim (
+	chain_execution_config		BIGINT		NOT NULL REFERENCES timetable.chain_execution_config(chain_execution_config)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	due							TIMESTAMPTZ	NOT NULL,
+	client_name					TEXT		NOT NULL,
+	claimed						TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	PRIMARY KEY (chain_execution_config, due)
+);
+
+-- SLA violations of chains: the run exceeded "max_duration" (MAX_DURATION) or the run "scheduled" at
+-- was not started within "max_start_delay" (MISSED_START). Every violation is reported once
+CREATE TABLE timetable.sla_violation (
+	sla_violation				BIGSERIAL	PRIMARY KEY,
+	chain_execution_config		BIGINT		NOT NULL REFERENCES timetable.chain_execution_config(chain_execution_config)
+											ON UPDATE CASCADE
+											ON DELETE CASCADE,
+	kind						TEXT		NOT NULL CHECK (kind IN ('MAX_DURATION', 'MISSED_START')),
+	run_status					BIGINT,
+	scheduled					TIMESTAMPTZ,
+	detected					TIMESTAMPTZ	NOT NULL DEFAULT now(),
+	client_name					TEXT		NOT NULL,
+	UNIQUE (chain_execution_config, run_status),
+	UNIQUE (chain_execution_config, scheduled)
+);
+
+CREATE OR REPLACE FUNCTION timetable.trig_max_chains() RETURNS trigger AS $$
+DECLARE
+	v_max_chains INTEGER;
+BEGIN
+	SELECT max_chains FROM timetable.tenant_quota WHERE tenant = NEW.tenant INTO v_max_chains;
+	IF v_max_chains <= (SELECT count(*) FROM timetable.chain_execution_config 
+		WHERE tenant = NEW.tenant AND chain_execution_config <> NEW.chain_execution_config) THEN
+		RAISE EXCEPTION 'Tenant % exceeded max_chains quota of %', NEW.tenant, v_max_chains
+		USING 
+			ERRCODE = 'program_limit_exceeded',
+			HINT = 'Please check timetable.tenant_quota';
+	END IF;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trig_max_chains
+	BEFORE INSERT OR UPDATE OF tenant ON timetable.chain_execution_config
+	FOR EACH ROW EXECUTE PROCEDURE timetable.trig_max_chains();
+
 CREATE OR REPLACE FUNCTION timetable.trig_chain_fixer() RETURNS trigger AS $$
 	DECLARE
 		tmp_parent_id BIGINT;
@@ -40,33 +40,7 @@ BEGIN
 END
 $$ LANGUAGE 'plpgsql';
 
--- is_cron_in_time returns TRUE if timestamp is listed in cron expression
-CREATE OR REPLACE FUNCTION timetable.is_cron_in_time(run_at timetable.cron, ts timestamptz) RETURNS BOOLEAN AS
-$$
-DECLARE 
-    a_by_minute integer[];
-    a_by_hour integer[];
-    a_by_day integer[];
-    a_by_month integer[];
-    a_by_day_of_week integer[]; 
-BEGIN
-    IF run_at IS NULL
-    THEN
-        RETURN TRUE;
-    END IF;
-    a_by_minute := timetable.cron_element_to_array(run_at, 'minute');
-    a_by_hour := timetable.cron_element_to_array(run_at, 'hour');
-    a_by_day := timetable.cron_element_to_array(run_at, 'day');
-    a_by_month := timetable.cron_element_to_array(run_at, 'month');
-    a_by_day_of_week := timetable.cron_element_to_array(run_at, 'day_of_week'); 
-    RETURN  (a_by_month[1]       IS NULL OR date_part('month', ts) = ANY(a_by_month))
-        AND (a_by_day_of_week[1] IS NULL OR date_part('dow', ts) = ANY(a_by_day_of_week))
-        AND (a_by_day[1]         IS NULL OR date_part('day', ts) = ANY(a_by_day))
-        AND (a_by_hour[1]        IS NULL OR date_part('hour', ts) = ANY(a_by_hour))
-        AND (a_by_minute[1]      IS NULL OR date_part('minute', ts) = ANY(a_by_minute));    
-END;
-$$ LANGUAGE 'plpgsql';
-
+` + sqlIsCronInTime + `
 -- cron_element_to_array() will return array with minutes, hours, days etc. of execution
 CREATE OR REPLACE FUNCTION timetable.cron_element_to_array(element text, element_type text) RETURNS integer[] AS
 $$
@@ -172,6 +146,45 @@ BEGIN
 END;
 $$ LANGUAGE 'plpgsql';
 
+-- resume_run() requests scheduler to resume failed chain run starting from the failed element
+CREATE OR REPLACE FUNCTION timetable.resume_run(run_status_id BIGINT) RETURNS BIGINT AS $$
+DECLARE
+    v_failed_element BIGINT;
+BEGIN
+    SELECT chain_id FROM timetable.run_status
+    WHERE start_status = run_status_id AND execution_status = 'CHAIN_FAILED'
+    INTO v_failed_element;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Failed chain run not found --> %', run_status_id
+        USING 
+            ERRCODE = 'invalid_parameter_value',
+            HINT = 'Please check run_status identifier of the failed run';
+    END IF;
+    INSERT INTO timetable.run_resume (run_status) VALUES (run_status_id)
+    ON CONFLICT (run_status) DO UPDATE SET requested = now(), resumed = NULL;
+    RETURN v_failed_element;
+END
+$$ LANGUAGE 'plpgsql';
+
+-- check_quota() returns the reason if the tenant owning the chain exceeded its quota, NULL otherwise
+CREATE OR REPLACE FUNCTION timetable.check_quota(config_id BIGINT) RETURNS TEXT AS $$
+    SELECT CASE
+        WHEN q.max_runs_per_hour <= (
+            SELECT count(*) FROM timetable.run_status s 
+                JOIN timetable.chain_execution_config cc USING (chain_execution_config)
+            WHERE cc.tenant = q.tenant AND s.start_status IS NULL AND s.execution_status = 'STARTED'
+                AND s.started > now() - interval '1 hour')
+        THEN format('Tenant %s exceeded max_runs_per_hour quota of %s', q.tenant, q.max_runs_per_hour)
+        WHEN q.max_runtime_per_day <= (
+            SELECT COALESCE(sum(s.finished - s.started), interval '0') FROM timetable.run_summary s 
+                JOIN timetable.chain_execution_config cc USING (chain_execution_config)
+            WHERE cc.tenant = q.tenant AND s.finished > now() - interval '1 day')
+        THEN format('Tenant %s exceeded max_runtime_per_day quota of %s', q.tenant, q.max_runtime_per_day)
+    END
+    FROM timetable.tenant_quota q JOIN timetable.chain_execution_config c ON c.tenant = q.tenant
+    WHERE c.chain_execution_config = config_id
+$$ LANGUAGE 'sql' STABLE;
+
 -- job_add() will add job to the system
 CREATE OR REPLACE FUNCTION timetable.job_add(
     task_name        TEXT,
@@ -212,3 +225,57 @@ FROM cte_chain
 RETURNING chain_execution_config 
 ' LANGUAGE 'sql';
 `
+
+const sqlIsCronInTime = `-- is_cron_in_time returns TRUE if timestamp is listed in cron expression. Expressions with the fixed hour are
+-- daylight saving time safe: wall clock times skipped when the clock is turned forward are due once at the first
+-- minute after the gap, times repeated when the clock is turned back are due only the first time
+CREATE OR REPLACE FUNCTION timetable.is_cron_in_time(run_at timetable.cron, ts timestamptz) RETURNS BOOLEAN AS
+$$
+DECLARE 
+    a_by_minute integer[];
+    a_by_hour integer[];
+    a_by_day integer[];
+    a_by_month integer[];
+    a_by_day_of_week integer[]; 
+    offset_now double precision;
+    offset_before double precision;
+    wall timestamp;
+BEGIN
+    IF run_at IS NULL
+    THEN
+        RETURN TRUE;
+    END IF;
+    a_by_minute := timetable.cron_element_to_array(run_at, 'minute');
+    a_by_hour := timetable.cron_element_to_array(run_at, 'hour');
+    a_by_day := timetable.cron_element_to_array(run_at, 'day');
+    a_by_month := timetable.cron_element_to_array(run_at, 'month');
+    a_by_day_of_week := timetable.cron_element_to_array(run_at, 'day_of_week'); 
+    IF a_by_hour[1] IS NOT NULL
+    THEN
+        offset_now := date_part('timezone', ts);
+        offset_before := date_part('timezone', ts - interval '3 hours');
+        IF offset_before > offset_now AND
+            date_part('timezone', ts - make_interval(secs => offset_before - offset_now)) = offset_before
+        THEN
+            RETURN FALSE; -- the wall clock time is repeated
+        END IF;
+    END IF;
+    -- wall clock minutes since the previous minute, more than one if the clock is turned forward
+    FOR wall IN SELECT generate_series(
+        CASE WHEN a_by_hour[1] IS NULL THEN date_trunc('minute', ts::timestamp)
+            ELSE date_trunc('minute', (ts - interval '1 minute')::timestamp) + interval '1 minute' END,
+        date_trunc('minute', ts::timestamp), interval '1 minute')
+    LOOP
+        IF  (a_by_month[1]       IS NULL OR date_part('month', wall) = ANY(a_by_month))
+        AND (a_by_day_of_week[1] IS NULL OR date_part('dow', wall) = ANY(a_by_day_of_week))
+        AND (a_by_day[1]         IS NULL OR date_part('day', wall) = ANY(a_by_day))
+        AND (a_by_hour[1]        IS NULL OR date_part('hour', wall) = ANY(a_by_hour))
+        AND (a_by_minute[1]      IS NULL OR date_part('minute', wall) = ANY(a_by_minute))
+        THEN
+            RETURN TRUE;
+        END IF;
+    END LOOP;
+    RETURN FALSE;
+END;
+$$ LANGUAGE 'plpgsql';
+`
@@ -5,10 +5,44 @@ const sqlTasks = `INSERT INTO timetable.base_task(task_id, name, script, kind) V
 	(DEFAULT, 'Sleep', 'Sleep', 'BUILTIN'),
 	(DEFAULT, 'Log', 'Log', 'BUILTIN'),
 	(DEFAULT, 'SendMail', 'SendMail', 'BUILTIN'),
-	(DEFAULT, 'Download', 'Download', 'BUILTIN');
+	(DEFAULT, 'Download', 'Download', 'BUILTIN'),
+	(DEFAULT, 'ExportRunHistory', 'ExportRunHistory', 'BUILTIN'),
+	(DEFAULT, 'Retention', 'Retention', 'BUILTIN'),
+	(DEFAULT, 'Notify', 'Notify', 'BUILTIN'),
+	(DEFAULT, 'S3Upload', 'S3Upload', 'BUILTIN'),
+	(DEFAULT, 'S3Download', 'S3Download', 'BUILTIN'),
+	(DEFAULT, 'SftpUpload', 'SftpUpload', 'BUILTIN'),
+	(DEFAULT, 'SftpDownload', 'SftpDownload', 'BUILTIN'),
+	(DEFAULT, 'Backup', 'Backup', 'BUILTIN'),
+	(DEFAULT, 'CopyFromFile', 'CopyFromFile', 'BUILTIN'),
+	(DEFAULT, 'CopyToFile', 'CopyToFile', 'BUILTIN'),
+	(DEFAULT, 'Slack', 'Slack', 'BUILTIN'),
+	(DEFAULT, 'RowCountSnapshot', 'RowCountSnapshot', 'BUILTIN'),
+	(DEFAULT, 'Telegram', 'Telegram', 'BUILTIN'),
+	(DEFAULT, 'RefreshMatViews', 'RefreshMatViews', 'BUILTIN'),
+	(DEFAULT, 'KubernetesJob', 'KubernetesJob', 'BUILTIN'),
+	(DEFAULT, 'PartitionMaintenance', 'PartitionMaintenance', 'BUILTIN'),
+	(DEFAULT, 'StoreArtifacts', 'StoreArtifacts', 'BUILTIN'),
+	(DEFAULT, 'WaitFor', 'WaitFor', 'BUILTIN');
 
 CREATE OR REPLACE FUNCTION timetable.get_task_id(task_name TEXT) 
 RETURNS BIGINT AS $$
 	SELECT task_id FROM timetable.base_task WHERE name = $1;
 $$ LANGUAGE 'sql'
-STRICT;`
+STRICT;
+` + sqlRetentionChain
+
+// default chain pruning log and run status tables, disabled until user sets live = TRUE
+const sqlRetentionChain = `
+WITH 
+	cte_chain(v_chain_id) AS (
+		INSERT INTO timetable.task_chain (task_id) VALUES (timetable.get_task_id('Retention'))
+		RETURNING chain_id
+	),
+	cte_config(v_chain_config_id, v_chain_id) AS (
+		INSERT INTO timetable.chain_execution_config (chain_id, chain_name, run_at, max_instances, live)
+		SELECT v_chain_id, 'timetable retention', '0 3 * * *', 1, FALSE FROM cte_chain
+		RETURNING chain_execution_config, chain_id
+	)
+INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+SELECT v_chain_config_id, v_chain_id, 1, '{"period": "30 days", "batchsize": 10000}' :: jsonb FROM cte_config;`
@@ -0,0 +1,29 @@
+package pgengine
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// inRecovery is set while the client is connected to the standby server
+var inRecovery int32
+
+// IsInRecovery checks if the configuration database is the standby server, the result is remembered
+// by InRecovery. The server is considered primary if the check fails
+func IsInRecovery(ctx context.Context) bool {
+	var res bool
+	if err := ConfigDb.GetContext(ctx, &res, "SELECT pg_is_in_recovery()"); err != nil {
+		LogToDB("ERROR", "Cannot check if the server is in recovery: ", err)
+	}
+	var val int32
+	if res {
+		val = 1
+	}
+	atomic.StoreInt32(&inRecovery, val)
+	return res
+}
+
+// InRecovery returns true if the standby server was detected by the last IsInRecovery call
+func InRecovery() bool {
+	return atomic.LoadInt32(&inRecovery) == 1
+}
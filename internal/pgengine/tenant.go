@@ -0,0 +1,164 @@
+package pgengine
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// TenantIsolation parameter enables scoping of chains, logs and REST API by tenant
+var TenantIsolation bool
+
+// ErrInvalidToken is returned if REST API token is not registered in timetable.api_token
+var ErrInvalidToken = errors.New("Invalid API token")
+
+// errTenantConnection is returned if the task of the tenant chain connects to another database, policies
+// protect the configuration database only
+var errTenantConnection = errors.New("Tasks of tenant chains cannot connect to other databases in tenant isolation mode")
+
+// Row level security policies scoping chains and their logs by tenant. The scheduler owns the tables
+// and bypasses policies, tenant roles see rows of the tenants they are members of only.
+// is_chain_member walks task_chain up to the head of the chain bypassing policies, so it checks the member
+// passed instead of current_user. Chains not referenced by any configuration yet are visible to build them
+const sqlTenantIsolation = `
+CREATE OR REPLACE FUNCTION timetable.is_tenant_member(tenant TEXT) RETURNS BOOLEAN AS $$
+	SELECT tenant = current_user OR EXISTS(SELECT 1 FROM pg_roles WHERE rolname = tenant AND pg_has_role(oid, 'MEMBER'))
+$$ LANGUAGE 'sql' STABLE;
+
+CREATE OR REPLACE FUNCTION timetable.is_chain_member(element BIGINT, member NAME) RETURNS BOOLEAN AS $$
+	WITH RECURSIVE chain AS (
+		SELECT chain_id, parent_id FROM timetable.task_chain WHERE chain_id = element
+		UNION ALL
+		SELECT tc.chain_id, tc.parent_id FROM timetable.task_chain tc JOIN chain ON tc.chain_id = chain.parent_id
+	), configs AS (
+		SELECT c.tenant FROM chain JOIN timetable.chain_execution_config c ON c.chain_id = chain.chain_id
+		WHERE chain.parent_id IS NULL
+	)
+	SELECT NOT EXISTS(SELECT 1 FROM configs) OR EXISTS(SELECT 1 FROM configs
+		WHERE tenant = member OR EXISTS(SELECT 1 FROM pg_roles WHERE rolname = tenant AND pg_has_role(member, oid, 'MEMBER')))
+$$ LANGUAGE 'sql' STABLE SECURITY DEFINER SET search_path = pg_catalog;
+
+ALTER TABLE timetable.chain_execution_config ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.chain_execution_config;
+CREATE POLICY tenant_isolation ON timetable.chain_execution_config
+	USING (timetable.is_tenant_member(tenant)) WITH CHECK (timetable.is_tenant_member(tenant)
+		AND (chain_id IS NULL OR timetable.is_chain_member(chain_id, current_user)));
+
+-- elements of other tenants are hidden, remote connections and roles are reserved for the scheduler
+ALTER TABLE timetable.task_chain ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.task_chain;
+CREATE POLICY tenant_isolation ON timetable.task_chain
+	USING (timetable.is_chain_member(chain_id, current_user))
+	WITH CHECK (run_uid IS NULL AND database_connection IS NULL
+		AND (parent_id IS NULL OR timetable.is_chain_member(parent_id, current_user)));
+
+-- base tasks are shared, tenants read them only
+ALTER TABLE timetable.base_task ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.base_task;
+CREATE POLICY tenant_isolation ON timetable.base_task FOR SELECT USING (true);
+
+ALTER TABLE timetable.chain_execution_parameters ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.chain_execution_parameters;
+CREATE POLICY tenant_isolation ON timetable.chain_execution_parameters
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = chain_execution_parameters.chain_execution_config));
+
+ALTER TABLE timetable.run_status ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.run_status;
+CREATE POLICY tenant_isolation ON timetable.run_status
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = run_status.chain_execution_config));
+
+ALTER TABLE timetable.execution_log ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.execution_log;
+CREATE POLICY tenant_isolation ON timetable.execution_log
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = execution_log.chain_execution_config));
+
+ALTER TABLE timetable.run_summary ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.run_summary;
+CREATE POLICY tenant_isolation ON timetable.run_summary
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = run_summary.chain_execution_config));
+
+ALTER TABLE timetable.run_resume ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.run_resume;
+CREATE POLICY tenant_isolation ON timetable.run_resume
+	USING (EXISTS(SELECT 1 FROM timetable.run_status s WHERE s.run_status = run_resume.run_status));
+
+ALTER TABLE timetable.run_artifact ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.run_artifact;
+CREATE POLICY tenant_isolation ON timetable.run_artifact
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = run_artifact.chain_execution_config));
+
+ALTER TABLE timetable.chain_wait ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.chain_wait;
+CREATE POLICY tenant_isolation ON timetable.chain_wait
+	USING (EXISTS(SELECT 1 FROM timetable.chain_execution_config c
+		WHERE c.chain_execution_config = chain_wait.chain_execution_config));
+
+ALTER TABLE timetable.tenant_quota ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON timetable.tenant_quota;
+CREATE POLICY tenant_isolation ON timetable.tenant_quota FOR SELECT
+	USING (timetable.is_tenant_member(tenant));
+
+-- no policies, client messages, API tokens and connection strings are visible to the scheduler only
+ALTER TABLE timetable.log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timetable.api_token ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timetable.database_connection ENABLE ROW LEVEL SECURITY;`
+
+// SetupTenantIsolation installs row level security policies scoping chains and logs by tenant
+func SetupTenantIsolation(ctx context.Context) bool {
+	LogToDB("LOG", "Installing tenant isolation policies...")
+	if _, err := ConfigDb.ExecContext(ctx, SchemaSQL(sqlTenantIsolation)); err != nil {
+		LogToDB("PANIC", "Cannot install tenant isolation policies: ", err)
+		return false
+	}
+	return true
+}
+
+// GetTokenTenant returns the tenant REST API token is issued for. Only SHA-256 hashes of tokens are stored
+func GetTokenTenant(ctx context.Context, token string) (tenant string, err error) {
+	if token == "" {
+		return "", ErrInvalidToken
+	}
+	hash := sha256.Sum256([]byte(token))
+	err = ConfigDb.GetContext(ctx, &tenant, SchemaSQL("SELECT tenant FROM timetable.api_token WHERE token_hash = $1"),
+		hex.EncodeToString(hash[:]))
+	if err == sql.ErrNoRows {
+		err = ErrInvalidToken
+	}
+	return
+}
+
+// isTenantRun returns true if the element belongs to the tenant chain run in tenant isolation mode
+func isTenantRun(chainElemExec *ChainElementExecution) bool {
+	return TenantIsolation && chainElemExec.Run != nil && chainElemExec.Run.Tenant != ""
+}
+
+// tenantRole returns the role the SQL task is executed as. In tenant isolation mode tasks of tenant chains
+// are executed as the tenant regardless of run_as_role and run_uid, so policies apply to them
+func tenantRole(chainElemExec *ChainElementExecution) (sql.NullString, error) {
+	if !isTenantRun(chainElemExec) {
+		return chainElemExec.Role(), nil
+	}
+	if chainElemExec.DatabaseConnection.Valid {
+		return sql.NullString{}, errTenantConnection
+	}
+	return sql.NullString{String: chainElemExec.Run.Tenant, Valid: true}, nil
+}
+
+// setLocalRole sets the role until the end of the chain transaction
+func setLocalRole(executor SQLExecutor, role sql.NullString) error {
+	LogToDB("LOG", "Setting local Role to ", role.String)
+	_, err := executor.Exec("SET LOCAL ROLE " + pq.QuoteIdentifier(role.String))
+	if err != nil {
+		LogToDB("ERROR", "Error in Setting local role", err)
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package pgengine
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantRole(t *testing.T) {
+	elem := &ChainElementExecution{RunAsRole: sql.NullString{String: "postgres", Valid: true}, Run: &ChainRun{Tenant: "team_a"}}
+	role, err := tenantRole(elem)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres", role.String, "Role of the task should be used without tenant isolation")
+
+	TenantIsolation = true
+	defer func() { TenantIsolation = false }()
+	role, err = tenantRole(elem)
+	assert.NoError(t, err)
+	assert.Equal(t, sql.NullString{String: "team_a", Valid: true}, role, "Tasks of tenant chains should be executed as the tenant")
+
+	elem.DatabaseConnection = sql.NullString{String: "1", Valid: true}
+	_, err = tenantRole(elem)
+	assert.Equal(t, errTenantConnection, err, "Tasks of tenant chains should not connect to other databases")
+
+	role, err = tenantRole(&ChainElementExecution{RunUID: sql.NullString{String: "etl", Valid: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, "etl", role.String, "Role of the task should be used outside of the chain run")
+}
@@ -6,11 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/secrets"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // ChainElementExecution structure describes each chain execution process
@@ -22,12 +23,55 @@ type ChainElementExecution struct {
 	Script             string         `db:"script"`
 	Kind               string         `db:"kind"`
 	RunUID             sql.NullString `db:"run_uid"`
+	RunAsRole          sql.NullString `db:"run_as_role"`
 	IgnoreError        bool           `db:"ignore_error"`
 	Autonomous         bool           `db:"autonomous"`
+	OnCommit           bool           `db:"on_commit"`
+	CompensateTaskID   sql.NullInt64  `db:"compensate_task_id"`
+	WorkDir            sql.NullString `db:"workdir"`
+	Umask              sql.NullString `db:"umask"`
+	Stdin              sql.NullString `db:"stdin" json:"-"`
 	DatabaseConnection sql.NullString `db:"database_connection"`
 	ConnectString      sql.NullString `db:"connect_string"`
+	Sink               sql.NullString `db:"sink"`
+	Settings           sql.NullString `db:"settings"`
+	Description        sql.NullString `db:"description"`
+	RunbookURL         sql.NullString `db:"runbook_url"`
+	SecretParams       bool           `json:"-"` // parameters contain resolved secrets and must not be logged
 	StartedAt          time.Time
 	Duration           int64 // in microseconds
+	ChildPID           int   // process ID of the shell command
+	RowsAffected       int64
+	OutputBytes        int
+	Output             string
+	Run                *ChainRun `json:"-"`
+	// Stdout and Stderr of SHELL and PROGRAM tasks are limited by OutputLimit, streams exceeding the limit
+	// are written completely to StdoutFile and StderrFile if OutputDir is set
+	Stdout     string `json:"-"`
+	Stderr     string `json:"-"`
+	StdoutFile string `json:"-"`
+	StderrFile string `json:"-"`
+}
+
+// ChainRun describes the chain run the element is executed within
+type ChainRun struct {
+	ChainConfigID int
+	ChainName     string
+	RunStatusID   int
+	StartedAt     time.Time
+	LastError     string // the error of the last failed element, e.g. one with ignore_error set
+	// ShellDisabledAction applies to elements blocked by NoShellTasks, see chain_execution_config.shell_disabled_action
+	ShellDisabledAction string
+	RunbookURL          string // the runbook of the chain used for tasks without their own one
+	Tenant              string // the tenant of the chain, SQL tasks are executed as the tenant in tenant isolation mode
+	// Results of the builtin tasks executed during the run as JSON encoded by tasks package by task name
+	Results map[string]json.RawMessage
+	Retries int // performed by the builtin tasks during the run, reported in the run summary
+	// Tx, ElementID and TaskName describe the builtin element being executed, Tx is the transaction of the element,
+	// i.e. the chain transaction or the on-commit one, and nil outside of the configuration database, e.g. in dev run
+	Tx        *sqlx.Tx
+	ElementID int
+	TaskName  string
 }
 
 func (chainElem ChainElementExecution) String() string {
@@ -40,13 +84,14 @@ func StartTransaction(ctx context.Context) (*sqlx.Tx, error) {
 	return ConfigDb.BeginTxx(ctx, nil)
 }
 
-// MustCommitTransaction commits transaction and log error in the case of error
-func MustCommitTransaction(tx *sqlx.Tx) {
+// MustCommitTransaction commits transaction and log error in the case of error, returns true on success
+func MustCommitTransaction(tx *sqlx.Tx) bool {
 	LogToDB("DEBUG", "Commit transaction for successful chain execution")
 	err := tx.Commit()
 	if err != nil {
 		LogToDB("ERROR", "Application cannot commit after job finished: ", err)
 	}
+	return err == nil
 }
 
 // MustRollbackTransaction rollbacks transaction and log error in the case of error
@@ -58,17 +103,33 @@ func MustRollbackTransaction(tx *sqlx.Tx) {
 	}
 }
 
-func mustSavepoint(tx *sqlx.Tx, savepoint string) {
-	LogToDB("DEBUG", "Define savepoint to ignore an error for the task: ", strconv.Quote(savepoint))
-	_, err := tx.Exec("SAVEPOINT " + strconv.Quote(savepoint))
+// TaskSavepoint returns the savepoint name used to guard chain element execution
+func TaskSavepoint(chainElemExec *ChainElementExecution) string {
+	return fmt.Sprintf("task_%d", chainElemExec.ChainID)
+}
+
+// MustSavepoint defines savepoint inside transaction and log error in the case of error
+func MustSavepoint(tx *sqlx.Tx, savepoint string) {
+	LogToDB("DEBUG", "Define savepoint to ignore an error for the task: ", savepoint)
+	_, err := tx.Exec("SAVEPOINT " + pq.QuoteIdentifier(savepoint))
 	if err != nil {
 		LogToDB("ERROR", err)
 	}
 }
 
-func mustRollbackToSavepoint(tx *sqlx.Tx, savepoint string) {
+// MustRollbackToSavepoint rollbacks transaction to the savepoint and log error in the case of error
+func MustRollbackToSavepoint(tx *sqlx.Tx, savepoint string) {
 	LogToDB("DEBUG", "Rollback to savepoint ignoring error for the task: ", savepoint)
-	_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + strconv.Quote(savepoint))
+	_, err := tx.Exec("ROLLBACK TO SAVEPOINT " + pq.QuoteIdentifier(savepoint))
+	if err != nil {
+		LogToDB("ERROR", err)
+	}
+}
+
+// MustReleaseSavepoint releases savepoint after successful task execution and log error in the case of error
+func MustReleaseSavepoint(tx *sqlx.Tx, savepoint string) {
+	LogToDB("DEBUG", "Release savepoint for the task: ", savepoint)
+	_, err := tx.Exec("RELEASE SAVEPOINT " + pq.QuoteIdentifier(savepoint))
 	if err != nil {
 		LogToDB("ERROR", err)
 	}
@@ -78,14 +139,24 @@ func mustRollbackToSavepoint(tx *sqlx.Tx, savepoint string) {
 func GetChainElements(tx *sqlx.Tx, chains interface{}, chainID int) bool {
 	const sqlSelectChains = `
 WITH RECURSIVE x
-(chain_id, task_id, task_name, script, kind, run_uid, ignore_error, autonomous, database_connection) AS 
+(chain_id, task_id, task_name, script, kind, run_uid, run_as_role, ignore_error, autonomous, on_commit, compensate_task_id, workdir, umask, stdin, sink, settings, database_connection, description, runbook_url) AS 
 (
 	SELECT tc.chain_id, tc.task_id, bt.name, 
 	bt.script, bt.kind, 
 	tc.run_uid, 
+	tc.run_as_role,
 	tc.ignore_error, 
 	tc.autonomous,
-	tc.database_connection 
+	tc.on_commit,
+	tc.compensate_task_id,
+	tc.workdir,
+	tc.umask,
+	tc.stdin,
+	tc.sink,
+	tc.settings,
+	tc.database_connection,
+	bt.description,
+	bt.runbook_url
 	FROM timetable.task_chain tc JOIN 
 	timetable.base_task bt USING (task_id) 
 	WHERE tc.parent_id IS NULL AND tc.chain_id = $1 
@@ -93,9 +164,19 @@ WITH RECURSIVE x
 	SELECT tc.chain_id, tc.task_id, bt.name, 
 	bt.script, bt.kind, 
 	tc.run_uid, 
+	tc.run_as_role,
 	tc.ignore_error, 
 	tc.autonomous,
-	tc.database_connection 
+	tc.on_commit,
+	tc.compensate_task_id,
+	tc.workdir,
+	tc.umask,
+	tc.stdin,
+	tc.sink,
+	tc.settings,
+	tc.database_connection,
+	bt.description,
+	bt.runbook_url
 	FROM timetable.task_chain tc JOIN 
 	timetable.base_task bt USING (task_id) JOIN 
 	x ON (x.chain_id = tc.parent_id) 
@@ -106,7 +187,17 @@ WITH RECURSIVE x
 		WHERE a.database_connection = x.database_connection) 
 	FROM x`
 
-	err := tx.Select(chains, sqlSelectChains, chainID)
+	query := SchemaSQL(sqlSelectChains)
+	if !Enabled(FeatureSinks) {
+		query = strings.Replace(query, "tc.sink", "NULL::jsonb", -1)
+	}
+	if !Enabled(FeatureTaskSettings) {
+		query = strings.Replace(query, "tc.settings", "NULL::jsonb", -1)
+	}
+	if !Enabled(FeatureRunAsRole) {
+		query = strings.Replace(query, "tc.run_as_role", "NULL::text", -1)
+	}
+	err := tx.Select(chains, query, chainID)
 
 	if err != nil {
 		LogToDB("ERROR", "Recursive queries to fetch chain tasks failed: ", err)
@@ -115,73 +206,171 @@ WITH RECURSIVE x
 	return true
 }
 
-// GetChainParamValues returns parameter values to pass for task being executed
-func GetChainParamValues(tx *sqlx.Tx, paramValues interface{}, chainElemExec *ChainElementExecution) bool {
+// GetChainParamValues returns parameter values to pass for task being executed. Secret references
+// in parameters marked as secret are resolved within the chain context, see secrets.ResolveJSON
+func GetChainParamValues(ctx context.Context, tx *sqlx.Tx, paramValues *[]string, chainElemExec *ChainElementExecution) bool {
 	const sqlGetParamValues = `
-SELECT value
+SELECT value, %s AS secret
 FROM  timetable.chain_execution_parameters
 WHERE chain_execution_config = $1
   AND chain_id = $2
 ORDER BY order_id ASC`
-	err := tx.Select(paramValues, sqlGetParamValues, chainElemExec.ChainConfig, chainElemExec.ChainID)
+	secretColumn := "secret"
+	if !Enabled(FeatureSecrets) {
+		secretColumn = "FALSE"
+	}
+	var params []struct {
+		Value  string `db:"value"`
+		Secret bool   `db:"secret"`
+	}
+	err := tx.SelectContext(ctx, &params, fmt.Sprintf(SchemaSQL(sqlGetParamValues), secretColumn), chainElemExec.ChainConfig, chainElemExec.ChainID)
 	if err != nil {
 		LogToDB("ERROR", "cannot fetch parameters values for chain: ", err)
 		return false
 	}
+	*paramValues = make([]string, len(params))
+	for i, p := range params {
+		if p.Secret {
+			chainElemExec.SecretParams = true
+			if p.Value, err = secrets.ResolveJSON(ctx, p.Value); err != nil {
+				LogToDB("ERROR", "cannot resolve secret parameter for chain: ", err)
+				return false
+			}
+		}
+		(*paramValues)[i] = p.Value
+	}
 	return true
 }
 
+// GetCompensation returns the element executing compensating base task of the chain element.
+// Compensation is executed with the parameters and connection of the element compensated
+func GetCompensation(tx *sqlx.Tx, chainElemExec *ChainElementExecution) (*ChainElementExecution, bool) {
+	compensation := *chainElemExec
+	err := tx.Get(&compensation, "SELECT task_id, name AS task_name, script, kind, description, runbook_url "+
+		SchemaSQL("FROM timetable.base_task WHERE task_id = $1"),
+		chainElemExec.CompensateTaskID)
+	if err != nil {
+		LogToDB("ERROR", "Cannot fetch compensating task for chain element: ", err)
+		return nil, false
+	}
+	compensation.IgnoreError = true
+	compensation.OnCommit = false
+	compensation.CompensateTaskID = sql.NullInt64{}
+	return &compensation, true
+}
+
 // ExecuteSQLTask executes SQL task
 func ExecuteSQLTask(ctx context.Context, tx *sqlx.Tx, chainElemExec *ChainElementExecution, paramValues []string) error {
+	return executeSQLTask(ctx, tx, chainElemExec, func(executor sqlRunner) (int64, error) {
+		return executeSQLCommand(executor, chainElemExec.Script, paramValues, chainElemExec.SecretParams)
+	})
+}
+
+// RowsWriter consumes the result set of the SQL task row by row and returns the number of rows written
+type RowsWriter interface {
+	WriteRows(rows *sql.Rows) (int64, error)
+}
+
+// ExecuteSQLTaskToSink executes SQL task passing its result sets to the writer instead of discarding them,
+// rows affected of the element is the number of rows written
+func ExecuteSQLTaskToSink(ctx context.Context, tx *sqlx.Tx, chainElemExec *ChainElementExecution, paramValues []string, w RowsWriter) error {
+	return executeSQLTask(ctx, tx, chainElemExec, func(executor sqlRunner) (int64, error) {
+		return querySQLCommand(executor, chainElemExec.Script, paramValues, chainElemExec.SecretParams, w)
+	})
+}
+
+// sqlRunner is implemented by both the database and the transaction
+type sqlRunner interface {
+	SQLExecutor
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// executeSQLTask runs the script with the executor chosen for the element, i.e. the chain transaction,
+// the autonomous connection or the remote database
+func executeSQLTask(ctx context.Context, tx *sqlx.Tx, chainElemExec *ChainElementExecution, run func(sqlRunner) (int64, error)) error {
 	var execTx *sqlx.Tx
 	var remoteDb *sqlx.DB
 	var err error
-	var executor SQLExecutor
+	var executor sqlRunner
+	var db *sqlx.DB
+
+	role, err := tenantRole(chainElemExec)
+	if err != nil {
+		return err
+	}
 
 	execTx = tx
 	if chainElemExec.Autonomous {
-		executor = ConfigDb
+		executor = ctxRunner{ctx, ConfigDb}
+		db = ConfigDb
 	} else {
-		executor = tx
+		executor = ctxRunner{ctx, tx}
 	}
 
 	//Connect to Remote DB
 	if chainElemExec.DatabaseConnection.Valid {
-		connectionString := GetConnectionString(chainElemExec.DatabaseConnection)
+		connectionString := chainElemExec.ConnectString.String
+		if !chainElemExec.ConnectString.Valid {
+			connectionString = GetConnectionString(chainElemExec.DatabaseConnection)
+		}
 		remoteDb, execTx, err = GetRemoteDBTransaction(ctx, connectionString)
 		if err != nil {
 			return err
 		}
+		defer FinalizeRemoteDBConnection(remoteDb)
 		if chainElemExec.Autonomous {
-			executor = remoteDb
+			executor = ctxRunner{ctx, remoteDb}
+			db = remoteDb
 			_ = execTx.Rollback()
+		} else {
+			// the remote transaction is independent of the chain transaction and committed right after the task
+			executor = ctxRunner{ctx, execTx}
 		}
-		defer FinalizeRemoteDBConnection(remoteDb)
 	}
 
-	// Set Role
-	if chainElemExec.RunUID.Valid && !chainElemExec.Autonomous {
-		SetRole(execTx, chainElemExec.RunUID)
-	}
-
-	if chainElemExec.IgnoreError && !chainElemExec.Autonomous {
-		mustSavepoint(execTx, chainElemExec.TaskName)
+	// Autonomous elements are executed without transaction, the role and settings are applied to the dedicated session
+	if chainElemExec.Autonomous && (role.Valid || chainElemExec.Settings.Valid) {
+		if PgBouncerMode && db == ConfigDb {
+			return errors.New("Role and settings of autonomous tasks require the session, not available behind PgBouncer")
+		}
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		executor = ctxRunner{ctx, conn}
 	}
 
-	err = ExecuteSQLCommand(executor, chainElemExec.Script, paramValues)
-
-	if err != nil && chainElemExec.IgnoreError && !chainElemExec.Autonomous {
-		mustRollbackToSavepoint(execTx, chainElemExec.TaskName)
+	// Set Role, the tenant role is set for the chain transaction only
+	if role.Valid && isTenantRun(chainElemExec) && !chainElemExec.Autonomous {
+		err = setLocalRole(executor, role)
+	} else if role.Valid {
+		err = SetRole(executor, role)
 	}
 
-	//Reset The Role
-	if chainElemExec.RunUID.Valid && !chainElemExec.Autonomous {
-		ResetRole(execTx)
+	if err == nil {
+		var restoreSettings func()
+		if restoreSettings, err = applyTaskSettings(executor, chainElemExec, !chainElemExec.Autonomous); err == nil {
+			chainElemExec.RowsAffected, err = run(executor)
+			// the failed transaction is rolled back to the savepoint or entirely, settings are reverted as well
+			if err == nil || chainElemExec.Autonomous {
+				restoreSettings()
+			}
+		}
+		//Reset The Role
+		if role.Valid && (err == nil || chainElemExec.Autonomous) {
+			ResetRole(executor)
+		}
 	}
 
 	// Commit changes on remote server
 	if chainElemExec.DatabaseConnection.Valid && !chainElemExec.Autonomous {
-		MustCommitTransaction(execTx)
+		if err != nil {
+			MustRollbackTransaction(execTx)
+		} else if !MustCommitTransaction(execTx) {
+			err = errors.New("Cannot commit remote transaction")
+		}
 	}
 
 	return err
@@ -193,39 +382,97 @@ type SQLExecutor interface {
 
 // ExecuteSQLCommand executes chain script with parameters inside transaction
 func ExecuteSQLCommand(executor SQLExecutor, script string, paramValues []string) error {
-	var err error
+	_, err := executeSQLCommand(executor, script, paramValues, false)
+	return err
+}
+
+// paramsLogValue returns parameters for debug messages, values are hidden if they contain resolved secrets
+func paramsLogValue(params []interface{}, secret bool) string {
+	if secret {
+		return fmt.Sprintf("; With %d secret parameters", len(params))
+	}
+	return fmt.Sprintf("; With parameters: %+v", params)
+}
+
+// executeSQLCommand returns the number of rows affected by all executions of the script
+func executeSQLCommand(executor SQLExecutor, script string, paramValues []string, secret bool) (rowsAffected int64, err error) {
 	var params []interface{}
+	var res sql.Result
 
 	if strings.TrimSpace(script) == "" {
-		return errors.New("SQL script cannot be empty")
+		return 0, errors.New("SQL script cannot be empty")
 	}
 	if len(paramValues) == 0 { //mimic empty param
-		_, err = executor.Exec(script)
-	} else {
-		for _, val := range paramValues {
-			if val > "" {
-				if err := json.Unmarshal([]byte(val), &params); err != nil {
-					return err
-				}
-				LogToDB("DEBUG", "Executing the command: ", script, fmt.Sprintf("; With parameters: %+v", params))
-				_, err = executor.Exec(script, params...)
+		res, err = executor.Exec(script)
+		return addRowsAffected(rowsAffected, res), err
+	}
+	for _, val := range paramValues {
+		if val > "" {
+			if err := json.Unmarshal([]byte(val), &params); err != nil {
+				return rowsAffected, err
 			}
+			LogToDB("DEBUG", "Executing the command: ", script, paramsLogValue(params, secret))
+			res, err = executor.Exec(script, params...)
+			rowsAffected = addRowsAffected(rowsAffected, res)
 		}
 	}
-	return err
+	return rowsAffected, err
 }
 
-//GetConnectionString of database_connection
+// querySQLCommand passes result sets of all executions of the script to the writer
+func querySQLCommand(queryer sqlRunner, script string, paramValues []string, secret bool, w RowsWriter) (rowsWritten int64, err error) {
+	if strings.TrimSpace(script) == "" {
+		return 0, errors.New("SQL script cannot be empty")
+	}
+	if len(paramValues) == 0 { //mimic empty param
+		paramValues = []string{"[]"}
+	}
+	for _, val := range paramValues {
+		if val == "" {
+			continue
+		}
+		var params []interface{}
+		if err := json.Unmarshal([]byte(val), &params); err != nil {
+			return rowsWritten, err
+		}
+		LogToDB("DEBUG", "Executing the query: ", script, paramsLogValue(params, secret))
+		rows, err := queryer.Query(script, params...)
+		if err != nil {
+			return rowsWritten, err
+		}
+		n, err := w.WriteRows(rows)
+		rowsWritten += n
+		if closeErr := rows.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return rowsWritten, err
+		}
+	}
+	return rowsWritten, nil
+}
+
+func addRowsAffected(rowsAffected int64, res sql.Result) int64 {
+	if res == nil {
+		return rowsAffected
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		return rowsAffected + n
+	}
+	return rowsAffected
+}
+
+// GetConnectionString of database_connection
 func GetConnectionString(databaseConnection sql.NullString) (connectionString string) {
 	err := ConfigDb.Get(&connectionString, "SELECT connect_string "+
-		"FROM timetable.database_connection WHERE database_connection = $1", databaseConnection)
+		SchemaSQL("FROM timetable.database_connection WHERE database_connection = $1"), databaseConnection)
 	if err != nil {
 		LogToDB("ERROR", "Issue while fetching connection string:", err)
 	}
 	return connectionString
 }
 
-//GetRemoteDBTransaction create a remote db connection and returns transaction object
+// GetRemoteDBTransaction create a remote db connection and returns transaction object
 func GetRemoteDBTransaction(ctx context.Context, connectionString string) (*sqlx.DB, *sqlx.Tx, error) {
 	if strings.TrimSpace(connectionString) == "" {
 		return nil, nil, errors.New("Connection string is blank")
@@ -255,20 +502,30 @@ func FinalizeRemoteDBConnection(remoteDb *sqlx.DB) {
 	remoteDb = nil
 }
 
-// SetRole - set the current user identifier of the current session
-func SetRole(tx *sqlx.Tx, runUID sql.NullString) {
+// Role returns the database role the SQL task is executed as, run_as_role takes precedence over legacy run_uid
+func (chainElem ChainElementExecution) Role() sql.NullString {
+	if chainElem.RunAsRole.Valid {
+		return chainElem.RunAsRole
+	}
+	return chainElem.RunUID
+}
+
+// SetRole - set the current user identifier of the current session. The task must not be executed
+// if the role cannot be set, otherwise it would run with privileges of the scheduler
+func SetRole(executor SQLExecutor, runUID sql.NullString) error {
 	LogToDB("LOG", "Setting Role to ", runUID.String)
-	_, err := tx.Exec(fmt.Sprintf("SET ROLE %v", runUID.String))
+	_, err := executor.Exec("SET ROLE " + pq.QuoteIdentifier(runUID.String))
 	if err != nil {
 		LogToDB("ERROR", "Error in Setting role", err)
 	}
+	return err
 }
 
-//ResetRole - RESET forms reset the current user identifier to be the current session user identifier
-func ResetRole(tx *sqlx.Tx) {
+// ResetRole - RESET forms reset the current user identifier to be the current session user identifier
+func ResetRole(executor SQLExecutor) {
 	LogToDB("LOG", "Resetting Role")
 	const sqlResetRole = `RESET ROLE`
-	_, err := tx.Exec(sqlResetRole)
+	_, err := executor.Exec(sqlResetRole)
 	if err != nil {
 		LogToDB("ERROR", "Error in ReSetting role", err)
 	}
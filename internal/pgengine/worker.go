@@ -0,0 +1,23 @@
+package pgengine
+
+import (
+	"context"
+	"database/sql"
+	"os"
+)
+
+// Host is the name of the host the scheduler is running on, it's recorded with every run status
+var Host, _ = os.Hostname()
+
+type workerIDKey struct{}
+
+// WithWorkerID returns the context of the worker executing chains, the ID is recorded with every run status
+func WithWorkerID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, workerIDKey{}, id)
+}
+
+// WorkerID returns the ID of the worker executing the chain, NULL outside of workers
+func WorkerID(ctx context.Context) sql.NullInt64 {
+	id, ok := ctx.Value(workerIDKey{}).(int)
+	return sql.NullInt64{Int64: int64(id), Valid: ok}
+}
@@ -0,0 +1,275 @@
+package schedule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maximum period to look for the next execution time
+const maxLookAhead = 5 * 366 * 24 * time.Hour
+
+// maxClockShift is the largest daylight saving time shift of the wall clock
+const maxClockShift = 3 * time.Hour
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// CronSchedule is the classic 5 fields cron expression evaluated on the client side.
+// If both day of month and day of week are restricted, the chain is due when either matches.
+// Expressions with the fixed hour are daylight saving time safe: wall clock times skipped when the clock is
+// turned forward are due once at the first minute after the gap, times repeated when the clock is turned back
+// are due only the first time. Expressions with any hour follow the elapsed time
+type CronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domStar, dowStar, hourStar    bool
+}
+
+// ParseCron parses classic cron expression "minute hour day-of-month month day-of-week"
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Cron expression must contain %d fields: %s", len(cronFields), expr)
+	}
+	sets := make([]map[int]bool, len(fields))
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %s: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] { // both 0 and 7 stand for Sunday
+		sets[4][0] = true
+	}
+	return &CronSchedule{
+		minute:   sets[0],
+		hour:     sets[1],
+		dom:      sets[2],
+		month:    sets[3],
+		dow:      sets[4],
+		domStar:  fields[2] == "*",
+		dowStar:  fields[4] == "*",
+		hourStar: fields[1] == "*",
+	}, nil
+}
+
+var (
+	cronMonthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+	// domainField matches the field accepted by timetable.cron domain
+	domainField = regexp.MustCompile(`^((\d+,)+\d+|\d+[/-]\d+|\*[/-]\d+|\d+|\*)$`)
+)
+
+// NormalizeCron converts the crontab schedule to the expression accepted by timetable.cron domain. Macros are
+// resolved, month and day names are replaced by numbers, and fields the domain cannot express, e.g. "1-10/2"
+// or "1-5,10", are expanded to lists. @reboot is returned as is
+func NormalizeCron(expr string) (string, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	if expr == "@reboot" {
+		return expr, nil
+	}
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return "", fmt.Errorf("Cron expression must contain %d fields: %s", len(cronFields), expr)
+	}
+	for i, names := range map[int][]string{3: cronMonthNames, 4: cronDayNames} {
+		for n, name := range names {
+			fields[i] = strings.Replace(fields[i], name, strconv.Itoa(n+cronFields[i].min), -1)
+		}
+	}
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return "", fmt.Errorf("Invalid cron expression %s: %v", expr, err)
+		}
+		if domainField.MatchString(f) {
+			continue
+		}
+		values := make([]string, 0, len(set))
+		for v := cronFields[i].min; v <= cronFields[i].max; v++ {
+			if set[v] {
+				values = append(values, strconv.Itoa(v))
+			}
+		}
+		fields[i] = strings.Join(values, ",")
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func parseCronField(field string, bounds cronField) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step: %s", item)
+			}
+			item = item[:i]
+		}
+		lo, hi := bounds.min, bounds.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			r := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(r[0])
+			hi, err2 = strconv.Atoi(r[1])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid range: %s", item)
+			}
+		default:
+			v, err := strconv.Atoi(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value: %s", item)
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < bounds.min || hi > bounds.max || lo > hi {
+			return nil, fmt.Errorf("value out of range [%d, %d]: %s", bounds.min, bounds.max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// matches returns true if the wall clock minute of t matches cron expression
+func (s *CronSchedule) matches(t time.Time) bool {
+	return s.minute[t.Minute()] && s.hour[t.Hour()] && s.month[int(t.Month())] && s.dayMatches(t)
+}
+
+// IsDue returns true if the minute of t matches cron expression, see CronSchedule for daylight saving time
+func (s *CronSchedule) IsDue(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	if s.hourStar {
+		return s.matches(t)
+	}
+	return s.matches(t) && !isRepeated(t) || s.skippedMatches(t)
+}
+
+// skippedMatches returns true if t is the first minute after the clock is turned forward and any of the
+// skipped wall clock minutes matches cron expression
+func (s *CronSchedule) skippedMatches(t time.Time) bool {
+	end := wallClock(t)
+	for w := wallClock(t.Add(-time.Minute)).Add(time.Minute); w.Before(end); w = w.Add(time.Minute) {
+		if s.matches(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// wallClock returns the wall clock time of t as UTC time, so wall clock minutes can be iterated over
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// isRepeated returns true if the wall clock time of t already occurred before the clock was turned back
+func isRepeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-maxClockShift).Zone()
+	if before <= offset {
+		return false
+	}
+	_, earlier := t.Add(-time.Duration(before-offset) * time.Second).Zone()
+	return earlier == before
+}
+
+// Next returns the first minute after t matching cron expression, see CronSchedule for daylight saving time
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for {
+		next := s.nextMatch(t)
+		if !s.hourStar {
+			if skipped := s.nextSkipped(t, next); !skipped.IsZero() {
+				return skipped
+			}
+			if !next.IsZero() && isRepeated(next) {
+				t = next.Add(time.Minute)
+				continue
+			}
+		}
+		return next
+	}
+}
+
+// nextSkipped returns the first minute after the clock is turned forward between from and until matching
+// cron expression with the skipped wall clock minutes, zero time if there is none. Zero until means no limit
+func (s *CronSchedule) nextSkipped(from, until time.Time) time.Time {
+	if from.Location() == time.UTC {
+		return time.Time{}
+	}
+	if until.IsZero() {
+		until = from.Add(maxLookAhead)
+	}
+	for h := from; !h.After(until); h = h.Add(time.Hour) {
+		_, offset := h.Zone()
+		_, next := h.Add(time.Hour).Zone()
+		if next <= offset {
+			continue
+		}
+		for m := h.Add(time.Minute); !m.After(h.Add(time.Hour)) && !m.After(until); m = m.Add(time.Minute) {
+			if !m.Before(from) && s.skippedMatches(m) {
+				return m
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// nextMatch returns the first minute starting from t matching cron expression by the wall clock
+func (s *CronSchedule) nextMatch(t time.Time) time.Time {
+	loc := t.Location()
+	deadline := t.Add(maxLookAhead)
+	for t.Before(deadline) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour[t.Hour()]:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
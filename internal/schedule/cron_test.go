@@ -0,0 +1,138 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/5 1-3 1,15 * 1-5", "@daily", "0 0 * * 7", "10-50/10 * * * *"} {
+		_, err := ParseCron(expr)
+		assert.NoError(t, err, expr)
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNormalizeCron(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"*/5 1-3 1,15 * 1-5": "*/5 1-3 1,15 * 1-5",
+		"@daily":             "0 0 * * *",
+		"@reboot":            "@reboot",
+		"0 12 * JAN-MAR mon": "0 12 * 1-3 1",
+		"0 0 * * sat,sun":    "0 0 * * 6,0",
+		"1-10/3 * * * *":     "1,4,7,10 * * * *",
+		"0 1-3,22 * * *":     "0 1,2,3,22 * * *",
+		"30 4 1-7 */2 1-5/2": "30 4 1-7 */2 1,3,5",
+	} {
+		actual, err := NormalizeCron(expr)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, actual, expr)
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "0 0 * foo *", "@sometimes"} {
+		_, err := NormalizeCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronIsDue(t *testing.T) {
+	s, err := ParseCron("*/15 9-17 * * 1-5")
+	assert.NoError(t, err)
+	// 2020-03-02 is Monday
+	assert.True(t, s.IsDue(time.Date(2020, 3, 2, 9, 15, 30, 0, time.UTC)))
+	assert.False(t, s.IsDue(time.Date(2020, 3, 2, 9, 16, 0, 0, time.UTC)))
+	assert.False(t, s.IsDue(time.Date(2020, 3, 1, 9, 15, 0, 0, time.UTC)))
+
+	s, err = ParseCron("0 0 13 * 5")
+	assert.NoError(t, err)
+	assert.True(t, s.IsDue(time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC)), "day of month matches")
+	assert.True(t, s.IsDue(time.Date(2020, 3, 6, 0, 0, 0, 0, time.UTC)), "day of week matches")
+	assert.False(t, s.IsDue(time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)))
+
+	s, err = ParseCron("0 0 * * 7")
+	assert.NoError(t, err)
+	assert.True(t, s.IsDue(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)), "7 is Sunday")
+}
+
+func TestCronNext(t *testing.T) {
+	s, err := ParseCron("30 2 29 2 *")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 29, 2, 30, 0, 0, time.UTC), s.Next(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+	s, err = ParseCron("@hourly")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 3, 1, 11, 0, 0, 0, time.UTC), s.Next(time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)))
+
+	s, err = ParseCron("0 0 31 2 *")
+	assert.NoError(t, err)
+	assert.True(t, s.Next(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)).IsZero())
+}
+
+func TestCronDaylightSaving(t *testing.T) {
+	for _, c := range []struct {
+		zone                   string
+		forward, back          time.Time // transitions in UTC
+		skipped, repeated, gap string    // cron expressions at the skipped and the repeated wall clock time
+	}{
+		{"Europe/Berlin", time.Date(2021, 3, 28, 1, 0, 0, 0, time.UTC), time.Date(2021, 10, 31, 1, 0, 0, 0, time.UTC),
+			"30 2 * * *", "30 2 * * *", "30 * * * *"},
+		{"America/New_York", time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC), time.Date(2021, 11, 7, 6, 0, 0, 0, time.UTC),
+			"30 2 * * *", "30 1 * * *", "30 * * * *"},
+		{"Australia/Lord_Howe", time.Date(2021, 10, 2, 15, 30, 0, 0, time.UTC), time.Date(2021, 4, 3, 15, 0, 0, 0, time.UTC),
+			"15 2 * * *", "45 1 * * *", "15 * * * *"},
+	} {
+		loc, err := time.LoadLocation(c.zone)
+		if err != nil {
+			t.Skip("Time zone database is not available: ", err)
+		}
+		// wall clock times skipped are due at the first minute after the gap
+		forward := c.forward.In(loc)
+		s, _ := ParseCron(c.skipped)
+		assert.True(t, s.IsDue(forward), "%s: skipped time should be due after the gap", c.zone)
+		assert.False(t, s.IsDue(forward.Add(time.Minute)), c.zone)
+		assert.Equal(t, forward, s.Next(forward.Add(-2*time.Hour)), c.zone)
+		assert.Len(t, dueMinutes(s, forward.Add(-12*time.Hour), forward.Add(12*time.Hour)), 1,
+			"%s: skipped time should be due once", c.zone)
+		// wall clock times of the repeated hour are due only the first time
+		s, _ = ParseCron(c.repeated)
+		runs := dueMinutes(s, c.back.Add(-12*time.Hour).In(loc), c.back.Add(12*time.Hour).In(loc))
+		assert.Len(t, runs, 1, "%s: repeated time should be due once", c.zone)
+		for _, r := range runs {
+			assert.False(t, isRepeated(r), c.zone)
+		}
+		next := s.Next(c.back.Add(-2 * time.Hour).In(loc))
+		assert.True(t, s.Next(next).Sub(next) > 23*time.Hour, "%s: repeated time should not be next", c.zone)
+		// chains executed every hour follow the elapsed time
+		s, _ = ParseCron(c.gap)
+		assert.Len(t, dueMinutes(s, c.back.Add(-3*time.Hour).In(loc), c.back.Add(3*time.Hour).In(loc)), 6, c.zone)
+	}
+}
+
+// dueMinutes returns minutes from the range the schedule is due at, every due minute must be the next of the previous
+func dueMinutes(s Schedule, from, to time.Time) (due []time.Time) {
+	next := s.Next(from)
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		if s.IsDue(t) {
+			if !t.Equal(next) {
+				return nil
+			}
+			due = append(due, t)
+			next = s.Next(t)
+		}
+	}
+	return
+}
+
+func TestParse(t *testing.T) {
+	_, err := Parse("cron", "* * * * *")
+	assert.NoError(t, err)
+	_, err = Parse("foo", "* * * * *")
+	assert.Error(t, err)
+	Register("foo", ParseCron)
+	_, err = Parse("foo", "* * * * *")
+	assert.NoError(t, err)
+}
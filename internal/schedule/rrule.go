@@ -0,0 +1,40 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// RRuleSchedule is the RFC 5545 recurrence set, e.g.
+// "DTSTART;TZID=Europe/Vienna:20200101T090000 RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1"
+type RRuleSchedule struct {
+	set *rrule.Set
+}
+
+// ParseRRule parses DTSTART, RRULE, RDATE and EXDATE properties separated by whitespaces or new lines.
+// DTSTART is mandatory, otherwise recurrence would depend on the moment of parsing
+func ParseRRule(expr string) (Schedule, error) {
+	set, err := rrule.StrSliceToRRuleSet(strings.Fields(expr))
+	if err != nil {
+		return nil, err
+	}
+	if set.GetDTStart().IsZero() && (set.GetRRule() == nil || set.GetRRule().OrigOptions.Dtstart.IsZero()) {
+		return nil, errors.New("RRULE schedule must specify DTSTART")
+	}
+	return &RRuleSchedule{set: set}, nil
+}
+
+// IsDue returns true if any occurrence falls into the minute of t
+func (s *RRuleSchedule) IsDue(t time.Time) bool {
+	t = t.Truncate(time.Minute)
+	next := s.set.After(t, true)
+	return !next.IsZero() && next.Before(t.Add(time.Minute))
+}
+
+// Next returns the first occurrence after t
+func (s *RRuleSchedule) Next(t time.Time) time.Time {
+	return s.set.After(t, false)
+}
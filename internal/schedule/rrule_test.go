@@ -0,0 +1,49 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRRule(t *testing.T) {
+	_, err := ParseRRule("DTSTART:20200101T090000Z\nRRULE:FREQ=WEEKLY;INTERVAL=2")
+	assert.NoError(t, err)
+	_, err = ParseRRule("RRULE:FREQ=WEEKLY;INTERVAL=2")
+	assert.EqualError(t, err, "RRULE schedule must specify DTSTART")
+	_, err = ParseRRule("DTSTART:20200101T090000Z RRULE:FREQ=FORTNIGHTLY")
+	assert.Error(t, err)
+	_, err = ParseRRule("")
+	assert.Error(t, err)
+}
+
+func TestRRuleLastBusinessDay(t *testing.T) {
+	s, err := Parse("rrule", "DTSTART:20200101T180000Z RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1")
+	assert.NoError(t, err)
+	// May 31, 2020 is Sunday, so the last business day is Friday May 29
+	assert.Equal(t, time.Date(2020, 5, 29, 18, 0, 0, 0, time.UTC), s.Next(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, s.IsDue(time.Date(2020, 5, 29, 18, 0, 42, 0, time.UTC)))
+	assert.False(t, s.IsDue(time.Date(2020, 5, 29, 18, 1, 0, 0, time.UTC)))
+	assert.False(t, s.IsDue(time.Date(2020, 5, 31, 18, 0, 0, 0, time.UTC)))
+}
+
+func TestRRuleEveryOtherWeek(t *testing.T) {
+	s, err := ParseRRule("DTSTART;TZID=Europe/Vienna:20200106T093000\nRRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3")
+	assert.NoError(t, err)
+	vienna, _ := time.LoadLocation("Europe/Vienna")
+	assert.True(t, s.IsDue(time.Date(2020, 1, 20, 9, 30, 0, 0, vienna)))
+	assert.False(t, s.IsDue(time.Date(2020, 1, 13, 9, 30, 0, 0, vienna)))
+	assert.True(t, s.Next(time.Date(2020, 2, 3, 9, 30, 0, 0, vienna)).IsZero(), "No occurrences after COUNT is exhausted")
+}
+
+func TestNextRuns(t *testing.T) {
+	s, err := ParseRRule("DTSTART:20200106T093000Z RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3")
+	assert.NoError(t, err)
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []time.Time{
+		time.Date(2020, 1, 6, 9, 30, 0, 0, time.UTC),
+		time.Date(2020, 1, 20, 9, 30, 0, 0, time.UTC),
+	}, NextRuns(s, from, 2))
+	assert.Len(t, NextRuns(s, from, 10), 3, "No more runs than occurrences")
+}
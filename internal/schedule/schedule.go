@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Schedule decides when the chain should be executed
+type Schedule interface {
+	// IsDue returns true if the chain should be executed at the minute of t
+	IsDue(t time.Time) bool
+	// Next returns the first time after t when the chain should be executed, zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// Engine parses schedule expression
+type Engine func(expr string) (Schedule, error)
+
+var (
+	engines = map[string]Engine{}
+	mutex   sync.RWMutex
+)
+
+// Register makes schedule engine available by the name
+func Register(name string, engine Engine) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	engines[name] = engine
+}
+
+// Parse parses expression using the engine specified
+func Parse(engine string, expr string) (Schedule, error) {
+	mutex.RLock()
+	e, ok := engines[engine]
+	mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown schedule engine: %s", engine)
+	}
+	return e(expr)
+}
+
+func init() {
+	Register("cron", ParseCron)
+	Register("rrule", ParseRRule)
+}
+
+// NextRuns returns at most count execution times after from
+func NextRuns(s Schedule, from time.Time, count int) []time.Time {
+	runs := make([]time.Time, 0, count)
+	for t := s.Next(from); !t.IsZero() && len(runs) < count; t = s.Next(t) {
+		runs = append(runs, t)
+	}
+	return runs
+}
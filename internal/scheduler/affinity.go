@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// affinityAllows decides if the chain can be executed by this client. connected reports
+// if the client executed the chain previously is still connected
+func affinityAllows(a pgengine.ChainAffinity, connected func(string) bool) bool {
+	if !a.Affinity.Valid || !a.LastClient.Valid || a.LastClient.String == pgengine.ClientName {
+		return true
+	}
+	if connected(a.LastClient.String) {
+		return false
+	}
+	return a.Affinity.String == "PREFER" || a.FailoverDue
+}
+
+// checkChainAffinity returns false if the chain should be left to the client executed it previously.
+// The chain is executed if affinity cannot be checked
+func checkChainAffinity(ctx context.Context, chain Chain) bool {
+	a, err := pgengine.GetChainAffinity(ctx, chain.ChainExecutionConfigID)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot check affinity of the chain configuration: ", err)
+		return true
+	}
+	allowed := affinityAllows(a, func(clientName string) bool {
+		connected, err := pgengine.IsClientConnected(ctx, clientName)
+		if err != nil {
+			pgengine.LogToDB("ERROR", "Cannot check if the client is connected: ", err)
+		}
+		return connected
+	})
+	switch {
+	case !allowed:
+		pgengine.LogToDB("DEBUG", fmt.Sprintf("Chain %s is left to the client %s", chain, a.LastClient.String))
+	case a.Affinity.Valid && a.LastClient.Valid && a.LastClient.String != pgengine.ClientName:
+		pgengine.LogToDB("LOG", fmt.Sprintf("Chain %s is taken over from the client %s", chain, a.LastClient.String))
+	}
+	return allowed
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// tripCircuitBreaker suspends the chain after max_failures consecutive failures, so the permanently failing
+// chain doesn't occupy workers retrying every minute
+func tripCircuitBreaker(ctx context.Context, chain Chain, runStatusID int) {
+	maxFailures, suspended := pgengine.SuspendFailingChain(ctx, chain.ChainExecutionConfigID)
+	if !suspended {
+		return
+	}
+	pgengine.LogToDB("ALERT", fmt.Sprintf("Chain %s failed %d consecutive times and is suspended",
+		chain.ChainName, maxFailures)+runbookHint(chain.RunbookURL))
+	events.Publish(chainEvent(ctx, events.ChainSuspended, chain, runStatusID))
+}
+
+// resumeSuspendedChains enables chains which cooldown passed, the next run is the trial one
+func resumeSuspendedChains(ctx context.Context) {
+	chains, err := pgengine.ResumeSuspendedChains(ctx)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not resume suspended chains: ", err)
+	}
+	for _, c := range chains {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Chain %s is resumed after the failure cooldown", c.ChainName))
+		events.Publish(events.Event{Kind: events.ChainResumed, ChainConfig: c.ChainConfig, ChainName: c.ChainName})
+	}
+}
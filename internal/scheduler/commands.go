@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// ValidateSchedules checks schedules of all chains and logs invalid ones. Returns false if any is invalid
+func ValidateSchedules(ctx context.Context) bool {
+	d, err := pgengine.GetDashboard(ctx, "")
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot validate chain schedules: ", err)
+		return false
+	}
+	var problems []string
+	for _, c := range d.Chains {
+		if _, err := c.ParseSchedule(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%d): %s", c.ChainName, c.ID, err))
+		}
+	}
+	if len(problems) == 0 {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Validated schedules of %d chains", len(d.Chains)))
+		return true
+	}
+	pgengine.LogToDB("ERROR", fmt.Sprintf("%d chains have invalid schedules:\n\t%s",
+		len(problems), strings.Join(problems, "\n\t")))
+	return false
+}
+
+// WriteChainList writes chains as the table with their schedules and next fire times
+func WriteChainList(w io.Writer, chains []pgengine.DashboardChain, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCHAIN\tLIVE\tSCHEDULE\tNEXT RUN")
+	for _, c := range chains {
+		schedule := "-"
+		switch {
+		case c.ScheduleEngine != nil && c.Schedule != nil:
+			schedule = *c.ScheduleEngine + ": " + *c.Schedule
+		case c.RunAt != nil:
+			schedule = *c.RunAt
+		}
+		next := "-"
+		if t := c.Next(now); t != nil {
+			next = t.Format("2006-01-02 15:04 MST")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%t\t%s\t%s\n", c.ID, c.ChainName, c.Live, schedule, next)
+	}
+	return tw.Flush()
+}
+
+// PrintChains writes all chains with their next fire times to w
+func PrintChains(ctx context.Context, w io.Writer) bool {
+	d, err := pgengine.GetDashboard(ctx, "")
+	if err == nil {
+		err = WriteChainList(w, d.Chains, time.Now())
+	}
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot list chains: ", err)
+		return false
+	}
+	return true
+}
+
+// WriteRunResult writes the status of the finished run and outputs of its elements
+func WriteRunResult(w io.Writer, result *RunResult) error {
+	if _, err := fmt.Fprintf(w, "Run %d finished with %s in %.1f s\n", result.RunStatusID, result.Status,
+		result.Duration); err != nil {
+		return err
+	}
+	for _, out := range result.Outputs {
+		if _, err := fmt.Fprintf(w, "%s: return code %d\n", out.TaskName, out.ReturnCode); err != nil {
+			return err
+		}
+		if output := strings.TrimSpace(out.Output); output != "" {
+			if _, err := fmt.Fprintln(w, output); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunChainByName triggers the chain once outside of its schedule, waits for the result and writes it to w.
+// Returns false if the chain cannot be triggered or fails
+func RunChainByName(ctx context.Context, w io.Writer, name string) bool {
+	configs, err := pgengine.ListChainConfigs(ctx, "")
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot find the chain: ", err)
+		return false
+	}
+	for _, c := range configs {
+		if c.ChainName != name {
+			continue
+		}
+		chain, err := GetChain(ctx, c.ID)
+		var result *RunResult
+		if err == nil {
+			result, err = RunChain(ctx, chain)
+		}
+		if err != nil {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot run chain %s: %s", name, err))
+			return false
+		}
+		if err = WriteRunResult(w, result); err != nil {
+			pgengine.LogToDB("ERROR", "Cannot write the run result: ", err)
+		}
+		return result.Success()
+	}
+	pgengine.LogToDB("ERROR", "Chain not found: ", name)
+	return false
+}
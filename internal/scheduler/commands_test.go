@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteChainList(t *testing.T) {
+	cron, runAt, interval, engine := "0 3 * * *", "@reboot", "@every 5 minutes", "INTERVAL"
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	assert.NoError(t, WriteChainList(&b, []pgengine.DashboardChain{
+		{ID: 1, ChainName: "backup", Live: true, RunAt: &cron},
+		{ID: 2, ChainName: "warmup", Live: true, RunAt: &runAt},
+		{ID: 3, ChainName: "poll", Live: false, ScheduleEngine: &engine, Schedule: &interval},
+	}, now))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Regexp(t, `^ID\s+CHAIN\s+LIVE\s+SCHEDULE\s+NEXT RUN$`, lines[0])
+		assert.Regexp(t, `^1\s+backup\s+true\s+0 3 \* \* \*\s+2020-05-02 03:00 UTC$`, lines[1])
+		assert.Regexp(t, `^2\s+warmup\s+true\s+@reboot\s+-$`, lines[2])
+		assert.Regexp(t, `^3\s+poll\s+false\s+INTERVAL: @every 5 minutes\s+-$`, lines[3])
+	}
+}
+
+func TestWriteRunResult(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteRunResult(&b, &RunResult{RunStatusID: 7, Status: "CHAIN_FAILED", Duration: 1.25,
+		Outputs: []TaskOutput{{TaskName: "Dump", Output: "done\n"}, {TaskName: "Upload", ReturnCode: 1}}}))
+	assert.Equal(t, "Run 7 finished with CHAIN_FAILED in 1.2 s\nDump: return code 0\ndone\nUpload: return code 1\n",
+		b.String())
+}
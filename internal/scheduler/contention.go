@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// waitChainInstances waits until less than max_instances of the chain are running and records the time waited,
+// so the contention report can show chains fighting each other. Returns false if the context is cancelled
+func waitChainInstances(ctx context.Context, chain Chain) bool {
+	var started time.Time
+	for !pgengine.CanProceedChainExecution(ctx, chain.ChainExecutionConfigID, chain.MaxInstances) {
+		if started.IsZero() {
+			started = clock.FromContext(ctx).Now()
+		}
+		pgengine.LogToDB("DEBUG", fmt.Sprintf("Cannot proceed with chain %s. Sleeping...", chain))
+		select {
+		case <-clock.FromContext(ctx).After(time.Duration(pgengine.WaitTime) * time.Second):
+		case <-ctx.Done():
+			pgengine.LogToDB("ERROR", "request cancelled\n")
+			return false
+		}
+	}
+	if !started.IsZero() {
+		pgengine.RecordChainWait(ctx, chain.ChainExecutionConfigID, pgengine.WaitMaxInstances, started, clock.FromContext(ctx).Now())
+	}
+	return true
+}
+
+// contentionBarWidth is the width of the bar of the longest total wait
+const contentionBarWidth = 30
+
+// WriteContentionReport writes the report as the table with bars proportional to the total wait of chains
+func WriteContentionReport(w io.Writer, report []pgengine.ChainContention) error {
+	if len(report) == 0 {
+		_, err := fmt.Fprintln(w, "No chains waited during the period")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHAIN\tCONSTRAINT\tWAITS\tTOTAL, s\tMAX, s\t\tCONCURRENT CHAINS")
+	longest := report[0].TotalWait // the report is sorted by total wait
+	for _, c := range report {
+		bar := 1
+		if longest > 0 {
+			bar = int(c.TotalWait/longest*contentionBarWidth + 0.5)
+		}
+		fmt.Fprintf(tw, "%s (%d)\t%s\t%d\t%.1f\t%.1f\t%s\t%s\n", c.ChainName, c.ChainConfig, c.Constraint,
+			c.Waits, c.TotalWait, c.MaxWait, strings.Repeat("#", bar), strings.Join(c.ConcurrentChains, ", "))
+	}
+	return tw.Flush()
+}
+
+// PrintContentionReport writes the report of chain waits during the period, e.g. "7 days", to w
+func PrintContentionReport(ctx context.Context, w io.Writer, period string) bool {
+	report, err := pgengine.GetContentionReport(ctx, period)
+	if err == nil {
+		err = WriteContentionReport(w, report)
+	}
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot build contention report: ", err)
+		return false
+	}
+	return true
+}
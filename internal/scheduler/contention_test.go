@@ -0,0 +1,29 @@
+package scheduler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteContentionReport(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteContentionReport(&b, nil))
+	assert.Equal(t, "No chains waited during the period\n", b.String())
+
+	b.Reset()
+	assert.NoError(t, WriteContentionReport(&b, []pgengine.ChainContention{
+		{ChainConfig: 1, ChainName: "export", Constraint: pgengine.WaitMaxInstances, Waits: 4, TotalWait: 120, MaxWait: 60,
+			ConcurrentChains: []string{"export", "vacuum"}},
+		{ChainConfig: 2, ChainName: "vacuum", Constraint: pgengine.WaitMaxInstances, Waits: 1, TotalWait: 30, MaxWait: 30},
+	}))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Regexp(t, `^CHAIN\s+CONSTRAINT\s+WAITS\s+TOTAL, s\s+MAX, s\s+CONCURRENT CHAINS$`, lines[0])
+		assert.Regexp(t, `^export \(1\)\s+MAX_INSTANCES\s+4\s+120\.0\s+60\.0\s+#{30}\s+export, vacuum$`, lines[1])
+		assert.Regexp(t, `^vacuum \(2\)\s+MAX_INSTANCES\s+1\s+30\.0\s+30\.0\s+#{8}\s*$`, lines[2])
+	}
+}
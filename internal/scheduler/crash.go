@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+//Select idempotent chains with runs of the client FixSchedulerCrash is about to mark DEAD
+const sqlSelectCrashedChains = sqlSelectLiveChains + ` AND idempotent AND chain_execution_config IN (
+	SELECT chain_execution_config FROM timetable.run_status WHERE run_status IN (
+		SELECT start_status
+		FROM timetable.run_status
+		WHERE execution_status IN ('STARTED', 'CHAIN_FAILED', 'CHAIN_DONE', 'DEAD') AND client_name = $1
+		GROUP BY 1
+		HAVING count(*) < 2))`
+
+// selectCrashedChains returns idempotent chains which runs were left unfinished by the crash of the client,
+// e.g. killed by OOM. The chain transaction was rolled back, so such chains are executed again from the start.
+// Must be called before FixSchedulerCrash, the run is not returned once it's marked DEAD
+func selectCrashedChains(ctx context.Context) []Chain {
+	if !pgengine.ResumeCrashed || !pgengine.Enabled(pgengine.FeatureCrashRecovery) {
+		return nil
+	}
+	var crashed []Chain
+	err := pgengine.ConfigDb.SelectContext(ctx, &crashed, pgengine.SchemaSQL(sqlSelectCrashedChains), pgengine.ClientName, pgengine.ClientGroup)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not query crashed chains: ", err)
+		return nil
+	}
+	return crashed
+}
@@ -0,0 +1,14 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectCrashedChainsDisabled(t *testing.T) {
+	pgengine.ResumeCrashed = false
+	assert.Nil(t, selectCrashedChains(context.Background()), "Crashed runs should be executed again only on demand")
+}
@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// checkLostClients alerts clients which disappeared without closing their session, e.g. crashed hosts, and
+// repairs their unfinished runs, so they don't count against max_instances forever
+func checkLostClients(ctx context.Context) {
+	lost, err := pgengine.MarkLostClients(ctx)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not check lost clients: ", err)
+	}
+	for _, c := range lost {
+		pgengine.LogToDB("ALERT", lostClientMessage(c))
+		events.Publish(events.Event{Kind: events.ClientDead, ClientName: c.ClientName})
+	}
+}
+
+func lostClientMessage(c pgengine.LostClient) string {
+	return fmt.Sprintf("Client %s on %s (pid %d) has not checked in since %s, %d unfinished runs are marked DEAD",
+		c.ClientName, c.Hostname, c.PID, c.Heartbeat.Format(time.RFC3339), c.DeadRuns)
+}
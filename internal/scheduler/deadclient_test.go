@@ -0,0 +1,16 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLostClientMessage(t *testing.T) {
+	c := pgengine.LostClient{ClientName: "worker02", Hostname: "host2", PID: 42,
+		Heartbeat: time.Date(2021, 1, 1, 3, 0, 0, 0, time.UTC), DeadRuns: 2}
+	assert.Equal(t, "Client worker02 on host2 (pid 42) has not checked in since 2021-01-01T03:00:00Z, "+
+		"2 unfinished runs are marked DEAD", lostClientMessage(c))
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// DevRun executes chains from the definition file locally without configuration database. There is no store
+// standing in for it, so SQL tasks cannot be executed and chains containing them fail, runs are not recorded.
+// Returns false if any chain failed
+func DevRun(ctx context.Context, filename string) bool {
+	chains, err := pgengine.ReadChainDefinitions(filename)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read chain definitions: ", err)
+		return false
+	}
+	success := true
+	for _, chain := range chains {
+		pgengine.LogToDB("LOG", "Dev run of the chain: ", chain.Name)
+		if !devRunChain(ctx, chain) {
+			pgengine.LogToDB("ERROR", "Dev run of the chain failed: ", chain.Name)
+			success = false
+			continue
+		}
+		pgengine.LogToDB("LOG", "Dev run of the chain succeeded: ", chain.Name)
+	}
+	return success
+}
+
+func devRunChain(ctx context.Context, chain pgengine.ChainDefinition) bool {
+	for _, task := range chain.Tasks {
+		if task.Kind == "SQL" {
+			pgengine.LogToDB("ERROR", "SQL tasks require PostgreSQL connection and cannot be executed in dev run: ", task.Name)
+			return false
+		}
+	}
+	// there is no chain transaction in dev run, but on-commit tasks are still executed last
+	ordered := make([]pgengine.TaskDefinition, 0, len(chain.Tasks))
+	for _, onCommit := range []bool{false, true} {
+		for _, task := range chain.Tasks {
+			if task.OnCommit == onCommit {
+				ordered = append(ordered, task)
+			}
+		}
+	}
+	run := &pgengine.ChainRun{ChainName: chain.Name, StartedAt: clock.FromContext(ctx).Now()}
+	for _, task := range ordered {
+		chainElemExec := &pgengine.ChainElementExecution{
+			TaskName:    task.Name,
+			Script:      task.Script,
+			Kind:        task.Kind,
+			IgnoreError: task.IgnoreError,
+			OnCommit:    task.OnCommit,
+			WorkDir:     sql.NullString{String: task.WorkDir, Valid: task.WorkDir != ""},
+			Umask:       sql.NullString{String: task.Umask, Valid: task.Umask != ""},
+			Stdin:       sql.NullString{String: task.Stdin, Valid: task.Stdin != ""},
+			Run:         run,
+		}
+		retCode, out, err := executeTask(ctx, nil, chainElemExec, task.ParamValues())
+		if len(out) > 0 {
+			pgengine.LogToDB("LOG", "Output of the task ", task.Name, ": ", strings.TrimSpace(string(out)))
+		}
+		if err != nil {
+			run.LastError = fmt.Sprintf("%s: %s", task.Name, err)
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Task execution failed: %s; Return code: %d; Error: %s", chainElemExec, retCode, err))
+			if !task.IgnoreError {
+				return false
+			}
+		}
+	}
+	return true
+}
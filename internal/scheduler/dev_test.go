@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevRun(t *testing.T) {
+	cmd = testCommander{}
+	ctx := context.Background()
+	f, err := ioutil.TempFile("", "chains*.json")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`[
+	{"name": "ok", "tasks": [
+		{"name": "NoOp", "kind": "BUILTIN", "parameters": ["foo"]},
+		{"name": "ping", "kind": "SHELL", "script": "ping", "parameters": [["localhost"]]},
+		{"name": "pong", "kind": "SHELL", "script": "pong", "ignore_error": true}
+	]},
+	{"name": "failed", "tasks": [
+		{"name": "pong", "kind": "SHELL", "script": "pong"}
+	]},
+	{"name": "sql", "tasks": [
+		{"name": "ping", "kind": "SHELL", "script": "ping", "parameters": [["localhost"]]},
+		{"name": "sql", "script": "SELECT 1", "ignore_error": true}
+	]}
+]`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	assert.False(t, DevRun(ctx, "non-existent.json"), "Dev run with non-existent file should fail")
+	assert.False(t, DevRun(ctx, f.Name()), "Dev run with failed chain should fail")
+	chains, err := pgengine.ReadChainDefinitions(f.Name())
+	assert.NoError(t, err)
+	assert.True(t, devRunChain(ctx, chains[0]), "Chain with ignored errors should succeed")
+	assert.False(t, devRunChain(ctx, chains[1]), "Chain with unknown command should fail")
+	assert.False(t, devRunChain(ctx, chains[2]), "Chain with SQL tasks should fail")
+}
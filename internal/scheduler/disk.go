@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import "syscall"
+
+// diskUsage returns total and free bytes of the file system containing the path
+func diskUsage(path string) (total int64, free int64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
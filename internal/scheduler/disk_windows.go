@@ -0,0 +1,8 @@
+package scheduler
+
+import "errors"
+
+// diskUsage is not implemented on Windows
+func diskUsage(path string) (total int64, free int64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on Windows")
+}
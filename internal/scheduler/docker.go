@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// dockerBinary is the Docker CLI used to run containers
+var dockerBinary = "docker"
+
+// dockerKillTimeout limits the time spent on killing the container after the task timeout
+const dockerKillTimeout = 30 * time.Second
+
+type dockerOpts struct {
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`
+	Options []string          `json:"options"`
+	Timeout int               `json:"timeout"` // in seconds, 0 means no timeout
+	Scratch string            `json:"scratch"` // container path of the scratch directory
+	// scratchDir is the host directory mounted as scratch
+	scratchDir string
+}
+
+// dockerEnv returns environment of the container with the chain context variables, parameters may override them
+func dockerEnv(chainElemExec *pgengine.ChainElementExecution, env map[string]string) map[string]string {
+	res := map[string]string{
+		"PGTT_CLIENTNAME":  pgengine.ClientName,
+		"PGTT_CHAINCONFIG": strconv.Itoa(chainElemExec.ChainConfig),
+		"PGTT_CHAINID":     strconv.Itoa(chainElemExec.ChainID),
+		"PGTT_TASKNAME":    chainElemExec.TaskName,
+	}
+	for k, v := range env {
+		res[k] = v
+	}
+	return res
+}
+
+// dockerRunArgs returns arguments of "docker run" for the container with the name
+func dockerRunArgs(image string, name string, opts dockerOpts, stdin bool) []string {
+	args := []string{"run", "--rm", "--name", name, "--label", "pg_timetable.client=" + pgengine.ClientName}
+	if stdin {
+		args = append(args, "--interactive")
+	}
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--env", k+"="+opts.Env[k])
+	}
+	if opts.Scratch != "" && opts.scratchDir != "" {
+		args = append(args, "--volume", opts.scratchDir+":"+opts.Scratch)
+	}
+	args = append(args, opts.Options...)
+	args = append(args, image)
+	return append(args, opts.Args...)
+}
+
+// executeDocker runs the container of the image specified in the script once for every parameter value
+// containing JSON object with container "args", "env" variables, additional docker run "options", "timeout" and
+// "scratch" path where the empty temporary directory is mounted. The chain context is passed in PGTT_* variables.
+// Container output is returned as the task output, the container is killed if the timeout is over
+func executeDocker(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (code int, out []byte, err error) {
+	image := strings.TrimSpace(chainElemExec.Script)
+	if image == "" {
+		return -1, []byte{}, errors.New("Docker image cannot be empty")
+	}
+	cmdOpts, err := newCommandOptions(chainElemExec)
+	if err != nil {
+		return -1, []byte{}, err
+	}
+	if len(paramValues) == 0 {
+		paramValues = []string{""}
+	}
+	for i, val := range paramValues {
+		var opts dockerOpts
+		if val > "" {
+			if err := json.Unmarshal([]byte(val), &opts); err != nil {
+				return -1, []byte{}, err
+			}
+		}
+		opts.Env = dockerEnv(chainElemExec, opts.Env)
+		name := fmt.Sprintf("pg_timetable_%d_%d_%d_%d", chainElemExec.ChainConfig, chainElemExec.ChainID, clock.FromContext(ctx).Now().UnixNano(), i)
+		if code, out, err = runScratchContainer(ctx, image, name, opts, cmdOpts); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// runScratchContainer creates the scratch directory for the container if needed and removes it afterwards
+func runScratchContainer(ctx context.Context, image string, name string, opts dockerOpts, cmdOpts commandOptions) (int, []byte, error) {
+	if opts.Scratch == "" {
+		return runContainer(ctx, image, name, opts, cmdOpts)
+	}
+	dir, err := ioutil.TempDir("", name+"_")
+	if err != nil {
+		return -1, []byte{}, err
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot remove scratch directory %s: %s", dir, err))
+		}
+	}()
+	// containers may run as any user
+	if err := os.Chmod(dir, 0777); err != nil { // #nosec
+		return -1, []byte{}, err
+	}
+	opts.scratchDir = dir
+	return runContainer(ctx, image, name, opts, cmdOpts)
+}
+
+func runContainer(ctx context.Context, image string, name string, opts dockerOpts, cmdOpts commandOptions) (int, []byte, error) {
+	runCtx, cancel := ctx, func() {}
+	if opts.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Second)
+	}
+	defer cancel()
+	argv := append([]string{dockerBinary}, dockerRunArgs(image, name, opts, cmdOpts.Stdin != "")...)
+	code, out, err := runCommand(runCtx, argv, [][]string{{}}, cmdOpts)
+	if runCtx.Err() == nil {
+		return code, out, err
+	}
+	// killing the docker client process leaves the container running
+	killCtx, killCancel := context.WithTimeout(context.Background(), dockerKillTimeout)
+	defer killCancel()
+	if _, _, killErr := runCommand(killCtx, []string{dockerBinary, "kill", name}, [][]string{{}}, commandOptions{}); killErr != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot kill container %s: %s", name, killErr))
+	}
+	if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return -1, out, fmt.Errorf("Container %s killed after timeout of %d seconds", name, opts.Timeout)
+	}
+	return -1, out, runCtx.Err()
+}
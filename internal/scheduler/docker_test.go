@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+// dockerCommander records docker commands, "sleep" containers run until killed
+type dockerCommander struct {
+	calls *[]string
+}
+
+func (c dockerCommander) CombinedOutput(ctx context.Context, opts commandOptions, command string, args ...string) ([]byte, error) {
+	*c.calls = append(*c.calls, command+" "+strings.Join(args, " "))
+	if args[len(args)-1] == "sleep" {
+		<-ctx.Done()
+		return []byte("interrupted"), ctx.Err()
+	}
+	return []byte("done"), nil
+}
+
+func TestDocker(t *testing.T) {
+	var calls []string
+	cmd = dockerCommander{&calls}
+	defer func() { cmd = testCommander{} }()
+	pgengine.ClientName = "worker01"
+	ctx := context.Background()
+	elem := &pgengine.ChainElementExecution{ChainConfig: 1, ChainID: 2, TaskName: "etl", Script: "alpine:3"}
+
+	_, out, err := executeDocker(ctx, elem, []string{`{"args": ["echo", "hi"], "env": {"B": "2", "A": "1"}, "options": ["--network", "none"]}`})
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(out))
+	if assert.Len(t, calls, 1) {
+		assert.Regexp(t, `^docker run --rm --name pg_timetable_1_2_\d+_0 --label pg_timetable.client=worker01 `+
+			`--env A=1 --env B=2 --env PGTT_CHAINCONFIG=1 --env PGTT_CHAINID=2 --env PGTT_CLIENTNAME=worker01 --env PGTT_TASKNAME=etl `+
+			`--network none alpine:3 echo hi$`, calls[0])
+	}
+
+	calls = nil
+	_, _, err = executeDocker(ctx, elem, []string{`{"env": {"PGTT_TASKNAME": "custom"}, "scratch": "/scratch"}`})
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Contains(t, calls[0], " --env PGTT_TASKNAME=custom ", "Parameters should override context variables")
+		args := strings.Fields(calls[0])
+		for i, arg := range args {
+			if arg == "--volume" {
+				volume := strings.Split(args[i+1], ":")
+				assert.Equal(t, "/scratch", volume[1])
+				_, err := os.Stat(volume[0])
+				assert.True(t, os.IsNotExist(err), "Scratch directory should be removed")
+			}
+		}
+		assert.Contains(t, calls[0], " --volume ")
+	}
+
+	calls = nil
+	_, _, err = executeDocker(ctx, elem, []string{`{"args": ["sleep"], "timeout": 1}`})
+	assert.Regexp(t, `^Container pg_timetable_1_2_\d+_0 killed after timeout of 1 seconds$`, err)
+	if assert.Len(t, calls, 2) {
+		name := strings.Fields(calls[0])[4]
+		assert.Equal(t, "docker kill "+name, calls[1], "Container should be killed after timeout")
+	}
+
+	calls = nil
+	elem.Stdin.String, elem.Stdin.Valid = "input", true
+	_, _, err = executeDocker(ctx, elem, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Contains(t, calls[0], " --interactive --env ")
+	}
+
+	_, _, err = executeDocker(ctx, &pgengine.ChainElementExecution{Script: " "}, nil)
+	assert.EqualError(t, err, "Docker image cannot be empty")
+	_, _, err = executeDocker(ctx, elem, []string{`["echo"]`})
+	assert.IsType(t, (*json.UnmarshalTypeError)(nil), err, "Parameters should be JSON object")
+}
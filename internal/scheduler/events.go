@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// chainEvent returns the event of the chain run
+func chainEvent(ctx context.Context, kind events.Kind, chain Chain, runStatusID int) events.Event {
+	return events.Event{
+		Kind:        kind,
+		Time:        clock.FromContext(ctx).Now(),
+		ClientName:  pgengine.ClientName,
+		ChainConfig: chain.ChainExecutionConfigID,
+		ChainID:     chain.ChainID,
+		ChainName:   chain.ChainName,
+		RunStatusID: runStatusID,
+		Description: chain.Description,
+		RunbookURL:  chain.RunbookURL}
+}
+
+// publishChainFinished publishes CHAIN_DONE or CHAIN_FAILED event depending on the run result
+func publishChainFinished(ctx context.Context, chain Chain, result *RunResult, run *pgengine.ChainRun) {
+	e := chainEvent(ctx, events.ChainFailed, chain, result.RunStatusID)
+	if result.Success() {
+		e.Kind = events.ChainDone
+	} else {
+		e.Error = run.LastError
+	}
+	e.Duration = result.Duration
+	events.Publish(e)
+}
+
+// publishElementFinished publishes ELEMENT_FINISHED event for every executed element including compensations
+func publishElementFinished(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, retCode int, err error) {
+	e := events.Event{
+		Kind:        events.ElementFinished,
+		Time:        clock.FromContext(ctx).Now(),
+		ClientName:  pgengine.ClientName,
+		ChainConfig: chainElemExec.ChainConfig,
+		ChainID:     chainElemExec.ChainID,
+		TaskName:    chainElemExec.TaskName,
+		TaskKind:    chainElemExec.Kind,
+		Script:      chainElemExec.Script,
+		ReturnCode:  retCode,
+		Duration:    float64(chainElemExec.Duration) / 1e6,
+		Description: chainElemExec.Description.String,
+		RunbookURL:  taskRunbookURL(chainElemExec)}
+	if chainElemExec.Run != nil {
+		e.ChainName = chainElemExec.Run.ChainName
+		e.RunStatusID = chainElemExec.Run.RunStatusID
+	}
+	if err != nil {
+		e.Error = err.Error()
+		if retCode == 0 {
+			e.ReturnCode = -1
+		}
+	}
+	events.Publish(e)
+}
+
+// taskRunbookURL returns the runbook of the task, or the runbook of the chain if the task has none
+func taskRunbookURL(chainElemExec *pgengine.ChainElementExecution) string {
+	if chainElemExec.RunbookURL.String == "" && chainElemExec.Run != nil {
+		return chainElemExec.Run.RunbookURL
+	}
+	return chainElemExec.RunbookURL.String
+}
+
+// runbookHint returns the suffix pointing to the runbook for failure messages
+func runbookHint(runbookURL string) string {
+	if runbookURL == "" {
+		return ""
+	}
+	return "; Runbook: " + runbookURL
+}
@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// chainExclusions contains chains listed in pgengine.ExclusionFile. The file is read again if modified,
+// so chains can be excluded on the host without restart
+type chainExclusions struct {
+	sync.Mutex
+	modTime time.Time
+	ids     map[int]bool
+	names   map[string]bool
+}
+
+var exclusions chainExclusions
+
+// parseExclusions reads chain names or chain_execution_config IDs one per line, lines starting with # are comments
+func parseExclusions(r io.Reader) (ids map[int]bool, names map[string]bool, err error) {
+	ids, names = make(map[int]bool), make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if id, err := strconv.Atoi(line); err == nil {
+			ids[id] = true
+		} else {
+			names[line] = true
+		}
+	}
+	return ids, names, scanner.Err()
+}
+
+// reload reads the file if it was modified. Missing file means no exclusions,
+// exclusions are kept if the file cannot be read
+func (e *chainExclusions) reload(filename string) {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		e.ids, e.names, e.modTime = nil, nil, time.Time{}
+		return
+	}
+	if err == nil && info.ModTime().Equal(e.modTime) {
+		return
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read exclusion file: ", err)
+		return
+	}
+	defer f.Close()
+	ids, names, err := parseExclusions(f)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read exclusion file: ", err)
+		return
+	}
+	e.ids, e.names, e.modTime = ids, names, info.ModTime()
+	pgengine.LogToDB("LOG", fmt.Sprintf("%d chains are excluded by %s", len(ids)+len(names), filename))
+}
+
+// excluded returns true if the chain is listed in the exclusion file
+func (e *chainExclusions) excluded(filename string, chain Chain) bool {
+	e.Lock()
+	defer e.Unlock()
+	e.reload(filename)
+	return e.ids[chain.ChainExecutionConfigID] || e.names[chain.ChainName]
+}
+
+// isChainExcluded returns true if the chain must not be executed by this client
+func isChainExcluded(chain Chain) bool {
+	if pgengine.ExclusionFile == "" {
+		return false
+	}
+	if exclusions.excluded(pgengine.ExclusionFile, chain) {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Chain %s is excluded on this client", chain))
+		return true
+	}
+	return false
+}
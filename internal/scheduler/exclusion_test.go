@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExclusions(t *testing.T) {
+	ids, names, err := parseExclusions(strings.NewReader("# comment\n\n 42 \nnightly vacuum\n7\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]bool{42: true, 7: true}, ids)
+	assert.Equal(t, map[string]bool{"nightly vacuum": true}, names)
+}
+
+func TestIsChainExcluded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exclusion")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "exclude")
+	defer func() { pgengine.ExclusionFile = "" }()
+
+	chain := Chain{ChainExecutionConfigID: 42, ChainName: "nightly vacuum"}
+	assert.False(t, isChainExcluded(chain), "no exclusion file specified")
+
+	pgengine.ExclusionFile = filename
+	assert.False(t, isChainExcluded(chain), "missing exclusion file means no exclusions")
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("42\n"), 0644))
+	assert.True(t, isChainExcluded(chain), "excluded by ID")
+	assert.False(t, isChainExcluded(Chain{ChainExecutionConfigID: 1, ChainName: "other"}))
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("nightly vacuum\n"), 0644))
+	assert.NoError(t, os.Chtimes(filename, time.Now(), time.Now().Add(time.Minute)))
+	assert.True(t, isChainExcluded(Chain{ChainExecutionConfigID: 1, ChainName: "nightly vacuum"}), "excluded by name after reload")
+	assert.False(t, isChainExcluded(Chain{ChainExecutionConfigID: 42, ChainName: "other"}), "ID removed after reload")
+
+	assert.NoError(t, os.Remove(filename))
+	assert.False(t, isChainExcluded(chain), "exclusions removed with the file")
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/jmoiron/sqlx"
+)
+
+// exclusiveLock pauses other chains of the client while the chain with exclusive_execution is running.
+// Chains queued after the exclusive chain wait until it's finished, so it cannot be starved
+var exclusiveLock sync.RWMutex
+
+// lockExclusiveExecution waits until the chain may start on this client: the exclusive chain waits for
+// running chains and runs alone, other chains wait for the running exclusive chain. Returns the unlock function
+func lockExclusiveExecution(chain Chain) func() {
+	if chain.ExclusiveExecution {
+		pgengine.LogToDB("DEBUG", fmt.Sprintf("Waiting for running chains to execute exclusive chain %s", chain))
+		exclusiveLock.Lock()
+		return exclusiveLock.Unlock
+	}
+	exclusiveLock.RLock()
+	return exclusiveLock.RUnlock
+}
+
+// lockChainTransaction obtains locks the chain transaction holds while the chain is running: the exclusive
+// execution lock in the cluster exclusive mode and locks of chain mutexes. Returns false if locks cannot be
+// obtained, e.g. the context is cancelled
+func lockChainTransaction(ctx context.Context, tx *sqlx.Tx, chain Chain) bool {
+	return lockClusterExclusive(ctx, tx, chain) && lockChainMutexes(ctx, tx, chain)
+}
+
+// lockClusterExclusive extends exclusive_execution to chains of all clients in the cluster exclusive mode
+func lockClusterExclusive(ctx context.Context, tx *sqlx.Tx, chain Chain) bool {
+	if !pgengine.ClusterExclusive {
+		return true
+	}
+	started := clock.FromContext(ctx).Now()
+	waited, err := pgengine.LockExclusiveExecution(ctx, tx, chain.ExclusiveExecution)
+	if err != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot obtain the exclusive execution lock for chain %s: %v", chain, err))
+		return false
+	}
+	if waited {
+		pgengine.RecordChainWait(ctx, chain.ChainExecutionConfigID, pgengine.WaitExclusive, started, clock.FromContext(ctx).Now())
+	}
+	return true
+}
+
+// lockChainMutexes serializes chains sharing named mutexes, e.g. ETL chains loading the same tables
+func lockChainMutexes(ctx context.Context, tx *sqlx.Tx, chain Chain) bool {
+	started := clock.FromContext(ctx).Now()
+	waited, err := pgengine.LockChainMutexes(ctx, tx, chain.ChainExecutionConfigID)
+	if err != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot obtain mutexes of chain %s: %v", chain, err))
+		return false
+	}
+	if waited {
+		pgengine.RecordChainWait(ctx, chain.ChainExecutionConfigID, pgengine.WaitMutex, started, clock.FromContext(ctx).Now())
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockExclusiveExecution(t *testing.T) {
+	unlock := lockExclusiveExecution(Chain{ChainExecutionConfigID: 1})
+	unlockOther := lockExclusiveExecution(Chain{ChainExecutionConfigID: 2})
+
+	exclusiveStarted := make(chan struct{})
+	go func() {
+		defer lockExclusiveExecution(Chain{ChainExecutionConfigID: 3, ExclusiveExecution: true})()
+		close(exclusiveStarted)
+	}()
+	unlock()
+	select {
+	case <-exclusiveStarted:
+		t.Fatal("Exclusive chain should wait for all running chains")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlockOther()
+	select {
+	case <-exclusiveStarted:
+	case <-time.After(time.Second):
+		t.Fatal("Exclusive chain should start once running chains finished")
+	}
+	assert.NotPanics(t, func() { lockExclusiveExecution(Chain{ChainExecutionConfigID: 4})() })
+}
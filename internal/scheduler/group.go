@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// groupOwner returns the member the chain is assigned to by rendezvous hashing. Every member computes the same
+// owner from the same member list, and only chains of the member leaving the group are reassigned
+func groupOwner(members []string, chainConfigID int) (owner string) {
+	var max uint64
+	for _, m := range members {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s/%d", m, chainConfigID)
+		if sum := mix64(h.Sum64()); owner == "" || sum > max {
+			owner, max = m, sum
+		}
+	}
+	return
+}
+
+// mix64 is the 64-bit finalizer of MurmurHash3, FNV alone spreads names differing in the last bytes poorly
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	return x ^ x>>33
+}
+
+// claimChains returns chains this client must execute. Runs of chains targeting the client group are assigned
+// to members by groupOwner, so members share the load, and claimed, so the run due at the moment is executed
+// once even while members join or leave the group
+func claimChains(ctx context.Context, headChains []Chain, due time.Time) []Chain {
+	var members []string
+	claimed := make([]Chain, 0, len(headChains))
+	for _, chain := range headChains {
+		if chain.ClientGroup != "" {
+			if members == nil {
+				members = pgengine.GetGroupMembers(ctx)
+			}
+			if groupOwner(members, chain.ChainExecutionConfigID) != pgengine.ClientName ||
+				!pgengine.ClaimChainRun(ctx, chain.ChainExecutionConfigID, due) {
+				continue
+			}
+		}
+		claimed = append(claimed, chain)
+	}
+	return claimed
+}
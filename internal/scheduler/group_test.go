@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupOwner(t *testing.T) {
+	assert.Empty(t, groupOwner(nil, 1))
+	assert.Equal(t, "a", groupOwner([]string{"a"}, 1))
+
+	members := []string{"a", "b", "c"}
+	owned := map[string]int{}
+	for id := 1; id <= 300; id++ {
+		owner := groupOwner(members, id)
+		assert.Equal(t, owner, groupOwner([]string{"c", "a", "b"}, id), "Owner should not depend on the member order")
+		owned[owner]++
+		if owner != "c" {
+			assert.Equal(t, owner, groupOwner([]string{"a", "b"}, id), "Only chains of the leaving member should move")
+		}
+	}
+	for _, m := range members {
+		assert.True(t, owned[m] > 50, "Chains should be spread between members: %v", owned)
+	}
+}
+
+func TestClaimChainsWithoutGroup(t *testing.T) {
+	chains := []Chain{{ChainExecutionConfigID: 1}, {ChainExecutionConfigID: 2}}
+	assert.Equal(t, chains, claimChains(context.Background(), chains, time.Now()), "Chains without group need no claim")
+	assert.Empty(t, claimChains(context.Background(), nil, time.Now()))
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// lockRetryInterval is the period the client name lock is tried, standbys poll it every heartbeat in HA mode
+func lockRetryInterval() time.Duration {
+	if pgengine.HAMode {
+		return pgengine.HAHeartbeat
+	}
+	return time.Duration(refetchTimeout) * time.Second
+}
+
+var leaderHeartbeatOnce sync.Once
+
+// startLeaderHeartbeat renews the lease of the leader every heartbeat in HA mode, since the main loop renews it
+// once a minute only. Standbys terminate the session of the leader not renewing the lease and take over
+func startLeaderHeartbeat(ctx context.Context) {
+	if !pgengine.HAMode {
+		return
+	}
+	leaderHeartbeatOnce.Do(func() {
+		go func() {
+			for {
+				select {
+				case <-clock.FromContext(ctx).After(pgengine.HAHeartbeat):
+				case <-ctx.Done():
+					return
+				}
+				if atomic.LoadInt32(&lockHeld) == 1 && atomic.LoadInt32(&reconnecting) == 0 && !pgengine.RenewClientLock(ctx) {
+					pgengine.LogToDB("ERROR", "The leader lost the lease of the client name")
+				}
+			}
+		}()
+	})
+}
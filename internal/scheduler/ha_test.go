@@ -0,0 +1,16 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockRetryInterval(t *testing.T) {
+	assert.Equal(t, time.Duration(refetchTimeout)*time.Second, lockRetryInterval())
+	pgengine.HAMode = true
+	defer func() { pgengine.HAMode = false }()
+	assert.Equal(t, pgengine.HAHeartbeat, lockRetryInterval(), "Standby should poll the lock every heartbeat")
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// livenessTimeout is the time the main loop may not iterate before the scheduler is considered wedged
+const livenessTimeout = 5 * defaultRefetchTimeout * time.Second
+
+// main loop state reported by probes, updated atomically
+var (
+	lastLoop     int64 // unix nanoseconds of the last main loop iteration
+	lockHeld     int32
+	reconnecting int32
+)
+
+// Health describes the scheduler state reported by liveness and readiness probes
+type Health struct {
+	LastLoop     time.Time `json:"last_loop"` // zero until the main loop is started
+	LockHeld     bool      `json:"lock_held"`
+	Reconnecting bool      `json:"reconnecting"`
+	Standby      bool      `json:"standby"`
+}
+
+// GetHealth returns the current state of the main loop
+func GetHealth() Health {
+	h := Health{
+		LockHeld:     atomic.LoadInt32(&lockHeld) == 1,
+		Reconnecting: atomic.LoadInt32(&reconnecting) == 1,
+		Standby:      pgengine.InRecovery()}
+	if ns := atomic.LoadInt64(&lastLoop); ns > 0 {
+		h.LastLoop = time.Unix(0, ns)
+	}
+	return h
+}
+
+// Live returns false if the started main loop did not iterate for livenessTimeout. Waiting for the lost
+// connection is not a failure, since the restart would not help
+func (h Health) Live(now time.Time) bool {
+	return h.LastLoop.IsZero() || h.Reconnecting || now.Sub(h.LastLoop) < livenessTimeout
+}
+
+// Ready returns true if the main loop is running with the client name lock held against the primary server
+func (h Health) Ready() bool {
+	return !h.LastLoop.IsZero() && h.LockHeld && !h.Reconnecting && !h.Standby
+}
+
+func markLoop(ctx context.Context) {
+	atomic.StoreInt64(&lastLoop, clock.FromContext(ctx).Now().UnixNano())
+}
+
+func setFlag(flag *int32, value bool) {
+	var v int32
+	if value {
+		v = 1
+	}
+	atomic.StoreInt32(flag, v)
+}
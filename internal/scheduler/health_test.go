@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Now()
+	assert.True(t, Health{}.Live(now), "Should be live until the main loop is started")
+	assert.False(t, Health{}.Ready(), "Should not be ready until the main loop is started")
+
+	h := Health{LastLoop: now.Add(-time.Minute), LockHeld: true}
+	assert.True(t, h.Live(now))
+	assert.True(t, h.Ready())
+	h.Standby = true
+	assert.False(t, h.Ready(), "Should not be ready on the standby server")
+
+	h = Health{LastLoop: now.Add(-livenessTimeout), LockHeld: true}
+	assert.False(t, h.Live(now), "Should not be live if the main loop is wedged")
+	h.Reconnecting = true
+	assert.True(t, h.Live(now), "Should be live while waiting for the database")
+	assert.False(t, h.Ready())
+
+	markLoop(context.Background())
+	setFlag(&lockHeld, true)
+	defer setFlag(&lockHeld, false)
+	assert.True(t, GetHealth().Ready())
+}
@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// heartbeatClient has the short timeout, so the unavailable monitor doesn't delay chains much
+var heartbeatClient = &http.Client{Timeout: 10 * time.Second}
+
+// chainHeartbeat returns the heartbeat URL of the chain, empty if the chain has none or it cannot be read
+func chainHeartbeat(ctx context.Context, chainConfigID int) string {
+	url, err := pgengine.GetChainHeartbeat(ctx, chainConfigID)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot get heartbeat URL of the chain configuration: ", err)
+	}
+	return url
+}
+
+// heartbeatSuffix returns the suffix of the heartbeat URL reporting the run result, healthchecks.io style
+func heartbeatSuffix(result *RunResult) string {
+	if result.Success() {
+		return ""
+	}
+	return "/fail"
+}
+
+// pingHeartbeat sends the request to the heartbeat URL with the suffix appended. Failures are only logged,
+// since the monitor detects missing pings anyway
+func pingHeartbeat(ctx context.Context, url string, suffix string) {
+	if url == "" {
+		return
+	}
+	url = strings.TrimRight(url, "/") + suffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = heartbeatClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= http.StatusBadRequest {
+				err = fmt.Errorf("Unexpected HTTP status: %s", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot ping heartbeat URL %s: %v", url, err))
+	}
+}
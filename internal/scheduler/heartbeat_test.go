@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingHeartbeat(t *testing.T) {
+	var pings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings = append(pings, r.URL.Path)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	pingHeartbeat(ctx, "", "/start")
+	assert.Empty(t, pings, "Chains without heartbeat URL should not be pinged")
+	pingHeartbeat(ctx, ts.URL+"/ping/uuid/", "/start")
+	pingHeartbeat(ctx, ts.URL+"/ping/uuid", heartbeatSuffix(&RunResult{Status: "CHAIN_DONE"}))
+	pingHeartbeat(ctx, ts.URL+"/ping/uuid", heartbeatSuffix(&RunResult{Status: "CHAIN_FAILED"}))
+	assert.Equal(t, []string{"/ping/uuid/start", "/ping/uuid", "/ping/uuid/fail"}, pings)
+	assert.NotPanics(t, func() { pingHeartbeat(ctx, ts.URL+"/down", "") }, "Monitor failures should only be logged")
+}
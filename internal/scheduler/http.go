@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// maximum size of the response body stored as task output
+const maxHTTPResponseSize = 64 * 1024
+
+type httpRequestOpts struct {
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	Body           string            `json:"body"`
+	Timeout        int               `json:"timeout"`
+	ExpectedStatus []int             `json:"expected_status"`
+}
+
+var httpClient = &http.Client{}
+
+// executeHTTPRequest performs HTTP request to the url for every parameter value.
+// Returns the last response status code, body and error if status code is not expected
+func executeHTTPRequest(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (code int, out []byte, err error) {
+	url := strings.TrimSpace(chainElemExec.Script)
+	if url == "" {
+		return -1, []byte{}, errors.New("URL cannot be empty")
+	}
+	if len(paramValues) == 0 { //mimic empty param
+		paramValues = []string{""}
+	}
+	for _, val := range paramValues {
+		opts := httpRequestOpts{Method: http.MethodGet, Timeout: 30, ExpectedStatus: []int{http.StatusOK}}
+		if val > "" {
+			if err := json.Unmarshal([]byte(val), &opts); err != nil {
+				return -1, []byte{}, err
+			}
+		}
+		if code, out, err = doHTTPRequest(ctx, url, opts, chainElemExec); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func doHTTPRequest(ctx context.Context, url string, opts httpRequestOpts, chainElemExec *pgengine.ChainElementExecution) (int, []byte, error) {
+	var body bytes.Buffer
+	tmpl, err := template.New("body").Parse(opts.Body)
+	if err != nil {
+		return -1, []byte{}, err
+	}
+	if err = tmpl.Execute(&body, chainElemExec); err != nil {
+		return -1, []byte{}, err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, strings.ToUpper(opts.Method), url, &body)
+	if err != nil {
+		return -1, []byte{}, err
+	}
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	pgengine.LogToDB("DEBUG", fmt.Sprintf("Performing HTTP request: %s %s", req.Method, url))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return -1, []byte{}, err
+	}
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	if err != nil {
+		return resp.StatusCode, out, err
+	}
+	for _, status := range opts.ExpectedStatus {
+		if resp.StatusCode == status {
+			return resp.StatusCode, out, nil
+		}
+	}
+	return resp.StatusCode, out, fmt.Errorf("Unexpected HTTP status: %s", resp.Status)
+}
@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	elem := &pgengine.ChainElementExecution{TaskName: "webhook", Script: ts.URL}
+
+	code, _, err := executeHTTPRequest(ctx, &pgengine.ChainElementExecution{}, nil)
+	assert.EqualError(t, err, "URL cannot be empty", "Empty URL should fail")
+	assert.Equal(t, -1, code)
+
+	_, _, err = executeHTTPRequest(ctx, elem, []string{`["foo"]`})
+	assert.Error(t, err, "Malformed parameter should fail")
+
+	code, _, err = executeHTTPRequest(ctx, elem, nil)
+	assert.EqualError(t, err, "Unexpected HTTP status: 401 Unauthorized", "Unexpected status should fail")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, out, err := executeHTTPRequest(ctx, elem, []string{`{"method": "post", "headers": {"X-Token": "secret"}, 
+		"body": "task {{.TaskName}}", "expected_status": [200, 201]}`})
+	assert.NoError(t, err, "Request with expected status should succeed")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "POST task webhook", string(out), "Body template should be executed")
+
+	_, _, err = executeHTTPRequest(ctx, elem, []string{`{"body": "{{.Unknown}}"}`})
+	assert.Error(t, err, "Body template with unknown field should fail")
+}
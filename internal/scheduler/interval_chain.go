@@ -6,25 +6,30 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
 	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 )
 
-//Select live chains with proper client_name value
+//Select live interval chains with proper client_name and client_group values
 const sqlSelectIntervalChains = `
 SELECT
-	chain_execution_config, chain_id, chain_name, self_destruct, exclusive_execution, COALESCE(max_instances, 16) as max_instances,
+	chain_execution_config, chain_id, chain_name, self_destruct, self_destruct_mode, exclusive_execution, 
+	COALESCE(description, '') AS description, COALESCE(runbook_url, '') AS runbook_url,
+	COALESCE(max_instances, 16) as max_instances, COALESCE(client_group, '') AS client_group, tenant,
 	EXTRACT(EPOCH FROM (substr(run_at, 7) :: interval)) :: int4 as interval_seconds,
-	starts_with(run_at, '@after') as repeat_after
+	starts_with(run_at, '@after') as repeat_after, interval_aligned
 FROM 
 	timetable.chain_execution_config 
 WHERE 
-	live AND (client_name = $1 or client_name IS NULL) AND substr(run_at, 1, 6) IN ('@every', '@after')`
+	live AND (client_name = $1 or client_name IS NULL) AND (client_group IS NULL OR client_group = $2)
+	AND substr(run_at, 1, 6) IN ('@every', '@after')`
 
 // IntervalChain structure used to represent repeated chains.
 type IntervalChain struct {
 	Chain
 	Interval    int  `db:"interval_seconds"`
 	RepeatAfter bool `db:"repeat_after"`
+	Aligned     bool `db:"interval_aligned"`
 }
 
 func (ichain IntervalChain) isListed(ichains []IntervalChain) bool {
@@ -37,21 +42,54 @@ func (ichain IntervalChain) isListed(ichains []IntervalChain) bool {
 }
 
 func (ichain IntervalChain) isValid() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
 	return (IntervalChain{}) != intervalChains[ichain.ChainExecutionConfigID]
 }
 
+// intervalStart returns the start of the interval the time falls into. Intervals are counted from the midnight
+// in the location of the time, so they are aligned to the wall clock of the scheduler time zone
+func intervalStart(t time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / interval * interval)
+}
+
+// delay returns the time left until the next execution. Aligned chains are executed at the next multiple of
+// the interval, e.g. every 5 minutes at :00, :05, :10, instead of drifting relative to the scheduler start
+func (ichain IntervalChain) delay(now time.Time) time.Duration {
+	interval := time.Duration(ichain.Interval) * time.Second
+	if !ichain.Aligned || interval <= 0 {
+		return interval
+	}
+	return intervalStart(now, interval).Add(interval).Sub(now)
+}
+
 func (ichain IntervalChain) reschedule(ctx context.Context) {
-	if ichain.SelfDestruct {
-		pgengine.DeleteChainConfig(ctx, ichain.ChainExecutionConfigID)
+	delay := ichain.delay(clock.FromContext(ctx).Now())
+	pgengine.LogToDB("DEBUG", fmt.Sprintf("Sleeping before next execution for %s for chain %s", delay, ichain))
+	select {
+	case <-clock.FromContext(ctx).After(delay):
+	case <-ctx.Done():
 		return
 	}
-	pgengine.LogToDB("DEBUG", fmt.Sprintf("Sleeping before next execution for %ds for chain %s", ichain.Interval, ichain))
-	time.Sleep(time.Duration(ichain.Interval) * time.Second)
 	if ichain.isValid() {
-		intervalChainsChan <- ichain
+		select {
+		case intervalChainsChan <- ichain:
+		case <-ctx.Done():
+		}
 	}
 }
 
+// isClaimed returns true if this client executes the run of the interval. Runs of group chains are claimed
+// for the interval the current time falls into, so members firing at different moments run the chain once
+func (ichain IntervalChain) isClaimed(ctx context.Context) bool {
+	due := clock.FromContext(ctx).Now()
+	if interval := time.Duration(ichain.Interval) * time.Second; interval > 0 {
+		due = intervalStart(due, interval)
+	}
+	return len(claimChains(ctx, []Chain{ichain.Chain}, due)) > 0
+}
+
 // map of active chains, updated every minute
 var intervalChains map[int]IntervalChain = make(map[int]IntervalChain)
 
@@ -60,10 +98,10 @@ var intervalChainsChan chan IntervalChain = make(chan IntervalChain)
 
 var mutex = &sync.Mutex{}
 
-func retriveIntervalChainsAndRun(sql string) {
+func retriveIntervalChainsAndRun(ctx context.Context, sql string) {
 	mutex.Lock()
 	ichains := []IntervalChain{}
-	err := pgengine.ConfigDb.Select(&ichains, sql, pgengine.ClientName)
+	err := pgengine.ConfigDb.Select(&ichains, sql, pgengine.ClientName, pgengine.ClientGroup)
 	if err != nil {
 		pgengine.LogToDB("ERROR", "Could not query pending interval tasks: ", err)
 	} else {
@@ -77,37 +115,73 @@ func retriveIntervalChainsAndRun(sql string) {
 		}
 	}
 
-	// update chains from the database and send to working channel new one
+	// update chains from the database and send to working channel new one, aligned chains wait for the boundary
+	var started []IntervalChain
 	for _, ichain := range ichains {
 		if (IntervalChain{}) == intervalChains[ichain.ChainExecutionConfigID] {
-			intervalChainsChan <- ichain
+			if ichain.Aligned {
+				go ichain.reschedule(ctx)
+			} else {
+				started = append(started, ichain)
+			}
 		}
 		intervalChains[ichain.ChainExecutionConfigID] = ichain
 	}
 	mutex.Unlock()
+	// sent without the lock, since workers check received chains holding it
+	for _, ichain := range started {
+		select {
+		case intervalChainsChan <- ichain:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func intervalChainWorker(ctx context.Context, ichains <-chan IntervalChain) {
-	for ichain := range ichains {
+func intervalChainWorker(ctx context.Context, ichains <-chan IntervalChain, stop <-chan struct{}) {
+	for {
+		var ichain IntervalChain
+		select {
+		case ichain = <-ichains:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
 		if !ichain.isValid() { // chain not in the list of active chains
 			continue
 		}
 		pgengine.LogToDB("DEBUG", fmt.Sprintf("Calling process interval chain for %s", ichain))
-		if !ichain.RepeatAfter {
+		// self destructive chains are rescheduled only if they weren't destructed after execution
+		if !ichain.RepeatAfter && !ichain.SelfDestruct {
 			go ichain.reschedule(ctx)
 		}
-		for !pgengine.CanProceedChainExecution(ctx, ichain.ChainExecutionConfigID, ichain.MaxInstances) {
-			pgengine.LogToDB("DEBUG", fmt.Sprintf("Cannot proceed with chain %s. Sleeping...", ichain))
-			select {
-			case <-time.After(time.Duration(pgengine.WaitTime) * time.Second):
-			case <-ctx.Done():
-				pgengine.LogToDB("ERROR", "request cancelled\n")
-				return
+		if !waitChainInstances(ctx, ichain.Chain) {
+			return
+		}
+		if pgengine.InRecovery() || isChainExcluded(ichain.Chain) || !checkChainWindow(ctx, ichain.Chain) || !checkChainAffinity(ctx, ichain.Chain) || !pgengine.CheckChainQuota(ctx, ichain.ChainExecutionConfigID, ichain.ChainID) || !ichain.isClaimed(ctx) ||
+			!pgengine.CheckChainPrecondition(ctx, ichain.ChainExecutionConfigID, ichain.ChainID) {
+			if ichain.RepeatAfter || ichain.SelfDestruct {
+				go ichain.reschedule(ctx)
 			}
+			continue
 		}
-		executeChain(ctx, ichain.ChainExecutionConfigID, ichain.ChainID)
-		if ichain.RepeatAfter {
+		executeIntervalChain(ctx, ichain)
+	}
+}
+
+// executeIntervalChain executes the chain and reschedules @after and self destructive chains once the run
+// is finished. The panicked run is considered failed and the chain is rescheduled before the panic
+// is propagated to the worker
+func executeIntervalChain(ctx context.Context, ichain IntervalChain) {
+	success := false
+	defer func() {
+		if ichain.SelfDestruct && ichain.destruct(ctx, success) {
+			return
+		}
+		if ichain.RepeatAfter || ichain.SelfDestruct {
 			go ichain.reschedule(ctx)
 		}
-	}
+	}()
+	success = executeChain(ctx, ichain.Chain)
 }
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntervalChainReschedule(t *testing.T) {
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithClock(context.Background(), c)
+
+	ichain := IntervalChain{Chain: Chain{ChainExecutionConfigID: 42}, Interval: 3600}
+	mutex.Lock()
+	intervalChains[ichain.ChainExecutionConfigID] = ichain
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		delete(intervalChains, ichain.ChainExecutionConfigID)
+		mutex.Unlock()
+	}()
+
+	go ichain.reschedule(ctx)
+	c.WaitForTimers(1)
+	c.Advance(59 * time.Minute)
+	select {
+	case <-intervalChainsChan:
+		t.Fatal("Interval chain should not be rescheduled before interval passed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Advance(time.Minute)
+	select {
+	case rescheduled := <-intervalChainsChan:
+		assert.Equal(t, ichain, rescheduled, "Interval chain should be rescheduled after interval passed")
+	case <-time.After(time.Second):
+		t.Fatal("Interval chain should be rescheduled after interval passed")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ichain.reschedule(ctx)
+		close(done)
+	}()
+	c.WaitForTimers(1)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Reschedule should return once the context is cancelled")
+	}
+}
+
+func TestIntervalChainRescheduleOnPanic(t *testing.T) {
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithClock(context.Background(), c)
+	// the run panics once it tries to start the transaction without the database connection
+	defer func(configDb *sqlx.DB) { pgengine.ConfigDb = configDb }(pgengine.ConfigDb)
+	pgengine.ConfigDb = nil
+
+	ichain := IntervalChain{Chain: Chain{ChainExecutionConfigID: 43}, Interval: 60, RepeatAfter: true}
+	mutex.Lock()
+	intervalChains[ichain.ChainExecutionConfigID] = ichain
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		delete(intervalChains, ichain.ChainExecutionConfigID)
+		mutex.Unlock()
+	}()
+
+	assert.Panics(t, func() { executeIntervalChain(ctx, ichain) }, "Panic should be propagated to the worker")
+	c.WaitForTimers(1)
+	c.Advance(time.Minute)
+	select {
+	case rescheduled := <-intervalChainsChan:
+		assert.Equal(t, ichain, rescheduled, "Panicked @after chain should be rescheduled")
+	case <-time.After(time.Second):
+		t.Fatal("Panicked @after chain should be rescheduled")
+	}
+}
+
+func TestIntervalChainDelay(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 3, 20, 0, time.UTC)
+	ichain := IntervalChain{Interval: 300}
+	assert.Equal(t, 5*time.Minute, ichain.delay(now), "Interval should be relative to now")
+	ichain.Aligned = true
+	assert.Equal(t, time.Minute+40*time.Second, ichain.delay(now), "Aligned chain should wait for 10:05")
+	assert.Equal(t, 5*time.Minute, ichain.delay(now.Add(time.Minute+40*time.Second)), "Aligned chain should wait for 10:10")
+	ichain.Interval = 0
+	assert.Equal(t, time.Duration(0), ichain.delay(now))
+
+	// boundaries are counted from the local midnight, not from the midnight UTC
+	kathmandu := time.FixedZone("NPT", 5*3600+45*60)
+	now = time.Date(2020, 1, 1, 10, 3, 20, 0, kathmandu)
+	ichain.Interval = 3600
+	assert.Equal(t, 56*time.Minute+40*time.Second, ichain.delay(now), "Aligned chain should wait for 11:00 local time")
+	assert.Equal(t, time.Date(2020, 1, 1, 10, 0, 0, 0, kathmandu), intervalStart(now, time.Hour))
+}
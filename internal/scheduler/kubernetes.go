@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/kubernetes"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// kubectlBinary is the Kubernetes CLI used to run jobs, inside the cluster it uses the service account of the pod
+var kubectlBinary = "kubectl"
+
+type kubernetesOpts struct {
+	Namespace string            `json:"namespace"`
+	Vars      map[string]string `json:"vars"`
+	Timeout   int               `json:"timeout"` // in seconds, 0 means no timeout
+}
+
+// kubernetesJob is the data available in the job manifest template
+type kubernetesJob struct {
+	Name       string
+	ClientName string
+	ChainID    int
+	Vars       map[string]string
+}
+
+// renderJobManifest executes the job manifest template
+func renderJobManifest(manifest string, job kubernetesJob) (string, error) {
+	tmpl, err := template.New("job").Option("missingkey=error").Parse(manifest)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, job); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// kubectlRunner executes kubectl with the commander of the scheduler
+func kubectlRunner(ctx context.Context, stdin string, args ...string) ([]byte, error) {
+	_, out, err := runCommand(ctx, append([]string{kubectlBinary}, args...), [][]string{{}}, commandOptions{Stdin: stdin})
+	return out, err
+}
+
+// executeKubernetesJob creates the Kubernetes Job from the manifest template specified in the script once
+// for every parameter value containing JSON object with the "namespace", template "vars" and "timeout".
+// It waits for the job completion and returns logs of the job as the task output. The job is deleted afterwards
+func executeKubernetesJob(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (code int, out []byte, err error) {
+	if strings.TrimSpace(chainElemExec.Script) == "" {
+		return -1, []byte{}, errors.New("Kubernetes job manifest cannot be empty")
+	}
+	if len(paramValues) == 0 {
+		paramValues = []string{""}
+	}
+	for i, val := range paramValues {
+		var opts kubernetesOpts
+		if val > "" {
+			if err := json.Unmarshal([]byte(val), &opts); err != nil {
+				return -1, []byte{}, err
+			}
+		}
+		data := kubernetesJob{
+			Name:       fmt.Sprintf("pg-timetable-%d-%d-%d-%d", chainElemExec.ChainConfig, chainElemExec.ChainID, clock.FromContext(ctx).Now().UnixNano(), i),
+			ClientName: pgengine.ClientName,
+			ChainID:    chainElemExec.ChainID,
+			Vars:       opts.Vars,
+		}
+		manifest, err := renderJobManifest(chainElemExec.Script, data)
+		if err != nil {
+			return -1, []byte{}, err
+		}
+		job, err := kubernetes.RunJob(ctx, kubectlRunner, manifest, opts.Namespace, opts.Timeout)
+		if err != nil {
+			return job.ExitCode, job.Logs, err
+		}
+		code, out = job.ExitCode, job.Logs
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/kubernetes"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+// kubectlCommander records kubectl commands, jobs complete immediately
+type kubectlCommander struct {
+	calls *[]string
+}
+
+func (c kubectlCommander) CombinedOutput(ctx context.Context, opts commandOptions, command string, args ...string) ([]byte, error) {
+	call := command + " " + strings.Join(args, " ")
+	*c.calls = append(*c.calls, call)
+	switch {
+	case strings.Contains(call, " create "):
+		return []byte("job.batch/" + strings.Fields(opts.Stdin)[0]), nil
+	case strings.Contains(call, " get pods "):
+		return []byte("0"), nil
+	case strings.Contains(call, " get "):
+		return []byte("Complete"), nil
+	case strings.Contains(call, " logs "):
+		return []byte("job logs"), nil
+	}
+	return []byte{}, nil
+}
+
+func TestRenderJobManifest(t *testing.T) {
+	manifest, err := renderJobManifest("name: {{.Name}}\nimage: train:{{.Vars.version}}", kubernetesJob{Name: "job", Vars: map[string]string{"version": "1.4"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "name: job\nimage: train:1.4", manifest)
+	_, err = renderJobManifest("image: train:{{.Vars.version}}", kubernetesJob{Vars: map[string]string{}})
+	assert.Error(t, err, "Missing template variables should fail")
+	_, err = renderJobManifest("{{.Name", kubernetesJob{})
+	assert.Error(t, err)
+}
+
+func TestKubernetesJob(t *testing.T) {
+	var calls []string
+	cmd = kubectlCommander{&calls}
+	defer func() { cmd = testCommander{} }()
+	defer func(d time.Duration) { kubernetes.PollInterval = d }(kubernetes.PollInterval)
+	kubernetes.PollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+	elem := &pgengine.ChainElementExecution{ChainConfig: 1, ChainID: 2, Script: "{{.Name}} {{.Vars.version}}"}
+
+	code, out, err := executeKubernetesJob(ctx, elem, []string{`{"namespace": "batch", "vars": {"version": "1.4"}}`})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "job logs", string(out))
+	if assert.Len(t, calls, 5) {
+		assert.Equal(t, "kubectl --namespace batch create --filename - --output name", calls[0])
+		assert.Regexp(t, `^kubectl --namespace batch delete job.batch/pg-timetable-1-2-\d+-0 --wait=false$`, calls[4])
+	}
+
+	_, _, err = executeKubernetesJob(ctx, elem, nil)
+	assert.Error(t, err, "Missing template variables should fail")
+	_, _, err = executeKubernetesJob(ctx, &pgengine.ChainElementExecution{Script: " "}, nil)
+	assert.EqualError(t, err, "Kubernetes job manifest cannot be empty")
+}
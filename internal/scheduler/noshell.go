@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// isShellDisabled returns true if tasks of the kind are executed outside of the database and disabled by NoShellTasks
+func isShellDisabled(kind string) bool {
+	if !pgengine.NoShellTasks {
+		return false
+	}
+	switch kind {
+	case "SHELL", "PROGRAM", "DOCKER", "K8S_JOB":
+		return true
+	}
+	return false
+}
+
+// shellDisabledAction returns the action of the chain for elements blocked by NoShellTasks.
+// FAIL is returned if shell tasks are enabled or the action cannot be read
+func shellDisabledAction(ctx context.Context, chainConfigID int) string {
+	if !pgengine.NoShellTasks {
+		return "FAIL"
+	}
+	action, err := pgengine.GetShellDisabledAction(ctx, chainConfigID)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot get shell disabled action of the chain configuration: ", err)
+		return "FAIL"
+	}
+	return action
+}
+
+// hasShellDisabledElements returns true if some element of the chain is blocked by NoShellTasks
+func hasShellDisabledElements(chainElements []pgengine.ChainElementExecution) bool {
+	for _, chainElemExec := range chainElements {
+		if isShellDisabled(chainElemExec.Kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipShellDisabledElement registers the element blocked by NoShellTasks with SHELL_DISABLED status instead
+// of executing it. Returns false if the chain must fail
+func skipShellDisabledElement(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, result *RunResult) bool {
+	pgengine.LogToDB("LOG", "Task execution skipped, shell tasks are disabled: ", chainElemExec)
+	pgengine.UpdateChainRunStatus(ctx, chainElemExec, result.RunStatusID, "SHELL_DISABLED")
+	result.Outputs = append(result.Outputs, TaskOutput{chainElemExec.ChainID, chainElemExec.TaskName, -1, ""})
+	if chainElemExec.Run.ShellDisabledAction == "SKIP_ELEMENT" || chainElemExec.IgnoreError {
+		return true
+	}
+	chainElemExec.Run.LastError = fmt.Sprintf("%s: %s", chainElemExec.TaskName, errShellTasksDisabled)
+	return false
+}
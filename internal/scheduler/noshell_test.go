@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellDisabledElements(t *testing.T) {
+	elements := []pgengine.ChainElementExecution{{Kind: "SQL"}, {Kind: "BUILTIN"}, {Kind: "DOCKER"}}
+	pgengine.NoShellTasks = false
+	assert.False(t, isShellDisabled("SHELL"), "Shell tasks are enabled")
+	assert.False(t, hasShellDisabledElements(elements))
+	assert.Equal(t, "FAIL", shellDisabledAction(context.Background(), 1), "Action is not read if shell tasks are enabled")
+
+	pgengine.NoShellTasks = true
+	defer func() { pgengine.NoShellTasks = false }()
+	for _, kind := range []string{"SHELL", "PROGRAM", "DOCKER", "K8S_JOB"} {
+		assert.True(t, isShellDisabled(kind), kind)
+	}
+	for _, kind := range []string{"SQL", "BUILTIN", "HTTP"} {
+		assert.False(t, isShellDisabled(kind), kind)
+	}
+	assert.True(t, hasShellDisabledElements(elements))
+	assert.False(t, hasShellDisabledElements(elements[:2]))
+}
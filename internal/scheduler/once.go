@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// RunOnce executes chains due at the moment, and @reboot chains if reboot is true, waits until they finish and
+// exits instead of looping, so pg_timetable can be invoked by external orchestrators. Interval chains are not
+// executed, they are never due at a moment. Returns false if chains cannot be dispatched or any of them failed
+func RunOnce(ctx context.Context, reboot bool) bool {
+	if !pgengine.TryLockClientName(ctx) {
+		return false
+	}
+	if pgengine.IsInRecovery(ctx) {
+		pgengine.LogToDB("ERROR", "Chains cannot be executed on the standby server")
+		return false
+	}
+	pgengine.ConfigDb.SetMaxOpenConns(Workers() + 1)
+	pgengine.FixSchedulerCrash(ctx)
+	due, err := selectDueChains(ctx, reboot)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not query pending tasks: ", err)
+		return false
+	}
+	pgengine.LogToDB("LOG", "Number of chains to be executed: ", len(due))
+	var failed int32
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, Workers())
+	for _, chain := range due {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(chain Chain) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if !runDueChain(ctx, chain) {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(chain)
+	}
+	wg.Wait()
+	if failed > 0 {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("%d of %d chains failed", failed, len(due)))
+		return false
+	}
+	return ctx.Err() == nil
+}
+
+// selectDueChains returns cron chains due at the moment, chains of client side engines due at the moment
+// and @reboot chains if requested. Runs of group chains are claimed by claimChains
+func selectDueChains(ctx context.Context, reboot bool) ([]Chain, error) {
+	var due, engineChains []Chain
+	if reboot {
+		if err := pgengine.ConfigDb.SelectContext(ctx, &due, pgengine.SchemaSQL(sqlSelectRebootChains), pgengine.ClientName, pgengine.ClientGroup); err != nil {
+			return nil, err
+		}
+	}
+	var cronChains []Chain
+	if err := pgengine.ConfigDb.SelectContext(ctx, &cronChains, pgengine.SchemaSQL(sqlSelectChains), pgengine.ClientName, pgengine.ClientGroup); err != nil {
+		return nil, err
+	}
+	if err := pgengine.ConfigDb.SelectContext(ctx, &engineChains, pgengine.SchemaSQL(sqlSelectEngineChains), pgengine.ClientName, pgengine.ClientGroup); err != nil {
+		return nil, err
+	}
+	now := clock.FromContext(ctx).Now()
+	due = append(due, cronChains...)
+	due = append(due, filterDueChains(engineChains, now)...)
+	return claimChains(ctx, due, now.Truncate(time.Minute)), nil
+}
+
+// runDueChain executes the chain the same way chainWorker does. Chains skipped due to exclusion, execution
+// window, affinity, quota or run_if are not considered failed. Returns false if the chain failed
+func runDueChain(ctx context.Context, chain Chain) bool {
+	if !waitChainInstances(ctx, chain) {
+		return false
+	}
+	if isChainExcluded(chain) || !checkChainWindow(ctx, chain) || !checkChainAffinity(ctx, chain) ||
+		!pgengine.CheckChainQuota(ctx, chain.ChainExecutionConfigID, chain.ChainID) ||
+		!pgengine.CheckChainPrecondition(ctx, chain.ChainExecutionConfigID, chain.ChainID) {
+		return true
+	}
+	success := executeChain(ctx, chain)
+	if chain.SelfDestruct {
+		chain.destruct(ctx, success)
+	}
+	return success
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// outputCapture keeps the head of the stream up to the limit. The stream exceeding the limit is written
+// completely to the spill file created in dir, if dir is empty the rest of the stream is dropped
+type outputCapture struct {
+	limit     int
+	dir       string
+	pattern   string // name pattern of the spill file, see ioutil.TempFile
+	head      bytes.Buffer
+	truncated bool
+	spill     *os.File
+	err       error
+}
+
+// newOutputCapture returns the capture of the stream named like stdout or stderr of the chain element
+func newOutputCapture(chainElemExec *pgengine.ChainElementExecution, stream string) *outputCapture {
+	runStatusID := 0
+	if chainElemExec.Run != nil {
+		runStatusID = chainElemExec.Run.RunStatusID
+	}
+	return &outputCapture{
+		limit:   pgengine.OutputLimit,
+		dir:     pgengine.OutputDir,
+		pattern: fmt.Sprintf("run%d_chain%d_%s_*.log", runStatusID, chainElemExec.ChainID, stream)}
+}
+
+// Write never fails, so the failed spill file cannot break the command
+func (c *outputCapture) Write(p []byte) (int, error) {
+	if c.spill == nil && c.err == nil && c.head.Len()+len(p) > c.limit && c.dir != "" {
+		if c.spill, c.err = ioutil.TempFile(c.dir, c.pattern); c.err == nil {
+			_, c.err = c.spill.Write(c.head.Bytes())
+		}
+	}
+	if c.spill != nil && c.err == nil {
+		_, c.err = c.spill.Write(p)
+	}
+	if room := c.limit - c.head.Len(); room < len(p) {
+		c.truncated = true
+		if room > 0 {
+			c.head.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	c.head.Write(p)
+	return len(p), nil
+}
+
+// Close returns the head of the stream and the name of the spill file, the spill file is removed on failure
+func (c *outputCapture) Close() (head string, file string) {
+	head = c.head.String()
+	if c.truncated {
+		head += "\n... truncated"
+	}
+	if c.spill == nil {
+		return
+	}
+	if err := c.spill.Close(); c.err == nil {
+		c.err = err
+	}
+	if c.err != nil {
+		pgengine.LogToDB("ERROR", "Cannot write output file: ", c.err)
+		_ = os.Remove(c.spill.Name())
+		return
+	}
+	return head, c.spill.Name()
+}
+
+// streamWriter copies the stream to the combined output and to the capture of the stream. The mutex
+// serializes writes of stdout and stderr copied by separate goroutines
+type streamWriter struct {
+	mu       *sync.Mutex
+	combined *bytes.Buffer
+	capture  io.Writer
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.combined.Write(p)
+	return w.capture.Write(p)
+}
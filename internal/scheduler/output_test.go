@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputCapture(t *testing.T) {
+	elem := &pgengine.ChainElementExecution{ChainID: 3, Run: &pgengine.ChainRun{RunStatusID: 42}}
+	c := newOutputCapture(elem, "stdout")
+	c.limit = 5
+	_, _ = c.Write([]byte("abc"))
+	_, _ = c.Write([]byte("defgh"))
+	head, file := c.Close()
+	assert.Equal(t, "abcde\n... truncated", head)
+	assert.Empty(t, file, "Output should be truncated without output directory")
+
+	dir, err := ioutil.TempDir("", "output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	c = newOutputCapture(elem, "stderr")
+	c.limit, c.dir = 5, dir
+	_, _ = c.Write([]byte("abc"))
+	assert.Nil(t, c.spill, "Output within the limit should not be spilled")
+	_, _ = c.Write([]byte("defgh"))
+	_, _ = c.Write([]byte("ij"))
+	head, file = c.Close()
+	assert.Equal(t, "abcde\n... truncated", head)
+	assert.True(t, strings.HasPrefix(file, dir+"/run42_chain3_stderr_"))
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdefghij", string(data), "Spill file should contain the whole stream")
+}
+
+func TestCommandStreams(t *testing.T) {
+	elem := &pgengine.ChainElementExecution{}
+	stdout, stderr := newOutputCapture(elem, "stdout"), newOutputCapture(elem, "stderr")
+	out, err := realCommander{}.CombinedOutput(context.Background(), commandOptions{Stdout: stdout, Stderr: stderr},
+		"sh", "-c", "echo out; echo err >&2")
+	assert.NoError(t, err)
+	// streams are written concurrently, so the order of lines in the combined output is not defined
+	assert.ElementsMatch(t, []string{"out", "err"}, strings.Split(strings.TrimSpace(string(out)), "\n"),
+		"Combined output should contain both streams")
+	head, _ := stdout.Close()
+	assert.Equal(t, "out\n", head)
+	head, _ = stderr.Close()
+	assert.Equal(t, "err\n", head)
+}
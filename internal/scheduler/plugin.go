@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/executor"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// executePlugin executes the task of the custom kind with the registered executor
+func executePlugin(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (int, []byte, error) {
+	e, ok := executor.Lookup(chainElemExec.Kind)
+	if !ok {
+		return -1, nil, fmt.Errorf("No executor registered for the task kind %s", chainElemExec.Kind)
+	}
+	return e.Execute(ctx, executor.Task{
+		ClientName:  pgengine.ClientName,
+		ChainConfig: chainElemExec.ChainConfig,
+		ChainID:     chainElemExec.ChainID,
+		TaskName:    chainElemExec.TaskName,
+		Kind:        chainElemExec.Kind,
+		Script:      chainElemExec.Script,
+		Params:      paramValues,
+	})
+}
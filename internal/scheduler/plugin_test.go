@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/executor"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutePlugin(t *testing.T) {
+	assert.NoError(t, executor.Register("TEST_PLUGIN", executor.ExecutorFunc(func(ctx context.Context, task executor.Task) (int, []byte, error) {
+		return 2, []byte(task.Script + task.Params[0]), nil
+	})))
+	elem := &pgengine.ChainElementExecution{Kind: "TEST_PLUGIN", Script: "topic:"}
+	code, out, err := executeTask(context.Background(), nil, elem, []string{"message"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, code)
+	assert.Equal(t, "topic:message", string(out))
+
+	elem.Kind = "UNKNOWN"
+	_, _, err = executeTask(context.Background(), nil, elem, nil)
+	assert.EqualError(t, err, "No executor registered for the task kind UNKNOWN")
+}
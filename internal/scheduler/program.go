@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseArgv parses JSON array of strings, null elements are rejected
+func parseArgv(val string) ([]string, error) {
+	var values []*string
+	if err := json.Unmarshal([]byte(val), &values); err != nil {
+		return nil, err
+	}
+	argv := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			return nil, fmt.Errorf("Argument %d cannot be null", i)
+		}
+		argv[i] = *v
+	}
+	return argv, nil
+}
+
+// executeProgram executes the program with argv stored in the script as JSON array, e.g. ["pg_dump", "-Fc"].
+// No shell is involved, every argument is passed to the program as is. The program is executed once for
+// every parameter value containing JSON array of arguments appended to the argv
+func executeProgram(ctx context.Context, script string, paramValues []string, opts commandOptions) (code int, out []byte, err error) {
+	argv, err := parseArgv(script)
+	if err != nil {
+		return -1, []byte{}, fmt.Errorf("Program script must be JSON array of strings: %s", err)
+	}
+	if len(argv) == 0 || strings.TrimSpace(argv[0]) == "" {
+		return -1, []byte{}, errors.New("Program cannot be empty")
+	}
+	if len(paramValues) == 0 {
+		paramValues = []string{""}
+	}
+	argsList := make([][]string, 0, len(paramValues))
+	for _, val := range paramValues {
+		args := []string{}
+		if val > "" {
+			if args, err = parseArgv(val); err != nil {
+				return -1, []byte{}, fmt.Errorf("Program parameters must be JSON array of strings: %s", err)
+			}
+		}
+		argsList = append(argsList, args)
+	}
+	return runCommand(ctx, argv, argsList, opts)
+}
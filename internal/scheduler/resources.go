@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// procDir is the proc filesystem providing load and memory statistics, missing on non Linux hosts
+var procDir = "/proc"
+
+// parseLoadAvg reads 1, 5 and 15 minutes load averages in the format of /proc/loadavg
+func parseLoadAvg(r io.Reader, res *pgengine.ClientResources) error {
+	var load1, load5, load15 float64
+	if _, err := fmt.Fscan(r, &load1, &load5, &load15); err != nil {
+		return err
+	}
+	res.Load1 = sql.NullFloat64{Float64: load1, Valid: true}
+	res.Load5 = sql.NullFloat64{Float64: load5, Valid: true}
+	res.Load15 = sql.NullFloat64{Float64: load15, Valid: true}
+	return nil
+}
+
+// parseMemInfo reads total and available memory in the format of /proc/meminfo
+func parseMemInfo(r io.Reader, res *pgengine.ClientResources) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			res.MemTotal = sql.NullInt64{Int64: kb * 1024, Valid: true}
+		case "MemAvailable:":
+			res.MemAvailable = sql.NullInt64{Int64: kb * 1024, Valid: true}
+		}
+	}
+	return scanner.Err()
+}
+
+// readProcFile parses the file of the proc filesystem, missing files are ignored
+func readProcFile(name string, res *pgengine.ClientResources, parse func(io.Reader, *pgengine.ClientResources) error) {
+	f, err := os.Open(procDir + "/" + name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if err := parse(f, res); err != nil {
+		pgengine.LogToDB("DEBUG", fmt.Sprintf("Cannot parse %s: %s", name, err))
+	}
+}
+
+// collectResources returns resources of the host, metrics not available on the platform are left unknown
+func collectResources() (res pgengine.ClientResources) {
+	if hostname, err := os.Hostname(); err == nil {
+		res.Hostname = sql.NullString{String: hostname, Valid: true}
+	}
+	readProcFile("loadavg", &res, parseLoadAvg)
+	readProcFile("meminfo", &res, parseMemInfo)
+	if total, free, err := diskUsage(os.TempDir()); err == nil {
+		res.DiskTotal = sql.NullInt64{Int64: total, Valid: true}
+		res.DiskFree = sql.NullInt64{Int64: free, Valid: true}
+	}
+	return
+}
+
+// reportResources saves resources of the host, so operators can spot the client about to fall over
+func reportResources(ctx context.Context) {
+	pgengine.ReportClientResources(ctx, collectResources())
+}
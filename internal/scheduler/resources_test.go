@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcFiles(t *testing.T) {
+	var res pgengine.ClientResources
+	assert.NoError(t, parseLoadAvg(strings.NewReader("0.00 1.50 2.25 1/123 4567\n"), &res))
+	assert.True(t, res.Load1.Valid, "Zero load is known")
+	assert.Equal(t, 1.5, res.Load5.Float64)
+	assert.Equal(t, 2.25, res.Load15.Float64)
+	assert.Error(t, parseLoadAvg(strings.NewReader(""), &res))
+
+	assert.NoError(t, parseMemInfo(strings.NewReader("MemTotal:       16384 kB\nMemFree:  1024 kB\nMemAvailable:    8192 kB\n"), &res))
+	assert.Equal(t, int64(16384*1024), res.MemTotal.Int64)
+	assert.Equal(t, int64(8192*1024), res.MemAvailable.Int64)
+}
+
+func TestCollectResources(t *testing.T) {
+	procDir = "non-existent"
+	defer func() { procDir = "/proc" }()
+	res := collectResources()
+	assert.True(t, res.Hostname.Valid)
+	assert.False(t, res.Load1.Valid, "Missing proc files should leave metrics unknown")
+	assert.False(t, res.MemTotal.Valid)
+}
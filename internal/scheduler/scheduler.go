@@ -3,47 +3,99 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"strings"
 	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
 	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
 	"github.com/cybertec-postgresql/pg_timetable/internal/tasks"
 	"github.com/jmoiron/sqlx"
 )
 
-const workersNumber = 16
+/* the main loop period in seconds, shortened by SetDebug to troubleshoot scheduling */
+const (
+	defaultRefetchTimeout = 60
+	debugRefetchTimeout   = 10
+)
 
-/* the main loop period. Should be 60 (sec) for release configuration. Set to 10 (sec) for debug purposes */
-const refetchTimeout = 60
+var refetchTimeout = defaultRefetchTimeout
 
-/* if the number of chains pulled for execution is higher than this value, try to spread execution to avoid spikes */
-const maxChainsThreshold = workersNumber * refetchTimeout
+// SetDebug shortens the main loop period, so interval chains, resumed runs, SLA checks and reconnects are
+// processed sooner. Cron schedules have the minute resolution, so they are still checked once a minute
+func SetDebug(debug bool) {
+	refetchTimeout = defaultRefetchTimeout
+	if debug {
+		refetchTimeout = debugRefetchTimeout
+	}
+}
 
-//Select live chains with proper client_name value
+//Select live chains with proper client_name and client_group values
 const sqlSelectLiveChains = `
 SELECT
-	chain_execution_config, chain_id, chain_name, self_destruct, exclusive_execution, COALESCE(max_instances, 16) as max_instances
+	chain_execution_config, chain_id, chain_name, self_destruct, self_destruct_mode, exclusive_execution, 
+	COALESCE(description, '') AS description, COALESCE(runbook_url, '') AS runbook_url,
+	COALESCE(max_instances, 16) as max_instances, COALESCE(client_group, '') AS client_group, tenant
 FROM 
 	timetable.chain_execution_config 
 WHERE 
-	live AND (client_name = $1 or client_name IS NULL)`
+	live AND (client_name = $1 or client_name IS NULL) AND (client_group IS NULL OR client_group = $2)`
 
 //Select chains to be executed right now()
 const sqlSelectChains = sqlSelectLiveChains +
-	` AND NOT COALESCE(starts_with(run_at, '@'), FALSE) AND timetable.is_cron_in_time(run_at, now())`
+	` AND schedule_engine IS NULL AND NOT COALESCE(starts_with(run_at, '@'), FALSE) AND timetable.is_cron_in_time(run_at, now())`
+
+//Select chains scheduled by the client side engines, the schedule itself is checked by filterDueChains()
+const sqlSelectEngineChains = `
+SELECT
+	chain_execution_config, chain_id, chain_name, self_destruct, self_destruct_mode, exclusive_execution, 
+	COALESCE(description, '') AS description, COALESCE(runbook_url, '') AS runbook_url,
+	COALESCE(max_instances, 16) as max_instances, schedule_engine, schedule, COALESCE(client_group, '') AS client_group, tenant
+FROM 
+	timetable.chain_execution_config 
+WHERE 
+	live AND (client_name = $1 or client_name IS NULL) AND (client_group IS NULL OR client_group = $2)
+	AND schedule_engine IS NOT NULL`
 
 //Select chains to be executed right after reboot
 const sqlSelectRebootChains = sqlSelectLiveChains + ` AND run_at = '@reboot'`
 
+//Select and mark chains requested to be resumed from the failed element by timetable.resume_run()
+const sqlSelectResumedChains = `
+WITH failed AS (
+	SELECT r.run_status, s.chain_execution_config, s.chain_id AS resume_from
+	FROM timetable.run_resume r JOIN timetable.run_status s ON s.start_status = r.run_status
+	WHERE r.resumed IS NULL AND s.execution_status = 'CHAIN_FAILED'
+)
+UPDATE timetable.run_resume r SET resumed = now()
+FROM failed f JOIN timetable.chain_execution_config c USING (chain_execution_config)
+WHERE r.run_status = f.run_status AND (c.client_name = $1 OR c.client_name IS NULL)
+	AND (c.client_group IS NULL OR c.client_group = $2)
+RETURNING
+	c.chain_execution_config, c.chain_id, c.chain_name, c.self_destruct, c.self_destruct_mode, c.exclusive_execution, 
+	COALESCE(c.description, '') AS description, COALESCE(c.runbook_url, '') AS runbook_url,
+	COALESCE(c.max_instances, 16) as max_instances, c.tenant, f.resume_from`
+
 // Chain structure used to represent tasks chains
 type Chain struct {
 	ChainExecutionConfigID int    `db:"chain_execution_config"`
 	ChainID                int    `db:"chain_id"`
 	ChainName              string `db:"chain_name"`
 	SelfDestruct           bool   `db:"self_destruct"`
+	SelfDestructMode       string `db:"self_destruct_mode"`
 	ExclusiveExecution     bool   `db:"exclusive_execution"`
 	MaxInstances           int    `db:"max_instances"`
+	ResumeFrom             int    `db:"resume_from"`
+	ScheduleEngine         string `db:"schedule_engine"`
+	Schedule               string `db:"schedule"`
+	Tenant                 string `db:"tenant"`
+	Description            string `db:"description"`
+	RunbookURL             string `db:"runbook_url"`
+	ClientGroup            string `db:"client_group"`
 }
 
 // create channel for passing chains to workers
@@ -61,42 +113,124 @@ const (
 	ContextCancelled
 )
 
-//Run executes jobs. Returns Fa
-func Run(ctx context.Context) RunStatus {
-	for !pgengine.TryLockClientName(ctx) {
+// lockClientName waits until the client name lock is obtained. In HA mode the client is the standby until
+// the lock is obtained, then it's the leader. Returns false if the context is cancelled
+func lockClientName(ctx context.Context) bool {
+	setFlag(&lockHeld, false)
+	for standby := false; !pgengine.TryLockClientName(ctx); standby = true {
+		if pgengine.HAMode && !standby {
+			pgengine.LogToDB("LOG", "Client is the standby, waiting for the leader to stop...")
+		}
+		markLoop(ctx)
 		select {
-		case <-time.After(refetchTimeout * time.Second):
+		case <-clock.FromContext(ctx).After(lockRetryInterval()):
 		case <-ctx.Done():
 			// If the request gets cancelled, log it
 			pgengine.LogToDB("ERROR", "request cancelled\n")
-			return ContextCancelled
+			return false
 		}
 	}
+	setFlag(&lockHeld, true)
+	if pgengine.HAMode {
+		pgengine.LogToDB("LOG", "Client is the leader")
+		startLeaderHeartbeat(ctx)
+	}
+	return true
+}
+
+// reconnect re-establishes the session after the connection loss and obtains the client name lock again,
+// so the main loop continues without restarting workers. Returns false if the context is cancelled
+func reconnect(ctx context.Context) bool {
+	pgengine.LogToDB("NOTICE", "Connection to the database lost, reconnecting...")
+	events.Publish(events.Event{Kind: events.ClientLost, ClientName: pgengine.ClientName})
+	setFlag(&reconnecting, true)
+	defer setFlag(&reconnecting, false)
+	if !pgengine.ReconnectDbAndFixLeftovers(ctx) || !lockClientName(ctx) {
+		return false
+	}
+	events.Publish(events.Event{Kind: events.ClientConnected, ClientName: pgengine.ClientName})
+	return true
+}
+
+// waitPrimary pauses chain dispatching while connected to the standby server until it's promoted,
+// so the scheduler can be pointed at the HA virtual IP. Returns false if the context is cancelled
+func waitPrimary(ctx context.Context) bool {
+	if !pgengine.IsInRecovery(ctx) {
+		return true
+	}
+	pgengine.LogToDB("NOTICE", "Connected to the standby server, chain dispatching is paused until promotion")
+	for pgengine.IsInRecovery(ctx) {
+		markLoop(ctx)
+		select {
+		case <-clock.FromContext(ctx).After(time.Duration(refetchTimeout) * time.Second):
+			if !pgengine.IsAlive() && !reconnect(ctx) {
+				return false
+			}
+		case <-ctx.Done():
+			pgengine.LogToDB("ERROR", "request cancelled\n")
+			return false
+		}
+	}
+	pgengine.LogToDB("LOG", "Connected to the primary server, chain dispatching is resumed")
+	pgengine.FixSchedulerCrash(ctx)
+	return true
+}
+
+// Run executes jobs until the context is cancelled. The session is re-established transparently
+// if the connection is lost
+func Run(ctx context.Context) RunStatus {
+	if !lockClientName(ctx) || !waitPrimary(ctx) {
+		return ContextCancelled
+	}
 	// create sleeping workers waiting data on channel
-	for w := 1; w <= workersNumber; w++ {
-		chainCtx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		go chainWorker(chainCtx, chains)
-		chainCtx, cancel = context.WithCancel(ctx)
-		defer cancel()
-		go intervalChainWorker(chainCtx, intervalChainsChan)
-	}
-	/* set maximum connection to workersNumber + 1 for system calls */
-	pgengine.ConfigDb.SetMaxOpenConns(workersNumber + 1)
-	/* cleanup potential database leftovers */
+	defer startWorkers(ctx)()
+	/* cleanup potential database leftovers, crashed runs are selected before they're marked DEAD */
+	crashedChains := selectCrashedChains(ctx)
 	pgengine.FixSchedulerCrash(ctx)
+	if len(crashedChains) > 0 {
+		pgengine.LogToDB("LOG", "Executing again idempotent chains left unfinished by the crash...")
+		runChains(ctx, crashedChains)
+	}
 	pgengine.LogToDB("LOG", "Checking for @reboot task chains...")
-	retriveChainsAndRun(ctx, sqlSelectRebootChains)
+	retriveChainsAndRun(ctx, pgengine.SchemaSQL(sqlSelectRebootChains))
+	var lastMinute time.Time
 	/* loop forever or until we ask it to stop */
 	for {
-		pgengine.LogToDB("LOG", "Checking for task chains...")
-		retriveChainsAndRun(ctx, sqlSelectChains)
+		markLoop(ctx)
+		if !waitPrimary(ctx) {
+			return ContextCancelled
+		}
+		// the heartbeat and the lease of the client name expire unless renewed
+		if !pgengine.RenewClientLock(ctx) && !lockClientName(ctx) {
+			return ContextCancelled
+		}
+		reportResources(ctx)
+		// the same minute is checked again if the loop iterates more often than once a minute
+		if now := clock.FromContext(ctx).Now(); !now.Truncate(time.Minute).Equal(lastMinute) {
+			lastMinute = now.Truncate(time.Minute)
+			pgengine.LogToDB("LOG", "Checking for task chains...")
+			retriveChainsAndRun(ctx, pgengine.SchemaSQL(sqlSelectChains))
+			retriveEngineChainsAndRun(ctx, now)
+		}
 		pgengine.LogToDB("LOG", "Checking for interval task chains...")
-		retriveIntervalChainsAndRun(sqlSelectIntervalChains)
+		retriveIntervalChainsAndRun(ctx, pgengine.SchemaSQL(sqlSelectIntervalChains))
+		if pgengine.Enabled(pgengine.FeatureResume) {
+			pgengine.LogToDB("LOG", "Checking for task chains to resume...")
+			retriveChainsAndRun(ctx, pgengine.SchemaSQL(sqlSelectResumedChains))
+		}
+		if pgengine.Enabled(pgengine.FeatureSLA) {
+			checkSLA(ctx)
+		}
+		if pgengine.Enabled(pgengine.FeatureClientLeases) {
+			checkLostClients(ctx)
+		}
+		if pgengine.Enabled(pgengine.FeatureCircuitBreaker) {
+			resumeSuspendedChains(ctx)
+		}
 		select {
-		case <-time.After(refetchTimeout * time.Second):
-			if !pgengine.IsAlive() {
-				return ConnectionDroppped
+		case <-clock.FromContext(ctx).After(time.Duration(refetchTimeout) * time.Second):
+			if !pgengine.IsAlive() && !reconnect(ctx) {
+				return ContextCancelled
 			}
 		case <-ctx.Done():
 			// If the request gets cancelled, log it
@@ -108,113 +242,503 @@ func Run(ctx context.Context) RunStatus {
 
 func retriveChainsAndRun(ctx context.Context, sql string) {
 	headChains := []Chain{}
-	err := pgengine.ConfigDb.SelectContext(ctx, &headChains, sql, pgengine.ClientName)
+	err := pgengine.ConfigDb.SelectContext(ctx, &headChains, sql, pgengine.ClientName, pgengine.ClientGroup)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not query pending tasks: ", err)
+		return
+	}
+	runChains(ctx, claimChains(ctx, headChains, clock.FromContext(ctx).Now().Truncate(time.Minute)))
+}
+
+func retriveEngineChainsAndRun(ctx context.Context, now time.Time) {
+	headChains := []Chain{}
+	err := pgengine.ConfigDb.SelectContext(ctx, &headChains, pgengine.SchemaSQL(sqlSelectEngineChains), pgengine.ClientName, pgengine.ClientGroup)
 	if err != nil {
 		pgengine.LogToDB("ERROR", "Could not query pending tasks: ", err)
 		return
 	}
+	runChains(ctx, claimChains(ctx, filterDueChains(headChains, now), now.Truncate(time.Minute)))
+}
+
+// filterDueChains returns chains which schedule engine reports due at the moment
+func filterDueChains(headChains []Chain, now time.Time) []Chain {
+	dueChains := make([]Chain, 0, len(headChains))
+	for _, headChain := range headChains {
+		s, err := schedule.Parse(headChain.ScheduleEngine, headChain.Schedule)
+		if err != nil {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot parse schedule of the chain %s: %v", headChain, err))
+			continue
+		}
+		if s.IsDue(now) {
+			dueChains = append(dueChains, headChain)
+		}
+	}
+	return dueChains
+}
+
+func runChains(ctx context.Context, headChains []Chain) {
 	headChainsCount := len(headChains)
 	pgengine.LogToDB("LOG", "Number of chains to be executed: ", headChainsCount)
+	/* if the number of chains is higher than workers can execute, try to spread execution to avoid spikes */
+	maxChainsThreshold := Workers() * refetchTimeout
 	/* now we can loop through so chains */
 	for _, headChain := range headChains {
 		if headChainsCount > maxChainsThreshold {
-			time.Sleep(time.Duration(refetchTimeout*1000/headChainsCount) * time.Millisecond)
+			clock.FromContext(ctx).Sleep(time.Duration(refetchTimeout*1000/headChainsCount) * time.Millisecond)
 		}
 		pgengine.LogToDB("DEBUG", fmt.Sprintf("Putting head chain %s to the execution channel", headChain))
+		events.Publish(chainEvent(ctx, events.ChainQueued, headChain, 0))
 		chains <- headChain
 	}
 }
 
-func chainWorker(ctx context.Context, chains <-chan Chain) {
-	for chain := range chains {
+// chainWorker executes chains until stopped, the chain being executed is finished first
+func chainWorker(ctx context.Context, chains <-chan Chain, stop <-chan struct{}) {
+	for {
+		var chain Chain
+		select {
+		case chain = <-chains:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
 		pgengine.LogToDB("DEBUG", fmt.Sprintf("Calling process chain for %s", chain))
-		for !pgengine.CanProceedChainExecution(ctx, chain.ChainExecutionConfigID, chain.MaxInstances) {
-			pgengine.LogToDB("DEBUG", fmt.Sprintf("Cannot proceed with chain %s. Sleeping...", chain))
-			select {
-			case <-time.After(time.Duration(pgengine.WaitTime) * time.Second):
-			case <-ctx.Done():
-				pgengine.LogToDB("ERROR", "request cancelled\n")
-				return
-			}
+		if !waitChainInstances(ctx, chain) {
+			return
 		}
-		executeChain(ctx, chain.ChainExecutionConfigID, chain.ChainID)
+		if pgengine.InRecovery() || isChainExcluded(chain) || !checkChainWindow(ctx, chain) || !checkChainAffinity(ctx, chain) || !pgengine.CheckChainQuota(ctx, chain.ChainExecutionConfigID, chain.ChainID) ||
+			!pgengine.CheckChainPrecondition(ctx, chain.ChainExecutionConfigID, chain.ChainID) {
+			continue
+		}
+		success := executeChain(ctx, chain)
 		if chain.SelfDestruct {
-			pgengine.DeleteChainConfig(ctx, chain.ChainExecutionConfigID)
+			chain.destruct(ctx, success)
 		}
 	}
 }
 
-/* execute a chain of tasks */
-func executeChain(ctx context.Context, chainConfigID int, chainID int) {
+// destruct deletes or disables self destructive chain depending on self_destruct_mode and the run result.
+// Returns true if chain shouldn't be executed anymore
+func (chain Chain) destruct(ctx context.Context, success bool) bool {
+	switch {
+	case success || chain.SelfDestructMode == "ALWAYS" || chain.SelfDestructMode == "":
+		pgengine.DeleteChainConfig(ctx, chain.ChainExecutionConfigID)
+		return true
+	case chain.SelfDestructMode == "DISABLE_ON_FAILURE":
+		pgengine.DisableChainConfig(ctx, chain.ChainExecutionConfigID)
+		return true
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Self destructive chain %s failed and will be executed again", chain))
+	return false
+}
+
+/* execute a chain of tasks, if chain.ResumeFrom is not 0 elements before that element are skipped. Returns true on success */
+func executeChain(ctx context.Context, chain Chain) bool {
+	return runChain(ctx, chain).Success()
+}
+
+// OnPanic is called with the recovered value and the stack before the panic of the chain run is propagated,
+// e.g. to report it to the error tracker
+var OnPanic func(chain Chain, r interface{}, stack []byte)
+
+func reportPanic(chain Chain) {
+	if r := recover(); r != nil {
+		if OnPanic != nil {
+			OnPanic(chain, r, debug.Stack())
+		}
+		panic(r)
+	}
+}
+
+// releaseOnPanic rolls back the chain transaction and marks the run failed if the chain panics, so the
+// connection is returned to the pool and the run is not left STARTED. The panic is propagated to the worker
+func releaseOnPanic(ctx context.Context, tx **sqlx.Tx, chain Chain, result *RunResult) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	// the transaction is already finished if the panic happened after the commit
+	if *tx != nil {
+		_ = (*tx).Rollback()
+	}
+	if result.RunStatusID != 0 {
+		pgengine.UpdateChainRunStatus(ctx,
+			&pgengine.ChainElementExecution{
+				ChainID:     chain.ChainID,
+				ChainConfig: chain.ChainExecutionConfigID}, result.RunStatusID, "CHAIN_FAILED")
+	}
+	panic(r)
+}
+
+// runChain executes chain elements and returns the run result including elements output
+func runChain(ctx context.Context, chain Chain) *RunResult {
+	defer reportPanic(chain)
+	defer lockExclusiveExecution(chain)()
 	var ChainElements []pgengine.ChainElementExecution
+	chainConfigID, chainID, resumeFrom := chain.ChainExecutionConfigID, chain.ChainID, chain.ResumeFrom
+	result := &RunResult{Status: "CHAIN_FAILED"}
 
 	tx, err := pgengine.StartTransaction(ctx)
 	if err != nil {
 		pgengine.LogToDB("ERROR", fmt.Sprint("Cannot start transaction: ", err))
-		return
+		return result
+	}
+	defer releaseOnPanic(ctx, &tx, chain, result)
+	if !lockChainTransaction(ctx, tx, chain) {
+		pgengine.MustRollbackTransaction(tx)
+		return result
 	}
 
-	pgengine.LogToDB("LOG", fmt.Sprintf("Starting chain ID: %d; configuration ID: %d", chainID, chainConfigID))
+	if resumeFrom != 0 {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Resuming chain ID: %d; configuration ID: %d from element ID: %d", chainID, chainConfigID, resumeFrom))
+	} else {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Starting chain ID: %d; configuration ID: %d", chainID, chainConfigID))
+	}
 
 	if !pgengine.GetChainElements(tx, &ChainElements, chainID) {
 		pgengine.MustRollbackTransaction(tx)
-		return
+		return result
+	}
+	if ChainElements = skipChainElements(ChainElements, resumeFrom); len(ChainElements) == 0 && resumeFrom != 0 {
+		pgengine.MustRollbackTransaction(tx)
+		return result
+	}
+
+	action := shellDisabledAction(ctx, chainConfigID)
+	if action == "SKIP_CHAIN" && hasShellDisabledElements(ChainElements) {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Chain ID: %d skipped, shell tasks are disabled", chainID))
+		pgengine.MustRollbackTransaction(tx)
+		result.RunStatusID = pgengine.InsertChainRunStatus(ctx, chainConfigID, chainID)
+		pgengine.UpdateChainRunStatus(ctx,
+			&pgengine.ChainElementExecution{
+				ChainID:     chainID,
+				ChainConfig: chainConfigID}, result.RunStatusID, "SHELL_DISABLED")
+		result.Status = "SHELL_DISABLED"
+		return result
 	}
 
 	runStatusID := pgengine.InsertChainRunStatus(ctx, chainConfigID, chainID)
+	summary := pgengine.NewRunSummary(runStatusID, chainConfigID, clock.FromContext(ctx).Now())
+	result.RunStatusID = runStatusID
+	run := &pgengine.ChainRun{ChainConfigID: chainConfigID, ChainName: chain.ChainName, RunStatusID: runStatusID,
+		StartedAt: summary.StartedAt, ShellDisabledAction: action, RunbookURL: chain.RunbookURL, Tenant: chain.Tenant}
+	events.Publish(chainEvent(ctx, events.ChainStarted, chain, runStatusID))
+	heartbeat := chainHeartbeat(ctx, chainConfigID)
+	pingHeartbeat(ctx, heartbeat, "/start")
+	defer func() {
+		result.Duration = clock.FromContext(ctx).Now().Sub(summary.StartedAt).Seconds()
+		publishChainFinished(ctx, chain, result, run)
+		pingHeartbeat(ctx, heartbeat, heartbeatSuffix(result))
+		if result.Status == "CHAIN_FAILED" {
+			tripCircuitBreaker(ctx, chain, runStatusID)
+		}
+	}()
 
-	/* now we can loop through every element of the task chain */
-	for _, chainElemExec := range ChainElements {
-		chainElemExec.ChainConfig = chainConfigID
-		pgengine.UpdateChainRunStatus(ctx, &chainElemExec, runStatusID, "STARTED")
-		retCode := executeСhainElement(ctx, tx, &chainElemExec)
-		if retCode != 0 && !chainElemExec.IgnoreError {
-			pgengine.LogToDB("ERROR", fmt.Sprintf("Chain ID: %d failed", chainID))
-			pgengine.UpdateChainRunStatus(ctx, &chainElemExec, runStatusID, "CHAIN_FAILED")
+	for i := range ChainElements {
+		ChainElements[i].ChainConfig = chainConfigID
+		ChainElements[i].Run = run
+	}
+	chainElements, onCommitElements := splitOnCommitElements(ChainElements)
+	executed, ok := executeChainElements(ctx, tx, chainElements, summary, result)
+	if !ok {
+		pgengine.LogToDB("ERROR", fmt.Sprintf("Chain ID: %d failed", chainID)+runbookHint(chain.RunbookURL))
+		pgengine.MustRollbackTransaction(tx)
+		compensateChainElements(ctx, executed, summary, result)
+		pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_FAILED")
+		return result
+	}
+	if !pgengine.MustCommitTransaction(tx) {
+		failed := &pgengine.ChainElementExecution{ChainID: chainID, ChainConfig: chainConfigID}
+		pgengine.UpdateChainRunStatus(ctx, failed, runStatusID, "CHAIN_FAILED")
+		compensateChainElements(ctx, executed, summary, result)
+		pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_FAILED")
+		return result
+	}
+	/* on-commit elements are executed in the new transaction only after the chain transaction committed */
+	if len(onCommitElements) > 0 {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Executing on-commit elements of chain ID: %d; configuration ID: %d", chainID, chainConfigID))
+		if tx, err = pgengine.StartTransaction(ctx); err != nil {
+			pgengine.LogToDB("ERROR", fmt.Sprint("Cannot start transaction: ", err))
+			pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_FAILED")
+			return result
+		}
+		if !lockChainTransaction(ctx, tx, chain) {
 			pgengine.MustRollbackTransaction(tx)
-			return
+			pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_FAILED")
+			return result
+		}
+		if _, ok := executeChainElements(ctx, tx, onCommitElements, summary, result); !ok {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("On-commit elements of chain ID: %d failed", chainID))
+			pgengine.MustRollbackTransaction(tx)
+			pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_FAILED")
+			return result
 		}
-		pgengine.UpdateChainRunStatus(ctx, &chainElemExec, runStatusID, "CHAIN_DONE")
+		pgengine.MustCommitTransaction(tx)
 	}
 	pgengine.LogToDB("LOG", fmt.Sprintf("Executed successfully chain ID: %d; configuration ID: %d", chainID, chainConfigID))
 	pgengine.UpdateChainRunStatus(ctx,
 		&pgengine.ChainElementExecution{
 			ChainID:     chainID,
 			ChainConfig: chainConfigID}, runStatusID, "CHAIN_DONE")
+	pgengine.LogRunSummary(ctx, summary, clock.FromContext(ctx).Now(), "CHAIN_DONE")
+	result.Status = "CHAIN_DONE"
+	return result
+}
+
+// splitOnCommitElements separates elements executed after the chain transaction commit preserving the order
+func splitOnCommitElements(chainElements []pgengine.ChainElementExecution) (elements, onCommit []pgengine.ChainElementExecution) {
+	for _, chainElemExec := range chainElements {
+		if chainElemExec.OnCommit {
+			onCommit = append(onCommit, chainElemExec)
+		} else {
+			elements = append(elements, chainElemExec)
+		}
+	}
+	return
+}
+
+// executeChainElements executes elements within the transaction. Returns successfully executed elements
+// and false if the element without ignore_error failed
+func executeChainElements(ctx context.Context, tx *sqlx.Tx, chainElements []pgengine.ChainElementExecution,
+	summary *pgengine.RunSummary, result *RunResult) (executed []pgengine.ChainElementExecution, ok bool) {
+	/* now we can loop through every element of the task chain */
+	for _, chainElemExec := range chainElements {
+		if isShellDisabled(chainElemExec.Kind) {
+			if !skipShellDisabledElement(ctx, &chainElemExec, result) {
+				pgengine.UpdateChainRunStatus(ctx, &chainElemExec, result.RunStatusID, "CHAIN_FAILED")
+				return executed, false
+			}
+			continue
+		}
+		pgengine.UpdateChainRunStatus(ctx, &chainElemExec, result.RunStatusID, "STARTED")
+		/* wrap element into savepoint, so ignored error doesn't abort the whole chain transaction */
+		savepoint := pgengine.TaskSavepoint(&chainElemExec)
+		if chainElemExec.IgnoreError {
+			pgengine.MustSavepoint(tx, savepoint)
+		}
+		retCode := executeСhainElement(ctx, tx, &chainElemExec)
+		summary.Add(&chainElemExec)
+		result.Outputs = append(result.Outputs, TaskOutput{chainElemExec.ChainID, chainElemExec.TaskName, retCode, chainElemExec.Output})
+		if retCode != 0 && !chainElemExec.IgnoreError {
+			pgengine.UpdateChainRunStatus(ctx, &chainElemExec, result.RunStatusID, "CHAIN_FAILED")
+			return executed, false
+		}
+		if chainElemExec.IgnoreError {
+			if retCode != 0 {
+				pgengine.MustRollbackToSavepoint(tx, savepoint)
+			} else {
+				pgengine.MustReleaseSavepoint(tx, savepoint)
+			}
+		}
+		if retCode == 0 {
+			executed = append(executed, chainElemExec)
+		}
+		pgengine.UpdateChainRunStatus(ctx, &chainElemExec, result.RunStatusID, "CHAIN_DONE")
+	}
+	return executed, true
+}
+
+// compensationOrder returns elements having compensating tasks in reverse order of execution
+func compensationOrder(executed []pgengine.ChainElementExecution) (elements []pgengine.ChainElementExecution) {
+	for i := len(executed) - 1; i >= 0; i-- {
+		if executed[i].CompensateTaskID.Valid {
+			elements = append(elements, executed[i])
+		}
+	}
+	return
+}
+
+// compensateChainElements undoes side effects of executed elements after the chain failure, e.g. created files
+// or HTTP calls, which cannot be rolled back by the transaction. Failed compensations are logged and skipped
+func compensateChainElements(ctx context.Context, executed []pgengine.ChainElementExecution,
+	summary *pgengine.RunSummary, result *RunResult) {
+	elements := compensationOrder(executed)
+	if len(elements) == 0 {
+		return
+	}
+	tx, err := pgengine.StartTransaction(ctx)
+	if err != nil {
+		pgengine.LogToDB("ERROR", fmt.Sprint("Cannot start transaction for compensations: ", err))
+		return
+	}
+	for _, chainElemExec := range elements {
+		compensation, ok := pgengine.GetCompensation(tx, &chainElemExec)
+		if !ok {
+			continue
+		}
+		pgengine.LogToDB("LOG", fmt.Sprintf("Compensating chain element ID: %d with task: %s", chainElemExec.ChainID, compensation.TaskName))
+		savepoint := pgengine.TaskSavepoint(compensation)
+		pgengine.MustSavepoint(tx, savepoint)
+		retCode := executeСhainElement(ctx, tx, compensation)
+		summary.Add(compensation)
+		result.Outputs = append(result.Outputs, TaskOutput{compensation.ChainID, compensation.TaskName, retCode, compensation.Output})
+		if retCode != 0 {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Compensation of chain element ID: %d failed", chainElemExec.ChainID))
+			pgengine.MustRollbackToSavepoint(tx, savepoint)
+		} else {
+			pgengine.MustReleaseSavepoint(tx, savepoint)
+		}
+	}
 	pgengine.MustCommitTransaction(tx)
 }
 
-func executeСhainElement(ctx context.Context, tx *sqlx.Tx, chainElemExec *pgengine.ChainElementExecution) int {
-	var paramValues []string
-	var err error
-	var out []byte
-	var retCode int
+// skipChainElements returns elements starting with the element resumeFrom, all elements returned if resumeFrom is 0.
+// Preceding elements are skipped only if their work was committed by the failed run: the chain transaction is
+// rolled back on failure, so its elements are executed again, and on-commit elements are executed again unless
+// the failed element is the on-commit one, i.e. the chain transaction was committed
+func skipChainElements(chainElements []pgengine.ChainElementExecution, resumeFrom int) []pgengine.ChainElementExecution {
+	if resumeFrom == 0 {
+		return chainElements
+	}
+	for i, failed := range chainElements {
+		if failed.ChainID != resumeFrom {
+			continue
+		}
+		var elements []pgengine.ChainElementExecution
+		for j, chainElemExec := range chainElements {
+			switch {
+			case failed.OnCommit && !chainElemExec.OnCommit:
+				// committed together with the chain transaction
+			case j >= i, chainElemExec.OnCommit && !failed.OnCommit, inChainTransaction(chainElemExec):
+				elements = append(elements, chainElemExec)
+			}
+		}
+		return elements
+	}
+	pgengine.LogToDB("ERROR", fmt.Sprintf("Element ID: %d to resume from not found in the chain", resumeFrom))
+	return nil
+}
 
-	pgengine.LogToDB("DEBUG", fmt.Sprintf("Executing task: %s", chainElemExec))
+// inChainTransaction returns true if the element is executed within the chain transaction, so its work is
+// rolled back together with it. Other kinds, autonomous and remote SQL elements commit their work themselves,
+// except for the Notify builtin sending notifications within the chain transaction
+func inChainTransaction(chainElemExec pgengine.ChainElementExecution) bool {
+	if chainElemExec.Kind == "BUILTIN" {
+		return chainElemExec.TaskName == "Notify"
+	}
+	return chainElemExec.Kind == "SQL" && !chainElemExec.Autonomous && !chainElemExec.DatabaseConnection.Valid
+}
 
-	if !pgengine.GetChainParamValues(tx, &paramValues, chainElemExec) {
-		return -1
+// builtinRun returns the run information passed to the builtin task together with the element executed and
+// its transaction, so builtins may take part in it
+func builtinRun(tx *sqlx.Tx, chainElemExec *pgengine.ChainElementExecution) *pgengine.ChainRun {
+	if chainElemExec.Run == nil {
+		chainElemExec.Run = &pgengine.ChainRun{}
 	}
+	run := chainElemExec.Run
+	run.Tx, run.ElementID, run.TaskName = tx, chainElemExec.ChainID, chainElemExec.TaskName
+	return run
+}
 
-	chainElemExec.StartedAt = time.Now()
+// errShellTasksDisabled is returned by executeTask when shell tasks execution skipped
+var errShellTasksDisabled = errors.New("Shell tasks are disabled")
+
+// executeTask executes task depending on its kind and returns return code, output and error
+func executeTask(ctx context.Context, tx *sqlx.Tx, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (retCode int, out []byte, err error) {
 	switch chainElemExec.Kind {
 	case "SQL":
-		err = pgengine.ExecuteSQLTask(ctx, tx, chainElemExec, paramValues)
+		if chainElemExec.Sink.Valid {
+			err = executeSQLToSink(ctx, tx, chainElemExec, paramValues)
+		} else {
+			err = pgengine.ExecuteSQLTask(ctx, tx, chainElemExec, paramValues)
+		}
 	case "SHELL":
 		if pgengine.NoShellTasks {
 			pgengine.LogToDB("LOG", "Shell task execution skipped: ", chainElemExec)
-			return -1
+			return -1, nil, errShellTasksDisabled
+		}
+		retCode, out, err = executeCommand(withChildPID(ctx, &chainElemExec.ChildPID), chainElemExec, paramValues)
+	case "PROGRAM":
+		if pgengine.NoShellTasks {
+			pgengine.LogToDB("LOG", "Program task execution skipped: ", chainElemExec)
+			return -1, nil, errShellTasksDisabled
+		}
+		retCode, out, err = executeCommand(withChildPID(ctx, &chainElemExec.ChildPID), chainElemExec, paramValues)
+	case "DOCKER":
+		if pgengine.NoShellTasks {
+			pgengine.LogToDB("LOG", "Docker task execution skipped: ", chainElemExec)
+			return -1, nil, errShellTasksDisabled
 		}
-		retCode, out, err = executeShellCommand(ctx, chainElemExec.Script, paramValues)
+		retCode, out, err = executeDocker(ctx, chainElemExec, paramValues)
+	case "K8S_JOB":
+		if pgengine.NoShellTasks {
+			pgengine.LogToDB("LOG", "Kubernetes job execution skipped: ", chainElemExec)
+			return -1, nil, errShellTasksDisabled
+		}
+		retCode, out, err = executeKubernetesJob(ctx, chainElemExec, paramValues)
 	case "BUILTIN":
-		err = tasks.ExecuteTask(chainElemExec.TaskName, paramValues)
+		out, err = tasks.ExecuteTask(ctx, chainElemExec.TaskName, paramValues, builtinRun(tx, chainElemExec))
+	case "HTTP":
+		retCode, out, err = executeHTTPRequest(ctx, chainElemExec, paramValues)
+	default:
+		retCode, out, err = executePlugin(ctx, chainElemExec, paramValues)
+	}
+	return
+}
+
+// executeSQLToSink streams result sets of SQL task to the sink of the element, the sink destination
+// is replaced only if the task succeeded
+func executeSQLToSink(ctx context.Context, tx *sqlx.Tx, chainElemExec *pgengine.ChainElementExecution, paramValues []string) error {
+	sink, err := tasks.OpenSink(chainElemExec.Sink.String)
+	if err != nil {
+		return err
+	}
+	if err = pgengine.ExecuteSQLTaskToSink(ctx, tx, chainElemExec, paramValues, sink); err != nil {
+		sink.Abort()
+		return err
+	}
+	return sink.Close(ctx)
+}
+
+// executeCommand executes SHELL or PROGRAM task with the working directory, umask and stdin of the element
+func executeCommand(ctx context.Context, chainElemExec *pgengine.ChainElementExecution, paramValues []string) (retCode int, out []byte, err error) {
+	opts, err := newCommandOptions(chainElemExec)
+	if err != nil {
+		return -1, nil, err
+	}
+	stdout, stderr := newOutputCapture(chainElemExec, "stdout"), newOutputCapture(chainElemExec, "stderr")
+	opts.Stdout, opts.Stderr = stdout, stderr
+	defer func() {
+		chainElemExec.Stdout, chainElemExec.StdoutFile = stdout.Close()
+		chainElemExec.Stderr, chainElemExec.StderrFile = stderr.Close()
+	}()
+	if chainElemExec.Kind == "PROGRAM" {
+		return executeProgram(ctx, chainElemExec.Script, paramValues, opts)
+	}
+	return executeShellCommand(ctx, chainElemExec.Script, paramValues, opts)
+}
+
+func executeСhainElement(ctx context.Context, tx *sqlx.Tx, chainElemExec *pgengine.ChainElementExecution) int {
+	var paramValues []string
+	var err error
+	var out []byte
+	var retCode int
+
+	pgengine.LogToDB("DEBUG", fmt.Sprintf("Executing task: %s", chainElemExec))
+
+	if !pgengine.GetChainParamValues(ctx, tx, &paramValues, chainElemExec) {
+		return -1
+	}
+
+	chainElemExec.StartedAt = clock.FromContext(ctx).Now()
+	retCode, out, err = executeTask(ctx, tx, chainElemExec, paramValues)
+	if err != nil && chainElemExec.Run != nil {
+		chainElemExec.Run.LastError = fmt.Sprintf("%s: %s", chainElemExec.TaskName, err)
+	}
+	if err == errShellTasksDisabled {
+		return -1
 	}
 
-	chainElemExec.Duration = time.Since(chainElemExec.StartedAt).Microseconds()
-	pgengine.LogChainElementExecution(chainElemExec, retCode, strings.TrimSpace(string(out)))
+	chainElemExec.Duration = clock.FromContext(ctx).Now().Sub(chainElemExec.StartedAt).Microseconds()
+	chainElemExec.OutputBytes = len(out)
+	chainElemExec.Output = strings.TrimSpace(string(out))
+	pgengine.LogChainElementExecution(chainElemExec, retCode, chainElemExec.Output)
+	publishElementFinished(ctx, chainElemExec, retCode, err)
 
 	if err != nil {
-		pgengine.LogToDB("ERROR", fmt.Sprintf("Task execution failed: %s; Error: %s", chainElemExec, err))
+		pgengine.LogToDB("ERROR", "Task execution failed: ", chainElemExec, "; Error: ", err,
+			runbookHint(taskRunbookURL(chainElemExec)))
 		if retCode != 0 {
 			return retCode
 		}
@@ -2,19 +2,26 @@ package scheduler
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 	"github.com/stretchr/testify/assert"
 )
 
 type testCommander struct{}
 
 // overwrite CombinedOutput function of os/exec so only parameter syntax and return codes are checked...
-func (c testCommander) CombinedOutput(ctx context.Context, command string, args ...string) ([]byte, error) {
+func (c testCommander) CombinedOutput(ctx context.Context, opts commandOptions, command string, args ...string) ([]byte, error) {
 	if strings.HasPrefix(command, "ping") {
 		return []byte(fmt.Sprint(command, args)), nil
 	}
@@ -29,35 +36,234 @@ func TestShellCommand(t *testing.T) {
 
 	ctx := context.Background()
 
-	_, _, err = executeShellCommand(ctx, "", []string{""})
+	_, _, err = executeShellCommand(ctx, "", []string{""}, commandOptions{})
 	assert.EqualError(t, err, "Shell command cannot be empty", "Empty command should out, fail")
 
-	_, out, err = executeShellCommand(ctx, "ping0", nil)
+	_, out, err = executeShellCommand(ctx, "ping0", nil, commandOptions{})
 	assert.NoError(t, err, "Command with nil param is out, OK")
 	assert.True(t, strings.HasPrefix(string(out), "ping0"), "Output should containt only command ")
 
-	_, _, err = executeShellCommand(ctx, "ping1", []string{})
+	_, _, err = executeShellCommand(ctx, "ping1", []string{}, commandOptions{})
 	assert.NoError(t, err, "Command with empty array param is OK")
 
-	_, _, err = executeShellCommand(ctx, "ping2", []string{""})
+	_, _, err = executeShellCommand(ctx, "ping2", []string{""}, commandOptions{})
 	assert.NoError(t, err, "Command with empty string param is OK")
 
-	_, _, err = executeShellCommand(ctx, "ping3", []string{"[]"})
+	_, _, err = executeShellCommand(ctx, "ping3", []string{"[]"}, commandOptions{})
 	assert.NoError(t, err, "Command with empty json array param is OK")
 
-	_, _, err = executeShellCommand(ctx, "ping3", []string{"[null]"})
+	_, _, err = executeShellCommand(ctx, "ping3", []string{"[null]"}, commandOptions{})
 	assert.NoError(t, err, "Command with nil array param is OK")
 
-	_, _, err = executeShellCommand(ctx, "ping4", []string{`["localhost"]`})
+	_, _, err = executeShellCommand(ctx, "ping4", []string{`["localhost"]`}, commandOptions{})
 	assert.NoError(t, err, "Command with one param is OK")
 
-	_, _, err = executeShellCommand(ctx, "ping5", []string{`["localhost", "-4"]`})
+	_, _, err = executeShellCommand(ctx, "ping5", []string{`["localhost", "-4"]`}, commandOptions{})
 	assert.NoError(t, err, "Command with many params is OK")
 
-	_, _, err = executeShellCommand(ctx, "pong", nil)
+	_, _, err = executeShellCommand(ctx, "pong", nil, commandOptions{})
 	assert.IsType(t, (*exec.Error)(nil), err, "Uknown command should produce error")
 
-	retCode, _, err = executeShellCommand(ctx, "ping5", []string{`{"param1": "localhost"}`})
+	retCode, _, err = executeShellCommand(ctx, "ping5", []string{`{"param1": "localhost"}`}, commandOptions{})
 	assert.IsType(t, (*json.UnmarshalTypeError)(nil), err, "Command should fail with mailformed json parameter")
 	assert.NotEqual(t, 0, retCode, "return code should indicate failure.")
 }
+
+func TestProgram(t *testing.T) {
+	cmd = testCommander{}
+	ctx := context.Background()
+
+	_, out, err := executeProgram(ctx, `["ping", "-c", "1"]`, []string{`["localhost"]`, ""}, commandOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "ping[-c 1]", string(out), "Program arguments should precede parameters")
+	_, out, err = executeProgram(ctx, `["ping", "-c", "1"]`, []string{`["$(reboot)"; "localhost"]`}, commandOptions{})
+	assert.Error(t, err, "Malformed parameters should fail")
+	assert.Empty(t, out)
+	_, out, _ = executeProgram(ctx, `["ping", "a b"]`, []string{`["$HOME; rm -rf /"]`}, commandOptions{})
+	assert.Equal(t, "ping[a b $HOME; rm -rf /]", string(out), "Arguments should be passed as is")
+
+	_, _, err = executeProgram(ctx, `ping -c 1`, nil, commandOptions{})
+	assert.Error(t, err, "Script should be JSON array")
+	_, _, err = executeProgram(ctx, `[]`, nil, commandOptions{})
+	assert.EqualError(t, err, "Program cannot be empty")
+	_, _, err = executeProgram(ctx, `["ping", null]`, nil, commandOptions{})
+	assert.EqualError(t, err, "Program script must be JSON array of strings: Argument 1 cannot be null")
+	_, _, err = executeProgram(ctx, `["ping"]`, []string{`[null]`}, commandOptions{})
+	assert.EqualError(t, err, "Program parameters must be JSON array of strings: Argument 0 cannot be null")
+	retCode, _, err := executeProgram(ctx, `["pong"]`, nil, commandOptions{})
+	assert.IsType(t, (*exec.Error)(nil), err, "Unknown program should produce error")
+	assert.NotEqual(t, 0, retCode)
+}
+
+func TestCommandOptions(t *testing.T) {
+	opts, err := newCommandOptions(&pgengine.ChainElementExecution{})
+	assert.NoError(t, err)
+	assert.Equal(t, commandOptions{}, opts, "Umask should be kept by default")
+	opts, err = newCommandOptions(&pgengine.ChainElementExecution{
+		WorkDir: sql.NullString{String: "/tmp", Valid: true},
+		Umask:   sql.NullString{String: "027", Valid: true},
+		Stdin:   sql.NullString{String: "foo", Valid: true}})
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp", opts.WorkDir)
+	assert.Equal(t, "foo", opts.Stdin)
+	if assert.NotNil(t, opts.Umask) {
+		assert.Equal(t, 027, *opts.Umask)
+	}
+	for _, umask := range []string{"8", "10000", "-1", "u=rwx"} {
+		_, err = newCommandOptions(&pgengine.ChainElementExecution{Umask: sql.NullString{String: umask, Valid: true}})
+		assert.EqualError(t, err, "Invalid umask: "+umask)
+	}
+}
+
+func TestRealCommanderOptions(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is not available")
+	}
+	out, err := realCommander{}.CombinedOutput(context.Background(), commandOptions{Stdin: "hello"}, "cat")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(out), "Stdin should be passed to the command")
+	dir, err := ioutil.TempDir("", "workdir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644))
+	out, err = realCommander{}.CombinedOutput(context.Background(), commandOptions{WorkDir: dir}, "cat", "file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(out), "Relative path should be resolved against the working directory")
+}
+
+func TestAffinityAllows(t *testing.T) {
+	pgengine.ClientName = "worker01"
+	connected := func(string) bool { return true }
+	gone := func(string) bool { return false }
+	affinity := func(mode, last string, failoverDue bool) pgengine.ChainAffinity {
+		return pgengine.ChainAffinity{
+			Affinity:    sql.NullString{String: mode, Valid: mode != ""},
+			LastClient:  sql.NullString{String: last, Valid: last != ""},
+			FailoverDue: failoverDue}
+	}
+	assert.True(t, affinityAllows(affinity("", "worker02", false), connected), "Chain without affinity runs anywhere")
+	assert.True(t, affinityAllows(affinity("REQUIRE", "", false), connected), "Chain never executed runs anywhere")
+	assert.True(t, affinityAllows(affinity("REQUIRE", "worker01", false), connected), "The last client runs the chain")
+	assert.False(t, affinityAllows(affinity("PREFER", "worker02", false), connected))
+	assert.True(t, affinityAllows(affinity("PREFER", "worker02", false), gone), "Should fail over if the last client is gone")
+	assert.False(t, affinityAllows(affinity("REQUIRE", "worker02", true), connected))
+	assert.False(t, affinityAllows(affinity("REQUIRE", "worker02", false), gone), "Should wait for the last client")
+	assert.True(t, affinityAllows(affinity("REQUIRE", "worker02", true), gone), "Should fail over after affinity_failover")
+}
+
+func TestSkipChainElements(t *testing.T) {
+	elements := []pgengine.ChainElementExecution{{ChainID: 1}, {ChainID: 2}, {ChainID: 3}}
+	assert.Equal(t, elements, skipChainElements(elements, 0), "All elements should be returned for the new run")
+	assert.Equal(t, elements[1:], skipChainElements(elements, 2), "Elements starting with the failed one should be returned")
+	assert.Empty(t, skipChainElements(elements, 42), "No elements should be returned for unknown element")
+
+	remote := sql.NullString{String: "remote", Valid: true}
+	elements = []pgengine.ChainElementExecution{
+		{ChainID: 1, Kind: "SQL"},
+		{ChainID: 2, Kind: "SHELL"},
+		{ChainID: 3, Kind: "SQL", Autonomous: true},
+		{ChainID: 4, Kind: "SQL", DatabaseConnection: remote},
+		{ChainID: 5, Kind: "SQL", OnCommit: true},
+		{ChainID: 6, Kind: "SQL"},
+		{ChainID: 7, Kind: "SQL", OnCommit: true}}
+	ids := func(elements []pgengine.ChainElementExecution) (ids []int) {
+		for _, e := range elements {
+			ids = append(ids, e.ChainID)
+		}
+		return
+	}
+	assert.Equal(t, []int{1, 5, 6, 7}, ids(skipChainElements(elements, 6)),
+		"Rolled back and not executed on-commit elements preceding the failed one should be executed again")
+	assert.Equal(t, []int{5, 7}, ids(skipChainElements(elements, 7)),
+		"Elements committed with the chain transaction should be skipped if on-commit element failed")
+
+	elements = []pgengine.ChainElementExecution{
+		{ChainID: 1, Kind: "BUILTIN", TaskName: "Notify"},
+		{ChainID: 2, Kind: "BUILTIN", TaskName: "SendMail"},
+		{ChainID: 3, Kind: "SQL"}}
+	assert.Equal(t, []int{1, 3}, ids(skipChainElements(elements, 3)),
+		"Notifications sent within the rolled back chain transaction should be sent again")
+}
+
+func TestSplitOnCommitElements(t *testing.T) {
+	elements := []pgengine.ChainElementExecution{{ChainID: 1, OnCommit: true}, {ChainID: 2}, {ChainID: 3, OnCommit: true}, {ChainID: 4}}
+	main, onCommit := splitOnCommitElements(elements)
+	assert.Equal(t, []pgengine.ChainElementExecution{elements[1], elements[3]}, main)
+	assert.Equal(t, []pgengine.ChainElementExecution{elements[0], elements[2]}, onCommit, "On-commit elements should preserve order")
+	main, onCommit = splitOnCommitElements(elements[1:2])
+	assert.Len(t, main, 1)
+	assert.Empty(t, onCommit)
+}
+
+func TestCompensationOrder(t *testing.T) {
+	comp := sql.NullInt64{Int64: 42, Valid: true}
+	executed := []pgengine.ChainElementExecution{{ChainID: 1, CompensateTaskID: comp}, {ChainID: 2}, {ChainID: 3, CompensateTaskID: comp}}
+	assert.Equal(t, []pgengine.ChainElementExecution{executed[2], executed[0]}, compensationOrder(executed),
+		"Elements with compensation should be returned in reverse order")
+	assert.Empty(t, compensationOrder(executed[1:2]))
+	assert.Empty(t, compensationOrder(nil))
+}
+
+func TestChainDestruct(t *testing.T) {
+	chain := Chain{ChainExecutionConfigID: 42, SelfDestruct: true, SelfDestructMode: "ON_SUCCESS"}
+	assert.False(t, chain.destruct(context.Background(), false),
+		"Failed chain should be preserved and executed again in ON_SUCCESS mode")
+}
+
+func TestSetDebug(t *testing.T) {
+	defer SetDebug(false)
+	SetDebug(true)
+	assert.Equal(t, debugRefetchTimeout, refetchTimeout)
+	SetDebug(false)
+	assert.Equal(t, defaultRefetchTimeout, refetchTimeout)
+}
+
+func TestFilterDueChains(t *testing.T) {
+	chains := []Chain{
+		{ChainExecutionConfigID: 1, ScheduleEngine: "cron", Schedule: "0 * * * *"},
+		{ChainExecutionConfigID: 2, ScheduleEngine: "cron", Schedule: "30 * * * *"},
+		{ChainExecutionConfigID: 3, ScheduleEngine: "unknown", Schedule: "0 * * * *"},
+		{ChainExecutionConfigID: 4, ScheduleEngine: "cron", Schedule: "bad"},
+	}
+	due := filterDueChains(chains, time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC))
+	assert.Equal(t, chains[:1], due, "Only chains due with known engine and valid schedule should be returned")
+}
+
+func TestChildPID(t *testing.T) {
+	var pid int
+	_, err := realCommander{}.CombinedOutput(withChildPID(context.Background(), &pid), commandOptions{}, "sh", "-c", "true")
+	assert.NoError(t, err)
+	assert.NotZero(t, pid, "Process ID of the shell command should be recorded")
+	assert.NotPanics(t, func() { setChildPID(context.Background(), 42) }, "Process ID may be ignored")
+}
+
+func TestRunbookURL(t *testing.T) {
+	chain := Chain{ChainExecutionConfigID: 1, ChainName: "export", Description: "Nightly export", RunbookURL: "https://wiki/export"}
+	e := chainEvent(context.Background(), events.ChainFailed, chain, 42)
+	assert.Equal(t, "Nightly export", e.Description)
+	assert.Equal(t, "https://wiki/export", e.RunbookURL)
+
+	run := &pgengine.ChainRun{RunbookURL: chain.RunbookURL}
+	element := &pgengine.ChainElementExecution{Run: run}
+	assert.Equal(t, "https://wiki/export", taskRunbookURL(element), "Task without runbook should use the chain one")
+	element.RunbookURL = sql.NullString{String: "https://wiki/upload", Valid: true}
+	assert.Equal(t, "https://wiki/upload", taskRunbookURL(element))
+
+	assert.Equal(t, "", runbookHint(""))
+	assert.Equal(t, "; Runbook: https://wiki/upload", runbookHint("https://wiki/upload"))
+}
+
+func TestReportPanic(t *testing.T) {
+	var reported interface{}
+	OnPanic = func(chain Chain, r interface{}, stack []byte) {
+		assert.Equal(t, "panicking", chain.ChainName)
+		assert.NotEmpty(t, stack)
+		reported = r
+	}
+	defer func() { OnPanic = nil }()
+	assert.PanicsWithValue(t, "boom", func() {
+		defer reportPanic(Chain{ChainName: "panicking"})
+		panic("boom")
+	}, "Panic should be propagated after reporting")
+	assert.Equal(t, "boom", reported)
+}
@@ -1,30 +1,90 @@
 package scheduler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 )
 
+// commandOptions describes the environment of SHELL and PROGRAM tasks
+type commandOptions struct {
+	WorkDir string
+	Umask   *int // nil keeps the umask of pg_timetable
+	Stdin   string
+	// Stdout and Stderr receive streams of the command besides the combined output, nil if not captured
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// newCommandOptions returns options of the chain element, umask is octal, e.g. "027"
+func newCommandOptions(chainElemExec *pgengine.ChainElementExecution) (opts commandOptions, err error) {
+	opts.WorkDir = chainElemExec.WorkDir.String
+	opts.Stdin = chainElemExec.Stdin.String
+	if chainElemExec.Umask.Valid {
+		umask, err := strconv.ParseUint(chainElemExec.Umask.String, 8, 32)
+		if err != nil || umask > 0777 {
+			return opts, fmt.Errorf("Invalid umask: %s", chainElemExec.Umask.String)
+		}
+		mask := int(umask)
+		opts.Umask = &mask
+	}
+	return
+}
+
 type commander interface {
-	CombinedOutput(context.Context, string, ...string) ([]byte, error)
+	CombinedOutput(context.Context, commandOptions, string, ...string) ([]byte, error)
 }
 
 type realCommander struct{}
 
-func (c realCommander) CombinedOutput(ctx context.Context, command string, args ...string) ([]byte, error) {
-	return exec.CommandContext(ctx, command, args...).CombinedOutput()
+func (c realCommander) CombinedOutput(ctx context.Context, opts commandOptions, command string, args ...string) ([]byte, error) {
+	proc := exec.CommandContext(ctx, command, args...)
+	proc.Dir = opts.WorkDir
+	if opts.Stdin != "" {
+		proc.Stdin = strings.NewReader(opts.Stdin)
+	}
+	var out bytes.Buffer
+	proc.Stdout = &out
+	proc.Stderr = &out
+	if opts.Stdout != nil && opts.Stderr != nil {
+		var mu sync.Mutex
+		proc.Stdout = streamWriter{&mu, &out, opts.Stdout}
+		proc.Stderr = streamWriter{&mu, &out, opts.Stderr}
+	}
+	if err := startWithUmask(proc, opts.Umask); err != nil {
+		return nil, err
+	}
+	setChildPID(ctx, proc.Process.Pid)
+	err := proc.Wait()
+	return out.Bytes(), err
+}
+
+type childPIDKey struct{}
+
+// withChildPID returns the context storing the process ID of the shell command executed with it to pid
+func withChildPID(ctx context.Context, pid *int) context.Context {
+	return context.WithValue(ctx, childPIDKey{}, pid)
+}
+
+func setChildPID(ctx context.Context, pid int) {
+	if p, ok := ctx.Value(childPIDKey{}).(*int); ok {
+		*p = pid
+	}
 }
 
 var cmd commander
 
-// ExecuteTask executes built-in task depending on task name and returns err result
-func executeShellCommand(ctx context.Context, command string, paramValues []string) (code int, out []byte, err error) {
+// executeShellCommand executes command once for every parameter value containing JSON array of arguments
+func executeShellCommand(ctx context.Context, command string, paramValues []string, opts commandOptions) (code int, out []byte, err error) {
 
 	if strings.TrimSpace(command) == "" {
 		return -1, []byte{}, errors.New("Shell command cannot be empty")
@@ -32,6 +92,7 @@ func executeShellCommand(ctx context.Context, command string, paramValues []stri
 	if len(paramValues) == 0 { //mimic empty param
 		paramValues = []string{""}
 	}
+	argsList := make([][]string, 0, len(paramValues))
 	for _, val := range paramValues {
 		params := []string{}
 		if val > "" {
@@ -39,8 +100,17 @@ func executeShellCommand(ctx context.Context, command string, paramValues []stri
 				return -1, []byte{}, err
 			}
 		}
-		out, err = cmd.CombinedOutput(ctx, command, params...) // #nosec
-		cmdLine := fmt.Sprintf("%s %v: ", command, params)
+		argsList = append(argsList, params)
+	}
+	return runCommand(ctx, []string{command}, argsList, opts)
+}
+
+// runCommand executes argv once for every arguments list appended, stops on the first failure
+func runCommand(ctx context.Context, argv []string, argsList [][]string, opts commandOptions) (code int, out []byte, err error) {
+	for _, args := range argsList {
+		params := append(append([]string{}, argv[1:]...), args...)
+		out, err = cmd.CombinedOutput(ctx, opts, argv[0], params...) // #nosec
+		cmdLine := fmt.Sprintf("%s %v: ", argv[0], params)
 		if len(out) > 0 {
 			pgengine.LogToDB("DEBUG", "Output for command ", cmdLine, string(out))
 		}
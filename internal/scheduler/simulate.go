@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
+)
+
+// SimulatedRun is the run of the chain the scheduler would start during the simulation
+type SimulatedRun struct {
+	At    time.Time
+	Chain string
+	RunAt string
+}
+
+type simulatedChain struct {
+	pgengine.ChainDefinition
+	cron     schedule.Schedule
+	interval *IntervalChain
+	due      <-chan time.Time
+}
+
+var intervalUnits = map[string]time.Duration{
+	"second": time.Second,
+	"sec":    time.Second,
+	"minute": time.Minute,
+	"min":    time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour}
+
+// parseInterval parses PostgreSQL interval used by @every and @after chains, e.g. "1 hour 30 minutes" or "01:30:00"
+func parseInterval(s string) (time.Duration, error) {
+	var d time.Duration
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Invalid interval: %s", s)
+	}
+	for i := 0; i < len(fields); i++ {
+		var h, m, sec int
+		if n, err := fmt.Sscanf(fields[i], "%d:%d:%d", &h, &m, &sec); err == nil && n == 3 {
+			d += time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+			continue
+		}
+		n, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || i+1 == len(fields) {
+			return 0, fmt.Errorf("Invalid interval: %s", s)
+		}
+		i++
+		unit, ok := intervalUnits[strings.TrimSuffix(fields[i], "s")]
+		if !ok {
+			return 0, fmt.Errorf("Invalid interval: %s", s)
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	return d, nil
+}
+
+func newSimulatedChain(c clock.Clock, chain pgengine.ChainDefinition) (sc simulatedChain, err error) {
+	sc.ChainDefinition = chain
+	switch runAt := strings.TrimSpace(chain.RunAt); {
+	case runAt == "@reboot":
+	case strings.HasPrefix(runAt, "@every"), strings.HasPrefix(runAt, "@after"):
+		d, err := parseInterval(runAt[6:])
+		if err != nil {
+			return sc, err
+		}
+		if d < time.Second {
+			return sc, fmt.Errorf("Interval of chain %s is less than a second", chain.Name)
+		}
+		sc.interval = &IntervalChain{Interval: int(d / time.Second), RepeatAfter: strings.HasPrefix(runAt, "@after")}
+		// interval chains are executed as soon as the scheduler fetches them
+		sc.due = c.After(0)
+	case runAt == "":
+		sc.cron, err = schedule.ParseCron("* * * * *")
+	default:
+		sc.cron, err = schedule.ParseCron(runAt)
+	}
+	return sc, err
+}
+
+// simulateRuns advances the fake clock second by second over the period and returns runs of live chains.
+// Interval chains wait for the timers of the clock the same way as scheduled by workers, @after chains are
+// considered finished at once, since durations of runs are not known in advance
+func simulateRuns(c *clock.Fake, chains []pgengine.ChainDefinition, period time.Duration) ([]SimulatedRun, error) {
+	var (
+		runs      []SimulatedRun
+		simulated []simulatedChain
+	)
+	for _, chain := range chains {
+		if !chain.Live {
+			continue
+		}
+		sc, err := newSimulatedChain(c, chain)
+		if err != nil {
+			return nil, err
+		}
+		if sc.cron == nil && sc.interval == nil {
+			runs = append(runs, SimulatedRun{c.Now(), chain.Name, chain.RunAt})
+			continue
+		}
+		simulated = append(simulated, sc)
+	}
+	for end := c.Now().Add(period); c.Now().Before(end); c.Advance(time.Second) {
+		now := c.Now()
+		for i, sc := range simulated {
+			if sc.cron != nil {
+				if now.Second() == 0 && sc.cron.IsDue(now) {
+					runs = append(runs, SimulatedRun{now, sc.Name, sc.RunAt})
+				}
+				continue
+			}
+			select {
+			case <-sc.due:
+				runs = append(runs, SimulatedRun{now, sc.Name, sc.RunAt})
+				simulated[i].due = c.After(sc.interval.delay(now))
+			default:
+			}
+		}
+	}
+	return runs, nil
+}
+
+// Simulate prints runs of live chains from the definition file the scheduler would start during the period,
+// e.g. "1 day", without executing them. Time is simulated by the fake clock, so the period passes at once
+func Simulate(ctx context.Context, w io.Writer, filename string, period string) bool {
+	chains, err := pgengine.ReadChainDefinitions(filename)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read chain definitions: ", err)
+		return false
+	}
+	d, err := parseInterval(period)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot parse simulation period: ", err)
+		return false
+	}
+	runs, err := simulateRuns(clock.NewFake(clock.FromContext(ctx).Now().Truncate(time.Minute)), chains, d)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot simulate chains: ", err)
+		return false
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tCHAIN\tRUN_AT")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", run.At.Format("2006-01-02 15:04:05"), run.Chain, run.RunAt)
+	}
+	return tw.Flush() == nil
+}
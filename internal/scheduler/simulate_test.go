@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterval(t *testing.T) {
+	for s, d := range map[string]time.Duration{
+		"5 minutes":         5 * time.Minute,
+		"1 hour 30 minutes": 90 * time.Minute,
+		"01:30:00":          90 * time.Minute,
+		"1 day 00:00:30":    24*time.Hour + 30*time.Second,
+		"0.5 hours":         30 * time.Minute} {
+		actual, err := parseInterval(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, d, actual, s)
+	}
+	for _, s := range []string{"", "5", "5 fortnights", "soon"} {
+		_, err := parseInterval(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSimulateRuns(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	chains := []pgengine.ChainDefinition{
+		{Name: "reboot", RunAt: "@reboot", Live: true},
+		{Name: "every", RunAt: "@every 20 minutes", Live: true},
+		{Name: "hourly", RunAt: "30 * * * *", Live: true},
+		{Name: "disabled", RunAt: "* * * * *"}}
+	runs, err := simulateRuns(clock.NewFake(start), chains, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []SimulatedRun{
+		{start, "reboot", "@reboot"},
+		{start, "every", "@every 20 minutes"},
+		{start.Add(20 * time.Minute), "every", "@every 20 minutes"},
+		{start.Add(30 * time.Minute), "hourly", "30 * * * *"},
+		{start.Add(40 * time.Minute), "every", "@every 20 minutes"}}, runs)
+
+	_, err = simulateRuns(clock.NewFake(start), []pgengine.ChainDefinition{{Name: "broken", RunAt: "61 * * * *", Live: true}}, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestSimulate(t *testing.T) {
+	f, err := ioutil.TempFile("", "chains*.json")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`[{"name": "nightly", "run_at": "0 3 * * *", "live": true, "tasks": [{"name": "NoOp", "kind": "BUILTIN"}]}]`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	ctx := clock.WithClock(context.Background(), clock.NewFake(time.Date(2020, 1, 1, 12, 0, 30, 0, time.UTC)))
+	var b bytes.Buffer
+	assert.True(t, Simulate(ctx, &b, f.Name(), "2 days"))
+	assert.Equal(t, []string{"TIME                 CHAIN    RUN_AT",
+		"2020-01-02 03:00:00  nightly  0 3 * * *",
+		"2020-01-03 03:00:00  nightly  0 3 * * *"}, strings.Split(strings.TrimSpace(b.String()), "\n"))
+
+	assert.False(t, Simulate(ctx, &b, f.Name(), "forever"), "Invalid period should fail")
+	assert.False(t, Simulate(ctx, &b, "non-existent.json", "1 day"), "Non-existent file should fail")
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/schedule"
+)
+
+// missedStartWindow is how far back scheduled runs are checked, so runs are not missed between main loop iterations
+const missedStartWindow = 2 * defaultRefetchTimeout * time.Second
+
+// checkSLA records and alerts runs exceeding max_duration and scheduled runs not started within max_start_delay
+func checkSLA(ctx context.Context) {
+	violations, err := pgengine.RecordOverruns(ctx)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not check chain durations: ", err)
+	}
+	for _, v := range violations {
+		alertSLA(ctx, v.ChainConfig, v.ChainName, v.RunStatusID, fmt.Sprintf("Chain %s run %d exceeds max_duration of %.0f s",
+			v.ChainName, *v.RunStatusID, v.Limit))
+	}
+	slaChains, err := pgengine.GetSLAChains(ctx)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Could not check chain starts: ", err)
+		return
+	}
+	now := clock.FromContext(ctx).Now()
+	for _, c := range slaChains {
+		delay := time.Duration(c.MaxStartDelay * float64(time.Second))
+		for _, scheduled := range missedStarts(slaSchedule(c), delay, now) {
+			recorded, err := pgengine.RecordMissedStart(ctx, c.ChainConfig, scheduled)
+			if err != nil {
+				pgengine.LogToDB("ERROR", "Could not record missed start: ", err)
+				continue
+			}
+			if recorded {
+				alertSLA(ctx, c.ChainConfig, c.ChainName, nil, fmt.Sprintf("Chain %s scheduled at %s was not started within %.0f s",
+					c.ChainName, scheduled.Format(time.RFC3339), c.MaxStartDelay))
+			}
+		}
+	}
+}
+
+// slaSchedule returns the calendar schedule of the chain, nil if the schedule has no fire times, e.g. @every
+func slaSchedule(c pgengine.SLAChain) schedule.Schedule {
+	engine, expr := "cron", c.RunAt
+	if c.ScheduleEngine != nil {
+		engine, expr = *c.ScheduleEngine, c.Schedule
+	}
+	if expr == nil {
+		return nil
+	}
+	s, err := schedule.Parse(engine, *expr)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// missedStarts returns fire times of the schedule which should have been started by now considering the delay
+func missedStarts(s schedule.Schedule, delay time.Duration, now time.Time) (due []time.Time) {
+	if s == nil {
+		return nil
+	}
+	deadline := now.Add(-delay)
+	for t := s.Next(deadline.Add(-missedStartWindow)); !t.IsZero() && !t.After(deadline); t = s.Next(t) {
+		due = append(due, t)
+	}
+	return
+}
+
+// alertSLA logs the violation with ALERT level and publishes SLA_VIOLATED event
+func alertSLA(ctx context.Context, chainConfigID int, chainName string, runStatusID *int, msg string) {
+	pgengine.LogToDB("ALERT", msg)
+	e := events.Event{
+		Kind:        events.SLAViolated,
+		Time:        clock.FromContext(ctx).Now(),
+		ClientName:  pgengine.ClientName,
+		ChainConfig: chainConfigID,
+		ChainName:   chainName,
+		Error:       msg}
+	if runStatusID != nil {
+		e.RunStatusID = *runStatusID
+	}
+	events.Publish(e)
+}
@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissedStarts(t *testing.T) {
+	hourly := "0 * * * *"
+	s := slaSchedule(pgengine.SLAChain{RunAt: &hourly})
+	now := time.Date(2021, 1, 1, 10, 5, 0, 0, time.UTC)
+	assert.Equal(t, []time.Time{time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)}, missedStarts(s, 5*time.Minute, now))
+	assert.Empty(t, missedStarts(s, 10*time.Minute, now), "Run should not be missed until the delay is over")
+	assert.Empty(t, missedStarts(s, 5*time.Minute, now.Add(missedStartWindow)), "Runs beyond the window are checked already")
+
+	every := "@every 1 minute"
+	assert.Nil(t, slaSchedule(pgengine.SLAChain{RunAt: &every}), "Interval chains have no start times")
+	assert.Empty(t, missedStarts(nil, time.Minute, now))
+	engine, rrule := "rrule", "DTSTART:20210101T100000Z RRULE:FREQ=MINUTELY;INTERVAL=1"
+	s = slaSchedule(pgengine.SLAChain{ScheduleEngine: &engine, Schedule: &rrule})
+	assert.Len(t, missedStarts(s, time.Minute, now), 2*defaultRefetchTimeout/60)
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// TaskOutput describes the result of the chain element executed within the run
+type TaskOutput struct {
+	ChainID    int    `json:"chain_id"`
+	TaskName   string `json:"task_name"`
+	ReturnCode int    `json:"returncode"`
+	Output     string `json:"output,omitempty"`
+}
+
+// RunResult describes the finished chain run
+type RunResult struct {
+	RunStatusID int          `json:"run_status"`
+	Status      string       `json:"status"`
+	Duration    float64      `json:"duration"` // in seconds
+	Outputs     []TaskOutput `json:"outputs"`
+}
+
+// Success returns true if the run finished with CHAIN_DONE status
+func (r *RunResult) Success() bool {
+	return r.Status == "CHAIN_DONE"
+}
+
+var (
+	// ErrChainNotFound is returned if there is no chain with such id available for the client
+	ErrChainNotFound = errors.New("Chain not found")
+	// ErrChainBusy is returned if the chain cannot be triggered due to max_instances
+	ErrChainBusy = errors.New("Maximum number of chain instances is running")
+	// ErrQuotaExceeded is returned if the tenant owning the chain exceeded its quota
+	ErrQuotaExceeded = errors.New("Chain tenant quota exceeded")
+	// ErrChainAffinity is returned if the chain is bound to another client by its affinity
+	ErrChainAffinity = errors.New("Chain is bound to another client")
+	// ErrChainExcluded is returned if the chain is listed in the exclusion file of the client
+	ErrChainExcluded = errors.New("Chain is excluded on this client")
+	// ErrStandby is returned if the client is connected to the standby server
+	ErrStandby = errors.New("Chains cannot be executed on the standby server")
+	// ErrChainWindow is returned if the chain is triggered outside of its execution window
+	ErrChainWindow = errors.New("Chain is triggered outside of its execution window")
+)
+
+//Select chain by id with proper client_name and client_group values, live status is ignored for triggered chains
+const sqlSelectChainByID = `
+SELECT
+	chain_execution_config, chain_id, chain_name, self_destruct, self_destruct_mode, exclusive_execution, 
+	COALESCE(description, '') AS description, COALESCE(runbook_url, '') AS runbook_url,
+	COALESCE(max_instances, 16) as max_instances, tenant
+FROM 
+	timetable.chain_execution_config 
+WHERE 
+	chain_execution_config = $1 AND (client_name = $2 or client_name IS NULL) AND (client_group IS NULL OR client_group = $3)`
+
+// GetChain returns chain by its chain_execution_config id
+func GetChain(ctx context.Context, chainConfigID int) (chain Chain, err error) {
+	err = pgengine.ConfigDb.GetContext(ctx, &chain, pgengine.SchemaSQL(sqlSelectChainByID), chainConfigID, pgengine.ClientName, pgengine.ClientGroup)
+	if err == sql.ErrNoRows {
+		err = ErrChainNotFound
+	}
+	return
+}
+
+// RunChain executes the chain outside of its schedule and waits for the result
+func RunChain(ctx context.Context, chain Chain) (*RunResult, error) {
+	if pgengine.InRecovery() {
+		return nil, ErrStandby
+	}
+	if isChainExcluded(chain) {
+		return nil, ErrChainExcluded
+	}
+	if !checkChainWindow(ctx, chain) {
+		return nil, ErrChainWindow
+	}
+	if !pgengine.CanProceedChainExecution(ctx, chain.ChainExecutionConfigID, chain.MaxInstances) {
+		return nil, ErrChainBusy
+	}
+	if !checkChainAffinity(ctx, chain) {
+		return nil, ErrChainAffinity
+	}
+	if !pgengine.CheckChainQuota(ctx, chain.ChainExecutionConfigID, chain.ChainID) {
+		return nil, ErrQuotaExceeded
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Triggered chain %s", chain))
+	result := runChain(ctx, chain)
+	if chain.SelfDestruct {
+		chain.destruct(ctx, result.Success())
+	}
+	return result, nil
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+var umaskMutex sync.Mutex
+
+// startWithUmask starts the command with the file mode creation mask set. Umask is the attribute of
+// the process inherited by the child, so it is changed only while the command is being started
+func startWithUmask(c *exec.Cmd, umask *int) error {
+	if umask == nil {
+		return c.Start()
+	}
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	old := syscall.Umask(*umask)
+	defer syscall.Umask(old)
+	return c.Start()
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartWithUmask(t *testing.T) {
+	if _, err := exec.LookPath("touch"); err != nil {
+		t.Skip("touch is not available")
+	}
+	dir, err := ioutil.TempDir("", "umask")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	umask := 077
+	_, err = realCommander{}.CombinedOutput(context.Background(), commandOptions{WorkDir: dir, Umask: &umask}, "touch", "private")
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, "private"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "File should be created with umask of the task")
+	}
+}
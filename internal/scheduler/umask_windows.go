@@ -0,0 +1,14 @@
+package scheduler
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// startWithUmask starts the command, umask is not available on Windows
+func startWithUmask(c *exec.Cmd, umask *int) error {
+	if umask != nil {
+		return errors.New("Umask is not supported on Windows")
+	}
+	return c.Start()
+}
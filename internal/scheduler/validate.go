@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/tasks"
+)
+
+// lookPath is overwritten in tests
+var lookPath = exec.LookPath
+
+// Select base tasks executed outside of the database by live chains of the client including compensations
+const sqlSelectLiveTasks = `
+WITH RECURSIVE x (chain_name, chain_id, task_id, compensate_task_id) AS (
+	SELECT c.chain_name, tc.chain_id, tc.task_id, tc.compensate_task_id
+	FROM timetable.chain_execution_config c JOIN timetable.task_chain tc USING (chain_id)
+	WHERE c.live AND (c.client_name = $1 OR c.client_name IS NULL) AND (c.client_group IS NULL OR c.client_group = $2)
+	UNION ALL
+	SELECT x.chain_name, tc.chain_id, tc.task_id, tc.compensate_task_id
+	FROM timetable.task_chain tc JOIN x ON x.chain_id = tc.parent_id
+)
+SELECT bt.name, bt.kind, bt.script, string_agg(DISTINCT x.chain_name, ', ' ORDER BY x.chain_name) AS chains
+FROM x JOIN timetable.base_task bt ON bt.task_id IN (x.task_id, x.compensate_task_id)
+WHERE bt.kind IN ('SHELL', 'PROGRAM', 'DOCKER', 'K8S_JOB', 'BUILTIN')
+GROUP BY bt.name, bt.kind, bt.script
+ORDER BY bt.name`
+
+// liveTask is the base task used by live chains
+type liveTask struct {
+	Name   string `db:"name"`
+	Kind   string `db:"kind"`
+	Script string `db:"script"`
+	Chains string `db:"chains"`
+}
+
+// validateTask returns the reason why the task cannot be executed by this client or empty string
+func validateTask(task liveTask) string {
+	if task.Kind == "BUILTIN" {
+		for _, name := range tasks.Names() {
+			if name == task.Name {
+				return ""
+			}
+		}
+		return "builtin task is not registered"
+	}
+	if pgengine.NoShellTasks {
+		return "shell tasks are disabled"
+	}
+	var binary string
+	switch task.Kind {
+	case "SHELL":
+		binary = strings.TrimSpace(task.Script)
+	case "PROGRAM":
+		argv, err := parseArgv(task.Script)
+		if err != nil || len(argv) == 0 {
+			return "program script must be non empty JSON array of strings"
+		}
+		binary = argv[0]
+	case "DOCKER":
+		binary = dockerBinary
+	case "K8S_JOB":
+		binary = kubectlBinary
+	}
+	if _, err := lookPath(binary); err != nil {
+		return fmt.Sprintf("%s not found", binary)
+	}
+	return ""
+}
+
+// ValidateTasks checks if builtin tasks and external binaries used by live chains are available and
+// logs the consolidated report. Returns false if some tasks cannot be executed
+func ValidateTasks(ctx context.Context) bool {
+	var liveTasks []liveTask
+	if err := pgengine.ConfigDb.SelectContext(ctx, &liveTasks, pgengine.SchemaSQL(sqlSelectLiveTasks), pgengine.ClientName, pgengine.ClientGroup); err != nil {
+		pgengine.LogToDB("ERROR", "Cannot validate tasks of live chains: ", err)
+		return false
+	}
+	var problems []string
+	for _, task := range liveTasks {
+		if reason := validateTask(task); reason != "" {
+			problems = append(problems, fmt.Sprintf("%s task %s used by %s: %s", task.Kind, task.Name, task.Chains, reason))
+		}
+	}
+	if len(problems) == 0 {
+		pgengine.LogToDB("LOG", fmt.Sprintf("Validated %d tasks of live chains", len(liveTasks)))
+		return true
+	}
+	pgengine.LogToDB("ERROR", fmt.Sprintf("%d tasks of live chains cannot be executed:\n\t%s",
+		len(problems), strings.Join(problems, "\n\t")))
+	return false
+}
@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTask(t *testing.T) {
+	defer func(f func(string) (string, error)) { lookPath = f }(lookPath)
+	lookPath = func(file string) (string, error) {
+		if file == "pg_dump" || file == "docker" {
+			return "/usr/bin/" + file, nil
+		}
+		return "", errors.New("not found")
+	}
+	assert.Empty(t, validateTask(liveTask{Name: "Sleep", Kind: "BUILTIN"}))
+	assert.Equal(t, "builtin task is not registered", validateTask(liveTask{Name: "Sleeep", Kind: "BUILTIN"}))
+	assert.Empty(t, validateTask(liveTask{Kind: "SHELL", Script: "pg_dump"}))
+	assert.Equal(t, "rsync not found", validateTask(liveTask{Kind: "SHELL", Script: "rsync "}))
+	assert.Empty(t, validateTask(liveTask{Kind: "PROGRAM", Script: `["pg_dump", "-Fc"]`}))
+	assert.Equal(t, "program script must be non empty JSON array of strings", validateTask(liveTask{Kind: "PROGRAM", Script: `pg_dump -Fc`}))
+	assert.Empty(t, validateTask(liveTask{Kind: "DOCKER", Script: "postgres:13"}))
+
+	pgengine.NoShellTasks = true
+	defer func() { pgengine.NoShellTasks = false }()
+	assert.Equal(t, "shell tasks are disabled", validateTask(liveTask{Kind: "SHELL", Script: "pg_dump"}))
+	assert.Empty(t, validateTask(liveTask{Name: "Sleep", Kind: "BUILTIN"}), "Builtin tasks are not affected")
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// windowAllows decides if the time of day of w.Now is within the execution window of the chain.
+// The window wraps around midnight if the start is later than the end, e.g. 22:00 - 05:00
+func windowAllows(w pgengine.ChainWindow) bool {
+	if !w.Start.Valid || !w.End.Valid {
+		return true
+	}
+	if w.Start.String < w.End.String {
+		return w.Now >= w.Start.String && w.Now < w.End.String
+	}
+	return w.Now >= w.Start.String || w.Now < w.End.String
+}
+
+// checkChainWindow returns false if the chain must not be started at the moment due to its execution window.
+// The chain is executed if the window cannot be checked
+func checkChainWindow(ctx context.Context, chain Chain) bool {
+	w, err := pgengine.GetChainWindow(ctx, chain.ChainExecutionConfigID)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot check execution window of the chain configuration: ", err)
+		return true
+	}
+	if windowAllows(w) {
+		return true
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Chain %s is not started outside of its execution window %s - %s",
+		chain, w.Start.String, w.End.String))
+	return false
+}
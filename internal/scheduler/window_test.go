@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowAllows(t *testing.T) {
+	window := func(start, end, now string) pgengine.ChainWindow {
+		return pgengine.ChainWindow{
+			Start: sql.NullString{String: start, Valid: start != ""},
+			End:   sql.NullString{String: end, Valid: end != ""},
+			Now:   now,
+		}
+	}
+	assert.True(t, windowAllows(window("", "", "12:00:00")), "Chain without window runs any time")
+	assert.True(t, windowAllows(window("09:00:00", "17:00:00", "09:00:00")), "Window start is inclusive")
+	assert.False(t, windowAllows(window("09:00:00", "17:00:00", "17:00:00")), "Window end is exclusive")
+	assert.False(t, windowAllows(window("09:00:00", "17:00:00", "08:59:59")))
+	assert.True(t, windowAllows(window("22:00:00", "05:00:00", "23:30:00")), "Window wraps around midnight")
+	assert.True(t, windowAllows(window("22:00:00", "05:00:00", "04:59:59")), "Window wraps around midnight")
+	assert.False(t, windowAllows(window("22:00:00", "05:00:00", "12:00:00")), "Business hours are outside of the night window")
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// defaultWorkersNumber is the number of workers unless changed by SetWorkers
+const defaultWorkersNumber = 16
+
+// worker pool state, workers are started by Run and resized by SetWorkers
+var (
+	workersMu     sync.Mutex
+	workersNumber = defaultWorkersNumber
+	workersCtx    context.Context // nil unless workers are started
+	workerStops   []chan struct{}
+)
+
+// Workers returns the number of workers executing chains
+func Workers() int {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	return workersNumber
+}
+
+// SetWorkers changes the number of workers executing chains and interval chains. Workers of the running
+// scheduler are started or stopped at once, stopped workers finish chains being executed first
+func SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	workersNumber = n
+	if workersCtx != nil {
+		resizeWorkers()
+	}
+}
+
+// resizeWorkers starts or stops workers to match workersNumber, workersMu must be locked
+func resizeWorkers() {
+	for len(workerStops) < workersNumber {
+		stop := make(chan struct{})
+		workerStops = append(workerStops, stop)
+		// workers are numbered, so runs can be attributed to them
+		ctx := pgengine.WithWorkerID(workersCtx, len(workerStops))
+		go superviseWorker(ctx, stop, func() { chainWorker(ctx, chains, stop) })
+		go superviseWorker(ctx, stop, func() { intervalChainWorker(ctx, intervalChainsChan, stop) })
+	}
+	for len(workerStops) > workersNumber {
+		close(workerStops[len(workerStops)-1])
+		workerStops = workerStops[:len(workerStops)-1]
+	}
+	/* set maximum connection to workersNumber + 1 for system calls */
+	if pgengine.ConfigDb != nil {
+		pgengine.ConfigDb.SetMaxOpenConns(workersNumber + 1)
+	}
+}
+
+// superviseWorker runs the worker and starts the replacement if it panics, so a panic inside a builtin or
+// the driver never reduces the number of workers. The panic is logged with the stack
+func superviseWorker(ctx context.Context, stop <-chan struct{}, worker func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		pgengine.LogToDB("PANIC", fmt.Sprintf("Worker panicked and is restarted: %v\n%s", r, debug.Stack()))
+		select {
+		case <-stop:
+		case <-ctx.Done():
+		default:
+			go superviseWorker(ctx, stop, worker)
+		}
+	}()
+	worker()
+}
+
+// startWorkers starts workers waiting for chains, returns the function stopping them
+func startWorkers(ctx context.Context) func() {
+	workersMu.Lock()
+	defer workersMu.Unlock()
+	var cancel context.CancelFunc
+	workersCtx, cancel = context.WithCancel(ctx)
+	resizeWorkers()
+	return func() {
+		workersMu.Lock()
+		defer workersMu.Unlock()
+		cancel()
+		for _, stop := range workerStops {
+			close(stop)
+		}
+		workersCtx, workerStops = nil, nil
+	}
+}
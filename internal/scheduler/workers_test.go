@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/tasks"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetWorkers(t *testing.T) {
+	defer SetWorkers(defaultWorkersNumber)
+	SetWorkers(2)
+	assert.Empty(t, workerStops, "Workers should not be started before the scheduler")
+
+	stop := startWorkers(context.Background())
+	assert.Len(t, workerStops, 2)
+	SetWorkers(5)
+	assert.Len(t, workerStops, 5)
+	assert.Equal(t, 5, Workers())
+	SetWorkers(0)
+	assert.Len(t, workerStops, 1, "At least one worker should be kept")
+	stop()
+	assert.Empty(t, workerStops)
+	assert.Nil(t, workersCtx)
+}
+
+func TestSuperviseWorker(t *testing.T) {
+	var calls int32
+	done := make(chan struct{})
+	superviseWorker(context.Background(), make(chan struct{}), func() {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("driver bug")
+		}
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Worker should be restarted after the panic")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	stop := make(chan struct{})
+	close(stop)
+	calls = 0
+	superviseWorker(context.Background(), stop, func() {
+		atomic.AddInt32(&calls, 1)
+		panic("driver bug")
+	})
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Stopped worker should not be restarted")
+}
+
+// recordingConn is the database connection recording transaction ends and statements executed
+type recordingConn struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (c *recordingConn) record(statement string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, statement)
+}
+
+func (c *recordingConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *recordingConn) Driver() driver.Driver                        { return nil }
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c, query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recordingConn) Commit() error             { c.record("COMMIT"); return nil }
+func (c *recordingConn) Rollback() error           { c.record("ROLLBACK"); return nil }
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	statement := s.query
+	for _, arg := range args {
+		if status, ok := arg.(string); ok && strings.HasPrefix(status, "CHAIN_") {
+			statement += " " + status
+		}
+	}
+	s.conn.record(statement)
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestReleaseOnPanic(t *testing.T) {
+	conn := &recordingConn{}
+	db := sqlx.NewDb(sql.OpenDB(conn), "postgres")
+	defer func(configDb *sqlx.DB) { pgengine.ConfigDb = configDb }(pgengine.ConfigDb)
+	pgengine.ConfigDb = db
+	tasks.Tasks["Panic"] = func(context.Context, *pgengine.ChainRun, *tasks.Result, string) error { panic("driver bug") }
+	defer delete(tasks.Tasks, "Panic")
+
+	ctx := context.Background()
+	tx, err := pgengine.StartTransaction(ctx)
+	assert.NoError(t, err)
+	result := &RunResult{RunStatusID: 42}
+	assert.Panics(t, func() {
+		defer releaseOnPanic(ctx, &tx, Chain{ChainID: 1, ChainExecutionConfigID: 1}, result)
+		_, _, _ = executeTask(ctx, tx, &pgengine.ChainElementExecution{Kind: "BUILTIN", TaskName: "Panic"}, []string{"{}"})
+	}, "Panic should be propagated to the worker")
+
+	assert.Equal(t, 0, db.Stats().InUse, "Transaction of the panicked chain should release the connection")
+	statements := strings.Join(conn.statements, "\n")
+	rollback := strings.Index(statements, "ROLLBACK")
+	assert.True(t, rollback >= 0, "Transaction of the panicked chain should be rolled back")
+	assert.True(t, strings.Index(statements, "CHAIN_FAILED") > rollback, "Run of the panicked chain should be marked failed")
+}
@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/sigv4"
+)
+
+// awsEndpoint returns the Secrets Manager endpoint of the region, overwritten in tests
+var awsEndpoint = func(region string) string {
+	return fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+}
+
+// awsRegion returns the region of the secret ARN, e.g. "arn:aws:secretsmanager:eu-west-1:123456789012:secret:db",
+// or AWS_REGION for secret names
+func awsRegion(secretID string) string {
+	if parts := strings.Split(secretID, ":"); len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+	return os.Getenv("AWS_REGION")
+}
+
+// fromAWSSecretsManager reads the secret "id#key" using AWS credentials from the environment. The key selects
+// the value of the secret stored as JSON object, e.g. "prod/timetable#password"
+func fromAWSSecretsManager(ctx context.Context, ref string) (string, error) {
+	secretID, key := splitKey(ref)
+	region := awsRegion(secretID)
+	if region == "" {
+		return "", errors.New("AWS region of the secret cannot be determined, set AWS_REGION")
+	}
+	creds := sigv4.Credentials{}.FromEnv()
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return "", errors.New("AWS credentials are required for AWS Secrets Manager")
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", awsEndpoint(region), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	hash := sha256.Sum256(body)
+	sigv4.Sign(req, creds, region, "secretsmanager", hex.EncodeToString(hash[:]), time.Now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if strings.Contains(string(msg), "ResourceNotFoundException") {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("AWS Secrets Manager request failed with status %s: %s", resp.Status, msg)
+	}
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return secret.SecretString, nil
+	}
+	var data map[string]interface{}
+	if err = json.Unmarshal([]byte(secret.SecretString), &data); err != nil {
+		return "", fmt.Errorf("Secret is not JSON object: %w", err)
+	}
+	return jsonKey(data, key)
+}
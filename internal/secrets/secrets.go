@@ -0,0 +1,148 @@
+// Package secrets resolves references to secrets kept outside of the configuration database, e.g.
+// "env:SMTP_PASSWORD", "file:/run/secrets/db", "vault:secret/data/timetable#password" or "awssm:prod/db#password"
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver returns the secret by the reference without the scheme
+type Resolver func(ctx context.Context, ref string) (string, error)
+
+// resolvers by the scheme of the reference
+var resolvers = map[string]Resolver{
+	"env":   fromEnv,
+	"file":  fromFile,
+	"vault": fromVault,
+	"awssm": fromAWSSecretsManager,
+}
+
+// CacheTTL is the time resolved secrets are reused, so rotated secrets are picked up afterwards
+var CacheTTL = time.Minute
+
+type cached struct {
+	value    string
+	resolved time.Time
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[string]cached{}
+)
+
+// ErrNotFound is returned if the secret or its key does not exist
+var ErrNotFound = errors.New("Secret not found")
+
+// IsReference returns true if the string starts with the known scheme, e.g. "vault:"
+func IsReference(s string) bool {
+	scheme := strings.SplitN(s, ":", 2)[0]
+	_, ok := resolvers[scheme]
+	return ok && strings.Contains(s, ":")
+}
+
+// Resolve returns the secret by the reference "<scheme>:<ref>", values are cached for CacheTTL
+func Resolve(ctx context.Context, reference string) (string, error) {
+	parts := strings.SplitN(reference, ":", 2)
+	resolve, ok := resolvers[parts[0]]
+	if !ok || len(parts) < 2 {
+		return "", fmt.Errorf("Unknown secret reference scheme: %s", parts[0])
+	}
+	cacheMu.Lock()
+	c, ok := cache[reference]
+	cacheMu.Unlock()
+	if ok && time.Since(c.resolved) < CacheTTL {
+		return c.value, nil
+	}
+	value, err := resolve(ctx, parts[1])
+	if err != nil {
+		return "", fmt.Errorf("Cannot resolve secret %s: %w", reference, err)
+	}
+	cacheMu.Lock()
+	cache[reference] = cached{value: value, resolved: time.Now()}
+	cacheMu.Unlock()
+	return value, nil
+}
+
+// ResolveJSON replaces references in all string values of the JSON document with secrets, e.g.
+// {"password": "vault:secret/data/smtp#password"}. Other values are left as is
+func ResolveJSON(ctx context.Context, doc string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		return "", err
+	}
+	v, err := resolveValue(ctx, v)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func resolveValue(ctx context.Context, v interface{}) (_ interface{}, err error) {
+	switch val := v.(type) {
+	case string:
+		if IsReference(val) {
+			return Resolve(ctx, val)
+		}
+	case []interface{}:
+		for i := range val {
+			if val[i], err = resolveValue(ctx, val[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k := range val {
+			if val[k], err = resolveValue(ctx, val[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// splitKey splits "path#key" reference
+func splitKey(ref string) (path string, key string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// jsonKey returns the value of the key of the JSON object, the whole object is returned if the key is empty
+func jsonKey(data map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		b, err := json.Marshal(data)
+		return string(b), err
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func fromEnv(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// fromFile reads the file, e.g. Docker or Kubernetes secret, trailing new line is removed
+func fromFile(_ context.Context, name string) (string, error) {
+	data, err := ioutil.ReadFile(name)
+	return strings.TrimRight(string(data), "\r\n"), err
+}
@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsReference(t *testing.T) {
+	assert.True(t, IsReference("env:PASSWORD"))
+	assert.True(t, IsReference("vault:secret/data/db#password"))
+	assert.False(t, IsReference("http://example.com"))
+	assert.False(t, IsReference("plain password"))
+	assert.False(t, IsReference("env"))
+}
+
+func TestResolveEnvAndFile(t *testing.T) {
+	ctx := context.Background()
+	os.Setenv("PGTT_TEST_SECRET", "s3cr3t")
+	defer os.Unsetenv("PGTT_TEST_SECRET")
+	value, err := Resolve(ctx, "env:PGTT_TEST_SECRET")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+	_, err = Resolve(ctx, "env:PGTT_TEST_SECRET_MISSING")
+	assert.Error(t, err)
+	_, err = Resolve(ctx, "unknown:value")
+	assert.Error(t, err)
+
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("from file\n"), 0600))
+	value, err = Resolve(ctx, "file:"+file)
+	assert.NoError(t, err)
+	assert.Equal(t, "from file", value, "Trailing new line should be removed")
+}
+
+func TestResolveCache(t *testing.T) {
+	defer func(ttl time.Duration) { CacheTTL = ttl }(CacheTTL)
+	ctx := context.Background()
+	os.Setenv("PGTT_TEST_ROTATED", "old")
+	defer os.Unsetenv("PGTT_TEST_ROTATED")
+	CacheTTL = time.Hour
+	_, _ = Resolve(ctx, "env:PGTT_TEST_ROTATED")
+	os.Setenv("PGTT_TEST_ROTATED", "new")
+	value, _ := Resolve(ctx, "env:PGTT_TEST_ROTATED")
+	assert.Equal(t, "old", value, "Cached value should be used within TTL")
+	CacheTTL = 0
+	value, _ = Resolve(ctx, "env:PGTT_TEST_ROTATED")
+	assert.Equal(t, "new", value, "Rotated secret should be resolved after TTL")
+}
+
+func TestResolveJSON(t *testing.T) {
+	os.Setenv("PGTT_TEST_SMTP", "mail-pwd")
+	defer os.Unsetenv("PGTT_TEST_SMTP")
+	doc, err := ResolveJSON(context.Background(), `{"username": "bot", "password": "env:PGTT_TEST_SMTP", "to": ["env:PGTT_TEST_SMTP"], "port": 25}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"username": "bot", "password": "mail-pwd", "to": ["mail-pwd"], "port": 25}`, doc)
+	_, err = ResolveJSON(context.Background(), `["env:PGTT_TEST_SMTP_MISSING"]`)
+	assert.Error(t, err)
+}
+
+func TestFromVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/data/timetable":
+			_, _ = w.Write([]byte(`{"data": {"data": {"password": "kv2"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/timetable":
+			_, _ = w.Write([]byte(`{"data": {"password": "kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_TOKEN", "vault-token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+	ctx := context.Background()
+
+	value, err := fromVault(ctx, "secret/data/timetable#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv2", value)
+	value, err = fromVault(ctx, "kv/timetable#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "kv1", value)
+	value, err = fromVault(ctx, "kv/timetable")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"password": "kv1"}`, value, "Whole secret should be returned without key")
+	_, err = fromVault(ctx, "kv/timetable#user")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = fromVault(ctx, "kv/missing#password")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestFromAWSSecretsManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request"))
+		var req struct{ SecretId string }
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.SecretId != "prod/timetable" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"SecretString": "{\"password\": \"aws-pwd\"}"}`))
+	}))
+	defer server.Close()
+	defer func(f func(string) string) { awsEndpoint = f }(awsEndpoint)
+	awsEndpoint = func(region string) string { return server.URL }
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_REGION", "eu-west-1")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	defer os.Unsetenv("AWS_REGION")
+	ctx := context.Background()
+
+	value, err := fromAWSSecretsManager(ctx, "prod/timetable#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "aws-pwd", value)
+	value, err = fromAWSSecretsManager(ctx, "prod/timetable")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"password": "aws-pwd"}`, value)
+	_, err = fromAWSSecretsManager(ctx, "prod/missing#password")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Equal(t, "us-east-2", awsRegion("arn:aws:secretsmanager:us-east-2:123456789012:secret:db"))
+}
@@ -0,0 +1,187 @@
+// Package sentry reports task failures, scheduler errors and panics to Sentry or compatible error trackers
+// using the store endpoint, so intermittent failures are aggregated into issues
+package sentry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+)
+
+// queueSize limits events waiting to be sent, events captured above the limit are dropped
+const queueSize = 100
+
+// event is the Sentry event payload
+type event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Logger      string                 `json:"logger"`
+	Platform    string                 `json:"platform"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     string                 `json:"message"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+	Fingerprint []string               `json:"fingerprint,omitempty"`
+}
+
+// Client sends captured events in the background goroutine, so reporting never blocks the scheduler
+type Client struct {
+	pending     int64 // captured events not sent yet, updated atomically, first for 64-bit alignment
+	endpoint    string
+	auth        string
+	serverName  string
+	environment string
+	client      *http.Client
+	queue       chan event
+	// OnError is called if the event cannot be sent or is dropped
+	OnError func(error)
+}
+
+// New returns the client sending events to the project of the DSN, e.g. "https://key@o1.ingest.sentry.io/42".
+// The serverName identifies the scheduler client, environment is optional, e.g. "production"
+func New(dsn string, serverName string, environment string) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	slash := strings.LastIndex(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || slash < 0 || u.Path[slash+1:] == "" {
+		return nil, errors.New("Sentry DSN must contain the public key, host and project ID")
+	}
+	c := &Client{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:slash], u.Path[slash+1:]),
+		auth:        "Sentry sentry_version=7, sentry_client=pg_timetable, sentry_key=" + u.User.Username(),
+		serverName:  serverName,
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan event, queueSize)}
+	if secret, ok := u.User.Password(); ok {
+		c.auth += ", sentry_secret=" + secret
+	}
+	go c.loop()
+	return c, nil
+}
+
+func (c *Client) loop() {
+	for e := range c.queue {
+		if err := c.send(e); err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+		atomic.AddInt64(&c.pending, -1)
+	}
+}
+
+// Flush waits until captured events are sent, returns false on timeout
+func (c *Client) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&c.pending) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// CaptureMessage reports the scheduler error, PANIC messages are reported with the fatal level
+func (c *Client) CaptureMessage(level string, msg string) {
+	e := event{Level: "error", Message: msg}
+	if level == "PANIC" {
+		e.Level = "fatal"
+	}
+	c.capture(e)
+}
+
+// CapturePanic reports the recovered panic of the chain run with its stack
+func (c *Client) CapturePanic(r interface{}, stack []byte, chainName string, chainConfig int) {
+	c.capture(event{
+		Level:       "fatal",
+		Message:     fmt.Sprintf("panic: %v", r),
+		Tags:        map[string]string{"chain_name": chainName},
+		Extra:       map[string]interface{}{"chain_config": chainConfig, "stack": string(stack)},
+		Fingerprint: []string{"panic", fmt.Sprint(r)}})
+}
+
+// HandleEvent reports failed chain elements and SLA violations. CHAIN_FAILED is not reported, since
+// the failed element is reported already
+func (c *Client) HandleEvent(ev events.Event) {
+	e := event{
+		Tags: map[string]string{"chain_name": ev.ChainName},
+		Extra: map[string]interface{}{"chain_config": ev.ChainConfig, "chain_id": ev.ChainID,
+			"run_status": ev.RunStatusID}}
+	if ev.RunbookURL != "" {
+		e.Extra["runbook_url"] = ev.RunbookURL
+	}
+	switch {
+	case ev.Kind == events.ElementFinished && ev.Error != "":
+		e.Level = "error"
+		e.Message = fmt.Sprintf("Task %s failed: %s", ev.TaskName, ev.Error)
+		e.Tags["task_name"], e.Tags["task_kind"] = ev.TaskName, ev.TaskKind
+		e.Extra["return_code"] = ev.ReturnCode
+		e.Fingerprint = []string{"task", ev.ChainName, ev.TaskName}
+	case ev.Kind == events.SLAViolated:
+		e.Level = "warning"
+		e.Message = ev.Error
+		e.Fingerprint = []string{"sla", ev.ChainName}
+	default:
+		return
+	}
+	c.capture(e)
+}
+
+func (c *Client) capture(e event) {
+	e.EventID = randomID()
+	e.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05.000000")
+	e.Logger, e.Platform = "pg_timetable", "go"
+	e.ServerName, e.Environment = c.serverName, c.environment
+	atomic.AddInt64(&c.pending, 1)
+	select {
+	case c.queue <- e:
+	default:
+		atomic.AddInt64(&c.pending, -1)
+		if c.OnError != nil {
+			c.OnError(errors.New("Sentry queue is full, event dropped: " + e.Message))
+		}
+	}
+}
+
+func (c *Client) send(e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.auth+", sentry_timestamp="+strconv.FormatInt(time.Now().Unix(), 10))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Sentry responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,68 @@
+// Package systemd implements the sd_notify protocol, so the scheduler can be started as the service with
+// Type=notify and WatchdogSec, and systemd restarts it when the main loop hangs
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notification states sent to systemd
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends the state to the socket of the service manager. Does nothing if not started by systemd
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' { // abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns WatchdogSec of the service, 0 if the watchdog is disabled or expected from
+// another process
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog pings the watchdog twice per interval while alive returns true, so systemd restarts the service
+// if the scheduler stops being alive. Returns when the context is cancelled
+func RunWatchdog(ctx context.Context, interval time.Duration, alive func() bool, onError func(error)) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		if alive() {
+			if err := Notify(Watchdog); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
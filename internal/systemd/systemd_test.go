@@ -0,0 +1,81 @@
+package systemd
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) (*net.UnixConn, func()) {
+	dir, err := ioutil.TempDir("", "systemd")
+	require.NoError(t, err)
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	os.Setenv("NOTIFY_SOCKET", socket)
+	return conn, func() {
+		os.Unsetenv("NOTIFY_SOCKET")
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 64)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	assert.NoError(t, Notify(Ready), "Should do nothing without NOTIFY_SOCKET")
+
+	conn, cleanup := listen(t)
+	defer cleanup()
+	assert.NoError(t, Notify(Ready))
+	assert.Equal(t, Ready, receive(t, conn))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+	assert.Zero(t, WatchdogInterval())
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	assert.Equal(t, 30*time.Second, WatchdogInterval())
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	assert.Zero(t, WatchdogInterval(), "Watchdog of another process should be ignored")
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn, cleanup := listen(t)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	alive := make(chan bool, 1)
+	alive <- false
+	done := make(chan struct{})
+	go func() {
+		RunWatchdog(ctx, 20*time.Millisecond, func() bool {
+			select {
+			case a := <-alive:
+				return a
+			default:
+				return true
+			}
+		}, func(err error) { t.Error(err) })
+		close(done)
+	}()
+	assert.Equal(t, Watchdog, receive(t, conn), "Should ping once alive")
+	cancel()
+	<-done
+}
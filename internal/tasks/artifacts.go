@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type artifactsOpts struct {
+	Files []string `json:"files"`
+	From  []string `json:"from"`
+	Keep  string   `json:"keep"`
+}
+
+// artifactFiles returns files matching the patterns and artifacts of the builtin tasks executed before in the run
+// by task name, e.g. "Backup", so produced files can be stored without knowing their names
+func artifactFiles(run *pgengine.ChainRun, opts artifactsOpts) (map[string][]string, error) {
+	files := make(map[string][]string)
+	for _, pattern := range opts.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match %s", pattern)
+		}
+		files["StoreArtifacts"] = append(files["StoreArtifacts"], matches...)
+	}
+	for _, name := range opts.From {
+		data, ok := run.Results[name]
+		if !ok {
+			return nil, fmt.Errorf("No result of the task %s in the current run", name)
+		}
+		var result Result
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		files[name] = append(files[name], result.Artifacts...)
+	}
+	return files, nil
+}
+
+// taskStoreArtifacts copies "files" (glob patterns are allowed) and artifacts of builtin tasks executed before
+// in the run "from" into the artifacts directory and registers them in timetable.run_artifact to be "kept"
+// for the interval specified, by default until Retention deletes the run
+func taskStoreArtifacts(ctx context.Context, run *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts artifactsOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if len(opts.Files) == 0 && len(opts.From) == 0 {
+		return errors.New("Files to store are not specified")
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	files, err := artifactFiles(run, opts)
+	if err != nil {
+		return err
+	}
+	for taskName, names := range files {
+		for _, file := range names {
+			id, err := pgengine.StoreArtifact(ctx, run.RunStatusID, taskName, file, opts.Keep)
+			if err != nil {
+				return fmt.Errorf("Cannot store artifact %s: %s", file, err)
+			}
+			pgengine.LogToDB("LOG", fmt.Sprintf("Artifact %d stored: %s", id, file))
+			result.AddArtifact(file)
+			result.AddMetric("stored", 1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.csv", "b.csv", "c.txt"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	backup, _ := json.Marshal(Result{Status: ResultOK, Artifacts: []string{"/backups/sales.dump"}})
+	run := &pgengine.ChainRun{Results: map[string]json.RawMessage{"Backup": backup}}
+
+	files, err := artifactFiles(run, artifactsOpts{Files: []string{filepath.Join(dir, "*.csv")}, From: []string{"Backup"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"StoreArtifacts": {filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv")},
+		"Backup":         {"/backups/sales.dump"},
+	}, files)
+
+	_, err = artifactFiles(run, artifactsOpts{Files: []string{filepath.Join(dir, "*.pdf")}})
+	assert.EqualError(t, err, "No files match "+filepath.Join(dir, "*.pdf"))
+	_, err = artifactFiles(run, artifactsOpts{From: []string{"CopyToFile"}})
+	assert.EqualError(t, err, "No result of the task CopyToFile in the current run")
+
+	assert.EqualError(t, taskStoreArtifacts(context.Background(), run, &Result{}, `{}`), "Files to store are not specified")
+	assert.EqualError(t, taskStoreArtifacts(context.Background(), run, &Result{}, `{"files": ["*.csv"]}`),
+		"Configuration database connection is not established")
+}
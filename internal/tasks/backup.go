@@ -0,0 +1,155 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type backupOpts struct {
+	Databases []string `json:"databases"`
+	Host      string   `json:"host"`
+	Port      int      `json:"port"`
+	Username  string   `json:"username"`
+	Password  string   `json:"password"`
+	Format    string   `json:"format"`
+	Compress  *int     `json:"compress"`
+	DestPath  string   `json:"destpath"`
+	Keep      int      `json:"keep"`
+	PgDump    string   `json:"pgdump"`
+	Options   []string `json:"options"`
+}
+
+// file extensions of pg_dump output formats
+var backupFormats = map[string]string{"custom": "dump", "plain": "sql", "directory": "dir", "tar": "tar"}
+
+const backupTimeFormat = "20060102T150405"
+
+// taskBackup dumps every database into destpath as <database>_<timestamp>.<ext> using pg_dump
+// and removes the oldest dumps of the database if there are more than keep of them.
+// Connection parameters omitted are taken by pg_dump from the libpq environment variables
+func taskBackup(_ context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts backupOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if len(opts.Databases) == 0 {
+		return errors.New("Databases to backup are not specified")
+	}
+	if opts.Format == "" {
+		opts.Format = "custom"
+	}
+	ext, ok := backupFormats[opts.Format]
+	if !ok {
+		return fmt.Errorf("Unsupported backup format: %s", opts.Format)
+	}
+	if opts.Compress != nil && (*opts.Compress < 0 || *opts.Compress > 9) {
+		return fmt.Errorf("Compression level must be between 0 and 9: %d", *opts.Compress)
+	}
+	if opts.PgDump == "" {
+		opts.PgDump = "pg_dump"
+	}
+	if _, err := os.Stat(opts.DestPath); err != nil {
+		return err
+	}
+	for _, db := range opts.Databases {
+		start := time.Now()
+		filename := filepath.Join(opts.DestPath, fmt.Sprintf("%s_%s.%s", db, start.Format(backupTimeFormat), ext))
+		if err := opts.dump(db, filename); err != nil {
+			return err
+		}
+		size, err := backupSize(filename)
+		if err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", fmt.Sprintf("Backup of database %s created in %s: %d bytes, %v",
+			db, filename, size, time.Since(start).Round(time.Millisecond)))
+		result.AddArtifact(filename)
+		result.AddMetric("bytes", float64(size))
+		if err := rotateBackups(opts.DestPath, db, ext, opts.Keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (opts backupOpts) dump(db string, filename string) error {
+	args := []string{"--format=" + opts.Format, "--file=" + filename}
+	if opts.Compress != nil {
+		args = append(args, "--compress="+strconv.Itoa(*opts.Compress))
+	}
+	if opts.Host != "" {
+		args = append(args, "--host="+opts.Host)
+	}
+	if opts.Port != 0 {
+		args = append(args, "--port="+strconv.Itoa(opts.Port))
+	}
+	if opts.Username != "" {
+		args = append(args, "--username="+opts.Username)
+	}
+	// never prompt for password, fail instead
+	args = append(args, "--no-password")
+	args = append(args, opts.Options...)
+	args = append(args, "--dbname="+db)
+	cmd := exec.Command(opts.PgDump, args...)
+	if opts.Password != "" {
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+opts.Password)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(filename)
+		return fmt.Errorf("Backup of database %s failed: %v: %s", db, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// backupSize returns the size of the dump file or the total size of the directory format dump
+func backupSize(filename string) (size int64, err error) {
+	err = filepath.Walk(filename, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return err
+	})
+	return
+}
+
+// rotateBackups removes the oldest dumps of the database leaving keep newest, keep <= 0 means keep all
+func rotateBackups(destPath string, db string, ext string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	files, err := ioutil.ReadDir(destPath)
+	if err != nil {
+		return err
+	}
+	var dumps []string
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, db+"_") || !strings.HasSuffix(name, "."+ext) {
+			continue
+		}
+		// names are sortable by timestamp, skip files of the other databases sharing the prefix
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, db+"_"), "."+ext)); err == nil {
+			dumps = append(dumps, name)
+		}
+	}
+	sort.Strings(dumps)
+	for i := 0; i < len(dumps)-keep; i++ {
+		if err := os.RemoveAll(filepath.Join(destPath, dumps[i])); err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", fmt.Sprintf("Old backup %s removed", dumps[i]))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fake pg_dump writes its arguments into the --file
+const fakePgDump = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--file=*) file="${arg#--file=}" ;;
+		--dbname=fail) echo "connection refused" >&2; exit 1 ;;
+	esac
+done
+echo "$@" > "$file"
+`
+
+func TestTaskBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pgdump := filepath.Join(dir, "pg_dump")
+	assert.NoError(t, ioutil.WriteFile(pgdump, []byte(fakePgDump), 0755))
+	dest := filepath.Join(dir, "dumps")
+	assert.NoError(t, os.Mkdir(dest, 0755))
+
+	assert.EqualError(t, taskBackup(context.Background(), nil, &Result{}, `{}`), "Databases to backup are not specified")
+	assert.EqualError(t, taskBackup(context.Background(), nil, &Result{}, `{"databases": ["db"], "format": "zip"}`), "Unsupported backup format: zip")
+	assert.EqualError(t, taskBackup(context.Background(), nil, &Result{}, `{"databases": ["db"], "compress": 10}`), "Compression level must be between 0 and 9: 10")
+	assert.Error(t, taskBackup(context.Background(), nil, &Result{}, `{"databases": ["db"], "destpath": "non-existent"}`), "Backup to non-existent directory should fail")
+	assert.Error(t, taskBackup(context.Background(), nil, &Result{}, `{"databases": ["fail"], "destpath": "`+dest+`", "pgdump": "`+pgdump+`"}`),
+		"Failed pg_dump should fail the task")
+
+	// leftovers of the previous runs, dumps of "db_other" database must be untouched by rotation of "db"
+	for _, name := range []string{"db_20200101T000000.dump", "db_20200102T000000.dump", "db_other_20200101T000000.dump", "db_20200101T000000.sql"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dest, name), nil, 0644))
+	}
+	assert.NoError(t, taskBackup(context.Background(), nil, &Result{}, `{"databases": ["db"], "destpath": "`+dest+`", "pgdump": "`+pgdump+`",
+		"compress": 5, "host": "localhost", "keep": 2}`))
+	files, err := filepath.Glob(filepath.Join(dest, "db_*.dump"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 3, "Two newest dumps of db and the dump of db_other should be kept")
+	assert.NotContains(t, files, filepath.Join(dest, "db_20200101T000000.dump"), "The oldest dump should be removed")
+	assert.FileExists(t, filepath.Join(dest, "db_20200101T000000.sql"), "Dumps of other formats should be untouched")
+
+	// sorted: the previous dump, the new one and db_other
+	args, err := ioutil.ReadFile(files[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(args), "--format=custom")
+	assert.Contains(t, string(args), "--compress=5 --host=localhost --no-password --dbname=db")
+}
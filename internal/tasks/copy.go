@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/lib/pq"
+)
+
+type copyFromOpts struct {
+	Filename  string   `json:"filename"`
+	Table     string   `json:"table"`
+	Columns   []string `json:"columns"`
+	Format    string   `json:"format"`
+	Delimiter string   `json:"delimiter"`
+	Null      *string  `json:"null"`
+	Header    bool     `json:"header"`
+}
+
+func parseCopyFromOpts(paramValues string) (opts copyFromOpts, err error) {
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if opts.Filename == "" {
+		return opts, errors.New("File to copy from is not specified")
+	}
+	if opts.Table == "" {
+		return opts, errors.New("Destination table is not specified")
+	}
+	switch opts.Format {
+	case "", "csv":
+		opts.Format = "csv"
+	case "text", "binary":
+		// the file is streamed as is and parsed on the server side
+		if opts.Header {
+			return opts, fmt.Errorf("Header is not supported by %s format", opts.Format)
+		}
+		if opts.Format == "binary" && (opts.Delimiter != "" || opts.Null != nil) {
+			return opts, errors.New("Delimiter and null are not supported by binary format")
+		}
+	default:
+		return opts, fmt.Errorf("Unsupported copy format: %s", opts.Format)
+	}
+	if opts.Delimiter == "" && opts.Format == "csv" {
+		opts.Delimiter = ","
+	}
+	if opts.Delimiter != "" && utf8.RuneCountInString(opts.Delimiter) != 1 {
+		return opts, fmt.Errorf("Delimiter must be a single character: %s", opts.Delimiter)
+	}
+	if len(opts.Columns) == 0 && !opts.Header && opts.Format == "csv" {
+		return opts, errors.New("Columns must be specified explicitly or by the header")
+	}
+	return
+}
+
+// newReader returns CSV reader positioned on the first data row and the destination columns.
+// Header row is skipped, its names are used if columns are not specified
+func (opts copyFromOpts) newReader(r io.Reader) (*csv.Reader, []string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma, _ = utf8.DecodeRuneInString(opts.Delimiter)
+	reader.ReuseRecord = true
+	columns := opts.Columns
+	if opts.Header {
+		header, err := reader.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(columns) == 0 {
+			columns = append([]string{}, header...)
+		}
+	}
+	return reader, columns, nil
+}
+
+// values converts fields equal to the null string into NULL. If null is not specified,
+// empty fields are NULL, which is the closest to the server side CSV format defaults
+func (opts copyFromOpts) values(record []string) []interface{} {
+	null := ""
+	if opts.Null != nil {
+		null = *opts.Null
+	}
+	values := make([]interface{}, len(record))
+	for i, field := range record {
+		if field != null {
+			values[i] = field
+		}
+	}
+	return values
+}
+
+// copyTable splits optionally schema qualified table name
+func copyTable(table string, columns []string) string {
+	if i := strings.Index(table, "."); i > 0 {
+		return pq.CopyInSchema(table[:i], table[i+1:], columns...)
+	}
+	return pq.CopyIn(table, columns...)
+}
+
+// nativeCopyFrom returns COPY statement for the server side formats, all columns are used if not specified
+func (opts copyFromOpts) nativeCopyFrom() string {
+	sql := "COPY " + quoteTable(opts.Table)
+	if len(opts.Columns) > 0 {
+		columns := make([]string, len(opts.Columns))
+		for i, c := range opts.Columns {
+			columns[i] = pq.QuoteIdentifier(c)
+		}
+		sql += " (" + strings.Join(columns, ", ") + ")"
+	}
+	sql += " FROM STDIN (FORMAT " + opts.Format
+	if opts.Delimiter != "" {
+		sql += ", DELIMITER " + pq.QuoteLiteral(opts.Delimiter)
+	}
+	if opts.Null != nil {
+		sql += ", NULL " + pq.QuoteLiteral(*opts.Null)
+	}
+	return sql + ")"
+}
+
+// quoteTable quotes optionally schema qualified table name
+func quoteTable(table string) string {
+	if i := strings.Index(table, "."); i > 0 {
+		return pq.QuoteIdentifier(table[:i]) + "." + pq.QuoteIdentifier(table[i+1:])
+	}
+	return pq.QuoteIdentifier(table)
+}
+
+// taskCopyFromFile streams the file into the table using COPY protocol in a single transaction.
+// CSV files are parsed on the client side, text and binary files are streamed to the server as is
+func taskCopyFromFile(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts, err := parseCopyFromOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(opts.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if opts.Format != "csv" {
+		count, err := pgengine.CopyFrom(ctx, opts.nativeCopyFrom(), f)
+		if err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", fmt.Sprintf("%d rows copied from %s into %s", count, opts.Filename, opts.Table))
+		result.AddMetric("rows", float64(count))
+		return nil
+	}
+	reader, columns, err := opts.newReader(f)
+	if err != nil {
+		return err
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	tx, err := pgengine.ConfigDb.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.Prepare(copyTable(opts.Table, columns))
+	if err != nil {
+		return err
+	}
+	var count int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.Exec(opts.values(record)...); err != nil {
+			return err
+		}
+		count++
+	}
+	if _, err = stmt.Exec(); err != nil {
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("%d rows copied from %s into %s", count, opts.Filename, opts.Table))
+	result.AddMetric("rows", float64(count))
+	return nil
+}
+
+type copyToOpts struct {
+	Query    string `json:"query"`
+	Filename string `json:"filename"`
+	Format   string `json:"format"`
+	Header   *bool  `json:"header"`
+}
+
+var copyToDelimiters = map[string]rune{"csv": ',', "tsv": '\t'}
+
+// taskCopyToFile exports the query result to the file, "-" stands for the standard output of the process
+func taskCopyToFile(_ context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts copyToOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if strings.TrimSpace(opts.Query) == "" {
+		return errors.New("Query to copy from is not specified")
+	}
+	if opts.Filename == "" {
+		return errors.New("File to copy to is not specified")
+	}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	delimiter, ok := copyToDelimiters[opts.Format]
+	if !ok {
+		return fmt.Errorf("Unsupported copy format: %s", opts.Format)
+	}
+	header := opts.Header == nil || *opts.Header
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	rows, err := pgengine.ConfigDb.Query(opts.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if opts.Filename == "-" {
+		return writeCSV(rows, os.Stdout, delimiter, header)
+	}
+	f, err := os.Create(opts.Filename)
+	if err != nil {
+		return err
+	}
+	if err = writeCSV(rows, f, delimiter, header); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", "Query result copied to ", opts.Filename)
+	result.AddArtifact(opts.Filename)
+	return nil
+}
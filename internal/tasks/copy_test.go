@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCopyFromOpts(t *testing.T) {
+	_, err := parseCopyFromOpts(`{"table": "t"}`)
+	assert.EqualError(t, err, "File to copy from is not specified")
+	_, err = parseCopyFromOpts(`{"filename": "f.csv"}`)
+	assert.EqualError(t, err, "Destination table is not specified")
+	_, err = parseCopyFromOpts(`{"filename": "f.csv", "table": "t", "format": "xlsx"}`)
+	assert.EqualError(t, err, "Unsupported copy format: xlsx")
+	_, err = parseCopyFromOpts(`{"filename": "f.txt", "table": "t", "format": "text", "header": true}`)
+	assert.EqualError(t, err, "Header is not supported by text format")
+	_, err = parseCopyFromOpts(`{"filename": "f.bin", "table": "t", "format": "binary", "delimiter": ";"}`)
+	assert.EqualError(t, err, "Delimiter and null are not supported by binary format")
+	_, err = parseCopyFromOpts(`{"filename": "f.csv", "table": "t", "delimiter": ";;", "header": true}`)
+	assert.EqualError(t, err, "Delimiter must be a single character: ;;")
+	_, err = parseCopyFromOpts(`{"filename": "f.csv", "table": "t"}`)
+	assert.EqualError(t, err, "Columns must be specified explicitly or by the header")
+	opts, err := parseCopyFromOpts(`{"filename": "f.csv", "table": "t", "header": true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, ",", opts.Delimiter)
+}
+
+func TestCopyFromReader(t *testing.T) {
+	opts, err := parseCopyFromOpts(`{"filename": "f.csv", "table": "t", "delimiter": ";", "header": true, "null": "\\N"}`)
+	assert.NoError(t, err)
+	reader, columns, err := opts.newReader(strings.NewReader("id;name\n1;foo\n2;\\N\n3;\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, columns, "Columns should be taken from the header")
+	var rows [][]interface{}
+	for record, err := reader.Read(); err == nil; record, err = reader.Read() {
+		rows = append(rows, opts.values(record))
+	}
+	assert.Equal(t, [][]interface{}{{"1", "foo"}, {"2", nil}, {"3", ""}}, rows)
+
+	opts.Columns = []string{"a", "b"}
+	_, columns, err = opts.newReader(strings.NewReader("id;name\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, columns, "Explicit columns should be preferred")
+
+	opts.Null = nil
+	assert.Equal(t, []interface{}{nil, "x"}, opts.values([]string{"", "x"}), "Empty fields should be NULL by default")
+}
+
+func TestCopyTable(t *testing.T) {
+	assert.Equal(t, `COPY "s"."t" ("a") FROM STDIN`, copyTable("s.t", []string{"a"}))
+	assert.Equal(t, `COPY "t" ("a", "b") FROM STDIN`, copyTable("t", []string{"a", "b"}))
+}
+
+func TestNativeCopyFrom(t *testing.T) {
+	opts, err := parseCopyFromOpts(`{"filename": "f.bin", "table": "s.t", "format": "binary"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `COPY "s"."t" FROM STDIN (FORMAT binary)`, opts.nativeCopyFrom(), "All columns should be used by default")
+	opts, err = parseCopyFromOpts(`{"filename": "f.txt", "table": "t", "format": "text", "columns": ["a", "b"], "delimiter": "|", "null": ""}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `COPY "t" ("a", "b") FROM STDIN (FORMAT text, DELIMITER '|', NULL '')`, opts.nativeCopyFrom())
+}
+
+func TestTaskCopyFromFile(t *testing.T) {
+	assert.Error(t, taskCopyFromFile(context.Background(), nil, &Result{}, `{"filename": "non-existent.csv", "table": "t", "header": true}`),
+		"Copy from non-existent file should fail")
+	assert.EqualError(t, taskCopyFromFile(context.Background(), nil, &Result{}, `{"filename": "copy_test.go", "table": "t", "columns": ["a"]}`),
+		"Configuration database connection is not established", "Copy without database connection should fail")
+	assert.EqualError(t, taskCopyFromFile(context.Background(), nil, &Result{}, `{"filename": "copy_test.go", "table": "t", "format": "text"}`),
+		"Configuration database pool is not established", "Native copy without database pool should fail")
+}
+
+func TestTaskCopyToFile(t *testing.T) {
+	assert.EqualError(t, taskCopyToFile(context.Background(), nil, &Result{}, `{"filename": "out.csv"}`), "Query to copy from is not specified")
+	assert.EqualError(t, taskCopyToFile(context.Background(), nil, &Result{}, `{"query": "SELECT 1"}`), "File to copy to is not specified")
+	assert.EqualError(t, taskCopyToFile(context.Background(), nil, &Result{}, `{"query": "SELECT 1", "filename": "-", "format": "xlsx"}`), "Unsupported copy format: xlsx")
+	assert.EqualError(t, taskCopyToFile(context.Background(), nil, &Result{}, `{"query": "SELECT 1", "filename": "-", "format": "tsv"}`),
+		"Configuration database connection is not established", "Copy without database connection should fail")
+}
@@ -1,8 +1,36 @@
 package tasks
 
-import "github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
-func taskLog(val string) error {
-	pgengine.LogToDB("USER", val)
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type logOpts struct {
+	Level   string  `json:"level"`
+	Message *string `json:"message"`
+}
+
+// log levels available for the Log task
+var logLevels = map[string]bool{"DEBUG": true, "NOTICE": true, "LOG": true, "USER": true, "ERROR": true}
+
+// taskLog logs {"level": "...", "message": "..."} value, any other value is logged as is with USER level
+func taskLog(_ context.Context, _ *pgengine.ChainRun, _ *Result, val string) error {
+	var opts logOpts
+	if err := json.Unmarshal([]byte(val), &opts); err != nil || opts.Message == nil {
+		pgengine.LogToDB("USER", val)
+		return nil
+	}
+	level := strings.ToUpper(opts.Level)
+	if level == "" {
+		level = "USER"
+	}
+	if !logLevels[level] {
+		return fmt.Errorf("Unsupported log level: %s", opts.Level)
+	}
+	pgengine.LogToDB(level, *opts.Message)
 	return nil
 }
@@ -0,0 +1,153 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// exportOpts describes the destination of the run history, either local directory or S3 bucket,
+// where the key of S3 object is used as the prefix of the generated file name
+type exportOpts struct {
+	DestPath string  `json:"destpath"`
+	S3       *s3Opts `json:"s3"`
+	Format   string  `json:"format"`
+	Period   string  `json:"period"`
+}
+
+const sqlSelectRunHistory = `
+SELECT 
+	chain_execution_config, chain_id, task_id, name, kind, last_run, finished, 
+	EXTRACT(EPOCH FROM finished - last_run) AS duration, returncode, client_name
+FROM 
+	timetable.execution_log 
+WHERE 
+	last_run > now() - $1 :: interval 
+ORDER BY 
+	last_run`
+
+func parseExportOpts(paramValues string) (opts exportOpts, err error) {
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	// Parquet output is not supported yet, only CSV files are exported
+	if opts.Format != "csv" {
+		return opts, fmt.Errorf("Unsupported export format: %s", opts.Format)
+	}
+	if opts.Period == "" {
+		opts.Period = "1 day"
+	}
+	if opts.S3 != nil {
+		if opts.DestPath != "" {
+			return opts, errors.New("Export destination must be either local directory or S3 bucket")
+		}
+		if opts.S3.Bucket == "" {
+			return opts, errors.New("S3 bucket not specified")
+		}
+		if opts.S3.Region == "" {
+			opts.S3.Region = "us-east-1"
+		}
+		return
+	}
+	_, err = os.Stat(opts.DestPath)
+	return
+}
+
+func taskExportRunHistory(ctx context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
+	opts, err := parseExportOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	rows, err := pgengine.ConfigDb.QueryContext(ctx, pgengine.SchemaSQL(sqlSelectRunHistory), opts.Period)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	name := fmt.Sprintf("run_history_%s.csv", clock.FromContext(ctx).Now().Format("20060102T150405"))
+	dir, pattern := opts.DestPath, name
+	if opts.S3 != nil {
+		dir, pattern = "", "pg_timetable_export_*"
+	}
+	f, err := ioutil.TempFile(dir, pattern+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = writeCSV(rows, f, ',', true); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if opts.S3 == nil {
+		filename := filepath.Join(opts.DestPath, name)
+		if err = os.Rename(f.Name(), filename); err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", "Run history exported to ", filename)
+		return nil
+	}
+	s3 := *opts.S3
+	s3.Key = path.Join(s3.Key, name)
+	s3.File = f.Name()
+	if err = s3.upload(ctx); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", "Run history exported to ", s3.objectURL())
+	return nil
+}
+
+// writeCSV writes optional header and all rows of the result set to w
+func writeCSV(rows *sql.Rows, w io.Writer, delimiter rune, header bool) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	if header {
+		if err = cw.Write(cols); err != nil {
+			return err
+		}
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(cols))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = v.String
+		}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// historyConn is the database connection returning the single row of the run history
+type historyConn struct{}
+
+func (c historyConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c historyConn) Driver() driver.Driver                        { return nil }
+func (c historyConn) Prepare(query string) (driver.Stmt, error)    { return historyStmt{}, nil }
+func (c historyConn) Close() error                                 { return nil }
+func (c historyConn) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+type historyStmt struct{}
+
+func (s historyStmt) Close() error  { return nil }
+func (s historyStmt) NumInput() int { return -1 }
+func (s historyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s historyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &historyRows{}, nil
+}
+
+type historyRows struct {
+	done bool
+}
+
+func (r *historyRows) Columns() []string { return []string{"chain_id", "name"} }
+func (r *historyRows) Close() error      { return nil }
+func (r *historyRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = int64(1), "backup"
+	return nil
+}
+
+func TestExportRunHistory(t *testing.T) {
+	assert.EqualError(t, taskExportRunHistory(context.Background(), nil, nil, ""), `unexpected end of JSON input`,
+		"Export with empty param should fail")
+	assert.EqualError(t, taskExportRunHistory(context.Background(), nil, nil, `{"destpath": ".", "format": "parquet"}`),
+		"Unsupported export format: parquet", "Export to unsupported format should fail")
+	assert.Error(t, taskExportRunHistory(context.Background(), nil, nil, `{"destpath": "non-existent"}`),
+		"Export to non-existent directory should fail")
+	assert.EqualError(t, taskExportRunHistory(context.Background(), nil, nil, `{"destpath": ".", "s3": {"bucket": "b"}}`),
+		"Export destination must be either local directory or S3 bucket", "Export to both destinations should fail")
+	assert.EqualError(t, taskExportRunHistory(context.Background(), nil, nil, `{"s3": {"key": "history"}}`),
+		"S3 bucket not specified", "Export to S3 without bucket should fail")
+	assert.EqualError(t, taskExportRunHistory(context.Background(), nil, nil, `{"destpath": "."}`),
+		"Configuration database connection is not established", "Export without database connection should fail")
+}
+
+func TestExportRunHistoryDestinations(t *testing.T) {
+	defer func(configDb *sqlx.DB) { pgengine.ConfigDb = configDb }(pgengine.ConfigDb)
+	pgengine.ConfigDb = sqlx.NewDb(sql.OpenDB(historyConn{}), "postgres")
+	ctx := clock.WithClock(context.Background(), clock.NewFake(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+	dir, err := ioutil.TempDir("", "export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, taskExportRunHistory(ctx, nil, nil, `{"destpath": "`+dir+`"}`))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "run_history_20200102T030405.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "chain_id,name\n1,backup\n", string(data))
+
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	s3 := `{"s3": {"endpoint": "` + server.URL + `", "bucket": "test", "key": "history", "accesskey": "key", "secretkey": "secret"}}`
+	assert.NoError(t, taskExportRunHistory(ctx, nil, nil, s3))
+	assert.Equal(t, "chain_id,name\n1,backup\n", string(objects["/test/history/run_history_20200102T030405.csv"]))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, taskExportRunHistory(cancelled, nil, nil, s3), "Export within cancelled context should fail")
+}
@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,7 +17,7 @@ type downloadOpts struct {
 	DestPath   string   `json:"destpath"`
 }
 
-func taskDownloadFile(paramValues string) error {
+func taskDownloadFile(_ context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
 	var opts downloadOpts
 	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
 		return err
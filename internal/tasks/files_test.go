@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -25,15 +26,15 @@ var ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http
 }))
 
 func TestDownloadFile(t *testing.T) {
-	assert.EqualError(t, taskDownloadFile(""), `unexpected end of JSON input`,
+	assert.EqualError(t, taskDownloadFile(context.Background(), nil, nil, ""), `unexpected end of JSON input`,
 		"Download with empty param should fail")
-	assert.EqualError(t, taskDownloadFile(`{"workersnum": 0, "fileurls": [] }`),
+	assert.EqualError(t, taskDownloadFile(context.Background(), nil, nil, `{"workersnum": 0, "fileurls": [] }`),
 		"Files to download are not specified", "Download with empty files should fail")
-	assert.Error(t, taskDownloadFile(`{"workersnum": 0, "fileurls": ["http://foo.bar"], "destpath": "non-existent" }`),
+	assert.Error(t, taskDownloadFile(context.Background(), nil, nil, `{"workersnum": 0, "fileurls": ["http://foo.bar"], "destpath": "non-existent" }`),
 		"Downlod with non-existent directory or insufficient rights should fail")
-	assert.Error(t, taskDownloadFile(`{"workersnum": 0, "fileurls": ["`+ts.URL+`"], "destpath": "." }`),
+	assert.Error(t, taskDownloadFile(context.Background(), nil, nil, `{"workersnum": 0, "fileurls": ["`+ts.URL+`"], "destpath": "." }`),
 		"Downlod with incorrect url should fail")
-	assert.NoError(t, taskDownloadFile(`{"workersnum": 0, "fileurls": ["`+ts.URL+`?filename=test.txt"], "destpath": "." }`),
+	assert.NoError(t, taskDownloadFile(context.Background(), nil, nil, `{"workersnum": 0, "fileurls": ["`+ts.URL+`?filename=test.txt"], "destpath": "." }`),
 		"Downlod with correct json input should succeed")
 	assert.NoError(t, os.RemoveAll("test.txt"), "Test output should be removed")
 
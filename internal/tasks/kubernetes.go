@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/kubernetes"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type kubernetesJobOpts struct {
+	Namespace    string                       `json:"namespace"`
+	Image        string                       `json:"image"`
+	Command      []string                     `json:"command"`
+	Args         []string                     `json:"args"`
+	Env          map[string]string            `json:"env"`
+	Resources    map[string]map[string]string `json:"resources"`
+	BackoffLimit int                          `json:"backoff_limit"`
+	Timeout      int                          `json:"timeout"` // in seconds, 0 means no timeout
+	Kubectl      string                       `json:"kubectl"`
+}
+
+// jobManifest returns JSON manifest of the Job running the single container, the unique name is generated by Kubernetes
+func jobManifest(opts kubernetesJobOpts) ([]byte, error) {
+	for kind := range opts.Resources {
+		if kind != "requests" && kind != "limits" {
+			return nil, fmt.Errorf("Unsupported resources: %s", kind)
+		}
+	}
+	container := map[string]interface{}{"name": "task", "image": opts.Image}
+	if len(opts.Command) > 0 {
+		container["command"] = opts.Command
+	}
+	if len(opts.Args) > 0 {
+		container["args"] = opts.Args
+	}
+	if len(opts.Resources) > 0 {
+		container["resources"] = opts.Resources
+	}
+	if len(opts.Env) > 0 {
+		names := make([]string, 0, len(opts.Env))
+		for name := range opts.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		env := make([]map[string]string, 0, len(names))
+		for _, name := range names {
+			env = append(env, map[string]string{"name": name, "value": opts.Env[name]})
+		}
+		container["env"] = env
+	}
+	return json.Marshal(map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"generateName": "pg-timetable-",
+			"labels":       map[string]string{"app.kubernetes.io/managed-by": "pg_timetable"},
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit": opts.BackoffLimit,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"restartPolicy": "Never",
+					"containers":    []interface{}{container},
+				},
+			},
+		},
+	})
+}
+
+// taskKubernetesJob creates Kubernetes Job running the "image" with the "command", "args", "env" and "resources"
+// and waits for its completion. Logs of the job are stored as the result output together with its exit code
+func taskKubernetesJob(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts := kubernetesJobOpts{Kubectl: "kubectl"}
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if opts.Image == "" {
+		return errors.New("Image of the Kubernetes job is not specified")
+	}
+	manifest, err := jobManifest(opts)
+	if err != nil {
+		return err
+	}
+	run := func(ctx context.Context, stdin string, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, opts.Kubectl, args...) // #nosec
+		cmd.Stdin = strings.NewReader(stdin)
+		return cmd.CombinedOutput()
+	}
+	start := time.Now()
+	job, err := kubernetes.RunJob(ctx, run, string(manifest), opts.Namespace, opts.Timeout)
+	if job.Name != "" {
+		result.AddArtifact(job.Name)
+		result.AddMetric("exit_code", float64(job.ExitCode))
+		result.AddMetric("duration", time.Since(start).Seconds())
+		result.Output += string(job.Logs)
+	}
+	return err
+}
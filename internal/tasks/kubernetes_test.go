@@ -0,0 +1,28 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobManifest(t *testing.T) {
+	manifest, err := jobManifest(kubernetesJobOpts{
+		Image:     "etl:2",
+		Command:   []string{"etl"},
+		Env:       map[string]string{"B": "2", "A": "1"},
+		Resources: map[string]map[string]string{"limits": {"memory": "8Gi"}},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion": "batch/v1", "kind": "Job",
+		"metadata": {"generateName": "pg-timetable-", "labels": {"app.kubernetes.io/managed-by": "pg_timetable"}},
+		"spec": {"backoffLimit": 0, "template": {"spec": {"restartPolicy": "Never", "containers": [{
+			"name": "task", "image": "etl:2", "command": ["etl"], "resources": {"limits": {"memory": "8Gi"}},
+			"env": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}]}]}}}}`, string(manifest))
+
+	_, err = jobManifest(kubernetesJobOpts{Image: "etl:2", Resources: map[string]map[string]string{"gpu": {}}})
+	assert.EqualError(t, err, "Unsupported resources: gpu")
+	assert.EqualError(t, taskKubernetesJob(context.Background(), nil, &Result{}, `{"command": ["etl"]}`), "Image of the Kubernetes job is not specified")
+	assert.Error(t, taskKubernetesJob(context.Background(), nil, &Result{}, `{"image": "etl:2", "kubectl": "/nonexistent/kubectl"}`))
+}
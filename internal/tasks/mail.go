@@ -1,24 +1,31 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 	"gopkg.in/gomail.v2"
 )
 
 type emailConn struct {
-	Username    string   `json:"username"`
-	Password    string   `json:"password"`
-	ServerHost  string   `json:"serverhost"`
-	ServerPort  int      `json:"serverport"`
-	SenderAddr  string   `json:"senderaddr"`
-	CcAddr      []string `json:"ccaddr"`
-	BccAddr     []string `json:"bccaddr"`
-	ToAddr      []string `json:"toaddr"`
-	Subject     string   `json:"subject"`
-	MsgBody     string   `json:"msgbody"`
-	Attachments []string `json:"attachment"`
+	Username    string      `json:"username"`
+	Password    string      `json:"password"`
+	ServerHost  string      `json:"serverhost"`
+	ServerPort  int         `json:"serverport"`
+	SenderAddr  string      `json:"senderaddr"`
+	CcAddr      []string    `json:"ccaddr"`
+	BccAddr     []string    `json:"bccaddr"`
+	ToAddr      []string    `json:"toaddr"`
+	Subject     string      `json:"subject"`
+	MsgBody     string      `json:"msgbody"`
+	BodyType    string      `json:"bodytype"`
+	Data        interface{} `json:"data"`
+	Attachments []string    `json:"attachment"`
 }
 
 type Dialer interface {
@@ -29,7 +36,7 @@ var getNewDialer func(host string, port int, username, password string) Dialer =
 	return gomail.NewDialer(host, port, username, password)
 }
 
-func taskSendMail(paramValues string) error {
+func taskSendMail(_ context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
 	var conn emailConn
 	if err := json.Unmarshal([]byte(paramValues), &conn); err != nil {
 		return err
@@ -52,10 +59,41 @@ func taskSendMail(paramValues string) error {
 	if len(conn.ToAddr) == 0 && len(conn.CcAddr) == 0 && len(conn.BccAddr) == 0 {
 		return errors.New("Recipient address not specified")
 	}
+	switch conn.BodyType {
+	case "":
+		conn.BodyType = "text/html"
+	case "text/html", "text/plain":
+	default:
+		return fmt.Errorf("Unsupported body type: %s", conn.BodyType)
+	}
+	var err error
+	// subject and body are templates executed against "data" parameter, e.g. "Report for {{.day}}"
+	if conn.Subject, err = executeTextTemplate(conn.Subject, conn.Data); err != nil {
+		return err
+	}
+	if conn.BodyType == "text/html" {
+		conn.MsgBody, err = executeHTMLTemplate(conn.MsgBody, conn.Data)
+	} else {
+		conn.MsgBody, err = executeTextTemplate(conn.MsgBody, conn.Data)
+	}
+	if err != nil {
+		return err
+	}
 
 	return sendMail(conn)
 }
 
+// executeHTMLTemplate escapes data values contextually, so they cannot break the markup
+func executeHTMLTemplate(text string, data interface{}) (string, error) {
+	tmpl, err := htmltemplate.New("mail").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
 func sendMail(conn emailConn) error {
 	mail := gomail.NewMessage()
 	mail.SetHeader("From", conn.SenderAddr)
@@ -82,7 +120,7 @@ func sendMail(conn emailConn) error {
 	mail.SetHeader("Bcc", bccrecipients...)
 
 	mail.SetHeader("Subject", conn.Subject)
-	mail.SetBody("text/html", conn.MsgBody)
+	mail.SetBody(conn.BodyType, conn.MsgBody)
 
 	//attach multiple documents
 	for _, attachment := range conn.Attachments {
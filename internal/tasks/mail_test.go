@@ -1,6 +1,8 @@
 package tasks
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,23 +23,58 @@ func TestTaskSendMail(t *testing.T) {
 		return &fakeDialer{}
 	}
 	assert := assert.New(t)
-	assert.Error(taskSendMail(""), `unexpected end of JSON input`,
+	assert.Error(taskSendMail(context.Background(), nil, nil, ""), `unexpected end of JSON input`,
 		"Sending mail with empty param should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":""}`),
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":""}`),
 		"The IP address or hostname of the mail server not specified", "Sending mail without host/IP should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":0}`),
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":0}`),
 		"The port of the mail server not specified", "Sending mail without port should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":587,"Username":""}`),
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":587,"Username":""}`),
 		"The username used for authenticating on the mail server not specified", "Sending mail without valid user id should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":""}`),
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":""}`),
 		"The password used for authenticating on the mail server not specified", "Sending mail with invalid authentication should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd","SenderAddr":""}`),
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd","SenderAddr":""}`),
 		"Sender address not specified", "Sending mail without a valid sender address should fail")
-	assert.EqualError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd",
+	assert.EqualError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd",
 		"SenderAddr":"abc@example.com","ToAddr":[],"CcAddr":[],"BccAddr":[]}`),
 		"Recipient address not specified", "Sending mail without recipient should fail")
-	assert.NoError(taskSendMail(`{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd",
+	assert.NoError(taskSendMail(context.Background(), nil, nil, `{"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd",
 		"SenderAddr":"abc@example.com","ToAddr":["to@example.com"],"CcAddr":["cc@example.com"],"BccAddr":["bcc@example.com"],
 		"Attachment": ["mail.go"]}`),
 		"Sending email with required json input should succeed")
 }
+
+type recordingDialer struct {
+	messages []*gomail.Message
+}
+
+func (d *recordingDialer) DialAndSend(m ...*gomail.Message) error {
+	d.messages = append(d.messages, m...)
+	return nil
+}
+
+func TestTaskSendMailTemplate(t *testing.T) {
+	dialer := &recordingDialer{}
+	getNewDialer = func(host string, port int, username, password string) Dialer {
+		return dialer
+	}
+	const conn = `"ServerHost":"smtp.example.com","ServerPort":587,"Username":"user","Password":"pwd",
+		"SenderAddr":"abc@example.com","ToAddr":["to@example.com"]`
+	assert.NoError(t, taskSendMail(context.Background(), nil, nil, `{`+conn+`,"subject":"Report {{.day}}","msgbody":"<b>{{.status}}</b>",
+		"data":{"day":"2020-03-01","status":"<failed>"}}`))
+	assert.Len(t, dialer.messages, 1)
+	var buf strings.Builder
+	_, err := dialer.messages[0].WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Subject: Report 2020-03-01")
+	assert.Contains(t, buf.String(), "<b>&lt;failed&gt;</b>", "Data should be escaped in HTML body")
+
+	assert.NoError(t, taskSendMail(context.Background(), nil, nil, `{`+conn+`,"bodytype":"text/plain","msgbody":"{{.status}}","data":{"status":"<failed>"}}`))
+	buf.Reset()
+	_, err = dialer.messages[1].WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "<failed>", "Data should not be escaped in plain text body")
+
+	assert.EqualError(t, taskSendMail(context.Background(), nil, nil, `{`+conn+`,"bodytype":"application/pdf"}`), "Unsupported body type: application/pdf")
+	assert.Error(t, taskSendMail(context.Background(), nil, nil, `{`+conn+`,"msgbody":"{{.status"}`), "Malformed template should fail")
+}
@@ -0,0 +1,104 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/lib/pq"
+)
+
+type matViewOpts struct {
+	Views        []string `json:"views"`
+	Concurrently bool     `json:"concurrently"`
+	LockTimeout  string   `json:"lock_timeout"`
+	Retries      int      `json:"retries"`
+	RetryDelay   string   `json:"retry_delay"`
+	retryDelay   time.Duration
+}
+
+// lockNotAvailable is SQLSTATE of the lock_timeout error
+const lockNotAvailable = "55P03"
+
+func parseMatViewOpts(paramValues string) (opts matViewOpts, err error) {
+	opts = matViewOpts{LockTimeout: "10s", Retries: 3, RetryDelay: "30s"}
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if len(opts.Views) == 0 {
+		return opts, errors.New("Materialized views to refresh are not specified")
+	}
+	if opts.Retries < 0 {
+		return opts, errors.New("Number of retries cannot be negative")
+	}
+	if opts.retryDelay, err = time.ParseDuration(opts.RetryDelay); err != nil {
+		return opts, fmt.Errorf("Invalid retry delay: %s", opts.RetryDelay)
+	}
+	return
+}
+
+// refreshMatView refreshes the materialized view within the transaction limited by lock_timeout
+func refreshMatView(name string, opts matViewOpts) error {
+	tx, err := pgengine.ConfigDb.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec("SELECT set_config('lock_timeout', $1, true)", opts.LockTimeout); err != nil {
+		return err
+	}
+	sql := "REFRESH MATERIALIZED VIEW "
+	if opts.Concurrently {
+		sql += "CONCURRENTLY "
+	}
+	if _, err := tx.Exec(sql + name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func isLockTimeout(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == lockNotAvailable
+}
+
+// taskRefreshMatViews refreshes materialized views one by one, optionally concurrently. The view is refreshed
+// again after "retry_delay" if it cannot be locked within "lock_timeout". Durations are reported by view
+func taskRefreshMatViews(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts, err := parseMatViewOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	c := clock.FromContext(ctx)
+	for _, view := range opts.Views {
+		var name string
+		// regclass output is the properly quoted name of the existing view
+		if err := pgengine.ConfigDb.Get(&name, "SELECT $1::regclass::text", view); err != nil {
+			return err
+		}
+		start := c.Now()
+		for attempt := 0; ; attempt++ {
+			err = refreshMatView(name, opts)
+			if err == nil || !isLockTimeout(err) || attempt >= opts.Retries {
+				break
+			}
+			pgengine.LogToDB("NOTICE", fmt.Sprintf("Cannot lock materialized view %s, retrying in %s", name, opts.retryDelay))
+			result.Retries++
+			c.Sleep(opts.retryDelay)
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot refresh materialized view %s: %s", name, err)
+		}
+		duration := c.Now().Sub(start).Seconds()
+		result.AddMetric(name, duration)
+		pgengine.LogToDB("LOG", fmt.Sprintf("Materialized view %s refreshed in %.3f seconds", name, duration))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatViewOpts(t *testing.T) {
+	_, err := parseMatViewOpts(`{}`)
+	assert.EqualError(t, err, "Materialized views to refresh are not specified")
+	_, err = parseMatViewOpts(`{"views": ["v"], "retries": -1}`)
+	assert.EqualError(t, err, "Number of retries cannot be negative")
+	_, err = parseMatViewOpts(`{"views": ["v"], "retry_delay": "soon"}`)
+	assert.EqualError(t, err, "Invalid retry delay: soon")
+	opts, err := parseMatViewOpts(`{"views": ["sales.daily", "sales.monthly"], "concurrently": true}`)
+	assert.NoError(t, err)
+	assert.True(t, opts.Concurrently)
+	assert.Equal(t, "10s", opts.LockTimeout)
+	assert.Equal(t, 3, opts.Retries)
+	assert.Equal(t, 30*time.Second, opts.retryDelay)
+	assert.EqualError(t, taskRefreshMatViews(context.Background(), nil, &Result{}, `{"views": ["v"]}`),
+		"Configuration database connection is not established")
+}
+
+func TestIsLockTimeout(t *testing.T) {
+	assert.True(t, isLockTimeout(&pq.Error{Code: "55P03"}))
+	assert.False(t, isLockTimeout(&pq.Error{Code: "42P01"}))
+	assert.False(t, isLockTimeout(errors.New("55P03")))
+}
@@ -0,0 +1,39 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type notifyOpts struct {
+	Channel string      `json:"channel"`
+	Payload string      `json:"payload"`
+	Data    interface{} `json:"data"`
+}
+
+// taskNotify sends NOTIFY with the payload template executed against the chain run information and data.
+// Notification is sent within the transaction of the element, so listeners learn only about committed work
+func taskNotify(ctx context.Context, run *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts notifyOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if opts.Channel == "" {
+		return errors.New("Notification channel not specified")
+	}
+	payload, err := executeTextTemplate(opts.Payload, newRunData(ctx, run, opts.Data))
+	if err != nil {
+		return err
+	}
+	if run.Tx == nil {
+		return errors.New("Notify task requires the chain transaction")
+	}
+	if _, err = run.Tx.Exec("SELECT pg_notify($1, $2)", opts.Channel, payload); err != nil {
+		return err
+	}
+	result.AddMetric("notifications", 1)
+	return nil
+}
@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// notifyConn is the database connection recording statements executed within transactions
+type notifyConn struct {
+	statements []string
+}
+
+func (c *notifyConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *notifyConn) Driver() driver.Driver                        { return nil }
+func (c *notifyConn) Prepare(query string) (driver.Stmt, error)    { return notifyStmt{c, query}, nil }
+func (c *notifyConn) Close() error                                 { return nil }
+func (c *notifyConn) Begin() (driver.Tx, error)                    { return c, nil }
+func (c *notifyConn) Commit() error                                { return nil }
+func (c *notifyConn) Rollback() error                              { return nil }
+
+type notifyStmt struct {
+	conn  *notifyConn
+	query string
+}
+
+func (s notifyStmt) Close() error  { return nil }
+func (s notifyStmt) NumInput() int { return -1 }
+func (s notifyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.statements = append(s.conn.statements, fmt.Sprint(s.query, args))
+	return driver.RowsAffected(0), nil
+}
+func (s notifyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestTaskNotify(t *testing.T) {
+	run := &pgengine.ChainRun{}
+	assert.EqualError(t, taskNotify(context.Background(), run, &Result{}, ""), `unexpected end of JSON input`,
+		"Notify with empty param should fail")
+	assert.EqualError(t, taskNotify(context.Background(), run, &Result{}, `{"payload": "done"}`),
+		"Notification channel not specified", "Notify without channel should fail")
+	assert.Error(t, taskNotify(context.Background(), run, &Result{}, `{"channel": "chain_done", "payload": "{{.Data.chain"}`),
+		"Notify with malformed payload template should fail")
+	assert.EqualError(t, taskNotify(context.Background(), run, &Result{}, `{"channel": "chain_done", "payload": "done"}`),
+		"Notify task requires the chain transaction", "Notify outside of the chain transaction should fail")
+
+	conn := &notifyConn{}
+	tx, err := sqlx.NewDb(sql.OpenDB(conn), "postgres").Beginx()
+	assert.NoError(t, err)
+	run = &pgengine.ChainRun{ChainConfigID: 3, ChainName: "export", RunStatusID: 42, Tx: tx, ElementID: 7, TaskName: "Notify"}
+	var result Result
+	assert.NoError(t, taskNotify(context.Background(), run, &result,
+		`{"channel": "chain_done", "payload": "{{.ChainName}} {{.ChainConfigID}} {{.RunStatusID}} {{.ElementID}} {{.TaskName}} {{.Data.file}}", "data": {"file": "a.csv"}}`))
+	assert.NoError(t, tx.Rollback())
+	assert.Equal(t, []string{"SELECT pg_notify($1, $2)[chain_done export 3 42 7 Notify a.csv]"}, conn.statements,
+		"Notification should be sent within the transaction with the run information")
+	assert.Equal(t, 1.0, result.Metrics["notifications"])
+}
@@ -0,0 +1,181 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/lib/pq"
+)
+
+type partitionOpts struct {
+	Table      string `json:"table"`
+	Interval   string `json:"interval"`
+	Premake    int    `json:"premake"`
+	Keep       int    `json:"keep"`
+	DetachOnly bool   `json:"detach_only"`
+}
+
+// partition name suffix layouts by interval, weekly partitions are named by their Monday
+var partitionLayouts = map[string]string{"day": "20060102", "week": "20060102", "month": "200601", "year": "2006"}
+
+type partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+func parsePartitionOpts(paramValues string) (opts partitionOpts, err error) {
+	opts = partitionOpts{Interval: "month", Premake: 3}
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if opts.Table == "" {
+		return opts, errors.New("Partitioned table is not specified")
+	}
+	if _, ok := partitionLayouts[opts.Interval]; !ok {
+		return opts, fmt.Errorf("Unsupported partition interval: %s", opts.Interval)
+	}
+	if opts.Premake < 1 || opts.Keep < 0 {
+		return opts, errors.New("Number of partitions to premake must be positive and to keep not negative")
+	}
+	return
+}
+
+// periodStart returns the beginning of the period containing t
+func periodStart(t time.Time, interval string) time.Time {
+	y, m, d := t.Date()
+	switch interval {
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// addPeriods moves the period start n periods forward or backward
+func addPeriods(t time.Time, interval string, n int) time.Time {
+	switch interval {
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(n, 0, 0)
+}
+
+// upcomingPartitions returns the partition of the current period and premake partitions after it
+func upcomingPartitions(now time.Time, relname string, opts partitionOpts) []partition {
+	start := periodStart(now, opts.Interval)
+	parts := make([]partition, 0, opts.Premake+1)
+	for i := 0; i <= opts.Premake; i++ {
+		from := addPeriods(start, opts.Interval, i)
+		parts = append(parts, partition{
+			Name: relname + "_p" + from.Format(partitionLayouts[opts.Interval]),
+			From: from,
+			To:   addPeriods(from, opts.Interval, 1),
+		})
+	}
+	return parts
+}
+
+// expiredPartitions returns sorted names of partitions created by the task ending before the keep periods
+// preceding the current one, other partitions are never touched
+func expiredPartitions(now time.Time, relname string, children []string, opts partitionOpts) []string {
+	if opts.Keep == 0 {
+		return nil
+	}
+	threshold := addPeriods(periodStart(now, opts.Interval), opts.Interval, -opts.Keep)
+	var expired []string
+	for _, child := range children {
+		if !strings.HasPrefix(child, relname+"_p") {
+			continue
+		}
+		from, err := time.Parse(partitionLayouts[opts.Interval], strings.TrimPrefix(child, relname+"_p"))
+		if err != nil {
+			continue
+		}
+		if !addPeriods(from, opts.Interval, 1).After(threshold) {
+			expired = append(expired, child)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+const sqlSelectPartitionedTable = `SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.oid = $1::regclass AND c.relkind = 'p'`
+
+const sqlSelectPartitions = `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = $1::regclass`
+
+// taskPartitionMaintenance creates partitions of the current and "premake" next periods of the table partitioned
+// by range of the time column and detaches partitions older than "keep" periods, dropping them unless "detach_only"
+func taskPartitionMaintenance(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts, err := parsePartitionOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	var table struct {
+		Schema  string `db:"nspname"`
+		Relname string `db:"relname"`
+	}
+	if err := pgengine.ConfigDb.Get(&table, sqlSelectPartitionedTable, opts.Table); err != nil {
+		return fmt.Errorf("Cannot find partitioned table %s: %s", opts.Table, err)
+	}
+	quote := func(name string) string {
+		return pq.QuoteIdentifier(table.Schema) + "." + pq.QuoteIdentifier(name)
+	}
+	parent := quote(table.Relname)
+	var children []string
+	if err := pgengine.ConfigDb.Select(&children, sqlSelectPartitions, opts.Table); err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(children))
+	for _, child := range children {
+		existing[child] = true
+	}
+	now := clock.FromContext(ctx).Now()
+	for _, part := range upcomingPartitions(now, table.Relname, opts) {
+		if existing[part.Name] {
+			continue
+		}
+		sql := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)", quote(part.Name), parent,
+			pq.QuoteLiteral(part.From.Format("2006-01-02")), pq.QuoteLiteral(part.To.Format("2006-01-02")))
+		if _, err := pgengine.ConfigDb.Exec(sql); err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", "Partition created: ", quote(part.Name))
+		result.AddMetric("created", 1)
+	}
+	for _, name := range expiredPartitions(now, table.Relname, children, opts) {
+		if _, err := pgengine.ConfigDb.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", parent, quote(name))); err != nil {
+			return err
+		}
+		result.AddMetric("detached", 1)
+		if opts.DetachOnly {
+			pgengine.LogToDB("LOG", "Partition detached: ", quote(name))
+			continue
+		}
+		if _, err := pgengine.ConfigDb.Exec("DROP TABLE " + quote(name)); err != nil {
+			return err
+		}
+		pgengine.LogToDB("LOG", "Partition dropped: ", quote(name))
+		result.AddMetric("dropped", 1)
+	}
+	return nil
+}
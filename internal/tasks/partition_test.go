@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePartitionOpts(t *testing.T) {
+	_, err := parsePartitionOpts(`{}`)
+	assert.EqualError(t, err, "Partitioned table is not specified")
+	_, err = parsePartitionOpts(`{"table": "t", "interval": "hour"}`)
+	assert.EqualError(t, err, "Unsupported partition interval: hour")
+	_, err = parsePartitionOpts(`{"table": "t", "premake": 0}`)
+	assert.Error(t, err)
+	opts, err := parsePartitionOpts(`{"table": "sales.orders", "keep": 12}`)
+	assert.NoError(t, err)
+	assert.Equal(t, partitionOpts{Table: "sales.orders", Interval: "month", Premake: 3, Keep: 12}, opts)
+	assert.EqualError(t, taskPartitionMaintenance(context.Background(), nil, &Result{}, `{"table": "t"}`),
+		"Configuration database connection is not established")
+}
+
+func TestUpcomingPartitions(t *testing.T) {
+	now := time.Date(2021, 12, 30, 15, 4, 5, 0, time.UTC) // Thursday
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	assert.Equal(t, []partition{
+		{"orders_p202112", date(2021, 12, 1), date(2022, 1, 1)},
+		{"orders_p202201", date(2022, 1, 1), date(2022, 2, 1)},
+	}, upcomingPartitions(now, "orders", partitionOpts{Interval: "month", Premake: 1}))
+	assert.Equal(t, []partition{
+		{"orders_p20211227", date(2021, 12, 27), date(2022, 1, 3)},
+		{"orders_p20220103", date(2022, 1, 3), date(2022, 1, 10)},
+	}, upcomingPartitions(now, "orders", partitionOpts{Interval: "week", Premake: 1}))
+	assert.Equal(t, []partition{
+		{"orders_p20211230", date(2021, 12, 30), date(2021, 12, 31)},
+		{"orders_p20211231", date(2021, 12, 31), date(2022, 1, 1)},
+	}, upcomingPartitions(now, "orders", partitionOpts{Interval: "day", Premake: 1}))
+	assert.Equal(t, "orders_p2022", upcomingPartitions(now, "orders", partitionOpts{Interval: "year", Premake: 1})[1].Name)
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	now := time.Date(2021, 12, 30, 15, 4, 5, 0, time.UTC)
+	children := []string{"orders_p202112", "orders_p202109", "orders_p202110", "orders_default", "orders_p202108", "other_p202101"}
+	assert.Equal(t, []string{"orders_p202108", "orders_p202109"},
+		expiredPartitions(now, "orders", children, partitionOpts{Interval: "month", Keep: 2}))
+	assert.Empty(t, expiredPartitions(now, "orders", children, partitionOpts{Interval: "month"}), "Keep all partitions by default")
+}
@@ -0,0 +1,47 @@
+package tasks
+
+import "encoding/json"
+
+// Result statuses of the builtin tasks
+const (
+	ResultOK      = "OK"
+	ResultFailed  = "FAILED"
+	ResultSkipped = "SKIPPED"
+)
+
+// Result is the machine-readable outcome of the builtin task. It is stored as the output
+// of the chain element and is available to the subsequent elements of the same run
+type Result struct {
+	Status    string             `json:"status"`
+	Message   string             `json:"message,omitempty"`
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+	Artifacts []string           `json:"artifacts,omitempty"`
+	Retries   int                `json:"retries,omitempty"` // of the operations failed temporarily, e.g. lock timeouts
+	Output    string             `json:"output,omitempty"`  // of the external process, e.g. job logs
+}
+
+// AddMetric adds value to the named metric, so metrics are accumulated over several parameter values
+func (r *Result) AddMetric(name string, value float64) {
+	if r.Metrics == nil {
+		r.Metrics = make(map[string]float64)
+	}
+	r.Metrics[name] += value
+}
+
+// AddArtifact records the file or object produced by the task
+func (r *Result) AddArtifact(artifact string) {
+	r.Artifacts = append(r.Artifacts, artifact)
+}
+
+// finish sets the final status of the result and returns it encoded as JSON
+func (r *Result) finish(err error) []byte {
+	switch {
+	case err != nil:
+		r.Status = ResultFailed
+		r.Message = err.Error()
+	case r.Status == "":
+		r.Status = ResultOK
+	}
+	out, _ := json.Marshal(r)
+	return out
+}
@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type retentionOpts struct {
+	Period    string `json:"period"`
+	BatchSize int    `json:"batchsize"`
+}
+
+// statements deleting at most $2 rows older than $1 interval, whole runs are deleted from run_status.
+// Statements are skipped if the feature of the table is disabled
+var sqlRetention = []struct {
+	feature string
+	sql     string
+}{
+	{pgengine.FeatureCore, `DELETE FROM timetable.log WHERE ctid = ANY(ARRAY(
+		SELECT ctid FROM timetable.log WHERE ts < now() - $1 :: interval LIMIT $2))`},
+	{pgengine.FeatureCore, `DELETE FROM timetable.execution_log WHERE ctid = ANY(ARRAY(
+		SELECT ctid FROM timetable.execution_log WHERE last_run < now() - $1 :: interval LIMIT $2))`},
+	{pgengine.FeatureCore, `DELETE FROM timetable.run_status WHERE COALESCE(start_status, run_status) = ANY(ARRAY(
+		SELECT COALESCE(start_status, run_status) FROM timetable.run_status 
+		GROUP BY 1 HAVING max(last_status_update) < now() - $1 :: interval LIMIT $2))`},
+	{pgengine.FeatureContention, `DELETE FROM timetable.chain_wait WHERE ctid = ANY(ARRAY(
+		SELECT ctid FROM timetable.chain_wait WHERE finished < now() - $1 :: interval LIMIT $2))`},
+	{pgengine.FeatureClientGroups, `DELETE FROM timetable.chain_claim WHERE ctid = ANY(ARRAY(
+		SELECT ctid FROM timetable.chain_claim WHERE claimed < now() - $1 :: interval LIMIT $2))`},
+}
+
+func taskRetention(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts := retentionOpts{Period: "30 days", BatchSize: 10000}
+	if paramValues > "" {
+		if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+			return err
+		}
+	}
+	if opts.BatchSize <= 0 {
+		return errors.New("Batch size should be greater than zero")
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	// artifact files are removed before runs they belong to
+	deleted, err := pgengine.DeleteExpiredArtifacts(ctx, opts.Period)
+	if err != nil {
+		return err
+	}
+	result.AddMetric("deleted_artifacts", float64(deleted))
+	for _, stmt := range sqlRetention {
+		if !pgengine.Enabled(stmt.feature) {
+			continue
+		}
+		var total int64
+		for {
+			res, err := pgengine.ConfigDb.ExecContext(ctx, pgengine.SchemaSQL(stmt.sql), opts.Period, opts.BatchSize)
+			if err != nil {
+				return err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			total += rows
+			if rows < int64(opts.BatchSize) {
+				break
+			}
+		}
+		pgengine.LogToDB("LOG", "Retention task deleted ", total, " rows older than ", opts.Period)
+		result.AddMetric("deleted_rows", float64(total))
+	}
+	return nil
+}
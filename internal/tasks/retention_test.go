@@ -0,0 +1,16 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	assert.Error(t, taskRetention(context.Background(), nil, &Result{}, "foo"), "Retention with malformed param should fail")
+	assert.EqualError(t, taskRetention(context.Background(), nil, &Result{}, `{"period": "1 day", "batchsize": -1}`),
+		"Batch size should be greater than zero", "Retention with negative batch size should fail")
+	assert.EqualError(t, taskRetention(context.Background(), nil, &Result{}, ""),
+		"Configuration database connection is not established", "Retention without database connection should fail")
+}
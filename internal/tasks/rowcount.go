@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type rowCountTable struct {
+	Name     string `json:"name"`
+	MinDelta *int64 `json:"mindelta"`
+	MaxDelta *int64 `json:"maxdelta"`
+}
+
+type rowCountOpts struct {
+	Tables   []rowCountTable `json:"tables"`
+	Checksum bool            `json:"checksum"`
+	Warn     bool            `json:"warn"`
+}
+
+// snapshot of the table taken by the previous run
+type rowCountSnapshot struct {
+	RowCount int64          `db:"row_count"`
+	Checksum sql.NullString `db:"checksum"`
+}
+
+const sqlSelectLastSnapshot = `SELECT row_count, checksum FROM timetable.row_count_snapshot
+WHERE table_name = $1 ORDER BY taken DESC LIMIT 1`
+
+const sqlInsertSnapshot = `INSERT INTO timetable.row_count_snapshot (table_name, row_count, checksum) VALUES ($1, $2, $3)`
+
+func parseRowCountOpts(paramValues string) (opts rowCountOpts, err error) {
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if len(opts.Tables) == 0 {
+		return opts, errors.New("Tables to snapshot are not specified")
+	}
+	for _, table := range opts.Tables {
+		if table.Name == "" {
+			return opts, errors.New("Table name is not specified")
+		}
+		if table.MinDelta != nil && table.MaxDelta != nil && *table.MinDelta > *table.MaxDelta {
+			return opts, fmt.Errorf("Minimum delta is greater than maximum delta for table %s", table.Name)
+		}
+	}
+	return
+}
+
+// checkDelta returns error if the row count changed outside of the expected range
+func (table rowCountTable) checkDelta(prev, cur int64) error {
+	delta := cur - prev
+	if table.MinDelta != nil && delta < *table.MinDelta || table.MaxDelta != nil && delta > *table.MaxDelta {
+		return fmt.Errorf("Row count delta %d of table %s (%d -> %d) is outside of the expected range [%s, %s]",
+			delta, table.Name, prev, cur, formatLimit(table.MinDelta), formatLimit(table.MaxDelta))
+	}
+	return nil
+}
+
+func formatLimit(limit *int64) string {
+	if limit == nil {
+		return "-"
+	}
+	return fmt.Sprint(*limit)
+}
+
+// taskRowCountSnapshot records row counts and optional checksums of the tables in timetable.row_count_snapshot.
+// Tables with row count delta since the previous snapshot outside of the expected range fail the task,
+// or only logged if "warn" is set
+func taskRowCountSnapshot(_ context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts, err := parseRowCountOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	if pgengine.ConfigDb == nil {
+		return errors.New("Configuration database connection is not established")
+	}
+	var violations []string
+	for _, table := range opts.Tables {
+		var name string
+		// regclass output is the properly quoted name of the existing table
+		if err := pgengine.ConfigDb.Get(&name, "SELECT $1::regclass::text", table.Name); err != nil {
+			return err
+		}
+		var cur rowCountSnapshot
+		query := fmt.Sprintf("SELECT count(*) AS row_count, NULL AS checksum FROM %s", name)
+		if opts.Checksum {
+			query = fmt.Sprintf("SELECT count(*) AS row_count, "+
+				"md5(string_agg(md5(t::text), '' ORDER BY md5(t::text))) AS checksum FROM %s AS t", name)
+		}
+		if err := pgengine.ConfigDb.Get(&cur, query); err != nil {
+			return err
+		}
+		var prev rowCountSnapshot
+		prevErr := pgengine.ConfigDb.Get(&prev, pgengine.SchemaSQL(sqlSelectLastSnapshot), name)
+		if prevErr != nil && prevErr != sql.ErrNoRows {
+			return prevErr
+		}
+		if _, err := pgengine.ConfigDb.Exec(pgengine.SchemaSQL(sqlInsertSnapshot), name, cur.RowCount, cur.Checksum); err != nil {
+			return err
+		}
+		result.AddMetric(name, float64(cur.RowCount))
+		if prevErr == sql.ErrNoRows {
+			pgengine.LogToDB("LOG", fmt.Sprintf("First snapshot of table %s: %d rows", name, cur.RowCount))
+			continue
+		}
+		msg := fmt.Sprintf("Snapshot of table %s: %d rows, delta %d", name, cur.RowCount, cur.RowCount-prev.RowCount)
+		if cur.Checksum.Valid && prev.Checksum.Valid {
+			if cur.Checksum.String == prev.Checksum.String {
+				msg += ", content unchanged"
+			} else {
+				msg += ", content changed"
+			}
+		}
+		pgengine.LogToDB("LOG", msg)
+		if err := table.checkDelta(prev.RowCount, cur.RowCount); err != nil {
+			violations = append(violations, err.Error())
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	result.AddMetric("violations", float64(len(violations)))
+	if opts.Warn {
+		for _, v := range violations {
+			pgengine.LogToDB("NOTICE", v)
+		}
+		return nil
+	}
+	return errors.New(strings.Join(violations, "; "))
+}
@@ -0,0 +1,37 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRowCountOpts(t *testing.T) {
+	_, err := parseRowCountOpts(`{}`)
+	assert.EqualError(t, err, "Tables to snapshot are not specified")
+	_, err = parseRowCountOpts(`{"tables": [{"mindelta": 1}]}`)
+	assert.EqualError(t, err, "Table name is not specified")
+	_, err = parseRowCountOpts(`{"tables": [{"name": "t", "mindelta": 10, "maxdelta": 1}]}`)
+	assert.EqualError(t, err, "Minimum delta is greater than maximum delta for table t")
+	opts, err := parseRowCountOpts(`{"tables": [{"name": "sales.orders", "mindelta": 1}], "checksum": true}`)
+	assert.NoError(t, err)
+	assert.True(t, opts.Checksum)
+	assert.EqualValues(t, 1, *opts.Tables[0].MinDelta)
+	assert.Nil(t, opts.Tables[0].MaxDelta)
+	assert.EqualError(t, taskRowCountSnapshot(context.Background(), nil, &Result{}, `{"tables": [{"name": "t"}]}`),
+		"Configuration database connection is not established")
+}
+
+func TestRowCountCheckDelta(t *testing.T) {
+	min, max := int64(1), int64(100)
+	table := rowCountTable{Name: "t", MinDelta: &min, MaxDelta: &max}
+	assert.NoError(t, table.checkDelta(10, 11))
+	assert.NoError(t, table.checkDelta(10, 110))
+	assert.EqualError(t, table.checkDelta(10, 10), "Row count delta 0 of table t (10 -> 10) is outside of the expected range [1, 100]")
+	assert.Error(t, table.checkDelta(10, 111))
+	table.MaxDelta = nil
+	assert.NoError(t, table.checkDelta(0, 1000000))
+	assert.EqualError(t, table.checkDelta(5, 0), "Row count delta -5 of table t (5 -> 0) is outside of the expected range [1, -]")
+	assert.NoError(t, rowCountTable{Name: "t"}.checkDelta(5, 0), "Should accept any delta without limits")
+}
@@ -0,0 +1,157 @@
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/cybertec-postgresql/pg_timetable/internal/sigv4"
+)
+
+type s3Opts struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+	AccessKey    string `json:"accesskey"`
+	SecretKey    string `json:"secretkey"`
+	SessionToken string `json:"sessiontoken"`
+	File         string `json:"file"`
+}
+
+var s3Client = &http.Client{}
+
+func parseS3Opts(paramValues string) (opts s3Opts, err error) {
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if opts.Bucket == "" {
+		return opts, errors.New("S3 bucket not specified")
+	}
+	if opts.Key == "" {
+		return opts, errors.New("S3 object key not specified")
+	}
+	if opts.File == "" {
+		return opts, errors.New("Local file not specified")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	return
+}
+
+// objectURL returns virtual hosted AWS URL if endpoint is omitted,
+// otherwise path style URL used by S3 compatible storages, e.g. MinIO
+func (opts s3Opts) objectURL() string {
+	segments := strings.Split(strings.TrimPrefix(opts.Key, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	key := strings.Join(segments, "/")
+	if opts.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", opts.Bucket, opts.Region, key)
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(opts.Endpoint, "/"), url.PathEscape(opts.Bucket), key)
+}
+
+func (opts s3Opts) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	creds := sigv4.Credentials{AccessKey: opts.AccessKey, SecretKey: opts.SecretKey, SessionToken: opts.SessionToken}.FromEnv()
+	sigv4.Sign(req, creds, opts.Region, "s3", payloadHash, clock.FromContext(req.Context()).Now())
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("S3 request %s %s failed with status %s: %s", req.Method, req.URL, resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// taskS3Upload uploads local file as a single object, so the file size is limited to 5GB by S3
+func taskS3Upload(ctx context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
+	opts, err := parseS3Opts(paramValues)
+	if err != nil {
+		return err
+	}
+	if err = opts.upload(ctx); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Uploaded %s to %s", opts.File, opts.objectURL()))
+	return nil
+}
+
+// upload puts the local file as the object
+func (opts s3Opts) upload(ctx context.Context) error {
+	f, err := os.Open(opts.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", opts.objectURL(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := opts.do(req, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// taskS3Download downloads object to the temporary file renamed to the destination on success
+func taskS3Download(ctx context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
+	opts, err := parseS3Opts(paramValues)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", opts.objectURL(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := opts.do(req, sigv4.EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	tmp, err := ioutil.TempFile(filepath.Dir(opts.File), filepath.Base(opts.File)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), opts.File); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Downloaded %s to %s", req.URL, opts.File))
+	return nil
+}
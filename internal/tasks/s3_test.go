@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3ObjectURL(t *testing.T) {
+	opts := s3Opts{Bucket: "backups", Region: "eu-central-1", Key: "/daily/db 1.dump"}
+	assert.Equal(t, "https://backups.s3.eu-central-1.amazonaws.com/daily/db%201.dump", opts.objectURL())
+	opts.Endpoint = "http://localhost:9000/"
+	assert.Equal(t, "http://localhost:9000/backups/daily/db%201.dump", opts.objectURL())
+}
+
+func TestTaskS3(t *testing.T) {
+	var mutex sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.Method {
+		case "PUT":
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case "GET":
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "s3")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.txt")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("pg_timetable"), 0644))
+	dst := filepath.Join(dir, "dst.txt")
+	conn := `"endpoint": "` + server.URL + `", "bucket": "test", "accesskey": "key", "secretkey": "secret", "key": "dir/obj.txt"`
+
+	assert.EqualError(t, taskS3Upload(context.Background(), nil, nil, `{"key": "obj"}`), "S3 bucket not specified")
+	assert.EqualError(t, taskS3Upload(context.Background(), nil, nil, `{"bucket": "test"}`), "S3 object key not specified")
+	assert.EqualError(t, taskS3Upload(context.Background(), nil, nil, `{"bucket": "test", "key": "obj"}`), "Local file not specified")
+	assert.Error(t, taskS3Upload(context.Background(), nil, nil, `{`+conn+`, "file": "non-existent"}`), "Upload of non-existent file should fail")
+
+	assert.NoError(t, taskS3Upload(context.Background(), nil, nil, `{`+conn+`, "file": "`+src+`"}`))
+	assert.Equal(t, []byte("pg_timetable"), objects["/test/dir/obj.txt"])
+	assert.NoError(t, taskS3Download(context.Background(), nil, nil, `{`+conn+`, "file": "`+dst+`"}`))
+	data, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "pg_timetable", string(data))
+
+	assert.Error(t, taskS3Download(context.Background(), nil, nil, `{"endpoint": "`+server.URL+`", "bucket": "test", "accesskey": "key", "key": "missing", "file": "`+dst+`"}`),
+		"Download of missing object should fail")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, taskS3Upload(ctx, nil, nil, `{`+conn+`, "file": "`+src+`"}`), "Upload within cancelled context should fail")
+}
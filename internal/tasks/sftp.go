@@ -0,0 +1,189 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type sftpOpts struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	PrivateKey string `json:"privatekey"`
+	Passphrase string `json:"passphrase"`
+	KnownHosts string `json:"knownhosts"`
+	HostKey    string `json:"hostkey"`
+	Timeout    int    `json:"timeout"`
+	Local      string `json:"localpath"`
+	Remote     string `json:"remotepath"`
+}
+
+func parseSftpOpts(paramValues string) (opts sftpOpts, err error) {
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	switch {
+	case opts.Host == "":
+		return opts, errors.New("The IP address or hostname of the SFTP server not specified")
+	case opts.Username == "":
+		return opts, errors.New("The username used for authenticating on the SFTP server not specified")
+	case opts.Password == "" && opts.PrivateKey == "":
+		return opts, errors.New("Neither password nor private key specified")
+	case opts.Local == "" || opts.Remote == "":
+		return opts, errors.New("Local and remote paths must be specified")
+	}
+	if opts.Port == 0 {
+		opts.Port = 22
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30
+	}
+	return
+}
+
+// hostKeyCallback verifies server against the explicit host key in authorized_keys format if specified,
+// or against the known_hosts file, "~/.ssh/known_hosts" by default. Unknown hosts are always rejected
+func (opts sftpOpts) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if opts.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.HostKey))
+		if err != nil {
+			return nil, err
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	if opts.KnownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		opts.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return knownhosts.New(opts.KnownHosts)
+}
+
+func (opts sftpOpts) authMethods() ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if opts.PrivateKey != "" {
+		pem, err := ioutil.ReadFile(opts.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		var signer ssh.Signer
+		if opts.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(opts.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		methods = append(methods, ssh.Password(opts.Password))
+	}
+	return methods, nil
+}
+
+func (opts sftpOpts) connect() (*ssh.Client, *sftp.Client, error) {
+	hostKeyCallback, err := opts.hostKeyCallback()
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, err := opts.authMethods()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)), &ssh.ClientConfig{
+		User:            opts.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(opts.Timeout) * time.Second,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, client, nil
+}
+
+func taskSftpUpload(_ context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
+	opts, err := parseSftpOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(opts.Local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	conn, client, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer client.Close()
+	dst, err := client.Create(opts.Remote)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Uploaded %s to %s:%s", opts.Local, opts.Host, opts.Remote))
+	return nil
+}
+
+func taskSftpDownload(_ context.Context, _ *pgengine.ChainRun, _ *Result, paramValues string) error {
+	opts, err := parseSftpOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	conn, client, err := opts.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer client.Close()
+	src, err := client.Open(opts.Remote)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(opts.Local)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Downloaded %s:%s to %s", opts.Host, opts.Remote, opts.Local))
+	return nil
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSftpServer serves sftp subsystem for the user "user" with password "pwd"
+func startSftpServer(t *testing.T) (listener net.Listener, hostKey string) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(private)
+	assert.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(pass) == "pwd" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", c.User())
+		},
+	}
+	config.AddHostKey(signer)
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSftp(conn, config)
+		}
+	}()
+	return listener, string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+}
+
+func serveSftp(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				_ = req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(requests)
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		_ = server.Serve()
+		server.Close()
+	}
+}
+
+func TestTaskSftp(t *testing.T) {
+	listener, hostKey := startSftpServer(t)
+	defer listener.Close()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	dir, err := ioutil.TempDir("", "sftp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.txt")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("pg_timetable"), 0644))
+	remote := filepath.Join(dir, "remote.txt")
+	dst := filepath.Join(dir, "dst.txt")
+	conn := fmt.Sprintf(`"host": "%s", "port": %s, "username": "user", "hostkey": %q`, host, port, hostKey)
+
+	assert.EqualError(t, taskSftpUpload(context.Background(), nil, nil, `{}`), "The IP address or hostname of the SFTP server not specified")
+	assert.EqualError(t, taskSftpUpload(context.Background(), nil, nil, `{"host": "localhost"}`), "The username used for authenticating on the SFTP server not specified")
+	assert.EqualError(t, taskSftpUpload(context.Background(), nil, nil, `{"host": "localhost", "username": "user"}`), "Neither password nor private key specified")
+	assert.EqualError(t, taskSftpUpload(context.Background(), nil, nil, `{"host": "localhost", "username": "user", "password": "pwd"}`), "Local and remote paths must be specified")
+
+	assert.Error(t, taskSftpUpload(context.Background(), nil, nil, `{`+conn+`, "password": "wrong", "localpath": "`+src+`", "remotepath": "`+remote+`"}`),
+		"Upload with wrong password should fail")
+	knownHosts := filepath.Join(dir, "known_hosts")
+	assert.NoError(t, ioutil.WriteFile(knownHosts, nil, 0644))
+	assert.Error(t, taskSftpUpload(context.Background(), nil, nil, fmt.Sprintf(`{"host": "%s", "port": %s, "username": "user", "password": "pwd", "knownhosts": "%s", "localpath": "%s", "remotepath": "%s"}`,
+		host, port, knownHosts, src, remote)), "Upload to unknown host should fail")
+
+	assert.NoError(t, taskSftpUpload(context.Background(), nil, nil, `{`+conn+`, "password": "pwd", "localpath": "`+src+`", "remotepath": "`+remote+`"}`))
+	assert.NoError(t, taskSftpDownload(context.Background(), nil, nil, `{`+conn+`, "password": "pwd", "localpath": "`+dst+`", "remotepath": "`+remote+`"}`))
+	data, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, "pg_timetable", string(data))
+}
@@ -0,0 +1,264 @@
+package tasks
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+// sinkOpts describes the destination of the SQL task result set stored in timetable.task_chain.sink
+type sinkOpts struct {
+	Path   string  `json:"path"`
+	S3     *s3Opts `json:"s3"`
+	Format string  `json:"format"`
+	Header *bool   `json:"header"`
+	Gzip   *bool   `json:"gzip"` // defaults to true for names ending with ".gz"
+}
+
+var sinkDelimiters = map[string]rune{"csv": ',', "tsv": '\t'}
+
+func parseSinkOpts(spec string) (opts sinkOpts, err error) {
+	if err = json.Unmarshal([]byte(spec), &opts); err != nil {
+		return
+	}
+	name := opts.Path
+	if opts.S3 != nil {
+		if opts.Path != "" {
+			return opts, errors.New("Sink must be either local file or S3 object")
+		}
+		if opts.S3.Bucket == "" {
+			return opts, errors.New("S3 bucket not specified")
+		}
+		if opts.S3.Key == "" {
+			return opts, errors.New("S3 object key not specified")
+		}
+		if opts.S3.Region == "" {
+			opts.S3.Region = "us-east-1"
+		}
+		name = opts.S3.Key
+	} else if opts.Path == "" {
+		return opts, errors.New("Sink file not specified")
+	}
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if _, ok := sinkDelimiters[opts.Format]; !ok && opts.Format != "json" {
+		return opts, fmt.Errorf("Unsupported sink format: %s", opts.Format)
+	}
+	if opts.Gzip == nil {
+		gz := strings.HasSuffix(name, ".gz")
+		opts.Gzip = &gz
+	}
+	return
+}
+
+// rowEncoder writes records of the result set in the sink format
+type rowEncoder interface {
+	encode(columns []string, types []string, values []interface{}) error
+	flush() error
+}
+
+// csvEncoder writes the header before the first record, so result sets of several executions
+// are concatenated under the columns of the first one
+type csvEncoder struct {
+	w       *csv.Writer
+	header  bool
+	written bool
+	record  []string
+}
+
+func (e *csvEncoder) encode(columns []string, _ []string, values []interface{}) error {
+	if !e.written && e.header {
+		if err := e.w.Write(columns); err != nil {
+			return err
+		}
+	}
+	e.written = true
+	e.record = e.record[:0]
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			e.record = append(e.record, "")
+		case []byte:
+			e.record = append(e.record, string(v))
+		case time.Time:
+			e.record = append(e.record, v.Format(time.RFC3339Nano))
+		default:
+			e.record = append(e.record, fmt.Sprint(v))
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonEncoder writes every record as the JSON object on the separate line (JSON Lines),
+// values of json and jsonb columns are embedded as is
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonEncoder) encode(columns []string, types []string, values []interface{}) error {
+	record := make(map[string]interface{}, len(columns))
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			if types[i] == "JSON" || types[i] == "JSONB" {
+				v = json.RawMessage(b)
+			} else {
+				v = string(b)
+			}
+		}
+		record[columns[i]] = v
+	}
+	return e.enc.Encode(record)
+}
+
+func (e *jsonEncoder) flush() error {
+	return nil
+}
+
+// Sink streams result sets into the temporary file, which is renamed to the destination or uploaded
+// to S3 on Close, so the destination never contains partial results
+type Sink struct {
+	opts sinkOpts
+	file *os.File
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+	enc  rowEncoder
+	rows int64
+}
+
+// OpenSink creates the sink described by the JSON specification
+func OpenSink(spec string) (*Sink, error) {
+	opts, err := parseSinkOpts(spec)
+	if err != nil {
+		return nil, err
+	}
+	dir, pattern := "", "pg_timetable_sink_*"
+	if opts.S3 == nil {
+		dir, pattern = filepath.Dir(opts.Path), filepath.Base(opts.Path)+".*"
+	}
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{opts: opts, file: f, buf: bufio.NewWriter(f)}
+	var w io.Writer = s.buf
+	if *opts.Gzip {
+		s.gz = gzip.NewWriter(s.buf)
+		w = s.gz
+	}
+	if delimiter, ok := sinkDelimiters[opts.Format]; ok {
+		cw := csv.NewWriter(w)
+		cw.Comma = delimiter
+		s.enc = &csvEncoder{w: cw, header: opts.Header == nil || *opts.Header}
+	} else {
+		s.enc = &jsonEncoder{enc: json.NewEncoder(w)}
+	}
+	return s, nil
+}
+
+// String returns the destination of the sink
+func (s *Sink) String() string {
+	if s.opts.S3 != nil {
+		return s.opts.S3.objectURL()
+	}
+	return s.opts.Path
+}
+
+// WriteRows writes all rows of the result set without keeping them in memory
+func (s *Sink) WriteRows(rows *sql.Rows) (n int64, err error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		if err = s.write(columns, types, values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+func (s *Sink) write(columns []string, types []string, values []interface{}) error {
+	if err := s.enc.encode(columns, types, values); err != nil {
+		return err
+	}
+	s.rows++
+	return nil
+}
+
+// finish flushes all the writers and closes the temporary file
+func (s *Sink) finish() error {
+	err := s.enc.flush()
+	if s.gz != nil {
+		if gzErr := s.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if bufErr := s.buf.Flush(); err == nil {
+		err = bufErr
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close moves written rows to the destination, the context limits the upload to S3
+func (s *Sink) Close(ctx context.Context) error {
+	defer os.Remove(s.file.Name())
+	if err := s.finish(); err != nil {
+		return err
+	}
+	if s.opts.S3 != nil {
+		opts := *s.opts.S3
+		opts.File = s.file.Name()
+		if err := opts.upload(ctx); err != nil {
+			return err
+		}
+	} else if err := os.Rename(s.file.Name(), s.opts.Path); err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Streamed %d rows to %s", s.rows, s))
+	return nil
+}
+
+// Abort discards written rows leaving the destination untouched
+func (s *Sink) Abort() {
+	_ = s.finish()
+	_ = os.Remove(s.file.Name())
+}
@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSinkOpts(t *testing.T) {
+	_, err := parseSinkOpts(`{}`)
+	assert.EqualError(t, err, "Sink file not specified")
+	_, err = parseSinkOpts(`{"path": "out.csv", "s3": {"bucket": "b", "key": "k"}}`)
+	assert.EqualError(t, err, "Sink must be either local file or S3 object")
+	_, err = parseSinkOpts(`{"s3": {"key": "k"}}`)
+	assert.EqualError(t, err, "S3 bucket not specified")
+	_, err = parseSinkOpts(`{"path": "out.xml", "format": "xml"}`)
+	assert.EqualError(t, err, "Unsupported sink format: xml")
+	opts, err := parseSinkOpts(`{"s3": {"bucket": "b", "key": "exports/out.csv.gz"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", opts.Format)
+	assert.Equal(t, "us-east-1", opts.S3.Region)
+	assert.True(t, *opts.Gzip, "Gzip should be enabled by the name suffix")
+	opts, err = parseSinkOpts(`{"path": "out.json.gz", "format": "json", "gzip": false}`)
+	assert.NoError(t, err)
+	assert.False(t, *opts.Gzip)
+}
+
+func TestSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	columns, types := []string{"id", "doc"}, []string{"INT8", "JSONB"}
+
+	path := filepath.Join(dir, "out.csv.gz")
+	s, err := OpenSink(`{"path": "` + path + `"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, s.write(columns, types, []interface{}{int64(1), []byte(`{"a": 1}`)}))
+	assert.NoError(t, s.write(columns, types, []interface{}{int64(2), nil}))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "Destination should not exist before the sink is closed")
+	assert.NoError(t, s.Close(context.Background()))
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Equal(t, "id,doc\n1,\"{\"\"a\"\": 1}\"\n2,\n", string(data))
+
+	path = filepath.Join(dir, "out.json")
+	s, err = OpenSink(`{"path": "` + path + `", "format": "json"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, s.write(columns, types, []interface{}{int64(1), []byte(`{"a":1}`)}))
+	assert.NoError(t, s.Close(context.Background()))
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"doc\":{\"a\":1},\"id\":1}\n", string(data))
+
+	s, err = OpenSink(`{"path": "` + path + `", "format": "json"}`)
+	assert.NoError(t, err)
+	assert.NoError(t, s.write(columns, types, []interface{}{int64(2), nil}))
+	s.Abort()
+	data, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"doc\":{\"a\":1},\"id\":1}\n", string(data), "Aborted sink should leave the destination untouched")
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2, "Temporary files should be removed")
+}
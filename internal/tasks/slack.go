@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+const defaultSlackText = `Chain *{{.ChainName}}* run {{.RunStatusID}} ({{.Duration}}){{if .LastError}} failed: {{.LastError}}{{end}}`
+
+type slackOpts struct {
+	Webhook   string      `json:"webhook"`
+	Text      string      `json:"text"`
+	Channel   string      `json:"channel"`
+	Username  string      `json:"username"`
+	IconEmoji string      `json:"iconemoji"`
+	OnError   bool        `json:"onerror"`
+	Data      interface{} `json:"data"`
+}
+
+// slackMessage is the payload accepted by Slack incoming webhooks
+type slackMessage struct {
+	Text      string `json:"text"`
+	Channel   string `json:"channel,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+}
+
+var slackClient = &http.Client{Timeout: 30 * time.Second}
+
+// taskSlack posts the text template executed against the chain run information to Slack incoming webhook.
+// If onerror is set the message is posted only if some element failed earlier in the run, so the task
+// can be used as an error handler following elements with ignore_error set
+func taskSlack(ctx context.Context, run *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts slackOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if opts.Webhook == "" {
+		return errors.New("Slack webhook URL not specified")
+	}
+	if opts.OnError && run.LastError == "" {
+		pgengine.LogToDB("DEBUG", "Slack message skipped, no errors occurred during the chain run")
+		result.Status = ResultSkipped
+		return nil
+	}
+	if opts.Text == "" {
+		opts.Text = defaultSlackText
+	}
+	text, err := executeTextTemplate(opts.Text, newRunData(ctx, run, opts.Data))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(slackMessage{Text: text, Channel: opts.Channel, Username: opts.Username, IconEmoji: opts.IconEmoji})
+	if err != nil {
+		return err
+	}
+	resp, err := slackClient.Post(opts.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Slack webhook request failed with status %s: %s", resp.Status, msg)
+	}
+	result.AddMetric("messages", 1)
+	return nil
+}
@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskSlack(t *testing.T) {
+	var messages []slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		messages = append(messages, msg)
+	}))
+	defer server.Close()
+
+	run := &pgengine.ChainRun{ChainName: "nightly", RunStatusID: 42, StartedAt: time.Now()}
+	result := &Result{}
+	assert.NoError(t, taskSlack(context.Background(), run, result, `{"webhook": "`+server.URL+`", "onerror": true}`))
+	assert.Empty(t, messages, "Should not post if there were no errors")
+	assert.Equal(t, ResultSkipped, result.Status)
+
+	run.LastError = "Download: connection refused"
+	assert.NoError(t, taskSlack(context.Background(), run, &Result{}, `{"webhook": "`+server.URL+`", "onerror": true, "channel": "#ops"}`))
+	if assert.Len(t, messages, 1) {
+		assert.Contains(t, messages[0].Text, "Chain *nightly* run 42")
+		assert.Contains(t, messages[0].Text, "failed: Download: connection refused")
+		assert.Equal(t, "#ops", messages[0].Channel)
+	}
+
+	assert.NoError(t, taskSlack(context.Background(), run, &Result{}, `{"webhook": "`+server.URL+`", "text": "{{.Data.team}}: {{.RunStatusID}}", "data": {"team": "dba"}}`))
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "dba: 42", messages[1].Text)
+	}
+
+	assert.Error(t, taskSlack(context.Background(), run, &Result{}, `{"webhook": "`+server.URL+`", "text": "{{if .LastError}}{{end}}"}`), "Should fail on bad request")
+	assert.Error(t, taskSlack(context.Background(), run, &Result{}, `{"text": "foo"}`), "Should fail without webhook")
+	assert.Error(t, taskSlack(context.Background(), run, &Result{}, `foo`), "Should fail on invalid JSON")
+}
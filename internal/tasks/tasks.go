@@ -1,52 +1,171 @@
 package tasks
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
 	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 )
 
+// Task is the builtin task handler called for every parameter value. The run describes the chain run the task
+// is executed in, the result accumulates metrics and artifacts reported by the task
+type Task func(ctx context.Context, run *pgengine.ChainRun, result *Result, val string) error
+
 // Tasks maps builtin task names with event handlers
-var Tasks = map[string](func(string) error){
-	"NoOp":     taskNoOp,
-	"Sleep":    taskSleep,
-	"Log":      taskLog,
-	"SendMail": taskSendMail,
-	"Download": taskDownloadFile}
-
-// ExecuteTask executes built-in task depending on task name and returns err result
-func ExecuteTask(name string, paramValues []string) error {
-	pgengine.LogToDB("DEBUG", fmt.Sprintf("Executing builtin task %s with parameters %v", name, paramValues))
+var Tasks = map[string]Task{
+	"NoOp":                 taskNoOp,
+	"Sleep":                taskSleep,
+	"Log":                  taskLog,
+	"SendMail":             taskSendMail,
+	"Download":             taskDownloadFile,
+	"ExportRunHistory":     taskExportRunHistory,
+	"S3Upload":             taskS3Upload,
+	"S3Download":           taskS3Download,
+	"SftpUpload":           taskSftpUpload,
+	"SftpDownload":         taskSftpDownload,
+	"Retention":            taskRetention,
+	"Backup":               taskBackup,
+	"CopyFromFile":         taskCopyFromFile,
+	"CopyToFile":           taskCopyToFile,
+	"RowCountSnapshot":     taskRowCountSnapshot,
+	"KubernetesJob":        taskKubernetesJob,
+	"PartitionMaintenance": taskPartitionMaintenance,
+	"WaitFor":              taskWaitFor,
+	"RefreshMatViews":      taskRefreshMatViews,
+	"Slack":                taskSlack,
+	"Telegram":             taskTelegram,
+	"Notify":               taskNotify,
+	"StoreArtifacts":       taskStoreArtifacts}
+
+// Names returns names of all builtin tasks
+func Names() []string {
+	names := make([]string, 0, len(Tasks))
+	for name := range Tasks {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ExecuteTask executes built-in task depending on task name and returns its result encoded as JSON
+// together with the error. The task is called for every parameter value accumulating the same result.
+// run is nil if the task is executed outside of the chain run, e.g. during dev run
+func ExecuteTask(ctx context.Context, name string, paramValues []string, run *pgengine.ChainRun) ([]byte, error) {
+	// parameters are not logged since they may contain resolved secrets
+	pgengine.LogToDB("DEBUG", fmt.Sprintf("Executing builtin task %s with %d parameters", name, len(paramValues)))
 	if len(paramValues) == 0 {
 		paramValues = append(paramValues, "")
 	}
-	f := Tasks[name]
-	if f == nil {
-		return errors.New("No built-in task found: " + name)
+	if run == nil {
+		run = &pgengine.ChainRun{}
+	}
+	task := Tasks[name]
+	if task == nil {
+		return nil, errors.New("No built-in task found: " + name)
 	}
+	var result Result
+	var err error
 	for _, val := range paramValues {
-		err := f(val)
-		if err != nil {
-			return err
+		if err = task(ctx, run, &result, val); err != nil {
+			break
 		}
 	}
-	return nil
+	out := result.finish(err)
+	run.Retries += result.Retries
+	if run.Results == nil {
+		run.Results = make(map[string]json.RawMessage)
+	}
+	run.Results[name] = out
+	return out, err
 }
 
-func taskNoOp(val string) error {
+func taskNoOp(_ context.Context, _ *pgengine.ChainRun, _ *Result, val string) error {
 	pgengine.LogToDB("DEBUG", "NoOp task called with value: ", val)
 	return nil
 }
 
-func taskSleep(val string) (err error) {
-	var d int
-	if d, err = strconv.Atoi(val); err != nil {
+// taskSleep accepts number of seconds, e.g. 5 or 0.5, or duration string, e.g. "1m30s"
+func taskSleep(ctx context.Context, _ *pgengine.ChainRun, _ *Result, val string) error {
+	d, err := parseSleepInterval(val)
+	if err != nil {
 		return err
 	}
-	pgengine.LogToDB("DEBUG", "Sleep task called for ", d, " seconds")
-	time.Sleep(time.Duration(d) * time.Second)
+	pgengine.LogToDB("DEBUG", "Sleep task called for ", d)
+	clock.FromContext(ctx).Sleep(d)
 	return nil
 }
+
+func parseSleepInterval(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, `"`) {
+		if err := json.Unmarshal([]byte(val), &val); err != nil {
+			return 0, err
+		}
+	}
+	if seconds, err := strconv.ParseFloat(val, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("Sleep interval cannot be negative: %s", val)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid sleep interval: %s", val)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("Sleep interval cannot be negative: %s", val)
+	}
+	return d, nil
+}
+
+// runData is passed to the message templates of the tasks reporting the chain run
+type runData struct {
+	ChainConfigID int
+	ChainName     string
+	RunStatusID   int
+	ElementID     int
+	TaskName      string
+	Duration      time.Duration
+	LastError     string
+	Results       map[string]interface{}
+	Data          interface{}
+}
+
+func newRunData(ctx context.Context, run *pgengine.ChainRun, data interface{}) runData {
+	d := runData{
+		ChainConfigID: run.ChainConfigID,
+		ChainName:     run.ChainName,
+		RunStatusID:   run.RunStatusID,
+		ElementID:     run.ElementID,
+		TaskName:      run.TaskName,
+		LastError:     run.LastError,
+		Results:       make(map[string]interface{}, len(run.Results)),
+		Data:          data}
+	for name, out := range run.Results {
+		var res interface{}
+		if json.Unmarshal(out, &res) == nil {
+			d.Results[name] = res
+		}
+	}
+	if !run.StartedAt.IsZero() {
+		d.Duration = clock.FromContext(ctx).Now().Sub(run.StartedAt).Round(time.Millisecond)
+	}
+	return d
+}
+
+// executeTextTemplate executes builtin parameter as a template against data, e.g. "Report for {{.day}}"
+func executeTextTemplate(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("param").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
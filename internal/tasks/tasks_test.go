@@ -1,27 +1,112 @@
 package tasks
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNoOp(t *testing.T) {
-	assert.NoError(t, taskNoOp("foo"))
+	assert.NoError(t, taskNoOp(context.Background(), nil, nil, "foo"))
 }
 
 func TestTaskSleep(t *testing.T) {
-	assert.NoError(t, taskSleep("1"))
-	assert.Error(t, taskSleep("foo"))
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithClock(context.Background(), c)
+	done := make(chan error)
+	go func() { done <- taskSleep(ctx, nil, nil, "1m30s") }()
+	c.WaitForTimers(1)
+	c.Advance(time.Minute)
+	select {
+	case <-done:
+		t.Fatal("Sleep should not finish before the interval passed")
+	default:
+	}
+	c.Advance(30 * time.Second)
+	assert.NoError(t, <-done)
+	assert.Error(t, taskSleep(ctx, nil, nil, "foo"))
 }
 
 func TestExecuteTask(t *testing.T) {
-	assert.Error(t, ExecuteTask("foo", []string{}))
-	assert.Error(t, ExecuteTask("Sleep", []string{"foo"}))
-	assert.NoError(t, ExecuteTask("NoOp", []string{}))
-	assert.NoError(t, ExecuteTask("NoOp", []string{"foo", "bar"}))
+	_, err := ExecuteTask(context.Background(), "foo", []string{}, nil)
+	assert.Error(t, err)
+	out, err := ExecuteTask(context.Background(), "Sleep", []string{"foo"}, nil)
+	assert.Error(t, err)
+	assert.JSONEq(t, `{"status": "FAILED", "message": "Invalid sleep interval: foo"}`, string(out))
+	out, err = ExecuteTask(context.Background(), "NoOp", []string{}, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status": "OK"}`, string(out))
+	run := &pgengine.ChainRun{}
+	_, err = ExecuteTask(context.Background(), "NoOp", []string{"foo", "bar"}, run)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status": "OK"}`, string(run.Results["NoOp"]), "Result should be available to the next elements")
+
+	Tasks["Retry"] = func(_ context.Context, _ *pgengine.ChainRun, result *Result, _ string) error {
+		result.Retries++
+		return nil
+	}
+	defer delete(Tasks, "Retry")
+	out, err = ExecuteTask(context.Background(), "Retry", []string{"a", "b"}, run)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"status": "OK", "retries": 2}`, string(out))
+	_, err = ExecuteTask(context.Background(), "Retry", []string{"c"}, run)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, run.Retries, "Retries should be accumulated by the run")
+}
+
+func TestResult(t *testing.T) {
+	var r Result
+	r.AddMetric("rows", 2)
+	r.AddMetric("rows", 3)
+	r.AddArtifact("a.csv")
+	assert.JSONEq(t, `{"status": "OK", "metrics": {"rows": 5}, "artifacts": ["a.csv"]}`, string(r.finish(nil)))
+	r = Result{Status: ResultSkipped}
+	assert.JSONEq(t, `{"status": "SKIPPED"}`, string(r.finish(nil)))
+	data := newRunData(context.Background(), &pgengine.ChainRun{Results: map[string]json.RawMessage{"Backup": r.finish(errors.New("failed"))}}, nil)
+	text, err := executeTextTemplate(`{{.Results.Backup.status}}: {{.Results.Backup.message}}`, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "FAILED: failed", text)
+}
+
+func TestRunDataDuration(t *testing.T) {
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	run := &pgengine.ChainRun{StartedAt: c.Now()}
+	c.Advance(90 * time.Second)
+	data := newRunData(clock.WithClock(context.Background(), c), run, nil)
+	assert.Equal(t, 90*time.Second, data.Duration, "Duration should be measured by the clock of the context")
 }
 
 func TestTaskLog(t *testing.T) {
-	assert.NoError(t, taskLog("foo"))
+	assert.NoError(t, taskLog(context.Background(), nil, nil, "foo"))
+}
+
+func TestTaskLogLevel(t *testing.T) {
+	assert.NoError(t, taskLog(context.Background(), nil, nil, `{"Description": "Logs Execution"}`), "Arbitrary JSON should be logged as is")
+	assert.NoError(t, taskLog(context.Background(), nil, nil, `{"level": "notice", "message": "chain started"}`))
+	assert.NoError(t, taskLog(context.Background(), nil, nil, `{"message": "chain started"}`))
+	assert.EqualError(t, taskLog(context.Background(), nil, nil, `{"level": "PANIC", "message": "chain started"}`), "Unsupported log level: PANIC")
+}
+
+func TestParseSleepInterval(t *testing.T) {
+	for val, d := range map[string]time.Duration{
+		"5":       5 * time.Second,
+		"0.5":     500 * time.Millisecond,
+		`"1m30s"`: 90 * time.Second,
+		`"2"`:     2 * time.Second,
+		" 100ms ": 100 * time.Millisecond,
+	} {
+		actual, err := parseSleepInterval(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, d, actual, val)
+	}
+	for _, val := range []string{"foo", "-1", `"-1s"`, `"unterminated`} {
+		_, err := parseSleepInterval(val)
+		assert.Error(t, err, val)
+	}
 }
@@ -0,0 +1,91 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+const defaultTelegramText = `Chain {{.ChainName}} run {{.RunStatusID}} ({{.Duration}}){{if .LastError}} failed: {{.LastError}}{{end}}`
+
+// telegramAPIURL is overwritten in tests
+var telegramAPIURL = "https://api.telegram.org"
+
+type telegramOpts struct {
+	Token     string          `json:"token"`
+	ChatID    json.RawMessage `json:"chatid"`
+	Text      string          `json:"text"`
+	ParseMode string          `json:"parsemode"`
+	OnError   bool            `json:"onerror"`
+	Data      interface{}     `json:"data"`
+}
+
+// telegramMessage is the payload of sendMessage method of Telegram Bot API
+type telegramMessage struct {
+	ChatID    json.RawMessage `json:"chat_id"`
+	Text      string          `json:"text"`
+	ParseMode string          `json:"parse_mode,omitempty"`
+}
+
+// telegramResponse is returned by every Telegram Bot API method
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+var telegramClient = &http.Client{Timeout: 30 * time.Second}
+
+// taskTelegram sends the text template executed against the chain run information through Telegram Bot API.
+// Chat ID is either numeric identifier or channel username, e.g. "@dba_alerts". Like Slack task with onerror
+// set the message is sent only if some element failed earlier in the run
+func taskTelegram(ctx context.Context, run *pgengine.ChainRun, result *Result, paramValues string) error {
+	var opts telegramOpts
+	if err := json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return err
+	}
+	if opts.Token == "" {
+		return errors.New("Telegram bot token not specified")
+	}
+	if len(opts.ChatID) == 0 {
+		return errors.New("Telegram chat ID not specified")
+	}
+	if opts.OnError && run.LastError == "" {
+		pgengine.LogToDB("DEBUG", "Telegram message skipped, no errors occurred during the chain run")
+		result.Status = ResultSkipped
+		return nil
+	}
+	if opts.Text == "" {
+		opts.Text = defaultTelegramText
+	}
+	text, err := executeTextTemplate(opts.Text, newRunData(ctx, run, opts.Data))
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(telegramMessage{ChatID: opts.ChatID, Text: text, ParseMode: opts.ParseMode})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(telegramAPIURL, "/"), opts.Token)
+	resp, err := telegramClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the error contains URL with the bot token
+		return errors.New(strings.Replace(err.Error(), opts.Token, "<token>", -1))
+	}
+	defer resp.Body.Close()
+	var response telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("Telegram request failed with status %s: %s", resp.Status, err)
+	}
+	if !response.OK {
+		return fmt.Errorf("Telegram request failed with status %s: %s", resp.Status, response.Description)
+	}
+	result.AddMetric("messages", 1)
+	return nil
+}
@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskTelegram(t *testing.T) {
+	var messages []telegramMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botsecret/sendMessage" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"ok": false, "description": "Unauthorized"}`))
+			return
+		}
+		var msg telegramMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		messages = append(messages, msg)
+		_, _ = w.Write([]byte(`{"ok": true, "result": {}}`))
+	}))
+	defer server.Close()
+	defer func(url string) { telegramAPIURL = url }(telegramAPIURL)
+	telegramAPIURL = server.URL
+
+	run := &pgengine.ChainRun{ChainName: "nightly", RunStatusID: 42, StartedAt: time.Now()}
+	result := &Result{}
+	assert.NoError(t, taskTelegram(context.Background(), run, result, `{"token": "secret", "chatid": -100123, "onerror": true}`))
+	assert.Empty(t, messages, "Should not send if there were no errors")
+	assert.Equal(t, ResultSkipped, result.Status)
+
+	run.LastError = "Backup: exit status 1"
+	result = &Result{}
+	assert.NoError(t, taskTelegram(context.Background(), run, result, `{"token": "secret", "chatid": "@dba", "onerror": true, "parsemode": "HTML"}`))
+	assert.EqualValues(t, 1, result.Metrics["messages"])
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, `"@dba"`, string(messages[0].ChatID))
+		assert.Equal(t, "HTML", messages[0].ParseMode)
+		assert.Contains(t, messages[0].Text, "Chain nightly run 42")
+		assert.Contains(t, messages[0].Text, "failed: Backup: exit status 1")
+	}
+
+	assert.NoError(t, taskTelegram(context.Background(), run, &Result{}, `{"token": "secret", "chatid": 1, "text": "{{.Data.team}}: {{.ChainName}}", "data": {"team": "dba"}}`))
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, "1", string(messages[1].ChatID))
+		assert.Equal(t, "dba: nightly", messages[1].Text)
+	}
+
+	assert.EqualError(t, taskTelegram(context.Background(), run, &Result{}, `{"token": "foo", "chatid": 1}`), "Telegram request failed with status 401 Unauthorized: Unauthorized")
+	assert.EqualError(t, taskTelegram(context.Background(), run, &Result{}, `{"chatid": 1}`), "Telegram bot token not specified")
+	assert.EqualError(t, taskTelegram(context.Background(), run, &Result{}, `{"token": "secret"}`), "Telegram chat ID not specified")
+	assert.Error(t, taskTelegram(context.Background(), run, &Result{}, `foo`), "Should fail on invalid JSON")
+}
@@ -0,0 +1,144 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
+)
+
+type waitForOpts struct {
+	Query       string  `json:"query"`
+	URL         string  `json:"url"`
+	Status      int     `json:"status"`
+	Timeout     string  `json:"timeout"`
+	Interval    string  `json:"interval"`
+	MaxInterval string  `json:"max_interval"`
+	Factor      float64 `json:"factor"`
+	timeout     time.Duration
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+var waitForClient = &http.Client{Timeout: 30 * time.Second}
+
+func parseWaitForOpts(paramValues string) (opts waitForOpts, err error) {
+	opts = waitForOpts{Timeout: "1h", Interval: "5s", MaxInterval: "5m", Factor: 2}
+	if err = json.Unmarshal([]byte(paramValues), &opts); err != nil {
+		return
+	}
+	if (strings.TrimSpace(opts.Query) == "") == (opts.URL == "") {
+		return opts, errors.New("Either query or url must be specified")
+	}
+	if opts.Factor < 1 {
+		return opts, errors.New("Backoff factor cannot be less than 1")
+	}
+	for _, d := range []struct {
+		name string
+		val  string
+		res  *time.Duration
+	}{{"timeout", opts.Timeout, &opts.timeout}, {"interval", opts.Interval, &opts.interval},
+		{"max interval", opts.MaxInterval, &opts.maxInterval}} {
+		if *d.res, err = time.ParseDuration(d.val); err != nil || *d.res <= 0 {
+			return opts, fmt.Errorf("Invalid %s: %s", d.name, d.val)
+		}
+	}
+	return opts, nil
+}
+
+// nextInterval returns the polling interval increased by the factor up to the max interval
+func (opts waitForOpts) nextInterval(interval time.Duration) time.Duration {
+	if next := time.Duration(float64(interval) * opts.Factor); next < opts.maxInterval {
+		return next
+	}
+	return opts.maxInterval
+}
+
+// waitFor calls check with exponentially growing intervals until it reports true or the timeout is over.
+// Returns the number of checks done
+func waitFor(c clock.Clock, opts waitForOpts, check func() (bool, error)) (int, error) {
+	deadline := c.Now().Add(opts.timeout)
+	interval := opts.interval
+	for attempts := 1; ; attempts++ {
+		ok, err := check()
+		if err != nil || ok {
+			return attempts, err
+		}
+		left := deadline.Sub(c.Now())
+		if left <= 0 {
+			return attempts, fmt.Errorf("Condition is not met within %s after %d attempts", opts.timeout, attempts)
+		}
+		if interval > left {
+			interval = left
+		}
+		pgengine.LogToDB("DEBUG", fmt.Sprintf("Condition is not met, checking again in %s", interval))
+		c.Sleep(interval)
+		interval = opts.nextInterval(interval)
+	}
+}
+
+// checkQuery returns the boolean result of the query, NULL or no rows mean the condition is not met
+func checkQuery(query string) (bool, error) {
+	rows, err := pgengine.ConfigDb.Query(query)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var res *bool
+	if rows.Next() {
+		if err = rows.Scan(&res); err != nil {
+			return false, err
+		}
+	}
+	return res != nil && *res, rows.Err()
+}
+
+// checkURL returns true if the endpoint responds with the expected status or any 2xx status if not specified.
+// Unavailable endpoint means the condition is not met
+func checkURL(url string, status int) (bool, error) {
+	resp, err := waitForClient.Get(url)
+	if err != nil {
+		pgengine.LogToDB("DEBUG", "Cannot check url: ", err)
+		return false, nil
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if status != 0 {
+		return resp.StatusCode == status, nil
+	}
+	return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+}
+
+// taskWaitFor delays the chain until the SQL query returns true or the HTTP endpoint responds successfully,
+// polling with exponential backoff from "interval" up to "max_interval". Fails if "timeout" is over
+func taskWaitFor(ctx context.Context, _ *pgengine.ChainRun, result *Result, paramValues string) error {
+	opts, err := parseWaitForOpts(paramValues)
+	if err != nil {
+		return err
+	}
+	check := func() (bool, error) { return checkURL(opts.URL, opts.Status) }
+	if opts.URL == "" {
+		if pgengine.ConfigDb == nil {
+			return errors.New("Configuration database connection is not established")
+		}
+		check = func() (bool, error) { return checkQuery(opts.Query) }
+	}
+	c := clock.FromContext(ctx)
+	start := c.Now()
+	attempts, err := waitFor(c, opts, check)
+	result.AddMetric("attempts", float64(attempts))
+	result.AddMetric("waited", c.Now().Sub(start).Seconds())
+	if err != nil {
+		return err
+	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Condition is met after %d attempts", attempts))
+	return nil
+}
@@ -0,0 +1,89 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWaitForOpts(t *testing.T) {
+	_, err := parseWaitForOpts(`{}`)
+	assert.EqualError(t, err, "Either query or url must be specified")
+	_, err = parseWaitForOpts(`{"query": "SELECT true", "url": "http://localhost"}`)
+	assert.EqualError(t, err, "Either query or url must be specified")
+	_, err = parseWaitForOpts(`{"query": "SELECT true", "factor": 0.5}`)
+	assert.EqualError(t, err, "Backoff factor cannot be less than 1")
+	_, err = parseWaitForOpts(`{"query": "SELECT true", "timeout": "forever"}`)
+	assert.EqualError(t, err, "Invalid timeout: forever")
+	_, err = parseWaitForOpts(`{"query": "SELECT true", "interval": "0s"}`)
+	assert.EqualError(t, err, "Invalid interval: 0s")
+	opts, err := parseWaitForOpts(`{"query": "SELECT true"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, opts.timeout)
+	assert.Equal(t, 10*time.Second, opts.nextInterval(opts.interval))
+	assert.Equal(t, 5*time.Minute, opts.nextInterval(4*time.Minute), "Interval should not exceed max interval")
+	assert.EqualError(t, taskWaitFor(context.Background(), nil, &Result{}, `{"query": "SELECT true"}`),
+		"Configuration database connection is not established")
+}
+
+func TestWaitFor(t *testing.T) {
+	opts, err := parseWaitForOpts(`{"query": "SELECT true", "interval": "1ms", "max_interval": "2ms", "timeout": "1s"}`)
+	assert.NoError(t, err)
+	calls := 0
+	attempts, err := waitFor(clock.Real, opts, func() (bool, error) { calls++; return calls == 3, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	_, err = waitFor(clock.Real, opts, func() (bool, error) { return false, errors.New("relation does not exist") })
+	assert.EqualError(t, err, "relation does not exist", "Check errors should fail immediately")
+
+	opts.timeout = 5 * time.Millisecond
+	_, err = waitFor(clock.Real, opts, func() (bool, error) { return false, nil })
+	assert.Error(t, err, "Should fail after timeout")
+}
+
+func TestWaitForClock(t *testing.T) {
+	opts, err := parseWaitForOpts(`{"query": "SELECT true", "interval": "10s", "max_interval": "20s", "timeout": "1m"}`)
+	assert.NoError(t, err)
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	start := c.Now()
+	done := make(chan int)
+	go func() {
+		attempts, _ := waitFor(c, opts, func() (bool, error) { return false, nil })
+		done <- attempts
+	}()
+	for {
+		select {
+		case attempts := <-done:
+			assert.Equal(t, 5, attempts, "Checks should run at 0s, 10s, 30s, 50s and 1m")
+			assert.Equal(t, start.Add(time.Minute), c.Now(), "Waiting should end at the timeout")
+			return
+		default:
+		}
+		if c.Timers() > 0 {
+			c.Advance(5 * time.Second)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTaskWaitForURL(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls < 2 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	var result Result
+	assert.NoError(t, taskWaitFor(context.Background(), nil, &result, `{"url": "`+ts.URL+`", "interval": "1ms"}`))
+	assert.Equal(t, 2.0, result.Metrics["attempts"])
+	assert.Error(t, taskWaitFor(context.Background(), nil, &Result{}, `{"url": "`+ts.URL+`", "status": 202, "interval": "1ms", "timeout": "10ms"}`),
+		"Should wait for the expected status")
+}
@@ -0,0 +1,251 @@
+// Package tracing exports chain runs as OpenTelemetry traces over OTLP/HTTP with JSON encoding.
+// The chain run is the root span, every executed chain element is its child span
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+)
+
+// maxActiveRuns limits traces kept in memory, runs started above the limit are not traced
+const maxActiveRuns = 1000
+
+// OTLP span kind and status codes
+const (
+	spanKindInternal = 1
+	statusOk         = 1
+	statusError      = 2
+)
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 values are encoded as strings
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes,omitempty"`
+	Status            status      `json:"status"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+// exportRequest is ExportTraceServiceRequest in OTLP JSON encoding
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+func stringAttr(key string, value string) attribute {
+	return attribute{key, attributeValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int) attribute {
+	s := strconv.Itoa(value)
+	return attribute{key, attributeValue{IntValue: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Exporter collects spans of the chain run from scheduler events and sends them once the run is finished.
+// It should be subscribed wrapped with events.Async, since the export waits for the collector
+type Exporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	mu       sync.Mutex
+	runs     map[int][]span // by run status, the first span is the root one
+	// OnError is called if the trace cannot be exported
+	OnError func(error)
+}
+
+// NewExporter returns the exporter sending traces to the OTLP/HTTP collector, e.g. "http://localhost:4318".
+// Headers are "key=value" pairs separated by commas as in OTEL_EXPORTER_OTLP_HEADERS
+func NewExporter(endpoint string, headers string, service string) *Exporter {
+	e := &Exporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		headers:  map[string]string{},
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		runs:     map[int][]span{}}
+	if !strings.HasSuffix(e.endpoint, "/v1/traces") {
+		e.endpoint += "/v1/traces"
+	}
+	for _, h := range strings.Split(headers, ",") {
+		if kv := strings.SplitN(h, "=", 2); len(kv) == 2 {
+			e.headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return e
+}
+
+// HandleEvent starts the trace on CHAIN_STARTED, adds element spans and exports the trace on CHAIN_DONE or CHAIN_FAILED
+func (e *Exporter) HandleEvent(ev events.Event) {
+	if ev.RunStatusID == 0 {
+		return
+	}
+	switch ev.Kind {
+	case events.ChainStarted:
+		e.startRun(ev)
+	case events.ElementFinished:
+		e.addElement(ev)
+	case events.ChainDone, events.ChainFailed:
+		if spans := e.finishRun(ev); spans != nil {
+			if err := e.export(spans); err != nil && e.OnError != nil {
+				e.OnError(err)
+			}
+		}
+	}
+}
+
+func (e *Exporter) startRun(ev events.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.runs) >= maxActiveRuns {
+		return
+	}
+	e.runs[ev.RunStatusID] = []span{{
+		TraceID:           randomID(16),
+		SpanID:            randomID(8),
+		Name:              ev.ChainName,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(ev.Time),
+		Attributes: []attribute{
+			stringAttr("pg_timetable.client_name", ev.ClientName),
+			intAttr("pg_timetable.chain_config", ev.ChainConfig),
+			intAttr("pg_timetable.chain_id", ev.ChainID),
+			intAttr("pg_timetable.run_status", ev.RunStatusID)}}}
+}
+
+func (e *Exporter) addElement(ev events.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans, ok := e.runs[ev.RunStatusID]
+	if !ok {
+		return
+	}
+	started := ev.Time.Add(-time.Duration(ev.Duration * float64(time.Second)))
+	s := span{
+		TraceID:           spans[0].TraceID,
+		SpanID:            randomID(8),
+		ParentSpanID:      spans[0].SpanID,
+		Name:              ev.TaskName,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(started),
+		EndTimeUnixNano:   unixNano(ev.Time),
+		Attributes: []attribute{
+			intAttr("pg_timetable.chain_id", ev.ChainID),
+			stringAttr("pg_timetable.task_kind", ev.TaskKind),
+			intAttr("pg_timetable.returncode", ev.ReturnCode)},
+		Status: spanStatus(ev.Error)}
+	switch ev.TaskKind {
+	case "SQL":
+		s.Attributes = append(s.Attributes, stringAttr("db.system", "postgresql"), stringAttr("db.statement", ev.Script))
+	case "SHELL", "PROGRAM":
+		s.Attributes = append(s.Attributes, stringAttr("process.command", ev.Script))
+	default:
+		s.Attributes = append(s.Attributes, stringAttr("pg_timetable.script", ev.Script))
+	}
+	e.runs[ev.RunStatusID] = append(spans, s)
+}
+
+func (e *Exporter) finishRun(ev events.Event) []span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans, ok := e.runs[ev.RunStatusID]
+	if !ok {
+		return nil
+	}
+	delete(e.runs, ev.RunStatusID)
+	spans[0].EndTimeUnixNano = unixNano(ev.Time)
+	spans[0].Status = spanStatus(ev.Error)
+	if ev.Kind == events.ChainFailed && spans[0].Status.Code != statusError {
+		spans[0].Status = status{Code: statusError, Message: "chain failed"}
+	}
+	return spans
+}
+
+func spanStatus(err string) status {
+	if err != "" {
+		return status{Code: statusError, Message: err}
+	}
+	return status{Code: statusOk}
+}
+
+// export sends spans of the run as the OTLP/HTTP JSON request
+func (e *Exporter) export(spans []span) error {
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []attribute{stringAttr("service.name", e.service)}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "pg_timetable"}, Spans: spans}}}}}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP collector responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	var received exportRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		auth = r.Header.Get("Authorization")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+
+	e := NewExporter(srv.URL, "Authorization=Bearer token, broken", "pg_timetable")
+	e.OnError = func(err error) { t.Error(err) }
+	started := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	e.HandleEvent(events.Event{Kind: events.ChainStarted, Time: started, ChainName: "export", RunStatusID: 7})
+	e.HandleEvent(events.Event{Kind: events.ElementFinished, Time: started.Add(3 * time.Second), RunStatusID: 7,
+		TaskName: "extract", TaskKind: "SQL", Script: "SELECT 1", Duration: 2})
+	e.HandleEvent(events.Event{Kind: events.ElementFinished, Time: started.Add(4 * time.Second), RunStatusID: 8,
+		TaskName: "unknown run"})
+	e.HandleEvent(events.Event{Kind: events.ChainFailed, Time: started.Add(5 * time.Second), RunStatusID: 7,
+		Error: "extract: timeout"})
+
+	assert.Equal(t, "Bearer token", auth, "Headers should be sent")
+	require.Len(t, received.ResourceSpans, 1)
+	assert.Equal(t, "pg_timetable", *received.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2, "Elements of other runs should not be added")
+	root, element := spans[0], spans[1]
+	assert.Len(t, root.TraceID, 32)
+	assert.Len(t, root.SpanID, 16)
+	assert.Equal(t, "export", root.Name)
+	assert.Equal(t, status{statusError, "extract: timeout"}, root.Status)
+	assert.Equal(t, unixNano(started), root.StartTimeUnixNano)
+	assert.Equal(t, unixNano(started.Add(5*time.Second)), root.EndTimeUnixNano)
+
+	assert.Equal(t, root.TraceID, element.TraceID)
+	assert.Equal(t, root.SpanID, element.ParentSpanID, "Element span should be the child of the run")
+	assert.Equal(t, unixNano(started.Add(time.Second)), element.StartTimeUnixNano, "Start should be derived from duration")
+	assert.Contains(t, element.Attributes, stringAttr("db.statement", "SELECT 1"))
+	assert.Equal(t, status{Code: statusOk}, element.Status)
+	assert.Empty(t, e.runs, "Finished runs should be removed")
+}
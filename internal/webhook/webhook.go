@@ -0,0 +1,118 @@
+// Package webhook posts scheduler events to the HTTP endpoint, e.g. incident management or chat tools.
+// The payload is the event as JSON or the JSON rendered by the user template
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+)
+
+// DefaultEvents are sent if the list of events is not specified
+const DefaultEvents = "CHAIN_STARTED,CHAIN_DONE,CHAIN_FAILED,CLIENT_CONNECTED,CLIENT_STOPPED"
+
+// Hook sends selected events to the URL. It should be subscribed wrapped with events.Async,
+// since the request waits for the endpoint
+type Hook struct {
+	url     string
+	headers map[string]string
+	kinds   map[events.Kind]bool
+	payload *template.Template // nil sends the event as is
+	client  *http.Client
+	// OnError is called if the event cannot be sent
+	OnError func(error)
+}
+
+// templateFuncs are available in payload templates, "json" quotes values, e.g. {"text": {{json .Error}}}
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// New returns the hook sending events of comma separated kinds to the url. Headers are "key=value" pairs
+// separated by commas, tmpl is the text/template of the JSON payload executed for the event
+func New(url string, kinds string, headers string, tmpl string) (*Hook, error) {
+	h := &Hook{
+		url:     url,
+		headers: map[string]string{},
+		kinds:   map[events.Kind]bool{},
+		client:  &http.Client{Timeout: 10 * time.Second}}
+	if kinds == "" {
+		kinds = DefaultEvents
+	}
+	for _, k := range strings.Split(kinds, ",") {
+		if k = strings.ToUpper(strings.TrimSpace(k)); k != "" {
+			h.kinds[events.Kind(k)] = true
+		}
+	}
+	for _, header := range strings.Split(headers, ",") {
+		if kv := strings.SplitN(header, "=", 2); len(kv) == 2 {
+			h.headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	if tmpl != "" {
+		var err error
+		if h.payload, err = template.New("payload").Funcs(templateFuncs).Parse(tmpl); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// HandleEvent sends the event if its kind is selected
+func (h *Hook) HandleEvent(e events.Event) {
+	if !h.kinds[e.Kind] {
+		return
+	}
+	if err := h.send(e); err != nil && h.OnError != nil {
+		h.OnError(fmt.Errorf("%s: %w", e.Kind, err))
+	}
+}
+
+// render returns the JSON payload of the event
+func (h *Hook) render(e events.Event) ([]byte, error) {
+	if h.payload == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	if err := h.payload.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("Payload template produced invalid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *Hook) send(e events.Event) error {
+	data, err := h.render(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHook(t *testing.T) {
+	var bodies []string
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		token = r.Header.Get("X-Token")
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+	failed := events.Event{Kind: events.ChainFailed, Time: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+		ChainName: "nightly", RunStatusID: 7, Error: `backup: "disk" full`}
+
+	h, err := New(srv.URL, "", "X-Token=secret, broken", "")
+	require.NoError(t, err)
+	h.OnError = func(err error) { t.Error(err) }
+	h.HandleEvent(events.Event{Kind: events.ChainQueued})
+	assert.Empty(t, bodies, "Events not selected should not be sent")
+	h.HandleEvent(failed)
+	assert.Equal(t, "secret", token, "Headers should be sent")
+	require.Len(t, bodies, 1)
+	assert.Contains(t, bodies[0], `"kind":"CHAIN_FAILED"`, "Event should be sent as is without template")
+
+	h, err = New(srv.URL, "chain_failed", "", `{"summary": {{json (printf "%s failed: %s" .ChainName .Error)}}, "run": {{.RunStatusID}}}`)
+	require.NoError(t, err)
+	h.OnError = func(err error) { t.Error(err) }
+	h.HandleEvent(events.Event{Kind: events.ChainDone})
+	h.HandleEvent(failed)
+	require.Len(t, bodies, 2)
+	assert.JSONEq(t, `{"summary": "nightly failed: backup: \"disk\" full", "run": 7}`, bodies[1])
+
+	h, err = New(srv.URL, "CHAIN_FAILED", "", `{"summary": "{{.Error}}"}`)
+	require.NoError(t, err)
+	var sendErr error
+	h.OnError = func(err error) { sendErr = err }
+	h.HandleEvent(failed)
+	assert.Error(t, sendErr, "Invalid JSON payload should not be sent")
+	assert.Len(t, bodies, 2)
+
+	_, err = New(srv.URL, "", "", "{{.Error")
+	assert.Error(t, err, "Malformed template should fail")
+}
+
+func TestHookStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	h, err := New(srv.URL, "", "", "")
+	require.NoError(t, err)
+	var sendErr error
+	h.OnError = func(err error) { sendErr = err }
+	h.HandleEvent(events.Event{Kind: events.ClientStopped})
+	assert.EqualError(t, sendErr, "CLIENT_STOPPED: Webhook responded with 503 Service Unavailable")
+}
@@ -0,0 +1,42 @@
+// Package winservice runs pg_timetable as the native Windows service: it installs, uninstalls, starts and stops
+// the service, reports its status to the service control manager and writes log messages to the event log
+package winservice
+
+import (
+	"errors"
+	"strings"
+)
+
+// Service control actions passed as "service <action>" non option arguments
+const (
+	Install   = "install"
+	Uninstall = "uninstall"
+	Start     = "start"
+	Stop      = "stop"
+)
+
+// ErrNotSupported is returned on platforms other than Windows
+var ErrNotSupported = errors.New("Windows services are not supported on this platform")
+
+// ServiceArgs returns arguments the service is started with: the command line without "service <action>"
+func ServiceArgs(args []string, action string) []string {
+	res := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "service" && i+1 < len(args) && args[i+1] == action {
+			return append(res, args[i+2:]...)
+		}
+		res = append(res, args[i])
+	}
+	return res
+}
+
+// eventType maps the log level to the event log entry type
+func eventType(level string) string {
+	switch strings.ToUpper(level) {
+	case "ERROR", "PANIC":
+		return "error"
+	case "NOTICE":
+		return "warning"
+	}
+	return "info"
+}
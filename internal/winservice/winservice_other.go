@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package winservice
+
+// IsService returns true if the process is started by the service control manager
+func IsService() bool {
+	return false
+}
+
+// Run reports the service status to the service control manager and blocks until the service is stopped
+func Run(name string, stop func()) error {
+	return ErrNotSupported
+}
+
+// OpenEventLog returns the function writing log messages to the Windows event log
+func OpenEventLog(name string) (func(level string, line string), error) {
+	return nil, ErrNotSupported
+}
+
+// Control executes the service control action
+func Control(action string, name string, args []string) error {
+	return ErrNotSupported
+}
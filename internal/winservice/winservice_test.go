@@ -0,0 +1,20 @@
+package winservice
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceArgs(t *testing.T) {
+	assert.Equal(t, []string{"-c", "worker01", "--dbname=timetable"},
+		ServiceArgs([]string{"-c", "worker01", "service", "install", "--dbname=timetable"}, Install))
+	assert.Equal(t, []string{"-c", "service", "--once"},
+		ServiceArgs([]string{"-c", "service", "--once"}, Install), "Option values should be kept")
+}
+
+func TestEventType(t *testing.T) {
+	assert.Equal(t, "error", eventType("PANIC"))
+	assert.Equal(t, "warning", eventType("NOTICE"))
+	assert.Equal(t, "info", eventType("LOG"))
+}
@@ -0,0 +1,137 @@
+package winservice
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// stopTimeout is the time Control waits for the service to stop
+const stopTimeout = 30 * time.Second
+
+// eventID is reported with every log message, pg_timetable does not register a message file
+const eventID = 1
+
+// IsService returns true if the process is started by the service control manager
+func IsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// handler reports the service running until the service control manager asks it to stop
+type handler struct {
+	stop func()
+}
+
+func (h handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+	for r := range requests {
+		switch r.Cmd {
+		case svc.Interrogate:
+			status <- r.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			h.stop()
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// Run reports the service status to the service control manager and blocks until the service is stopped.
+// stop is called before the stopped status is reported, e.g. to close the session
+func Run(name string, stop func()) error {
+	return svc.Run(name, handler{stop: stop})
+}
+
+// OpenEventLog returns the function writing log messages to the Windows event log with the service name as
+// the source, so it can be used as pgengine.PrintHook
+func OpenEventLog(name string) (func(level string, line string), error) {
+	l, err := eventlog.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return func(level string, line string) {
+		switch eventType(level) {
+		case "error":
+			_ = l.Error(eventID, line)
+		case "warning":
+			_ = l.Warning(eventID, line)
+		default:
+			_ = l.Info(eventID, line)
+		}
+	}, nil
+}
+
+// Control executes the service control action. The service is installed with the current executable and args,
+// it's started automatically and restarted by the service control manager if the process fails
+func Control(action string, name string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = m.Disconnect() }()
+	if action == Install {
+		return install(m, name, args)
+	}
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("Service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	switch action {
+	case Uninstall:
+		if err = s.Delete(); err != nil {
+			return err
+		}
+		return eventlog.Remove(name)
+	case Start:
+		return s.Start()
+	case Stop:
+		st, err := s.Control(svc.Stop)
+		for deadline := time.Now().Add(stopTimeout); err == nil && st.State != svc.Stopped; {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Service %s did not stop in %s", name, stopTimeout)
+			}
+			time.Sleep(300 * time.Millisecond)
+			st, err = s.Query()
+		}
+		return err
+	}
+	return fmt.Errorf("Unknown service action: %s", action)
+}
+
+func install(m *mgr.Mgr, name string, args []string) error {
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("Service %s already exists", name)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: name,
+		Description: "pg_timetable job scheduler for PostgreSQL",
+		StartType:   mgr.StartAutomatic}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err = s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: time.Minute}},
+		uint32((24 * time.Hour).Seconds())); err != nil {
+		_ = s.Delete()
+		return err
+	}
+	if err = eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		_ = s.Delete()
+		return err
+	}
+	return nil
+}
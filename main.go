@@ -2,12 +2,26 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/cybertec-postgresql/pg_timetable/executor"
+	"github.com/cybertec-postgresql/pg_timetable/internal/api"
 	"github.com/cybertec-postgresql/pg_timetable/internal/cmdparser"
+	"github.com/cybertec-postgresql/pg_timetable/internal/crontab"
+	"github.com/cybertec-postgresql/pg_timetable/internal/events"
+	"github.com/cybertec-postgresql/pg_timetable/internal/lint"
 	"github.com/cybertec-postgresql/pg_timetable/internal/pgengine"
 	"github.com/cybertec-postgresql/pg_timetable/internal/scheduler"
+	"github.com/cybertec-postgresql/pg_timetable/internal/sentry"
+	"github.com/cybertec-postgresql/pg_timetable/internal/systemd"
+	"github.com/cybertec-postgresql/pg_timetable/internal/tracing"
+	"github.com/cybertec-postgresql/pg_timetable/internal/webhook"
+	"github.com/cybertec-postgresql/pg_timetable/internal/winservice"
 )
 
 /**
@@ -26,7 +40,57 @@ func main() {
 		pgengine.LogToDB("PANIC", "Error parsing command line arguments: ", err)
 		os.Exit(2)
 	}
-	connctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	pgengine.LogFormat = cmdOpts.LogFormat
+	pgengine.ConsoleLogLevel, pgengine.DBLogLevel = cmdOpts.LogLevel, cmdOpts.LogDBLevel
+	if cmdOpts.PluginDir != "" {
+		if _, err := executor.LoadDir(cmdOpts.PluginDir); err != nil {
+			pgengine.LogToDB("PANIC", "Cannot load executor plugins: ", err)
+			os.Exit(2)
+		}
+	}
+	if cmdOpts.DevRun != "" {
+		pgengine.ClientName = cmdOpts.ClientName
+		pgengine.NoShellTasks = cmdOpts.NoShellTasks
+		pgengine.VerboseLogLevel = cmdOpts.Verbose
+		if !scheduler.DevRun(ctx, cmdOpts.DevRun) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if cmdOpts.Simulate != "" {
+		if !scheduler.Simulate(ctx, os.Stdout, cmdOpts.Simulate, cmdOpts.SimulatePeriod) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if cmdOpts.Lint != "" {
+		pgengine.VerboseLogLevel = cmdOpts.Verbose
+		if !lint.Run(cmdOpts.Lint, cmdOpts.LintRules) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if cmdOpts.Crontab != "" {
+		if !crontab.Run(cmdOpts.Crontab, cmdOpts.CrontabOutput) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if cmdOpts.Service != "" {
+		args := winservice.ServiceArgs(os.Args[1:], cmdOpts.Service)
+		if err := winservice.Control(cmdOpts.Service, cmdOpts.ServiceName, args); err != nil {
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Cannot %s service %s: %s", cmdOpts.Service, cmdOpts.ServiceName, err))
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if winservice.IsService() {
+		runService(cmdOpts.ServiceName)
+	}
+	connctx, cancel := ctx, func() {}
+	if cmdOpts.InitTimeout > 0 {
+		connctx, cancel = context.WithTimeout(ctx, time.Duration(cmdOpts.InitTimeout)*time.Second)
+	}
 	defer cancel()
 	if !pgengine.InitAndTestConfigDBConnection(connctx, *cmdOpts) {
 		os.Exit(2)
@@ -41,11 +105,240 @@ func main() {
 			os.Exit(3)
 		}
 	}
+	if !pgengine.ValidateSchema(ctx) {
+		os.Exit(3)
+	}
+	if cmdOpts.ContentionReport != "" {
+		if !scheduler.PrintContentionReport(ctx, os.Stdout, cmdOpts.ContentionReport) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	switch cmdOpts.Command {
+	case cmdparser.CommandValidate:
+		// connection and schema version are checked above
+		if !scheduler.ValidateSchedules(ctx) || !scheduler.ValidateTasks(ctx) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case cmdparser.CommandList:
+		if !scheduler.PrintChains(ctx, os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if cmdOpts.TenantIsolation && !pgengine.SetupTenantIsolation(ctx) {
+		os.Exit(3)
+	}
+	if !pgengine.RegisterTaskKinds(ctx, executor.Kinds()) {
+		os.Exit(3)
+	}
+	if cmdOpts.ImportDir != "" {
+		if !importChains(ctx, cmdOpts) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	if cmdOpts.Init {
 		os.Exit(0)
 	}
+	if cmdOpts.Command == cmdparser.CommandChainRun {
+		if !scheduler.RunChainByName(ctx, os.Stdout, cmdOpts.ChainName) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	pgengine.SetupCloseHandler()
-	for scheduler.Run(ctx) == scheduler.ConnectionDroppped {
-		pgengine.ReconnectDbAndFixLeftovers(ctx)
+	setupReloadHandler()
+	scheduler.SetWorkers(cmdOpts.Workers)
+	scheduler.SetDebug(cmdOpts.Debug)
+	pgengine.StartLogWriter()
+	scheduler.ValidateTasks(ctx)
+	setupEvents(cmdOpts)
+	if cmdOpts.RestPort > 0 {
+		api.UIEnabled = cmdOpts.UI
+		api.Start(ctx, cmdOpts.RestAddress, cmdOpts.RestPort)
+	}
+	events.Publish(events.Event{Kind: events.ClientConnected, ClientName: pgengine.ClientName})
+	if cmdOpts.Once {
+		ok := scheduler.RunOnce(ctx, cmdOpts.OnceReboot)
+		pgengine.OnClose()
+		pgengine.FinalizeConfigDBConnection()
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	setupSystemd(ctx)
+	scheduler.Run(ctx)
+}
+
+// runService writes log messages to the event log and reports the status to the service control manager.
+// The process exits when the service is stopped
+func runService(name string) {
+	if printEvent, err := winservice.OpenEventLog(name); err == nil {
+		pgengine.PrintHook = printEvent
+	}
+	go func() {
+		if err := winservice.Run(name, pgengine.CloseSession); err != nil {
+			pgengine.LogToDB("PANIC", "Cannot run service: ", err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}()
+}
+
+// setupReloadHandler re-reads the configuration file, environment and command line on SIGHUP and applies
+// log settings and the number of workers without restart. Other options are applied on restart only
+func setupReloadHandler() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			cmdOpts, err := cmdparser.Parse()
+			if err != nil {
+				pgengine.LogToDB("ERROR", "Cannot reload configuration: ", err)
+				continue
+			}
+			pgengine.SetLogSettings(cmdOpts.LogFormat, cmdOpts.LogLevel, cmdOpts.LogDBLevel, cmdOpts.Verbose)
+			scheduler.SetWorkers(cmdOpts.Workers)
+			pgengine.LogToDB("LOG", fmt.Sprintf("Configuration reloaded, %d workers", cmdOpts.Workers))
+		}
+	}()
+}
+
+// setupSystemd notifies systemd the scheduler is ready and stopping, and pings the watchdog while the main loop
+// is alive if WatchdogSec is set
+func setupSystemd(ctx context.Context) {
+	if err := systemd.Notify(systemd.Ready); err != nil {
+		pgengine.LogToDB("ERROR", "Cannot notify systemd: ", err)
+		return
+	}
+	onClose := pgengine.OnClose
+	pgengine.OnClose = func() {
+		_ = systemd.Notify(systemd.Stopping)
+		if onClose != nil {
+			onClose()
+		}
+	}
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go systemd.RunWatchdog(ctx, interval, func() bool {
+			return scheduler.GetHealth().Live(time.Now())
+		}, func(err error) {
+			pgengine.LogToDB("ERROR", "Cannot ping systemd watchdog: ", err)
+		})
+	}
+}
+
+// setupEvents subscribes integrations to the scheduler events
+func setupEvents(cmdOpts *cmdparser.CmdOptions) {
+	events.Default.OnPanic = func(s events.Subscriber, e events.Event, r interface{}) {
+		pgengine.LogToDB("ERROR", "Event subscriber failed on ", e.Kind, ": ", r)
+	}
+	events.Subscribe(pgengine.LogEvents)
+	// queued events, e.g. CLIENT_STOPPED, are delivered before the session is closed
+	var queues []*events.AsyncSubscriber
+	var tracker *sentry.Client
+	pgengine.OnClose = func() {
+		events.Publish(events.Event{Kind: events.ClientStopped, ClientName: pgengine.ClientName})
+		for _, q := range queues {
+			q.Close()
+		}
+		if tracker != nil {
+			tracker.Flush(5 * time.Second)
+		}
+	}
+	if cmdOpts.SentryDSN != "" {
+		var err error
+		if tracker, err = sentry.New(cmdOpts.SentryDSN, pgengine.ClientName, cmdOpts.SentryEnvironment); err != nil {
+			pgengine.LogToDB("PANIC", "Cannot parse Sentry DSN: ", err)
+			os.Exit(2)
+		}
+		// not logged as ERROR, otherwise failures of the tracker would be reported to the tracker
+		tracker.OnError = func(err error) {
+			pgengine.LogToDB("LOG", "Cannot report to Sentry: ", err)
+		}
+		events.Subscribe(tracker)
+		pgengine.ErrorHook = tracker.CaptureMessage
+		scheduler.OnPanic = func(chain scheduler.Chain, r interface{}, stack []byte) {
+			tracker.CapturePanic(r, stack, chain.ChainName, chain.ChainExecutionConfigID)
+			tracker.Flush(5 * time.Second)
+		}
+	}
+	if cmdOpts.EventsChannel != "" {
+		notify := events.Async(pgengine.NotifyEvents(cmdOpts.EventsChannel), 1000)
+		notify.OnDrop = func(e events.Event) {
+			pgengine.LogToDB("ERROR", "Event queue is full, event dropped: ", e.Kind)
+		}
+		events.Subscribe(notify)
+		queues = append(queues, notify)
+	}
+	if cmdOpts.WebhookURL != "" {
+		var tmpl []byte
+		var err error
+		if cmdOpts.WebhookTemplate != "" {
+			if tmpl, err = ioutil.ReadFile(cmdOpts.WebhookTemplate); err != nil {
+				pgengine.LogToDB("PANIC", "Cannot read webhook template: ", err)
+				os.Exit(2)
+			}
+		}
+		hook, err := webhook.New(cmdOpts.WebhookURL, cmdOpts.WebhookEvents, cmdOpts.WebhookHeaders, string(tmpl))
+		if err != nil {
+			pgengine.LogToDB("PANIC", "Cannot parse webhook template: ", err)
+			os.Exit(2)
+		}
+		hook.OnError = func(err error) {
+			pgengine.LogToDB("ERROR", "Cannot send event to the webhook: ", err)
+		}
+		hooks := events.Async(hook, 1000)
+		hooks.OnDrop = func(e events.Event) {
+			pgengine.LogToDB("ERROR", "Webhook queue is full, event dropped: ", e.Kind)
+		}
+		events.Subscribe(hooks)
+		queues = append(queues, hooks)
+	}
+	if cmdOpts.OTLPEndpoint != "" {
+		exporter := tracing.NewExporter(cmdOpts.OTLPEndpoint, cmdOpts.OTLPHeaders, "pg_timetable")
+		exporter.OnError = func(err error) {
+			pgengine.LogToDB("ERROR", "Cannot export chain run trace: ", err)
+		}
+		traces := events.Async(exporter, 1000)
+		traces.OnDrop = func(e events.Event) {
+			pgengine.LogToDB("ERROR", "Tracing queue is full, event dropped: ", e.Kind)
+		}
+		events.Subscribe(traces)
+		queues = append(queues, traces)
+	}
+}
+
+// importChains synchronizes chains with definitions of the import directory. Definitions are checked with
+// lint rules first if the rules file is specified
+func importChains(ctx context.Context, cmdOpts *cmdparser.CmdOptions) bool {
+	chains, err := pgengine.ReadChainDefinitionsDir(cmdOpts.ImportDir)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot read chain definitions: ", err)
+		return false
+	}
+	if cmdOpts.LintRules != "" {
+		cfg, err := lint.ReadConfig(cmdOpts.LintRules)
+		if err != nil {
+			pgengine.LogToDB("ERROR", "Cannot read lint rules: ", err)
+			return false
+		}
+		if issues := lint.Lint(cfg, chains); len(issues) > 0 {
+			for _, issue := range issues {
+				pgengine.LogToDB("ERROR", issue)
+			}
+			pgengine.LogToDB("ERROR", fmt.Sprintf("Import cancelled, %d lint issues found", len(issues)))
+			return false
+		}
+	}
+	res, err := pgengine.ImportChainDefinitions(ctx, chains)
+	if err != nil {
+		pgengine.LogToDB("ERROR", "Cannot import chain definitions: ", err)
+		return false
 	}
+	pgengine.LogToDB("LOG", fmt.Sprintf("Chains imported: %d created, %d updated, %d deleted, %d unchanged",
+		res.Created, res.Updated, res.Deleted, res.Unchanged))
+	return true
 }
@@ -0,0 +1,40 @@
+-- An example for Backup task
+DO $$
+DECLARE
+	v_head_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	INSERT INTO timetable.task_chain (task_id)
+		VALUES (timetable.get_task_id('Backup'))
+	RETURNING
+		chain_id INTO v_head_id;
+
+	-- Create the chain execution configuration executed every night
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, max_instances, live)
+	VALUES 
+		(v_head_id, 'Nightly backup', '0 2 * * *', 1, TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the task:
+		-- "databases":  String array of the databases to dump
+		-- "host", "port", "username", "password": Connection parameters, libpq environment variables are used if omitted
+		-- "format":     pg_dump output format: "custom"(default), "plain", "directory" or "tar"
+		-- "compress":   Compression level 0-9
+		-- "destpath":   The directory to store dumps into
+		-- "keep":       The number of the newest dumps of each database to retain, 0 or omitted keeps all
+		-- "pgdump":     The path to pg_dump binary, "pg_dump" by default
+		-- "options":    String array of additional pg_dump options
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '
+				{
+					"databases": ["timetable"], 
+					"format": "custom", 
+					"compress": 6,
+					"destpath": "/var/backups/postgresql", 
+					"keep": 7
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
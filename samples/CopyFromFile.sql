@@ -0,0 +1,39 @@
+-- An example for CopyFromFile task
+DO $$
+DECLARE
+	v_head_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	CREATE TABLE IF NOT EXISTS public.location(id integer, name text);
+
+	INSERT INTO timetable.task_chain (task_id)
+		VALUES (timetable.get_task_id('CopyFromFile'))
+	RETURNING
+		chain_id INTO v_head_id;
+
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Import locations', '0 5 * * *', TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the task:
+		-- "filename":   The CSV file to copy from
+		-- "table":      The destination table, optionally schema qualified
+		-- "columns":    String array of the destination columns, header names are used if omitted
+		-- "format":     "csv"(default)
+		-- "delimiter":  The field delimiter, "," by default
+		-- "null":       The string representing NULL, empty fields are NULL if omitted
+		-- "header":     Whether the first line contains column names and should be skipped
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '
+				{
+					"filename": "/tmp/location.csv", 
+					"table": "public.location", 
+					"delimiter": ";", 
+					"header": true
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
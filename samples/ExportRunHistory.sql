@@ -0,0 +1,31 @@
+-- An example for ExportRunHistory task.
+DO $$
+DECLARE
+	v_head_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	-- Create the chain
+	INSERT INTO timetable.task_chain (task_id)
+	    VALUES (timetable.get_task_id ('ExportRunHistory'))
+	RETURNING
+	    chain_id INTO v_head_id;
+
+	-- Create the chain execution configuration executed every day at midnight
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Export run history of the last day', '0 0 * * *', TRUE)
+	RETURNING
+	    chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the task: destination directory, format and period of the history
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '
+				{
+					"destpath": ".", 
+					"format": "csv", 
+					"period": "1 day"
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
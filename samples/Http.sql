@@ -0,0 +1,40 @@
+-- An example for HTTP task.
+DO $$
+DECLARE
+	v_task_id bigint;
+	v_head_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	-- Create the HTTP task, script contains URL
+	INSERT INTO timetable.base_task(name, kind, script)
+		VALUES ('post webhook', 'HTTP'::timetable.task_kind, 'https://example.com/webhook')
+	RETURNING 
+		task_id INTO v_task_id;
+
+	-- Create the chain
+	INSERT INTO timetable.task_chain (task_id)
+	    VALUES (v_task_id)
+	RETURNING
+	    chain_id INTO v_head_id;
+
+	-- Create the chain execution configuration executed every hour
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Post webhook every hour', '0 * * * *', TRUE)
+	RETURNING
+	    chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the request, body is a template with chain element fields available
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '
+				{
+					"method": "POST", 
+					"headers": {"Content-Type": "application/json"}, 
+					"body": "{\"task\": \"{{.TaskName}}\"}",
+					"timeout": 10,
+					"expected_status": [200, 201, 204]
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
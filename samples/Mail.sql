@@ -22,9 +22,11 @@ BEGIN
 		-- "ccaddr":	  String array of the recipients(Cc) email addresses
 		-- "bccaddr":	  String array of the recipients(Bcc) email addresses
 		-- "toaddr":      String array of the recipients(To) email addresses
-		-- "subject":	  Subject of the email
+		-- "subject":	  Subject of the email, may contain template actions like {{.name}}
 		-- "attachment":  String array of the attachments
-		-- "msgbody":	  The body of the email
+		-- "msgbody":	  The body of the email, may contain template actions like {{.name}}
+		-- "bodytype":	  "text/html"(default) or "text/plain"
+		-- "data":		  Object with the values used by subject and body templates
 
 	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
 		VALUES (v_chain_config_id, v_chain_id, 1, '{
@@ -36,9 +38,10 @@ BEGIN
 				"ccaddr":		["recipient_cc@example.com"],
 				"bccaddr":		["recipient_bcc@example.com"],
 				"toaddr":       ["recipient@example.com"],
-				"subject": 		"pg_timetable - No Reply",
+				"subject": 		"pg_timetable - {{.title}}",
 				"attachment":   ["D:\\Go stuff\\Books\\Concurrency in Go.pdf","D:\\Go stuff\\Books\\The Way To Go.pdf"],
-				"msgbody":		"<b>Hello User,</b> <p>I got some Go books for you enjoy</p> <i>pg_timetable</i>!"
+				"msgbody":		"<b>Hello {{.user}},</b> <p>I got some Go books for you enjoy</p> <i>pg_timetable</i>!",
+				"data":			{"title": "No Reply", "user": "User"}
 				}'::jsonb);
 
 END;
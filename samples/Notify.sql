@@ -0,0 +1,46 @@
+-- An example for Notify task. Listeners subscribed with LISTEN report_ready learn about the new report once
+-- the chain transaction is committed
+DO $$
+DECLARE
+	v_task_id bigint;
+	v_head_id bigint;
+	v_chain_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	-- Create the base task building the report
+	INSERT INTO timetable.base_task(name, kind, script)
+		VALUES ('build report', 'SQL', 'SELECT pg_sleep(1)')
+	RETURNING
+		task_id INTO v_task_id;
+
+	-- Create the chain
+	INSERT INTO timetable.task_chain (task_id)
+		VALUES (v_task_id)
+	RETURNING
+		chain_id INTO v_head_id;
+
+	-- Append Notify task at the end of the chain
+	INSERT INTO timetable.task_chain (parent_id, task_id)
+		VALUES (v_head_id, timetable.get_task_id('Notify'))
+	RETURNING
+		chain_id INTO v_chain_id;
+
+	-- Create the chain execution configuration executed every day at 6 AM
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Build report and notify listeners', '0 6 * * *', TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the Notify task: channel, payload template and template data
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_chain_id, 1, '
+				{
+					"channel": "report_ready", 
+					"payload": "{\"report\": \"{{.Data.report}}\", \"run\": {{.RunStatusID}}}", 
+					"data": {"report": "daily"}
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
@@ -0,0 +1,55 @@
+-- An example for S3Upload task. The dump created by the shell task is uploaded every night
+DO $$
+DECLARE
+	v_task_id bigint;
+	v_head_id bigint;
+	v_chain_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	-- Create the shell task dumping the database
+	INSERT INTO timetable.base_task(name, kind, script)
+		VALUES ('dump database', 'SHELL', 'pg_dump')
+	RETURNING
+		task_id INTO v_task_id;
+
+	INSERT INTO timetable.task_chain (task_id)
+		VALUES (v_task_id)
+	RETURNING
+		chain_id INTO v_head_id;
+
+	-- Append S3Upload task at the end of the chain
+	INSERT INTO timetable.task_chain (parent_id, task_id)
+		VALUES (v_head_id, timetable.get_task_id('S3Upload'))
+	RETURNING
+		chain_id INTO v_chain_id;
+
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Dump database and upload to S3', '0 1 * * *', TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '["-Fc", "-f", "/tmp/timetable.dump", "timetable"]'::jsonb);
+
+	-- Create the parameters for the S3Upload task:
+		-- "endpoint":     S3 compatible storage URL, e.g. "http://localhost:9000". AWS is used if omitted
+		-- "region":       The region of the bucket, "us-east-1" by default
+		-- "bucket":       The name of the bucket
+		-- "key":          The key of the object
+		-- "accesskey":    The access key, AWS_ACCESS_KEY_ID environment variable is used if omitted
+		-- "secretkey":    The secret key, AWS_SECRET_ACCESS_KEY environment variable is used if omitted
+		-- "sessiontoken": The optional session token of the temporary credentials
+		-- "file":         The local file uploaded, or the destination of S3Download task
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_chain_id, 1, '
+				{
+					"region": "eu-central-1", 
+					"bucket": "backups", 
+					"key": "timetable/timetable.dump", 
+					"file": "/tmp/timetable.dump"
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
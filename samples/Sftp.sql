@@ -0,0 +1,42 @@
+-- An example for SftpUpload task. SftpDownload accepts the same parameters
+DO $$
+DECLARE
+	v_head_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	INSERT INTO timetable.task_chain (task_id)
+		VALUES (timetable.get_task_id('SftpUpload'))
+	RETURNING
+		chain_id INTO v_head_id;
+
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Upload report to partner', '30 6 * * *', TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the task:
+		-- "host":        The IP address or hostname of the SFTP server
+		-- "port":        The port of the SFTP server, 22 by default
+		-- "username":    The username used for authenticating on the SFTP server
+		-- "password":    The password, may be omitted if "privatekey" is specified
+		-- "privatekey":  The path to the private key file
+		-- "passphrase":  The passphrase of the encrypted private key
+		-- "hostkey":     The public key of the server in authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+		-- "knownhosts":  The known_hosts file used if "hostkey" is omitted, "~/.ssh/known_hosts" by default
+		-- "timeout":     The connection timeout in seconds, 30 by default
+		-- "localpath":   The local file path
+		-- "remotepath":  The remote file path
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '
+				{
+					"host": "sftp.example.com", 
+					"username": "user", 
+					"privatekey": "/home/postgres/.ssh/id_ed25519", 
+					"localpath": "/tmp/report.csv", 
+					"remotepath": "incoming/report.csv"
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';
@@ -0,0 +1,52 @@
+-- An example for Slack task used as an error handler. The download element ignores errors,
+-- so the Slack element is always executed but posts the message only if the download failed
+DO $$
+DECLARE
+	v_task_id bigint;
+	v_head_id bigint;
+	v_chain_id bigint;
+	v_chain_config_id bigint;
+BEGIN
+	-- Create the base task downloading the file
+	INSERT INTO timetable.base_task(name, kind, script)
+		VALUES ('download rates', 'SHELL', 'curl')
+	RETURNING
+		task_id INTO v_task_id;
+
+	-- Create the chain, errors of the download are ignored and handled by the next element
+	INSERT INTO timetable.task_chain (task_id, ignore_error)
+		VALUES (v_task_id, TRUE)
+	RETURNING
+		chain_id INTO v_head_id;
+
+	-- Append Slack task at the end of the chain
+	INSERT INTO timetable.task_chain (parent_id, task_id)
+		VALUES (v_head_id, timetable.get_task_id('Slack'))
+	RETURNING
+		chain_id INTO v_chain_id;
+
+	-- Create the chain execution configuration executed every hour
+	INSERT INTO timetable.chain_execution_config 
+		(chain_id, chain_name, run_at, live)
+	VALUES 
+		(v_head_id, 'Download rates and report failures', '0 * * * *', TRUE)
+	RETURNING
+		chain_execution_config INTO v_chain_config_id;
+
+	-- Create the parameters for the download task
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_head_id, 1, '["-fsSo", "/tmp/rates.xml", "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"]'::jsonb);
+
+	-- Create the parameters for the Slack task: webhook, message template posted only on error
+	INSERT INTO timetable.chain_execution_parameters (chain_execution_config, chain_id, order_id, value)
+		VALUES (v_chain_config_id, v_chain_id, 1, '
+				{
+					"webhook": "https://hooks.slack.com/services/T000/B000/XXXX", 
+					"channel": "#dba",
+					"onerror": true,
+					"text": ":red_circle: {{.ChainName}} run {{.RunStatusID}} failed after {{.Duration}}: {{.LastError}} (owner: {{.Data.owner}})", 
+					"data": {"owner": "@oncall"}
+				}'::jsonb);
+END;
+$$
+LANGUAGE 'plpgsql';